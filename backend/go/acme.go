@@ -0,0 +1,99 @@
+package main
+
+import (
+	"SwiftPost/models"
+	"SwiftPost/utils"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// tlsLog 证书申请和 TLS 握手的日志
+var tlsLog = utils.NewLogger("tls")
+
+// newCertManager 创建 ACME 证书管理器。证书在第一次 TLS 握手时按需申请，
+// 账号密钥和证书缓存在 cache_dir 中，重启后不会重复申请
+func newCertManager(config *utils.Config, db *models.Database) (*autocert.Manager, error) {
+	acmeConfig := config.Server.SSL.ACME
+	manager := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		Cache:      autocert.DirCache(acmeConfig.CacheDir),
+		HostPolicy: acmeHostPolicy(config.Server.Domain, acmeConfig.CustomDomains, db),
+		Email:      acmeConfig.Email,
+	}
+	
+	// directory_url 为空时 acme.Client 使用 Let's Encrypt
+	client := &acme.Client{DirectoryURL: acmeConfig.DirectoryURL}
+	if acmeConfig.CAFile != "" {
+		data, err := os.ReadFile(acmeConfig.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("无法读取 ACME 根证书: %v", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("无法解析 ACME 根证书: %s", acmeConfig.CAFile)
+		}
+		
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+		client.HTTPClient = &http.Client{Transport: transport}
+	}
+	manager.Client = client
+	
+	return manager, nil
+}
+
+// acmeHostPolicy 只为主域名和用户已验证的自定义域名申请证书，
+// 避免任意 SNI 触发签发请求、耗尽 CA 的签发配额
+func acmeHostPolicy(mainDomain string, customDomains bool, db *models.Database) autocert.HostPolicy {
+	return func(ctx context.Context, host string) error {
+		if strings.EqualFold(host, mainDomain) {
+			return nil
+		}
+		if customDomains {
+			verified, err := db.Users().IsVerifiedCustomDomain(host)
+			if err != nil {
+				tlsLog.Error("查询自定义域名 %s 失败: %v", host, err)
+				return fmt.Errorf("查询自定义域名失败")
+			}
+			if verified {
+				return nil
+			}
+		}
+		return fmt.Errorf("域名 %s 不是主域名或已验证的自定义域名", host)
+	}
+}
+
+// httpsRedirectHandler 把 HTTP 请求重定向到 HTTPS 端口上的同一地址
+func httpsRedirectHandler(httpsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.Trim(host, "[]")
+		if httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		
+		// 308 保留请求方法和请求体，GET 和 HEAD 使用兼容性更好的 301
+		code := http.StatusPermanentRedirect
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			code = http.StatusMovedPermanently
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), code)
+	})
+}
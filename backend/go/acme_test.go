@@ -0,0 +1,197 @@
+package main
+
+import (
+	"SwiftPost/models"
+	"SwiftPost/utils"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 设置 SWIFTPOST_TEST_ACME_DIRECTORY 后对 Pebble 测试真实签发，例如：
+//
+//	pebble-challtestsrv -defaultIPv4 127.0.0.1 &
+//	pebble -config test/config/pebble-config.json -dnsserver 127.0.0.1:8053 &
+//	SWIFTPOST_TEST_ACME_DIRECTORY=https://localhost:14000/dir \
+//	SWIFTPOST_TEST_ACME_CA_FILE=test/certs/pebble.minica.pem go test -run TestACMEIssuance
+//
+// Pebble 把所有域名解析到本机，在 SWIFTPOST_TEST_ACME_HTTP_PORT（默认为 Pebble 的 httpPort 5002）上验证 HTTP-01
+const (
+	acmeDirectoryEnv = "SWIFTPOST_TEST_ACME_DIRECTORY"
+	acmeCAFileEnv    = "SWIFTPOST_TEST_ACME_CA_FILE"
+	acmeHTTPPortEnv  = "SWIFTPOST_TEST_ACME_HTTP_PORT"
+)
+
+const (
+	acmeMainDomain       = "swiftpost.test"
+	acmeVerifiedDomain   = "mail.verified.test"
+	acmeUnverifiedDomain = "mail.unverified.test"
+)
+
+// newACMETestConfig 主域名为 acmeMainDomain，允许为自定义域名申请证书
+func newACMETestConfig(t *testing.T, directoryURL string) *utils.Config {
+	t.Helper()
+	config, err := (&utils.ConfigLoader{}).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Server.Domain = acmeMainDomain
+	acmeConfig := &config.Server.SSL.ACME
+	acmeConfig.Enabled = true
+	acmeConfig.DirectoryURL = directoryURL
+	acmeConfig.CacheDir = t.TempDir()
+	acmeConfig.CustomDomains = true
+	return config
+}
+
+// createDomainUser 创建绑定了自定义域名的用户，verified 为 true 时标记为已验证
+func createDomainUser(t *testing.T, db *models.Database, username, domain string, verified bool) int {
+	t.Helper()
+	id, err := db.Users().Create(username, username+"@example.com", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Users().UpdateCustomDomain(int(id), domain); err != nil {
+		t.Fatal(err)
+	}
+	if verified {
+		if err := db.Users().SetCustomDomainVerified(int(id), domain); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return int(id)
+}
+
+func TestACMEHostPolicy(t *testing.T) {
+	db := newTestDB(t)
+	createDomainUser(t, db, "alice", acmeVerifiedDomain, true)
+	createDomainUser(t, db, "bob", acmeUnverifiedDomain, false)
+	carol := createDomainUser(t, db, "carol", "mail.disabled.test", true)
+	user, err := db.Users().GetByID(carol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user.IsActive = false
+	if err := db.Users().Update(user); err != nil {
+		t.Fatal(err)
+	}
+	
+	policy := acmeHostPolicy(acmeMainDomain, true, db)
+	cases := map[string]bool{
+		acmeMainDomain:       true,
+		"SwiftPost.Test":     true,
+		acmeVerifiedDomain:   true,
+		acmeUnverifiedDomain: false,
+		"mail.disabled.test": false,
+		"random.example.com": false,
+	}
+	for host, allowed := range cases {
+		err := policy(context.Background(), host)
+		if allowed && err != nil {
+			t.Errorf("%s 应当允许申请证书: %v", host, err)
+		}
+		if !allowed && err == nil {
+			t.Errorf("%s 不应允许申请证书", host)
+		}
+	}
+	
+	// 关闭 custom_domains 后只允许主域名
+	policy = acmeHostPolicy(acmeMainDomain, false, db)
+	if err := policy(context.Background(), acmeVerifiedDomain); err == nil {
+		t.Error("关闭 custom_domains 后不应为自定义域名申请证书")
+	}
+}
+
+// TestACMERefusesUnverifiedDomain 未验证的域名在访问 CA 之前就被拒绝
+func TestACMERefusesUnverifiedDomain(t *testing.T) {
+	var requests atomic.Int32
+	ca := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		http.Error(w, "unexpected", http.StatusInternalServerError)
+	}))
+	defer ca.Close()
+	
+	db := newTestDB(t)
+	createDomainUser(t, db, "bob", acmeUnverifiedDomain, false)
+	manager, err := newCertManager(newACMETestConfig(t, ca.URL), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	
+	for _, host := range []string{acmeUnverifiedDomain, "random.example.com"} {
+		// 策略放行时 autocert 会不断重试访问 CA，不等它返回
+		result := make(chan error, 1)
+		go func() {
+			_, err := manager.GetCertificate(&tls.ClientHelloInfo{ServerName: host})
+			result <- err
+		}()
+		select {
+		case err := <-result:
+			if err == nil {
+				t.Errorf("%s 不应获得证书", host)
+			}
+		case <-time.After(5 * time.Second):
+			t.Errorf("%s 没有被主机策略拒绝，正在向 CA 申请证书", host)
+		}
+	}
+	if n := requests.Load(); n != 0 {
+		t.Fatalf("拒绝的域名不应访问 CA，实际请求了 %d 次", n)
+	}
+}
+
+// TestACMEIssuance 向 Pebble 为主域名和已验证的自定义域名申请证书
+func TestACMEIssuance(t *testing.T) {
+	directoryURL := os.Getenv(acmeDirectoryEnv)
+	if directoryURL == "" {
+		t.Skipf("未设置 %s，跳过 Pebble 签发测试", acmeDirectoryEnv)
+	}
+	httpPort := os.Getenv(acmeHTTPPortEnv)
+	if httpPort == "" {
+		httpPort = "5002"
+	}
+	
+	db := newTestDB(t)
+	createDomainUser(t, db, "alice", acmeVerifiedDomain, true)
+	config := newACMETestConfig(t, directoryURL)
+	config.Server.SSL.ACME.CAFile = os.Getenv(acmeCAFileEnv)
+	manager, err := newCertManager(config, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	
+	// 和 main.go 一样在 HTTP 端口上响应 HTTP-01 验证
+	listener, err := net.Listen("tcp", net.JoinHostPort("", httpPort))
+	if err != nil {
+		t.Fatalf("无法监听 HTTP-01 验证端口 %s: %v", httpPort, err)
+	}
+	challengeServer := &http.Server{Handler: manager.HTTPHandler(nil), ReadHeaderTimeout: 10 * time.Second}
+	go challengeServer.Serve(listener)
+	defer challengeServer.Close()
+	
+	for _, host := range []string{acmeMainDomain, acmeVerifiedDomain} {
+		t.Run(host, func(t *testing.T) {
+			cert, err := manager.GetCertificate(&tls.ClientHelloInfo{ServerName: host})
+			if err != nil {
+				t.Fatalf("申请证书失败: %v", err)
+			}
+			leaf, err := x509.ParseCertificate(cert.Certificate[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := leaf.VerifyHostname(host); err != nil {
+				t.Fatalf("证书不包含 %s: %v", host, err)
+			}
+		})
+	}
+	
+	if _, err := manager.GetCertificate(&tls.ClientHelloInfo{ServerName: acmeUnverifiedDomain}); err == nil {
+		t.Fatalf("%s 未验证，不应获得证书", acmeUnverifiedDomain)
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"SwiftPost/models"
+	"SwiftPost/utils"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const benchUsage = `用法: swiftpost bench [参数]
+
+在临时的 SQLite 数据库上并发执行发信、收件箱列表和管理后台用户列表，报告吞吐量和延迟。
+-mailbox 大于 0 时第一个测试用户的收件箱预先写入这么多邮件，收件箱列表只读取这个用户。
+不会读写 config.json 中配置的数据库。
+
+参数:
+`
+
+// benchResult 一类操作的统计
+type benchResult struct {
+	name      string
+	mu        sync.Mutex
+	latencies []time.Duration
+	errors    int64
+	locked    int64
+}
+
+func (r *benchResult) record(start time.Time, err error) {
+	elapsed := time.Since(start)
+	if err != nil {
+		atomic.AddInt64(&r.errors, 1)
+		if strings.Contains(err.Error(), "database is locked") {
+			atomic.AddInt64(&r.locked, 1)
+		}
+		return
+	}
+	r.mu.Lock()
+	r.latencies = append(r.latencies, elapsed)
+	r.mu.Unlock()
+}
+
+func (r *benchResult) print(duration time.Duration) {
+	sort.Slice(r.latencies, func(i, j int) bool { return r.latencies[i] < r.latencies[j] })
+	percentile := func(p float64) time.Duration {
+		if len(r.latencies) == 0 {
+			return 0
+		}
+		return r.latencies[int(float64(len(r.latencies)-1)*p)]
+	}
+	fmt.Printf("  %-6s %8.0f 次/秒  p50 %-10v p99 %-10v 错误 %d（database is locked %d）\n",
+		r.name, float64(len(r.latencies))/duration.Seconds(),
+		percentile(0.5).Round(time.Microsecond), percentile(0.99).Round(time.Microsecond),
+		r.errors, r.locked)
+}
+
+// runBenchCommand 执行 swiftpost bench 子命令，返回进程退出码
+func runBenchCommand(args []string) int {
+	flags := flag.NewFlagSet("bench", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, benchUsage)
+		flags.PrintDefaults()
+	}
+	duration := flags.Duration("duration", 10*time.Second, "测试时长")
+	senders := flags.Int("senders", 8, "并发发信的数量")
+	readers := flags.Int("readers", 16, "并发读取收件箱的数量")
+	admins := flags.Int("admins", 2, "并发读取管理后台用户列表的数量")
+	users := flags.Int("users", 50, "测试用户数量")
+	seed := flags.Int("seed", 2000, "开始前预先写入的邮件数量")
+	mailbox := flags.Int("mailbox", 0, "第一个测试用户收件箱中预先写入的邮件数量")
+	path := flags.String("db", "", "测试数据库文件，默认在临时目录中创建并在结束后删除")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *users < 2 || *senders < 0 || *readers < 0 || *admins < 0 || *mailbox < 0 {
+		flags.Usage()
+		return 2
+	}
+	
+	if *path == "" {
+		dir, err := os.MkdirTemp("", "swiftpost-bench-")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ 无法创建临时目录: %v\n", err)
+			return 1
+		}
+		defer os.RemoveAll(dir)
+		*path = filepath.Join(dir, "bench.db")
+	}
+	
+	config := &utils.Config{}
+	config.Database.Driver = models.DriverSQLite
+	config.Database.Path = *path
+	
+	db, err := models.OpenDatabase(config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	defer db.Close()
+	
+	if err := models.MigrateUp(db); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ 数据库迁移失败: %v\n", err)
+		return 1
+	}
+	
+	userIDs, err := benchSeed(db, *users, *seed, *mailbox)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ 准备测试数据失败: %v\n", err)
+		return 1
+	}
+	
+	fmt.Printf("数据库: %s\n用户 %d，预置邮件 %d，大收件箱 %d，发信并发 %d，读取并发 %d，用户列表并发 %d，时长 %v\n\n",
+		*path, *users, *seed, *mailbox, *senders, *readers, *admins, *duration)
+	
+	send := &benchResult{name: "发信"}
+	list := &benchResult{name: "收件箱"}
+	userList := &benchResult{name: "用户列表"}
+	deadline := time.Now().Add(*duration)
+	
+	var wg sync.WaitGroup
+	for i := 0; i < *senders; i++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			rnd := rand.New(rand.NewSource(int64(worker)))
+			for n := 0; time.Now().Before(deadline); n++ {
+				start := time.Now()
+				sender, recipient := benchPair(userIDs, rnd)
+				err := benchSend(db, sender, recipient, fmt.Sprintf("bench %d-%d", worker, n))
+				send.record(start, err)
+			}
+		}(i)
+	}
+	for i := 0; i < *readers; i++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			rnd := rand.New(rand.NewSource(int64(1000 + worker)))
+			for time.Now().Before(deadline) {
+				userID := userIDs[0]
+				if *mailbox == 0 {
+					userID = userIDs[rnd.Intn(len(userIDs))]
+				}
+				start := time.Now()
+				err := benchList(db, userID)
+				list.record(start, err)
+			}
+		}(i)
+	}
+	for i := 0; i < *admins; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for time.Now().Before(deadline) {
+				start := time.Now()
+				err := benchUserList(db)
+				userList.record(start, err)
+			}
+		}()
+	}
+	wg.Wait()
+	
+	send.print(*duration)
+	list.print(*duration)
+	userList.print(*duration)
+	return 0
+}
+
+// benchSeed 创建测试用户并预先写入邮件，mailbox 封邮件写入第一个用户的收件箱，返回用户ID
+func benchSeed(db *models.Database, users, emails, mailbox int) ([]int, error) {
+	userIDs := make([]int, 0, users)
+	for i := 0; i < users; i++ {
+		id, err := db.Users().Create(fmt.Sprintf("bench%d", i), fmt.Sprintf("bench%d@bench.local", i), "x")
+		if err != nil {
+			return nil, err
+		}
+		userIDs = append(userIDs, int(id))
+	}
+	
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < emails; i++ {
+		sender, recipient := benchPair(userIDs, rnd)
+		if err := benchSend(db, sender, recipient, fmt.Sprintf("seed %d", i)); err != nil {
+			return nil, err
+		}
+	}
+	for i := 0; i < mailbox; i++ {
+		sender := userIDs[1+rnd.Intn(len(userIDs)-1)]
+		if err := benchSend(db, sender, userIDs[0], fmt.Sprintf("mailbox %d", i)); err != nil {
+			return nil, err
+		}
+	}
+	return userIDs, nil
+}
+
+// benchPair 随机选择发件人和收件人
+func benchPair(userIDs []int, rnd *rand.Rand) (sender, recipient int) {
+	return userIDs[rnd.Intn(len(userIDs))], userIDs[rnd.Intn(len(userIDs))]
+}
+
+// benchSend 和发信接口一样写入邮件并更新发件人的存储用量
+func benchSend(db *models.Database, sender, recipient int, subject string) error {
+	body := strings.Repeat("SwiftPost ", 50)
+	
+	_, err := db.Emails().Create(&models.Email{
+		SenderID:       sender,
+		RecipientID:    recipient,
+		SenderEmail:    fmt.Sprintf("user%d@bench.local", sender),
+		RecipientEmail: fmt.Sprintf("user%d@bench.local", recipient),
+		Subject:        subject,
+		Body:           body,
+	})
+	if err != nil {
+		return err
+	}
+	return db.Users().UpdateStorage(sender, int64(len(body)))
+}
+
+// benchList 和收件箱页面一样读取第一页邮件、总数和未读数
+func benchList(db *models.Database, userID int) error {
+	if _, err := db.Users().GetByID(userID); err != nil {
+		return err
+	}
+	if _, _, err := db.Emails().ListByFolder(userID, "inbox", models.Page{Limit: 20}); err != nil {
+		return err
+	}
+	if _, err := db.Emails().CountByFolder(userID, "inbox"); err != nil {
+		return err
+	}
+	_, err := db.Emails().CountUnread(userID)
+	return err
+}
+
+// benchUserList 和管理后台用户列表一样读取第一页用户、总数和每个用户的邮件数量
+func benchUserList(db *models.Database) error {
+	users, _, err := db.Users().List(models.Page{Limit: 20})
+	if err != nil {
+		return err
+	}
+	if _, err := db.Users().Count(); err != nil {
+		return err
+	}
+	
+	userIDs := make([]int, len(users))
+	for i, user := range users {
+		userIDs[i] = user.ID
+	}
+	_, err = db.Emails().CountByUsers(userIDs)
+	return err
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"SwiftPost/utils"
+	"flag"
+	"fmt"
+	"os"
+)
+
+const configUsage = `用法: swiftpost config <命令> [参数]
+
+命令:
+  print   打印配置。默认打印内置的默认配置；加上 --effective 时打印按默认值、配置文件、
+          SWIFTPOST_* 环境变量和命令行参数合并后实际生效的配置。
+          密钥和密码默认显示为 ******，加上 --show-secrets 显示原值。
+  check   按启动时的规则检查实际生效的配置，不启动服务器。有错误时退出码为 1
+
+参数:
+`
+
+// runConfigCommand 执行 swiftpost config 子命令，返回进程退出码
+func runConfigCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, configUsage)
+		return 2
+	}
+	
+	switch args[0] {
+	case "print":
+		return runConfigPrint(args[1:])
+	case "check":
+		return runConfigCheck(args[1:])
+	}
+	fmt.Fprint(os.Stderr, configUsage)
+	return 2
+}
+
+// configFlagSet 子命令的参数，包含 -config 和覆盖配置项的参数
+func configFlagSet(name string) (*flag.FlagSet, *string, map[string]string) {
+	flags := flag.NewFlagSet("config "+name, flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, configUsage)
+		flags.PrintDefaults()
+	}
+	configFile := flags.String("config", utils.DefaultConfigFile(), "配置文件")
+	return flags, configFile, utils.ConfigFlags(flags)
+}
+
+// runConfigPrint 执行 swiftpost config print
+func runConfigPrint(args []string) int {
+	flags, configFile, configFlags := configFlagSet("print")
+	effective := flags.Bool("effective", false, "打印实际生效的配置")
+	format := flags.String("format", "json", "输出格式：json、yaml 或 toml")
+	showSecrets := flags.Bool("show-secrets", false, "显示密钥和密码")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	
+	// 不加 --effective 时不读取任何来源，只得到默认配置
+	loader := &utils.ConfigLoader{}
+	if *effective {
+		if _, err := os.Stat(*configFile); err == nil {
+			loader.File = *configFile
+		}
+		loader.Env = os.Environ()
+		loader.Flags = configFlags
+	}
+	config, err := loader.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ 无法加载配置: %v\n", err)
+		return 1
+	}
+	if !*showSecrets {
+		config = utils.RedactConfig(config)
+	}
+	
+	data, err := utils.MarshalConfig(config, *format)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	os.Stdout.Write(data)
+	return 0
+}
+
+// runConfigCheck 执行 swiftpost config check，逐项列出警告和错误
+func runConfigCheck(args []string) int {
+	flags, configFile, configFlags := configFlagSet("check")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	
+	// 配置文件不存在时启动会创建默认配置，检查时只报告
+	if _, err := os.Stat(*configFile); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ 无法读取配置文件: %v\n", err)
+		return 1
+	}
+	unknown, err := utils.UnknownConfigKeys(*configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	
+	loader := &utils.ConfigLoader{File: *configFile, Env: os.Environ(), Flags: configFlags}
+	config, err := loader.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	
+	warnings, err := utils.CheckConfig(config)
+	for _, key := range unknown {
+		fmt.Printf("⚠️  %s: 无法识别的配置项，将被忽略\n", key)
+	}
+	for _, warning := range warnings {
+		fmt.Printf("⚠️  %s\n", warning)
+	}
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return 1
+	}
+	
+	fmt.Printf("✅ 配置检查通过（%s，运行环境 %s）\n", *configFile, config.Env)
+	return 0
+}
@@ -0,0 +1,333 @@
+package handlers
+
+import (
+	"SwiftPost/models"
+	"SwiftPost/utils"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const defaultMaxTokenRequests = 3
+
+// errTooManyTokenRequests 同一地址在一小时内请求的链接过多
+var errTooManyTokenRequests = errors.New("请求过于频繁")
+
+// publicBaseURL 邮件中链接使用的站点地址
+func publicBaseURL(config *utils.Config) string {
+	if config.Account.PublicURL != "" {
+		return strings.TrimRight(config.Account.PublicURL, "/")
+	}
+	
+	scheme, defaultPort := "http", "80"
+	if config.Server.SSL.Enabled {
+		scheme, defaultPort = "https", "443"
+	}
+	
+	host := config.Server.Domain
+	if config.Server.Port != "" && config.Server.Port != defaultPort {
+		host += ":" + config.Server.Port
+	}
+	return scheme + "://" + host
+}
+
+func accountTokenTTL(config *utils.Config, purpose string) time.Duration {
+	if purpose == models.AccountTokenPasswordReset {
+		return utils.PasswordResetTTL(config)
+	}
+	return utils.VerificationTTL(config)
+}
+
+// sendAccountToken 签发密码重置或邮箱验证令牌并发送给用户，同一地址每小时的发送次数受限
+func sendAccountToken(ctx context.Context, db *models.Database, config *utils.Config, user *models.User, purpose string) error {
+	maxRequests := config.Account.MaxRequestsPerHour
+	if maxRequests <= 0 {
+		maxRequests = defaultMaxTokenRequests
+	}
+	
+	count, err := models.CountRecentAccountTokens(db, user.Email, purpose, time.Now().Add(-time.Hour))
+	if err != nil {
+		return err
+	}
+	if count >= maxRequests {
+		authLog.WarnContext(ctx, "账号链接请求过于频繁，已忽略: %s (%s)", user.Email, purpose)
+		return errTooManyTokenRequests
+	}
+	
+	ttl := accountTokenTTL(config, purpose)
+	expiresAt := time.Now().Add(ttl)
+	tokenID := uuid.NewString()
+	if err := models.CreateAccountToken(db, tokenID, user.ID, purpose, user.Email, expiresAt); err != nil {
+		return err
+	}
+	
+	token, err := utils.GenerateAccountToken(purpose, user.ID, user.Email, tokenID, expiresAt)
+	if err != nil {
+		return err
+	}
+	
+	// 令牌放在URL片段中，不会出现在服务器和代理的访问日志里
+	var subject, body string
+	if purpose == models.AccountTokenPasswordReset {
+		subject = "SwiftPost 密码重置"
+		body = fmt.Sprintf("%s，您好：\n\n我们收到了重置您 SwiftPost 账号密码的请求。请在 %d 分钟内打开以下链接设置新密码：\n\n%s/login#reset_token=%s\n\n如果这不是您本人的操作，请忽略本邮件，您的密码不会被修改。\n",
+			user.Username, int(ttl.Minutes()), publicBaseURL(config), token)
+	} else {
+		subject = "SwiftPost 邮箱验证"
+		body = fmt.Sprintf("%s，您好：\n\n感谢注册 SwiftPost。请在 %d 小时内打开以下链接验证邮箱并激活账号：\n\n%s/login#verify_token=%s\n\n如果您没有注册过 SwiftPost，请忽略本邮件。\n",
+			user.Username, int(ttl.Hours()), publicBaseURL(config), token)
+	}
+	
+	return deliverAccountMessage(db, config, user, subject, body)
+}
+
+// deliverAccountMessage 按配置通过外发邮件或站内系统消息发送账号通知
+func deliverAccountMessage(db *models.Database, config *utils.Config, user *models.User, subject, body string) error {
+	if config.Account.TokenDelivery == "smtp" {
+		return utils.SendMail(config, user.Email, subject, body)
+	}
+	
+	// 站内系统消息以系统地址的名义投递到用户自己的收件箱
+	emailID, err := db.Emails().Create(&models.Email{
+		SenderID:       user.ID,
+		RecipientID:    user.ID,
+		SenderEmail:    "no-reply@" + config.Server.Domain,
+		RecipientEmail: user.Email,
+		Subject:        subject,
+		Body:           body,
+	})
+	if err != nil {
+		return err
+	}
+	
+	go notifyNewEmail(user.ID, int(emailID))
+	return nil
+}
+
+// ForgotPasswordHandler 发送密码重置链接，无论邮箱是否存在都返回相同的结果
+func ForgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Email) == "" {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "邮箱不能为空",
+		})
+		return
+	}
+	
+	if localPasswordDisabled() {
+		respondJSON(w, http.StatusForbidden, map[string]interface{}{
+			"success": false,
+			"message": "已禁用密码登录，请使用单点登录",
+		})
+		return
+	}
+	
+	db := models.GetDB()
+	config := utils.GetConfig()
+	
+	user, err := db.Users().GetByEmail(strings.TrimSpace(req.Email))
+	switch {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		authLog.ErrorContext(r.Context(), "查询用户失败: %v", err)
+	case !user.IsActive || !user.EmailVerified:
+	default:
+		// 目录用户的密码由LDAP管理
+		if config.LDAP.Enabled {
+			if linked, _ := models.HasUserIdentity(db, user.ID, models.LDAPIssuer(config)); linked {
+				break
+			}
+		}
+		if err := sendAccountToken(r.Context(), db, config, user, models.AccountTokenPasswordReset); err != nil && err != errTooManyTokenRequests {
+			authLog.ErrorContext(r.Context(), "发送密码重置链接失败: %v", err)
+		}
+	}
+	
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "如果该邮箱已注册，密码重置链接已发送，请注意查收",
+	})
+}
+
+// ResetPasswordHandler 使用密码重置令牌设置新密码，成功后该用户的全部会话失效
+func ResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "无效的请求格式",
+		})
+		return
+	}
+	
+	if len(req.Password) < 6 {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "密码长度至少6位",
+		})
+		return
+	}
+	
+	db := models.GetDB()
+	config := utils.GetConfig()
+	
+	user, tokenID, ok := consumeAccountToken(r.Context(), db, config, models.AccountTokenPasswordReset, req.Token)
+	if !ok {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "重置链接无效或已过期，请重新申请",
+		})
+		return
+	}
+	
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		authLog.ErrorContext(r.Context(), "密码哈希失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "服务器内部错误",
+		})
+		return
+	}
+	
+	if err := db.Users().UpdatePassword(user.ID, string(hashedPassword)); err != nil {
+		authLog.ErrorContext(r.Context(), "更新密码失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "服务器内部错误",
+		})
+		return
+	}
+	
+	// 作废其他尚未使用的重置链接，并让已有的登录全部失效
+	models.InvalidateAccountTokens(db, user.ID, models.AccountTokenPasswordReset)
+	if _, err := db.Sessions().RevokeAllForUser(user.ID); err != nil {
+		authLog.ErrorContext(r.Context(), "撤销用户会话失败: %v", err)
+	}
+	DisconnectUser(user.ID)
+	
+	authLog.InfoContext(r.Context(), "用户通过重置链接修改了密码: %s (令牌 %s)", user.Email, tokenID)
+	
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "密码已重置，请使用新密码登录",
+	})
+}
+
+// VerifyEmailHandler 使用邮箱验证令牌激活待验证的账号
+func VerifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "无效的请求格式",
+		})
+		return
+	}
+	
+	db := models.GetDB()
+	config := utils.GetConfig()
+	
+	user, _, ok := consumeAccountToken(r.Context(), db, config, models.AccountTokenVerifyEmail, req.Token)
+	if !ok {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "验证链接无效或已过期，请重新发送",
+		})
+		return
+	}
+	
+	if err := db.Users().SetEmailVerified(user.ID, true); err != nil {
+		authLog.ErrorContext(r.Context(), "更新邮箱验证状态失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "服务器内部错误",
+		})
+		return
+	}
+	models.InvalidateAccountTokens(db, user.ID, models.AccountTokenVerifyEmail)
+	
+	authLog.InfoContext(r.Context(), "用户完成邮箱验证: %s (%s)", user.Username, user.Email)
+	
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "邮箱验证成功，现在可以登录了",
+	})
+}
+
+// ResendVerificationHandler 重新发送邮箱验证链接，无论邮箱是否存在都返回相同的结果
+func ResendVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Email) == "" {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "邮箱不能为空",
+		})
+		return
+	}
+	
+	db := models.GetDB()
+	config := utils.GetConfig()
+	
+	user, err := db.Users().GetByEmail(strings.TrimSpace(req.Email))
+	if err == nil && user.IsActive && !user.EmailVerified {
+		if err := sendAccountToken(r.Context(), db, config, user, models.AccountTokenVerifyEmail); err != nil && err != errTooManyTokenRequests {
+			authLog.ErrorContext(r.Context(), "发送邮箱验证链接失败: %v", err)
+		}
+	} else if err != nil && err != sql.ErrNoRows {
+		authLog.ErrorContext(r.Context(), "查询用户失败: %v", err)
+	}
+	
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "如果该邮箱正在等待验证，验证链接已重新发送",
+	})
+}
+
+// consumeAccountToken 校验令牌签名和用途，确认邮箱未变更后将令牌标记为已使用
+func consumeAccountToken(ctx context.Context, db *models.Database, config *utils.Config, purpose, token string) (*models.User, string, bool) {
+	userID, email, tokenID, err := utils.ParseAccountToken(purpose, token)
+	if err != nil {
+		return nil, "", false
+	}
+	
+	user, err := db.Users().GetByID(userID)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			authLog.ErrorContext(ctx, "获取用户信息失败: %v", err)
+		}
+		return nil, "", false
+	}
+	
+	// 令牌签发后邮箱被修改的，旧链接作废
+	if !user.IsActive || !strings.EqualFold(user.Email, email) {
+		return nil, "", false
+	}
+	
+	if err := models.ConsumeAccountToken(db, tokenID, user.ID, purpose); err != nil {
+		if err != sql.ErrNoRows {
+			authLog.ErrorContext(ctx, "使用账号令牌失败: %v", err)
+		}
+		return nil, "", false
+	}
+	
+	return user, tokenID, true
+}
@@ -3,10 +3,12 @@ package handlers
 import (
 	"SwiftPost/models"
 	"SwiftPost/utils"
+	"database/sql"
 	"encoding/json"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 	"golang.org/x/crypto/bcrypt"
@@ -14,12 +16,9 @@ import (
 
 // AdminGetUsersHandler 获取用户列表
 func AdminGetUsersHandler(w http.ResponseWriter, r *http.Request) {
-	userID := r.Context().Value("user_id").(int)
-	
 	// 验证管理员权限
 	db := models.GetDB()
-	user, err := models.GetUserByID(db, userID)
-	if err != nil || !user.IsAdmin {
+	if !hasPermission(r, models.PermUsersRead) {
 		respondJSON(w, http.StatusForbidden, map[string]interface{}{
 			"success": false,
 			"message": "需要管理员权限",
@@ -28,22 +27,30 @@ func AdminGetUsersHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	// 获取分页参数
-	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
-	if page < 1 {
-		page = 1
+	pageReq, page, err := parsePage(r)
+	if err != nil {
+		respondInvalidCursor(w)
+		return
 	}
 	
-	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
-	if limit < 1 || limit > 100 {
-		limit = 20
+	// 获取用户列表，按域名授权的管理员只能看到该域名下的用户
+	var users []*models.User
+	var pageInfo *models.PageInfo
+	var total int
+	allDomains, domains := models.PermissionDomains(requestPermissions(r), models.PermUsersRead)
+	if allDomains {
+		users, pageInfo, err = db.Users().List(pageReq)
+		if err == nil {
+			total, err = db.Users().Count()
+		}
+	} else {
+		users, pageInfo, err = db.Users().ListInDomains(domains, pageReq)
+		if err == nil {
+			total, err = db.Users().CountInDomains(domains)
+		}
 	}
-	
-	offset := (page - 1) * limit
-	
-	// 获取用户列表
-	users, err := models.GetAllUsers(db, limit, offset)
 	if err != nil {
-		utils.Error("获取用户列表失败: %v", err)
+		utils.ErrorContext(r.Context(), "获取用户列表失败: %v", err)
 		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
 			"success": false,
 			"message": "获取用户列表失败",
@@ -51,28 +58,33 @@ func AdminGetUsersHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
-	// 获取用户总数
-	total, err := models.CountUsers(db)
+	// 一次查询本页全部用户的邮件统计
+	userIDs := make([]int, len(users))
+	for i, user := range users {
+		userIDs[i] = user.ID
+	}
+	emailCounts, err := db.Emails().CountByUsers(userIDs)
 	if err != nil {
-		utils.Error("统计用户数量失败: %v", err)
-		total = len(users)
+		utils.ErrorContext(r.Context(), "统计用户邮件数量失败: %v", err)
+		emailCounts = map[int]*models.UserEmailCounts{}
 	}
 	
 	// 准备响应数据
 	userList := make([]map[string]interface{}, len(users))
 	for i, user := range users {
-		// 获取用户的邮件统计
-		var sentCount, receivedCount int
-		db.QueryRow("SELECT COUNT(*) FROM emails WHERE sender_id = ? AND is_deleted = 0", user.ID).Scan(&sentCount)
-		db.QueryRow("SELECT COUNT(*) FROM emails WHERE recipient_id = ? AND is_deleted = 0", user.ID).Scan(&receivedCount)
+		counts := emailCounts[user.ID]
+		if counts == nil {
+			counts = &models.UserEmailCounts{}
+		}
 		
 		userList[i] = map[string]interface{}{
-			"id":            user.ID,
-			"username":      user.Username,
-			"email":         user.Email,
-			"is_admin":      user.IsAdmin,
-			"custom_domain": user.CustomDomain,
-			"is_active":     user.IsActive,
+			"id":             user.ID,
+			"username":       user.Username,
+			"email":          user.Email,
+			"is_admin":       user.IsAdmin,
+			"custom_domain":  user.CustomDomain,
+			"is_active":      user.IsActive,
+			"email_verified": user.EmailVerified,
 			"storage": map[string]interface{}{
 				"used":  float64(user.StorageUsed) / (1024 * 1024),
 				"max":   float64(user.MaxStorage) / (1024 * 1024),
@@ -84,23 +96,264 @@ func AdminGetUsersHandler(w http.ResponseWriter, r *http.Request) {
 				}(),
 			},
 			"stats": map[string]interface{}{
-				"sent_emails":     sentCount,
-				"received_emails": receivedCount,
+				"sent_emails":     counts.Sent,
+				"received_emails": counts.Received,
 			},
 			"created_at": user.CreatedAt.Format("2006-01-02 15:04:05"),
 			"updated_at": user.UpdatedAt.Format("2006-01-02 15:04:05"),
 		}
 	}
 	
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success":    true,
+		"users":      userList,
+		"pagination": paginationResponse(pageReq, page, total, pageInfo),
+	})
+}
+
+// AdminGetUserSessionsHandler 获取用户已登录的设备
+func AdminGetUserSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "无效的用户ID",
+		})
+		return
+	}
+	
+	// 验证管理员权限
+	db := models.GetDB()
+	if !hasPermission(r, models.PermUsersRead) {
+		respondJSON(w, http.StatusForbidden, map[string]interface{}{
+			"success": false,
+			"message": "需要管理员权限",
+		})
+		return
+	}
+	
+	if !canManageUserID(db, r, models.PermUsersRead, userID) {
+		respondUserForbidden(w)
+		return
+	}
+	
+	currentSessionID, _ := r.Context().Value("session_id").(int)
+	sessionList, err := listSessions(db, userID, currentSessionID)
+	if err != nil {
+		utils.ErrorContext(r.Context(), "获取会话列表失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "获取会话列表失败",
+		})
+		return
+	}
+	
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success":  true,
+		"user_id":  userID,
+		"sessions": sessionList,
+	})
+}
+
+// AdminRevokeUserSessionsHandler 注销用户的某个设备，不指定 session_id 时注销全部设备
+func AdminRevokeUserSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	adminID := r.Context().Value("user_id").(int)
+	vars := mux.Vars(r)
+	userID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "无效的用户ID",
+		})
+		return
+	}
+	
+	// 验证管理员权限
+	db := models.GetDB()
+	if !hasPermission(r, models.PermUsersResetPassword) {
+		respondJSON(w, http.StatusForbidden, map[string]interface{}{
+			"success": false,
+			"message": "需要管理员权限",
+		})
+		return
+	}
+	
+	if !canManageUserID(db, r, models.PermUsersResetPassword, userID) {
+		respondUserForbidden(w)
+		return
+	}
+	
+	if sessionIDStr := r.URL.Query().Get("session_id"); sessionIDStr != "" {
+		sessionID, err := strconv.Atoi(sessionIDStr)
+		if err != nil {
+			respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"success": false,
+				"message": "无效的会话ID",
+			})
+			return
+		}
+		
+		if err := db.Sessions().RevokeForUser(userID, sessionID); err != nil {
+			if err == sql.ErrNoRows {
+				respondJSON(w, http.StatusNotFound, map[string]interface{}{
+					"success": false,
+					"message": "会话不存在",
+				})
+				return
+			}
+			utils.ErrorContext(r.Context(), "撤销会话失败: %v", err)
+			respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+				"success": false,
+				"message": "撤销会话失败",
+			})
+			return
+		}
+		DisconnectSession(sessionID)
+		
+		utils.InfoContext(r.Context(), "管理员 %d 注销了用户 %d 的会话 %d", adminID, userID, sessionID)
+		respondJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"message": "设备已退出登录",
+			"revoked": 1,
+		})
+		return
+	}
+	
+	count, err := db.Sessions().RevokeAllForUser(userID)
+	if err != nil {
+		utils.ErrorContext(r.Context(), "撤销用户会话失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "撤销会话失败",
+		})
+		return
+	}
+	DisconnectUser(userID)
+	
+	utils.InfoContext(r.Context(), "管理员 %d 注销了用户 %d 的所有会话 (%d 个)", adminID, userID, count)
+	
 	respondJSON(w, http.StatusOK, map[string]interface{}{
 		"success": true,
-		"users":   userList,
-		"pagination": map[string]interface{}{
-			"page":       page,
-			"limit":      limit,
-			"total":      total,
-			"total_page": (total + limit - 1) / limit,
-		},
+		"message": "用户已在所有设备上退出登录",
+		"revoked": count,
+	})
+}
+
+// AdminForceReloginHandler 批量强制重新登录，用于安全事件响应
+func AdminForceReloginHandler(w http.ResponseWriter, r *http.Request) {
+	adminID := r.Context().Value("user_id").(int)
+	currentSessionID, _ := r.Context().Value("session_id").(int)
+	
+	// 验证管理员权限
+	db := models.GetDB()
+	if !hasPermission(r, models.PermSystemManage) {
+		respondJSON(w, http.StatusForbidden, map[string]interface{}{
+			"success": false,
+			"message": "需要管理员权限",
+		})
+		return
+	}
+	
+	var req struct {
+		UserIDs []int `json:"user_ids"`
+		All     bool  `json:"all"`
+		// RevokeAPICredentials 同时删除个人访问令牌和应用专用密码，凭据可能已泄露时使用
+		RevokeAPICredentials bool `json:"revoke_api_credentials"`
+	}
+	
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "无效的请求格式",
+		})
+		return
+	}
+	
+	if !req.All && len(req.UserIDs) == 0 {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "请指定用户或选择全部用户",
+		})
+		return
+	}
+	
+	var total, tokens, appPasswords int64
+	var err error
+	if req.All {
+		// 保留当前管理员的会话，避免操作者自己被登出
+		total, err = db.Sessions().RevokeAll(currentSessionID)
+		if err != nil {
+			utils.ErrorContext(r.Context(), "撤销所有会话失败: %v", err)
+			respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+				"success": false,
+				"message": "撤销会话失败",
+			})
+			return
+		}
+		DisconnectAllExcept(currentSessionID)
+		if req.RevokeAPICredentials {
+			tokens, appPasswords, err = models.DeleteAllAPICredentials(db)
+			if err != nil {
+				utils.ErrorContext(r.Context(), "删除所有 API 凭据失败: %v", err)
+				respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+					"success": false,
+					"message": "会话已撤销，但删除 API 凭据失败",
+					"revoked": total,
+				})
+				return
+			}
+		}
+		utils.WarnContext(r.Context(), "管理员 %d 强制所有用户重新登录 (%d 个会话, %d 个访问令牌, %d 个应用专用密码)",
+			adminID, total, tokens, appPasswords)
+	} else {
+		var failed []int
+		for _, userID := range req.UserIDs {
+			count, err := db.Sessions().RevokeAllForUser(userID)
+			if err != nil {
+				utils.ErrorContext(r.Context(), "撤销用户 %d 的会话失败: %v", userID, err)
+				failed = append(failed, userID)
+				continue
+			}
+			DisconnectUser(userID)
+			total += count
+			
+			if req.RevokeAPICredentials {
+				userTokens, userAppPasswords, err := models.DeleteUserAPICredentials(db, userID)
+				if err != nil {
+					utils.ErrorContext(r.Context(), "删除用户 %d 的 API 凭据失败: %v", userID, err)
+					failed = append(failed, userID)
+					continue
+				}
+				tokens += userTokens
+				appPasswords += userAppPasswords
+			}
+		}
+		utils.WarnContext(r.Context(), "管理员 %d 强制 %d 个用户重新登录 (%d 个会话, %d 个访问令牌, %d 个应用专用密码)",
+			adminID, len(req.UserIDs), total, tokens, appPasswords)
+		if len(failed) > 0 {
+			respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+				"success": false,
+				"message": "部分用户的凭据撤销失败",
+				"failed":  failed,
+				"revoked": total,
+			})
+			return
+		}
+	}
+	
+	// revoked_types 列出本次撤销的凭据类型，未选择撤销 API 凭据时只有 sessions
+	revokedTypes := []string{"sessions"}
+	if req.RevokeAPICredentials {
+		revokedTypes = append(revokedTypes, "personal_access_tokens", "app_passwords")
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success":               true,
+		"message":               "已强制重新登录",
+		"revoked":               total,
+		"revoked_types":         revokedTypes,
+		"revoked_tokens":        tokens,
+		"revoked_app_passwords": appPasswords,
 	})
 }
 
@@ -119,8 +372,7 @@ func AdminUpdateUserHandler(w http.ResponseWriter, r *http.Request) {
 	
 	// 验证管理员权限
 	db := models.GetDB()
-	admin, err := models.GetUserByID(db, adminID)
-	if err != nil || !admin.IsAdmin {
+	if !hasPermission(r, models.PermUsersWrite) {
 		respondJSON(w, http.StatusForbidden, map[string]interface{}{
 			"success": false,
 			"message": "需要管理员权限",
@@ -138,13 +390,14 @@ func AdminUpdateUserHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	var updateData struct {
-		Username     *string `json:"username"`
-		Email        *string `json:"email"`
-		IsAdmin      *bool   `json:"is_admin"`
-		IsActive     *bool   `json:"is_active"`
-		CustomDomain *string `json:"custom_domain"`
-		MaxStorage   *int64  `json:"max_storage"`
-		Password     *string `json:"password"`
+		Username      *string `json:"username"`
+		Email         *string `json:"email"`
+		IsAdmin       *bool   `json:"is_admin"`
+		IsActive      *bool   `json:"is_active"`
+		CustomDomain  *string `json:"custom_domain"`
+		MaxStorage    *int64  `json:"max_storage"`
+		Password      *string `json:"password"`
+		EmailVerified *bool   `json:"email_verified"`
 	}
 	
 	if err := json.NewDecoder(r.Body).Decode(&updateData); err != nil {
@@ -156,7 +409,7 @@ func AdminUpdateUserHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	// 获取用户信息
-	user, err := models.GetUserByID(db, userID)
+	user, err := db.Users().GetByID(userID)
 	if err != nil {
 		if err.Error() == "sql: no rows in result set" {
 			respondJSON(w, http.StatusNotFound, map[string]interface{}{
@@ -165,7 +418,7 @@ func AdminUpdateUserHandler(w http.ResponseWriter, r *http.Request) {
 			})
 			return
 		}
-		utils.Error("获取用户信息失败: %v", err)
+		utils.ErrorContext(r.Context(), "获取用户信息失败: %v", err)
 		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
 			"success": false,
 			"message": "获取用户信息失败",
@@ -173,12 +426,41 @@ func AdminUpdateUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
+	if !canManageUser(r, models.PermUsersWrite, user) {
+		respondUserForbidden(w)
+		return
+	}
+	
+	// 只有超级管理员可以修改管理员状态，按域名授权的管理员不能把用户移到管理范围之外的域名
+	if updateData.IsAdmin != nil && *updateData.IsAdmin != user.IsAdmin && !isSuperAdmin(r) {
+		respondJSON(w, http.StatusForbidden, map[string]interface{}{
+			"success": false,
+			"message": "只有超级管理员可以修改管理员状态",
+		})
+		return
+	}
+	// 设置密码等同于重置密码，需要和重置密码接口相同的权限
+	if updateData.Password != nil && *updateData.Password != "" && !canManageUser(r, models.PermUsersResetPassword, user) {
+		respondJSON(w, http.StatusForbidden, map[string]interface{}{
+			"success": false,
+			"message": "需要重置密码权限",
+		})
+		return
+	}
+	if updateData.Email != nil && !models.PermissionCoversDomain(requestPermissions(r), models.PermUsersWrite, models.EmailDomain(*updateData.Email)) {
+		respondJSON(w, http.StatusForbidden, map[string]interface{}{
+			"success": false,
+			"message": "不能使用管理范围之外的邮箱域名",
+		})
+		return
+	}
+	
 	// 更新字段
 	updated := false
 	
 	if updateData.Username != nil && *updateData.Username != user.Username {
 		// 检查用户名是否已存在
-		existingUser, err := models.GetUserByUsername(db, *updateData.Username)
+		existingUser, err := db.Users().GetByUsername(*updateData.Username)
 		if err == nil && existingUser != nil && existingUser.ID != userID {
 			respondJSON(w, http.StatusConflict, map[string]interface{}{
 				"success": false,
@@ -192,7 +474,7 @@ func AdminUpdateUserHandler(w http.ResponseWriter, r *http.Request) {
 	
 	if updateData.Email != nil && *updateData.Email != user.Email {
 		// 检查邮箱是否已存在
-		existingUser, err := models.GetUserByEmail(db, *updateData.Email)
+		existingUser, err := db.Users().GetByEmail(*updateData.Email)
 		if err == nil && existingUser != nil && existingUser.ID != userID {
 			respondJSON(w, http.StatusConflict, map[string]interface{}{
 				"success": false,
@@ -224,11 +506,16 @@ func AdminUpdateUserHandler(w http.ResponseWriter, r *http.Request) {
 		updated = true
 	}
 	
+	if updateData.EmailVerified != nil && *updateData.EmailVerified != user.EmailVerified {
+		user.EmailVerified = *updateData.EmailVerified
+		updated = true
+	}
+	
 	if updateData.Password != nil && *updateData.Password != "" {
 		// 哈希新密码
 		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(*updateData.Password), bcrypt.DefaultCost)
 		if err != nil {
-			utils.Error("密码哈希失败: %v", err)
+			utils.ErrorContext(r.Context(), "密码哈希失败: %v", err)
 			respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
 				"success": false,
 				"message": "密码处理失败",
@@ -240,8 +527,8 @@ func AdminUpdateUserHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	if updated {
-		if err := models.UpdateUser(db, user); err != nil {
-			utils.Error("更新用户信息失败: %v", err)
+		if err := db.Users().Update(user); err != nil {
+			utils.ErrorContext(r.Context(), "更新用户信息失败: %v", err)
 			respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
 				"success": false,
 				"message": "更新用户信息失败",
@@ -249,19 +536,56 @@ func AdminUpdateUserHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		
-		utils.Info("管理员 %d 更新了用户 %d 的信息", adminID, userID)
+		// Users().Update 不修改密码和邮箱验证状态，需要单独保存
+		if updateData.Password != nil && *updateData.Password != "" {
+			if err := db.Users().UpdatePassword(userID, user.PasswordHash); err != nil {
+				utils.ErrorContext(r.Context(), "更新用户密码失败: %v", err)
+				respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+					"success": false,
+					"message": "更新用户信息失败",
+				})
+				return
+			}
+		}
+		if updateData.EmailVerified != nil {
+			if err := db.Users().SetEmailVerified(userID, user.EmailVerified); err != nil {
+				utils.ErrorContext(r.Context(), "更新邮箱验证状态失败: %v", err)
+				respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+					"success": false,
+					"message": "更新用户信息失败",
+				})
+				return
+			}
+		}
+		// 超级管理员设置的自定义域名视为已验证，其他管理员设置的域名需要用户通过DNS验证
+		if updateData.CustomDomain != nil && user.CustomDomain != "" && isSuperAdmin(r) {
+			if err := db.Users().SetCustomDomainVerified(userID, user.CustomDomain); err != nil {
+				utils.ErrorContext(r.Context(), "更新自定义域名验证状态失败: %v", err)
+			}
+		}
+		
+		utils.InfoContext(r.Context(), "管理员 %d 更新了用户 %d 的信息", adminID, userID)
+		
+		// 禁用账号或重置密码后，该用户已有的登录全部失效
+		if !user.IsActive || (updateData.Password != nil && *updateData.Password != "") {
+			if _, err := db.Sessions().RevokeAllForUser(userID); err != nil {
+				utils.ErrorContext(r.Context(), "撤销用户会话失败: %v", err)
+			}
+			DisconnectUser(userID)
+		}
 		
 		respondJSON(w, http.StatusOK, map[string]interface{}{
 			"success": true,
 			"message": "用户信息更新成功",
 			"user": map[string]interface{}{
-				"id":            user.ID,
-				"username":      user.Username,
-				"email":         user.Email,
-				"is_admin":      user.IsAdmin,
-				"is_active":     user.IsActive,
-				"custom_domain": user.CustomDomain,
-				"max_storage":   user.MaxStorage,
+				"id":             user.ID,
+				"username":       user.Username,
+				"email":          user.Email,
+				"is_admin":       user.IsAdmin,
+				"is_active":      user.IsActive,
+				"custom_domain":  user.CustomDomain,
+				"max_storage":    user.MaxStorage,
+				"email_verified": user.EmailVerified,
 			},
 		})
 	} else {
@@ -272,6 +596,183 @@ func AdminUpdateUserHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// AdminResetUserMFAHandler 重置用户的两步验证（用户丢失验证器和恢复码时使用）
+func AdminResetUserMFAHandler(w http.ResponseWriter, r *http.Request) {
+	adminID := r.Context().Value("user_id").(int)
+	vars := mux.Vars(r)
+	userID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "无效的用户ID",
+		})
+		return
+	}
+	
+	// 验证管理员权限
+	db := models.GetDB()
+	if !hasPermission(r, models.PermUsersResetPassword) {
+		respondJSON(w, http.StatusForbidden, map[string]interface{}{
+			"success": false,
+			"message": "需要管理员权限",
+		})
+		return
+	}
+	
+	if !canManageUserID(db, r, models.PermUsersResetPassword, userID) {
+		respondUserForbidden(w)
+		return
+	}
+	
+	err = models.DisableMFA(db, userID)
+	if err == nil {
+		err = models.DeleteUserWebAuthnCredentials(db, userID)
+	}
+	if err != nil {
+		utils.ErrorContext(r.Context(), "重置两步验证失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "重置两步验证失败",
+		})
+		return
+	}
+	
+	// 重置后该用户的已有登录全部失效
+	db.Sessions().RevokeAllForUser(userID)
+	DisconnectUser(userID)
+	
+	utils.WarnContext(r.Context(), "管理员 %d 重置了用户 %d 的两步验证", adminID, userID)
+	
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "两步验证已重置",
+	})
+}
+
+// AdminResetUserPasswordHandler 重置用户密码：指定新密码时直接修改，否则向用户发送密码重置链接
+func AdminResetUserPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	adminID := r.Context().Value("user_id").(int)
+	vars := mux.Vars(r)
+	userID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "无效的用户ID",
+		})
+		return
+	}
+	
+	db := models.GetDB()
+	if !hasPermission(r, models.PermUsersResetPassword) {
+		respondJSON(w, http.StatusForbidden, map[string]interface{}{
+			"success": false,
+			"message": "需要管理员权限",
+		})
+		return
+	}
+	
+	var req struct {
+		Password string `json:"password"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"success": false,
+				"message": "无效的请求格式",
+			})
+			return
+		}
+	}
+	
+	user, err := db.Users().GetByID(userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondJSON(w, http.StatusNotFound, map[string]interface{}{
+				"success": false,
+				"message": "用户不存在",
+			})
+			return
+		}
+		utils.ErrorContext(r.Context(), "获取用户信息失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "获取用户信息失败",
+		})
+		return
+	}
+	if !canManageUser(r, models.PermUsersResetPassword, user) {
+		respondUserForbidden(w)
+		return
+	}
+	
+	if req.Password == "" {
+		config := utils.GetConfig()
+		if err := sendAccountToken(r.Context(), db, config, user, models.AccountTokenPasswordReset); err != nil {
+			if err == errTooManyTokenRequests {
+				respondJSON(w, http.StatusTooManyRequests, map[string]interface{}{
+					"success": false,
+					"message": "该用户的重置链接请求过于频繁，请稍后再试",
+				})
+				return
+			}
+			utils.ErrorContext(r.Context(), "发送密码重置链接失败: %v", err)
+			respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+				"success": false,
+				"message": "发送密码重置链接失败",
+			})
+			return
+		}
+		
+		utils.InfoContext(r.Context(), "管理员 %d 向用户 %d 发送了密码重置链接", adminID, userID)
+		respondJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"message": "密码重置链接已发送给用户",
+		})
+		return
+	}
+	
+	if len(req.Password) < 6 {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "密码长度至少6位",
+		})
+		return
+	}
+	
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		utils.ErrorContext(r.Context(), "密码哈希失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "密码处理失败",
+		})
+		return
+	}
+	
+	if err := db.Users().UpdatePassword(userID, string(hashedPassword)); err != nil {
+		utils.ErrorContext(r.Context(), "更新用户密码失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "重置密码失败",
+		})
+		return
+	}
+	
+	// 作废尚未使用的重置链接，并让该用户已有的登录全部失效
+	models.InvalidateAccountTokens(db, userID, models.AccountTokenPasswordReset)
+	if _, err := db.Sessions().RevokeAllForUser(userID); err != nil {
+		utils.ErrorContext(r.Context(), "撤销用户会话失败: %v", err)
+	}
+	DisconnectUser(userID)
+	
+	utils.WarnContext(r.Context(), "管理员 %d 重置了用户 %d 的密码", adminID, userID)
+	
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "密码已重置",
+	})
+}
+
 // AdminDeleteUserHandler 删除用户
 func AdminDeleteUserHandler(w http.ResponseWriter, r *http.Request) {
 	adminID := r.Context().Value("user_id").(int)
@@ -287,8 +788,7 @@ func AdminDeleteUserHandler(w http.ResponseWriter, r *http.Request) {
 	
 	// 验证管理员权限
 	db := models.GetDB()
-	admin, err := models.GetUserByID(db, adminID)
-	if err != nil || !admin.IsAdmin {
+	if !hasPermission(r, models.PermUsersDelete) {
 		respondJSON(w, http.StatusForbidden, map[string]interface{}{
 			"success": false,
 			"message": "需要管理员权限",
@@ -306,7 +806,7 @@ func AdminDeleteUserHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	// 检查用户是否存在
-	user, err := models.GetUserByID(db, userID)
+	user, err := db.Users().GetByID(userID)
 	if err != nil {
 		if err.Error() == "sql: no rows in result set" {
 			respondJSON(w, http.StatusNotFound, map[string]interface{}{
@@ -315,7 +815,7 @@ func AdminDeleteUserHandler(w http.ResponseWriter, r *http.Request) {
 			})
 			return
 		}
-		utils.Error("获取用户信息失败: %v", err)
+		utils.ErrorContext(r.Context(), "获取用户信息失败: %v", err)
 		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
 			"success": false,
 			"message": "获取用户信息失败",
@@ -323,41 +823,23 @@ func AdminDeleteUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
-	// 永久删除用户的所有数据
-	// 注意：这是一个危险操作，实际生产中应该使用软删除
-	// 这里为了简化，直接硬删除
-	
-	// 删除用户的邮件和附件
-	// 先获取用户的所有邮件
-	rows, err := db.Query("SELECT id FROM emails WHERE sender_id = ? OR recipient_id = ?", userID, userID)
-	if err == nil {
-		defer rows.Close()
-		for rows.Next() {
-			var emailID int
-			if err := rows.Scan(&emailID); err == nil {
-				// 删除邮件的附件
-				db.Exec("DELETE FROM attachments WHERE email_id = ?", emailID)
-			}
-		}
+	if !canManageUser(r, models.PermUsersDelete, user) {
+		respondUserForbidden(w)
+		return
 	}
 	
-	// 删除用户的邮件
-	db.Exec("DELETE FROM emails WHERE sender_id = ? OR recipient_id = ?", userID, userID)
-	
-	// 删除用户的会话
-	db.Exec("DELETE FROM sessions WHERE user_id = ?", userID)
-	
-	// 删除用户
-	if err := models.DeleteUser(db, userID); err != nil {
-		utils.Error("删除用户失败: %v", err)
+	// 在一个事务中删除用户及其邮件、附件、会话、登录凭据和角色
+	if err := db.Users().Delete(userID); err != nil {
+		utils.ErrorContext(r.Context(), "删除用户失败: %v", err)
 		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
 			"success": false,
 			"message": "删除用户失败",
 		})
 		return
 	}
+	DisconnectUser(userID)
 	
-	utils.Info("管理员 %d 删除了用户 %d (%s)", adminID, userID, user.Email)
+	utils.InfoContext(r.Context(), "管理员 %d 删除了用户 %d (%s)", adminID, userID, user.Email)
 	
 	respondJSON(w, http.StatusOK, map[string]interface{}{
 		"success": true,
@@ -367,12 +849,9 @@ func AdminDeleteUserHandler(w http.ResponseWriter, r *http.Request) {
 
 // AdminGetStatsHandler 获取系统统计信息
 func AdminGetStatsHandler(w http.ResponseWriter, r *http.Request) {
-	userID := r.Context().Value("user_id").(int)
-	
 	// 验证管理员权限
 	db := models.GetDB()
-	user, err := models.GetUserByID(db, userID)
-	if err != nil || !user.IsAdmin {
+	if !hasPermission(r, models.PermStatsRead) {
 		respondJSON(w, http.StatusForbidden, map[string]interface{}{
 			"success": false,
 			"message": "需要管理员权限",
@@ -380,66 +859,56 @@ func AdminGetStatsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
-	// 获取用户统计
-	var totalUsers, activeUsers, adminUsers int
-	db.QueryRow("SELECT COUNT(*) FROM users").Scan(&totalUsers)
-	db.QueryRow("SELECT COUNT(*) FROM users WHERE is_active = 1").Scan(&activeUsers)
-	db.QueryRow("SELECT COUNT(*) FROM users WHERE is_admin = 1").Scan(&adminUsers)
+	today := startOfDay(time.Now())
 	
-	// 获取邮件统计
-	var totalEmails, unreadEmails, todayEmails int
-	db.QueryRow("SELECT COUNT(*) FROM emails WHERE is_deleted = 0").Scan(&totalEmails)
-	db.QueryRow("SELECT COUNT(*) FROM emails WHERE is_read = 0 AND is_deleted = 0").Scan(&unreadEmails)
-	db.QueryRow("SELECT COUNT(*) FROM emails WHERE DATE(created_at) = DATE('now') AND is_deleted = 0").Scan(&todayEmails)
+	// 获取用户和存储统计
+	userTotals, err := db.Users().Totals()
+	if err != nil {
+		utils.ErrorContext(r.Context(), "获取用户统计失败: %v", err)
+		userTotals = &models.UserTotals{}
+	}
+	totalUsers, activeUsers := userTotals.Total, userTotals.Active
 	
-	// 获取存储统计
-	var totalStorageUsed, totalStorageCapacity int64
-	db.QueryRow("SELECT SUM(storage_used) FROM users").Scan(&totalStorageUsed)
-	db.QueryRow("SELECT SUM(max_storage) FROM users").Scan(&totalStorageCapacity)
+	// 获取邮件统计
+	emailTotals, err := db.Emails().Totals(today)
+	if err != nil {
+		utils.ErrorContext(r.Context(), "获取邮件统计失败: %v", err)
+		emailTotals = &models.EmailTotals{}
+	}
 	
 	// 获取今日新用户
-	var newUsersToday int
-	db.QueryRow("SELECT COUNT(*) FROM users WHERE DATE(created_at) = DATE('now')").Scan(&newUsersToday)
+	newUsersToday, _ := db.Users().CountCreatedSince(today)
 	
 	// 获取最近7天活跃用户
-	var activeUsers7Days int
-	db.QueryRow(`
-		SELECT COUNT(DISTINCT user_id) FROM (
-			SELECT sender_id as user_id FROM emails WHERE created_at >= DATE('now', '-7 days')
-			UNION
-			SELECT recipient_id as user_id FROM emails WHERE created_at >= DATE('now', '-7 days')
-		)`, 
-	).Scan(&activeUsers7Days)
+	activeUsers7Days, _ := db.Emails().CountActiveUsersSince(today.AddDate(0, 0, -7))
 	
 	// 获取附件统计
-	var totalAttachments, attachmentSize int64
-	db.QueryRow("SELECT COUNT(*) FROM attachments").Scan(&totalAttachments)
-	db.QueryRow("SELECT COALESCE(SUM(file_size), 0) FROM attachments").Scan(&attachmentSize)
+	totalAttachments, attachmentSize, _ := db.Attachments().Totals()
 	
 	// 获取系统信息
-	config, _ := utils.LoadConfig("config.json")
+	config := utils.GetConfig()
 	
 	stats := map[string]interface{}{
 		"users": map[string]interface{}{
 			"total":          totalUsers,
 			"active":         activeUsers,
-			"admins":         adminUsers,
+			"admins":         userTotals.Admins,
 			"new_today":      newUsersToday,
 			"active_7_days":  activeUsers7Days,
 			"inactive":       totalUsers - activeUsers,
 		},
 		"emails": map[string]interface{}{
-			"total":          totalEmails,
-			"unread":         unreadEmails,
-			"today":          todayEmails,
-			"avg_per_user":   float64(totalEmails) / float64(totalUsers),
+			"total":          emailTotals.Total,
+			"unread":         emailTotals.Unread,
+			"today":          emailTotals.Since,
+			"avg_per_user":   float64(emailTotals.Total) / float64(totalUsers),
 		},
 		"storage": map[string]interface{}{
-			"used":           float64(totalStorageUsed) / (1024 * 1024 * 1024), // GB
-			"capacity":       float64(totalStorageCapacity) / (1024 * 1024 * 1024), // GB
+			"used":           float64(userTotals.StorageUsed) / (1024 * 1024 * 1024), // GB
+			"capacity":       float64(userTotals.StorageCapacity) / (1024 * 1024 * 1024), // GB
 			"usage_percent": func() float64 {
-				if totalStorageCapacity > 0 {
-					return float64(totalStorageUsed) / float64(totalStorageCapacity) * 100
+				if userTotals.StorageCapacity > 0 {
+					return float64(userTotals.StorageUsed) / float64(userTotals.StorageCapacity) * 100
 				}
 				return 0
 			}(),
@@ -456,9 +925,10 @@ func AdminGetStatsHandler(w http.ResponseWriter, r *http.Request) {
 			"websocket":      config.WebSocket.Enabled,
 		},
 		"performance": map[string]interface{}{
-			"db_connections": 25, // SQLite默认连接数
-			"rate_limit":     config.Security.RateLimit,
-			"token_expiry":   config.Security.TokenExpiry,
+			"db_connections":  25, // 连接池上限
+			"rate_limit":      config.Security.RateLimit,
+			"send_rate_limit": config.Security.SendRateLimit,
+			"token_expiry":    config.Security.TokenExpiry,
 		},
 	}
 	
@@ -470,12 +940,9 @@ func AdminGetStatsHandler(w http.ResponseWriter, r *http.Request) {
 
 // AdminGetEmailsHandler 获取所有邮件（管理员）
 func AdminGetEmailsHandler(w http.ResponseWriter, r *http.Request) {
-	userID := r.Context().Value("user_id").(int)
-	
 	// 验证管理员权限
 	db := models.GetDB()
-	user, err := models.GetUserByID(db, userID)
-	if err != nil || !user.IsAdmin {
+	if !hasPermission(r, models.PermMailReadAll) {
 		respondJSON(w, http.StatusForbidden, map[string]interface{}{
 			"success": false,
 			"message": "需要管理员权限",
@@ -484,78 +951,39 @@ func AdminGetEmailsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	// 获取分页参数
-	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
-	if page < 1 {
-		page = 1
-	}
-	
-	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
-	if limit < 1 || limit > 100 {
-		limit = 20
+	pageReq, page, err := parsePage(r)
+	if err != nil {
+		respondInvalidCursor(w)
+		return
 	}
 	
-	offset := (page - 1) * limit
-	
 	// 获取搜索参数
 	search := r.URL.Query().Get("search")
 	
 	var emails []*models.Email
+	var pageInfo *models.PageInfo
 	var total int
 	
 	if search != "" {
 		// 搜索邮件
-		query := `
-			SELECT e.id, e.uuid, e.sender_id, e.recipient_id, e.sender_email, e.recipient_email,
-			       e.subject, e.body, e.is_read, e.is_starred, e.is_deleted, e.is_draft,
-			       e.has_attachment, e.created_at, e.updated_at
-			FROM emails e
-			WHERE (e.subject LIKE ? OR e.body LIKE ? OR e.sender_email LIKE ? OR e.recipient_email LIKE ?)
-			  AND e.is_deleted = 0
-			ORDER BY e.created_at DESC
-			LIMIT ? OFFSET ?
-		`
-		
-		searchPattern := "%" + search + "%"
-		rows, err := db.Query(query, searchPattern, searchPattern, searchPattern, searchPattern, limit, offset)
+		emails, pageInfo, err = db.Emails().Search(search, pageReq)
 		if err != nil {
-			utils.Error("搜索邮件失败: %v", err)
+			utils.ErrorContext(r.Context(), "搜索邮件失败: %v", err)
 			respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
 				"success": false,
 				"message": "搜索邮件失败",
 			})
 			return
 		}
-		defer rows.Close()
-		
-		emails = make([]*models.Email, 0)
-		for rows.Next() {
-			var email models.Email
-			err := rows.Scan(
-				&email.ID, &email.UUID, &email.SenderID, &email.RecipientID,
-				&email.SenderEmail, &email.RecipientEmail,
-				&email.Subject, &email.Body,
-				&email.IsRead, &email.IsStarred, &email.IsDeleted, &email.IsDraft,
-				&email.HasAttachment, &email.CreatedAt, &email.UpdatedAt,
-			)
-			if err != nil {
-				continue
-			}
-			emails = append(emails, &email)
-		}
 		
 		// 获取总数
-		db.QueryRow(`
-			SELECT COUNT(*) FROM emails 
-			WHERE (subject LIKE ? OR body LIKE ? OR sender_email LIKE ? OR recipient_email LIKE ?)
-			  AND is_deleted = 0
-		`, searchPattern, searchPattern, searchPattern, searchPattern).Scan(&total)
+		total, _ = db.Emails().CountSearch(search)
 		
 	} else {
 		// 获取所有邮件
-		var err error
-		emails, err = models.GetAllEmails(db, limit, offset)
+		emails, pageInfo, err = db.Emails().List(pageReq)
 		if err != nil {
-			utils.Error("获取邮件列表失败: %v", err)
+			utils.ErrorContext(r.Context(), "获取邮件列表失败: %v", err)
 			respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
 				"success": false,
 				"message": "获取邮件列表失败",
@@ -563,44 +991,25 @@ func AdminGetEmailsHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		
-		total, err = models.CountAllEmails(db)
+		total, err = db.Emails().Count()
 		if err != nil {
 			total = len(emails)
 		}
 	}
 	
-	// 获取发件人和收件人信息
 	emailList := make([]map[string]interface{}, len(emails))
 	for i, email := range emails {
-		sender, _ := models.GetUserByID(db, email.SenderID)
-		recipient, _ := models.GetUserByID(db, email.RecipientID)
-		
-		senderName := email.SenderEmail
-		if sender != nil {
-			senderName = sender.Username
-		}
-		
-		recipientName := email.RecipientEmail
-		if recipient != nil {
-			recipientName = recipient.Username
-		}
-		
-		bodyPreview := getBodyPreview(email.Body)
-		if len(bodyPreview) > 100 {
-			bodyPreview = bodyPreview[:100] + "..."
-		}
-		
 		emailList[i] = map[string]interface{}{
 			"id":              email.ID,
 			"uuid":            email.UUID,
 			"sender_id":       email.SenderID,
 			"sender_email":    email.SenderEmail,
-			"sender_name":     senderName,
+			"sender_name":     email.SenderName,
 			"recipient_id":    email.RecipientID,
 			"recipient_email": email.RecipientEmail,
-			"recipient_name":  recipientName,
+			"recipient_name":  email.RecipientName,
 			"subject":         email.Subject,
-			"body_preview":    bodyPreview,
+			"body_preview":    email.Preview,
 			"is_read":         email.IsRead,
 			"is_starred":      email.IsStarred,
 			"is_deleted":      email.IsDeleted,
@@ -612,15 +1021,10 @@ func AdminGetEmailsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	respondJSON(w, http.StatusOK, map[string]interface{}{
-		"success": true,
-		"emails":  emailList,
-		"pagination": map[string]interface{}{
-			"page":       page,
-			"limit":      limit,
-			"total":      total,
-			"total_page": (total + limit - 1) / limit,
-		},
-		"search": search,
+		"success":    true,
+		"emails":     emailList,
+		"pagination": paginationResponse(pageReq, page, total, pageInfo),
+		"search":     search,
 	})
 }
 
@@ -630,8 +1034,7 @@ func AdminCreateUserHandler(w http.ResponseWriter, r *http.Request) {
 	
 	// 验证管理员权限
 	db := models.GetDB()
-	admin, err := models.GetUserByID(db, adminID)
-	if err != nil || !admin.IsAdmin {
+	if !hasPermission(r, models.PermUsersWrite) {
 		respondJSON(w, http.StatusForbidden, map[string]interface{}{
 			"success": false,
 			"message": "需要管理员权限",
@@ -690,8 +1093,23 @@ func AdminCreateUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
+	if req.IsAdmin && !isSuperAdmin(r) {
+		respondJSON(w, http.StatusForbidden, map[string]interface{}{
+			"success": false,
+			"message": "只有超级管理员可以创建管理员",
+		})
+		return
+	}
+	if !models.PermissionCoversDomain(requestPermissions(r), models.PermUsersWrite, models.EmailDomain(req.Email)) {
+		respondJSON(w, http.StatusForbidden, map[string]interface{}{
+			"success": false,
+			"message": "不能使用管理范围之外的邮箱域名",
+		})
+		return
+	}
+	
 	// 检查用户名和邮箱是否已存在
-	existingUser, _ := models.GetUserByUsername(db, req.Username)
+	existingUser, _ := db.Users().GetByUsername(req.Username)
 	if existingUser != nil {
 		respondJSON(w, http.StatusConflict, map[string]interface{}{
 			"success": false,
@@ -700,7 +1118,7 @@ func AdminCreateUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
-	existingUser, _ = models.GetUserByEmail(db, req.Email)
+	existingUser, _ = db.Users().GetByEmail(req.Email)
 	if existingUser != nil {
 		respondJSON(w, http.StatusConflict, map[string]interface{}{
 			"success": false,
@@ -712,7 +1130,7 @@ func AdminCreateUserHandler(w http.ResponseWriter, r *http.Request) {
 	// 哈希密码
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
-		utils.Error("密码哈希失败: %v", err)
+		utils.ErrorContext(r.Context(), "密码哈希失败: %v", err)
 		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
 			"success": false,
 			"message": "密码处理失败",
@@ -721,9 +1139,9 @@ func AdminCreateUserHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	// 创建用户
-	userID, err := models.CreateUser(db, req.Username, req.Email, string(hashedPassword))
+	userID, err := db.Users().Create(req.Username, req.Email, string(hashedPassword))
 	if err != nil {
-		utils.Error("创建用户失败: %v", err)
+		utils.ErrorContext(r.Context(), "创建用户失败: %v", err)
 		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
 			"success": false,
 			"message": "创建用户失败",
@@ -732,21 +1150,26 @@ func AdminCreateUserHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	// 更新额外信息
-	user, err := models.GetUserByID(db, int(userID))
+	user, err := db.Users().GetByID(int(userID))
 	if err != nil {
-		utils.Error("获取新用户信息失败: %v", err)
+		utils.ErrorContext(r.Context(), "获取新用户信息失败: %v", err)
 	} else {
 		user.IsAdmin = req.IsAdmin
 		user.IsActive = req.IsActive
 		user.CustomDomain = req.CustomDomain
 		user.MaxStorage = req.MaxStorage
 		
-		if err := models.UpdateUser(db, user); err != nil {
-			utils.Error("更新用户信息失败: %v", err)
+		if err := db.Users().Update(user); err != nil {
+			utils.ErrorContext(r.Context(), "更新用户信息失败: %v", err)
+		} else if user.CustomDomain != "" && isSuperAdmin(r) {
+			// 超级管理员设置的自定义域名视为已验证，其他管理员设置的域名需要用户通过DNS验证
+			if err := db.Users().SetCustomDomainVerified(user.ID, user.CustomDomain); err != nil {
+				utils.ErrorContext(r.Context(), "更新自定义域名验证状态失败: %v", err)
+			}
 		}
 	}
 	
-	utils.Info("管理员 %d 创建了新用户 %d (%s)", adminID, userID, req.Email)
+	utils.InfoContext(r.Context(), "管理员 %d 创建了新用户 %d (%s)", adminID, userID, req.Email)
 	
 	respondJSON(w, http.StatusCreated, map[string]interface{}{
 		"success": true,
@@ -765,12 +1188,8 @@ func AdminCreateUserHandler(w http.ResponseWriter, r *http.Request) {
 
 // AdminGetSystemLogsHandler 获取系统日志
 func AdminGetSystemLogsHandler(w http.ResponseWriter, r *http.Request) {
-	userID := r.Context().Value("user_id").(int)
-	
 	// 验证管理员权限
-	db := models.GetDB()
-	user, err := models.GetUserByID(db, userID)
-	if err != nil || !user.IsAdmin {
+	if !hasPermission(r, models.PermStatsRead) {
 		respondJSON(w, http.StatusForbidden, map[string]interface{}{
 			"success": false,
 			"message": "需要管理员权限",
@@ -798,8 +1217,7 @@ func AdminSendSystemNotificationHandler(w http.ResponseWriter, r *http.Request)
 	
 	// 验证管理员权限
 	db := models.GetDB()
-	user, err := models.GetUserByID(db, userID)
-	if err != nil || !user.IsAdmin {
+	if !hasPermission(r, models.PermNotificationsSend) {
 		respondJSON(w, http.StatusForbidden, map[string]interface{}{
 			"success": false,
 			"message": "需要管理员权限",
@@ -833,7 +1251,7 @@ func AdminSendSystemNotificationHandler(w http.ResponseWriter, r *http.Request)
 	
 	// 创建WebSocket通知消息
 	notification := WebSocketMessage{
-		Type: "system_notification",
+		Type: MessageTypeSystemNotification,
 		Payload: map[string]interface{}{
 			"title":   req.Title,
 			"message": req.Message,
@@ -848,13 +1266,13 @@ func AdminSendSystemNotificationHandler(w http.ResponseWriter, r *http.Request)
 	if req.ToAll {
 		// 发送给所有在线用户
 		manager.Broadcast <- notification
-		utils.Info("管理员 %d 发送了系统通知给所有用户", userID)
+		utils.InfoContext(r.Context(), "管理员 %d 发送了系统通知给所有用户", userID)
 	} else if len(req.UserIDs) > 0 {
 		// 发送给指定用户
 		for _, targetUserID := range req.UserIDs {
-			SendToUser(targetUserID, notification)
+			deliverToUser(db, targetUserID, notification)
 		}
-		utils.Info("管理员 %d 发送了系统通知给用户 %v", userID, req.UserIDs)
+		utils.InfoContext(r.Context(), "管理员 %d 发送了系统通知给用户 %v", userID, req.UserIDs)
 	} else {
 		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
 			"success": false,
@@ -868,6 +1286,3 @@ func AdminSendSystemNotificationHandler(w http.ResponseWriter, r *http.Request)
 		"message": "系统通知发送成功",
 	})
 }
-
-// 需要导入的包
-import "time"
\ No newline at end of file
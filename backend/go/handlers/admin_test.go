@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"SwiftPost/models"
+	"SwiftPost/utils"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	
+	"golang.org/x/crypto/bcrypt"
+)
+
+// superAdmin 拥有全部后台权限的超级管理员
+func superAdmin(user *models.User) testAdmin {
+	return testAdmin{ID: user.ID, SuperAdmin: true, Permissions: models.ValidPermissions}
+}
+
+// createAPICredentials 为用户创建一个个人访问令牌和一个应用专用密码
+func createAPICredentials(t *testing.T, db *models.Database, user *models.User) {
+	t.Helper()
+	_, err := models.CreatePersonalAccessToken(db, &models.PersonalAccessToken{
+		UserID: user.ID, Name: "ci", TokenHash: utils.HashToken("token-" + user.Username),
+		Prefix: "sp_" + user.Username, Scopes: []string{models.ScopeMailRead},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := models.CreateAppPassword(db, user.ID, "thunderbird", utils.HashAppPassword("app-"+user.Username)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// countAPICredentials 用户剩余的个人访问令牌和应用专用密码数量
+func countAPICredentials(t *testing.T, db *models.Database, user *models.User) (tokens, appPasswords int) {
+	t.Helper()
+	patList, err := models.GetPersonalAccessTokensByUser(db, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appList, err := models.GetAppPasswordsByUser(db, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(patList), len(appList)
+}
+
+func TestForceReloginRevokesAPICredentials(t *testing.T) {
+	_, db := newTestEnv(t)
+	admin := createTestUser(t, db, "admin", "password123")
+	alice := createTestUser(t, db, "alice", "password123")
+	bob := createTestUser(t, db, "bob", "password123")
+	for _, user := range []*models.User{alice, bob} {
+		if _, _, err := issueSession(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/login", nil), db, user); err != nil {
+			t.Fatal(err)
+		}
+		createAPICredentials(t, db, user)
+	}
+	
+	// 默认只撤销会话，API 凭据保留
+	w, resp := callAdminJSON(t, AdminForceReloginHandler, http.MethodPost, "/api/admin/sessions/revoke", superAdmin(admin), nil,
+		map[string]interface{}{"user_ids": []int{alice.ID}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("强制重新登录返回 %d: %v", w.Code, resp)
+	}
+	if types := resp["revoked_types"].([]interface{}); len(types) != 1 || types[0] != "sessions" {
+		t.Fatalf("未选择撤销 API 凭据时 revoked_types 应只有 sessions，实际为 %v", types)
+	}
+	if tokens, appPasswords := countAPICredentials(t, db, alice); tokens != 1 || appPasswords != 1 {
+		t.Fatalf("不应删除 API 凭据，剩余 %d 个令牌、%d 个应用专用密码", tokens, appPasswords)
+	}
+	
+	w, resp = callAdminJSON(t, AdminForceReloginHandler, http.MethodPost, "/api/admin/sessions/revoke", superAdmin(admin), nil,
+		map[string]interface{}{"user_ids": []int{alice.ID}, "revoke_api_credentials": true})
+	if w.Code != http.StatusOK {
+		t.Fatalf("强制重新登录返回 %d: %v", w.Code, resp)
+	}
+	if types := resp["revoked_types"].([]interface{}); len(types) != 3 {
+		t.Fatalf("revoked_types 应包含会话、访问令牌和应用专用密码，实际为 %v", types)
+	}
+	if resp["revoked_tokens"] != float64(1) || resp["revoked_app_passwords"] != float64(1) {
+		t.Fatalf("应撤销 1 个令牌和 1 个应用专用密码: %v", resp)
+	}
+	if tokens, appPasswords := countAPICredentials(t, db, alice); tokens != 0 || appPasswords != 0 {
+		t.Fatalf("alice 的 API 凭据应被删除，剩余 %d 个令牌、%d 个应用专用密码", tokens, appPasswords)
+	}
+	if tokens, appPasswords := countAPICredentials(t, db, bob); tokens != 1 || appPasswords != 1 {
+		t.Fatal("不应删除未指定用户的 API 凭据")
+	}
+	
+	w, resp = callAdminJSON(t, AdminForceReloginHandler, http.MethodPost, "/api/admin/sessions/revoke", superAdmin(admin), nil,
+		map[string]interface{}{"all": true, "revoke_api_credentials": true})
+	if w.Code != http.StatusOK {
+		t.Fatalf("强制全部重新登录返回 %d: %v", w.Code, resp)
+	}
+	if tokens, appPasswords := countAPICredentials(t, db, bob); tokens != 0 || appPasswords != 0 {
+		t.Fatalf("bob 的 API 凭据应被删除，剩余 %d 个令牌、%d 个应用专用密码", tokens, appPasswords)
+	}
+}
+
+func TestAdminUpdateUserPasswordRequiresResetPermission(t *testing.T) {
+	_, db := newTestEnv(t)
+	admin := createTestUser(t, db, "admin", "password123")
+	alice := createTestUser(t, db, "alice", "password123")
+	vars := map[string]string{"id": strconv.Itoa(alice.ID)}
+	body := map[string]interface{}{"password": "attacker-password"}
+	
+	// 只有 users:write 时不能通过更新接口设置密码
+	writer := testAdmin{ID: admin.ID, Permissions: []string{models.PermUsersWrite}}
+	w, resp := callAdminJSON(t, AdminUpdateUserHandler, http.MethodPut, "/api/admin/users/"+vars["id"], writer, vars, body)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("没有重置密码权限时应返回 403，实际为 %d: %v", w.Code, resp)
+	}
+	current, _ := db.Users().GetByID(alice.ID)
+	if bcrypt.CompareHashAndPassword([]byte(current.PasswordHash), []byte("password123")) != nil {
+		t.Fatal("被拒绝的请求不应修改密码")
+	}
+	
+	resetter := testAdmin{ID: admin.ID, Permissions: []string{models.PermUsersWrite, models.PermUsersResetPassword}}
+	w, resp = callAdminJSON(t, AdminUpdateUserHandler, http.MethodPut, "/api/admin/users/"+vars["id"], resetter, vars, body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("拥有重置密码权限时应能设置密码，实际为 %d: %v", w.Code, resp)
+	}
+	current, _ = db.Users().GetByID(alice.ID)
+	if bcrypt.CompareHashAndPassword([]byte(current.PasswordHash), []byte("attacker-password")) != nil {
+		t.Fatal("密码应已更新")
+	}
+}
+
+// TestAdminCustomDomainVerification 只有超级管理员设置的自定义域名直接视为已验证
+func TestAdminCustomDomainVerification(t *testing.T) {
+	_, db := newTestEnv(t)
+	admin := createTestUser(t, db, "admin", "password123")
+	alice := createTestUser(t, db, "alice", "password123")
+	domainAdmin := testAdmin{ID: admin.ID, Permissions: []string{models.PermUsersWrite + "@example.com"}}
+	
+	verified := func(email string) bool {
+		t.Helper()
+		user, err := db.Users().GetByEmail(email)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return user.CustomDomainVerified
+	}
+	
+	vars := map[string]string{"id": strconv.Itoa(alice.ID)}
+	w, resp := callAdminJSON(t, AdminUpdateUserHandler, http.MethodPut, "/api/admin/users/"+vars["id"], domainAdmin, vars,
+		map[string]interface{}{"custom_domain": "mail.victim.test"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("更新用户返回 %d: %v", w.Code, resp)
+	}
+	if verified(alice.Email) {
+		t.Fatal("按域名授权的管理员设置的自定义域名不应直接视为已验证")
+	}
+	
+	w, resp = callAdminJSON(t, AdminCreateUserHandler, http.MethodPost, "/api/admin/users", domainAdmin, nil, map[string]interface{}{
+		"username": "bob", "email": "bob@example.com", "password": "password123",
+		"is_active": true, "custom_domain": "mail.bob.test",
+	})
+	if w.Code != http.StatusOK && w.Code != http.StatusCreated {
+		t.Fatalf("创建用户返回 %d: %v", w.Code, resp)
+	}
+	if verified("bob@example.com") {
+		t.Fatal("按域名授权的管理员创建的用户的自定义域名不应直接视为已验证")
+	}
+	
+	w, resp = callAdminJSON(t, AdminUpdateUserHandler, http.MethodPut, "/api/admin/users/"+vars["id"], superAdmin(admin), vars,
+		map[string]interface{}{"custom_domain": "mail.alice.test"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("更新用户返回 %d: %v", w.Code, resp)
+	}
+	if !verified(alice.Email) {
+		t.Fatal("超级管理员设置的自定义域名应视为已验证")
+	}
+}
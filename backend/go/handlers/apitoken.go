@@ -0,0 +1,322 @@
+package handlers
+
+import (
+	"SwiftPost/models"
+	"SwiftPost/utils"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultTokenExpiryDays = 90
+	maxTokenExpiryDays     = 365
+	maxTokenNameLength     = 64
+)
+
+// CreateTokenRequest 创建个人访问令牌的请求，expires_in_days 为 0 表示永不过期，不填默认90天
+type CreateTokenRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays *int     `json:"expires_in_days"`
+}
+
+// GetTokensHandler 列出当前用户的个人访问令牌
+func GetTokensHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(int)
+	
+	tokens, err := models.GetPersonalAccessTokensByUser(models.GetDB(), userID)
+	if err != nil {
+		authLog.ErrorContext(r.Context(), "获取个人访问令牌失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "获取访问令牌失败",
+		})
+		return
+	}
+	
+	if tokens == nil {
+		tokens = []*models.PersonalAccessToken{}
+	}
+	
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"tokens":  tokens,
+		"scopes":  models.ValidScopes,
+	})
+}
+
+// CreateTokenHandler 创建个人访问令牌，令牌明文只在创建时返回一次
+func CreateTokenHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(int)
+	allowAdmin := len(requestPermissions(r)) > 0
+	
+	var req CreateTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "无效的请求格式",
+		})
+		return
+	}
+	
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len([]rune(req.Name)) > maxTokenNameLength {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "名称不能为空且不能超过64个字符",
+		})
+		return
+	}
+	
+	scopes, message := normalizeScopes(req.Scopes, allowAdmin)
+	if message != "" {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": message,
+		})
+		return
+	}
+	
+	days := defaultTokenExpiryDays
+	if req.ExpiresInDays != nil {
+		days = *req.ExpiresInDays
+	}
+	if days < 0 || days > maxTokenExpiryDays {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "有效期必须在0到365天之间（0表示永不过期）",
+		})
+		return
+	}
+	
+	tokenString, err := utils.GeneratePersonalAccessToken()
+	if err != nil {
+		authLog.ErrorContext(r.Context(), "生成个人访问令牌失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "服务器内部错误",
+		})
+		return
+	}
+	
+	token := &models.PersonalAccessToken{
+		UserID:    userID,
+		Name:      req.Name,
+		TokenHash: utils.HashToken(tokenString),
+		Prefix:    tokenString[:len(utils.PersonalAccessTokenPrefix)+4],
+		Scopes:    scopes,
+		CreatedAt: time.Now(),
+	}
+	if days > 0 {
+		expiresAt := time.Now().AddDate(0, 0, days)
+		token.ExpiresAt = &expiresAt
+	}
+	
+	id, err := models.CreatePersonalAccessToken(models.GetDB(), token)
+	if err != nil {
+		authLog.ErrorContext(r.Context(), "保存个人访问令牌失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "创建访问令牌失败",
+		})
+		return
+	}
+	token.ID = int(id)
+	
+	authLog.InfoContext(r.Context(), "用户 %d 创建了个人访问令牌: %s (%s)", userID, req.Name, strings.Join(scopes, " "))
+	
+	respondJSON(w, http.StatusCreated, map[string]interface{}{
+		"success": true,
+		"message": "访问令牌已创建，请立即复制保存，之后将无法再次查看",
+		"token":   tokenString,
+		"info":    token,
+	})
+}
+
+// normalizeScopes 校验并去重权限范围，只有拥有后台权限的用户可以授予 admin 权限
+func normalizeScopes(requested []string, allowAdmin bool) ([]string, string) {
+	if len(requested) == 0 {
+		return nil, "至少需要选择一个权限范围"
+	}
+	
+	seen := make(map[string]bool)
+	var scopes []string
+	for _, scope := range requested {
+		scope = strings.TrimSpace(scope)
+		valid := false
+		for _, s := range models.ValidScopes {
+			if s == scope {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return nil, "无效的权限范围: " + scope
+		}
+		if scope == models.ScopeAdmin && !allowAdmin {
+			return nil, "只有管理员可以授予 admin 权限"
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	
+	return scopes, ""
+}
+
+// DeleteTokenHandler 撤销个人访问令牌
+func DeleteTokenHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(int)
+	tokenID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "无效的令牌ID",
+		})
+		return
+	}
+	
+	if err := models.DeletePersonalAccessToken(models.GetDB(), userID, tokenID); err != nil {
+		if err == sql.ErrNoRows {
+			respondJSON(w, http.StatusNotFound, map[string]interface{}{
+				"success": false,
+				"message": "访问令牌不存在",
+			})
+			return
+		}
+		authLog.ErrorContext(r.Context(), "撤销个人访问令牌失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "撤销访问令牌失败",
+		})
+		return
+	}
+	
+	authLog.InfoContext(r.Context(), "用户 %d 撤销了个人访问令牌 %d", userID, tokenID)
+	
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "访问令牌已撤销",
+	})
+}
+
+// GetAppPasswordsHandler 列出当前用户的应用专用密码
+func GetAppPasswordsHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(int)
+	
+	passwords, err := models.GetAppPasswordsByUser(models.GetDB(), userID)
+	if err != nil {
+		authLog.ErrorContext(r.Context(), "获取应用专用密码失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "获取应用专用密码失败",
+		})
+		return
+	}
+	
+	if passwords == nil {
+		passwords = []*models.AppPassword{}
+	}
+	
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success":       true,
+		"app_passwords": passwords,
+	})
+}
+
+// CreateAppPasswordHandler 创建应用专用密码，供邮件客户端登录使用，明文只返回一次
+func CreateAppPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(int)
+	
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "无效的请求格式",
+		})
+		return
+	}
+	
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len([]rune(req.Name)) > maxTokenNameLength {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "名称不能为空且不能超过64个字符",
+		})
+		return
+	}
+	
+	password, err := utils.GenerateAppPassword()
+	if err != nil {
+		authLog.ErrorContext(r.Context(), "生成应用专用密码失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "服务器内部错误",
+		})
+		return
+	}
+	
+	id, err := models.CreateAppPassword(models.GetDB(), userID, req.Name, utils.HashAppPassword(password))
+	if err != nil {
+		authLog.ErrorContext(r.Context(), "保存应用专用密码失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "创建应用专用密码失败",
+		})
+		return
+	}
+	
+	authLog.InfoContext(r.Context(), "用户 %d 创建了应用专用密码: %s", userID, req.Name)
+	
+	respondJSON(w, http.StatusCreated, map[string]interface{}{
+		"success":  true,
+		"message":  "应用专用密码已创建，请立即在邮件客户端中使用，之后将无法再次查看",
+		"id":       id,
+		"password": password,
+	})
+}
+
+// DeleteAppPasswordHandler 撤销应用专用密码
+func DeleteAppPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(int)
+	passwordID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "无效的密码ID",
+		})
+		return
+	}
+	
+	if err := models.DeleteAppPassword(models.GetDB(), userID, passwordID); err != nil {
+		if err == sql.ErrNoRows {
+			respondJSON(w, http.StatusNotFound, map[string]interface{}{
+				"success": false,
+				"message": "应用专用密码不存在",
+			})
+			return
+		}
+		authLog.ErrorContext(r.Context(), "撤销应用专用密码失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "撤销应用专用密码失败",
+		})
+		return
+	}
+	
+	authLog.InfoContext(r.Context(), "用户 %d 撤销了应用专用密码 %d", userID, passwordID)
+	
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "应用专用密码已撤销",
+	})
+}
@@ -5,15 +5,17 @@ import (
 	"SwiftPost/utils"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strings"
 	"time"
 
-	"github.com/dgrijalva/jwt-go"
-	"github.com/gorilla/mux"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// authLog 登录、注册、会话和各种认证方式的日志
+var authLog = utils.NewLogger("auth")
+
 type AuthRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
@@ -26,10 +28,17 @@ type RegisterRequest struct {
 }
 
 type AuthResponse struct {
-	Success bool   `json:"success"`
-	Token   string `json:"token,omitempty"`
-	Message string `json:"message,omitempty"`
-	User    *UserResponse `json:"user,omitempty"`
+	Success              bool          `json:"success"`
+	Token                string        `json:"token,omitempty"`
+	RefreshToken         string        `json:"refresh_token,omitempty"`
+	ExpiresIn            int           `json:"expires_in,omitempty"`
+	MFARequired          bool          `json:"mfa_required,omitempty"`
+	MFAToken             string        `json:"mfa_token,omitempty"`
+	MFAMethods           []string      `json:"mfa_methods,omitempty"`
+	MFASetupRequired     bool          `json:"mfa_setup_required,omitempty"`
+	VerificationRequired bool          `json:"verification_required,omitempty"`
+	Message              string        `json:"message,omitempty"`
+	User                 *UserResponse `json:"user,omitempty"`
 }
 
 type UserResponse struct {
@@ -43,7 +52,7 @@ type UserResponse struct {
 func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	var req RegisterRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		utils.Error("注册请求解析失败: %v", err)
+		authLog.ErrorContext(r.Context(), "注册请求解析失败: %v", err)
 		respondJSON(w, http.StatusBadRequest, AuthResponse{
 			Success: false,
 			Message: "无效的请求格式",
@@ -51,6 +60,14 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
+	if localPasswordDisabled() {
+		respondJSON(w, http.StatusForbidden, AuthResponse{
+			Success: false,
+			Message: "已禁用本地注册，请使用单点登录",
+		})
+		return
+	}
+	
 	// 验证输入
 	if strings.TrimSpace(req.Username) == "" {
 		respondJSON(w, http.StatusBadRequest, AuthResponse{
@@ -86,7 +103,7 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	
 	// 检查邮箱是否已注册
 	db := models.GetDB()
-	existingUser, err := models.GetUserByEmail(db, req.Email)
+	existingUser, err := db.Users().GetByEmail(req.Email)
 	if err == nil && existingUser != nil {
 		respondJSON(w, http.StatusConflict, AuthResponse{
 			Success: false,
@@ -96,7 +113,7 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	// 检查用户名是否已存在
-	existingUser, err = models.GetUserByUsername(db, req.Username)
+	existingUser, err = db.Users().GetByUsername(req.Username)
 	if err == nil && existingUser != nil {
 		respondJSON(w, http.StatusConflict, AuthResponse{
 			Success: false,
@@ -108,7 +125,7 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	// 哈希密码
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
-		utils.Error("密码哈希失败: %v", err)
+		authLog.ErrorContext(r.Context(), "密码哈希失败: %v", err)
 		respondJSON(w, http.StatusInternalServerError, AuthResponse{
 			Success: false,
 			Message: "服务器内部错误",
@@ -117,9 +134,9 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	// 创建用户
-	userID, err := models.CreateUser(db, req.Username, req.Email, string(hashedPassword))
+	userID, err := db.Users().Create(req.Username, req.Email, string(hashedPassword))
 	if err != nil {
-		utils.Error("创建用户失败: %v", err)
+		authLog.ErrorContext(r.Context(), "创建用户失败: %v", err)
 		respondJSON(w, http.StatusInternalServerError, AuthResponse{
 			Success: false,
 			Message: "创建用户失败",
@@ -127,21 +144,12 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
-	utils.Info("新用户注册: %s (%s)", req.Username, req.Email)
+	authLog.InfoContext(r.Context(), "新用户注册: %s (%s)", req.Username, req.Email)
 	
-	// 生成 JWT token
-	config, _ := utils.LoadConfig("config.json")
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": userID,
-		"username": req.Username,
-		"email": req.Email,
-		"exp": time.Now().Add(time.Hour * time.Duration(config.Security.TokenExpiry)).Unix(),
-		"iat": time.Now().Unix(),
-	})
-	
-	tokenString, err := token.SignedString([]byte(config.Security.JWTSecret))
+	// 获取用户信息
+	user, err := db.Users().GetByID(int(userID))
 	if err != nil {
-		utils.Error("生成Token失败: %v", err)
+		authLog.ErrorContext(r.Context(), "获取用户信息失败: %v", err)
 		respondJSON(w, http.StatusInternalServerError, AuthResponse{
 			Success: false,
 			Message: "服务器内部错误",
@@ -149,10 +157,34 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
-	// 获取用户信息
-	user, err := models.GetUserByID(db, int(userID))
+	// 管理员开启邮箱验证时，新账号处于待验证状态，验证邮箱后才能登录
+	config := utils.GetConfig()
+	if config.Account.RequireEmailVerification {
+		if err := db.Users().SetEmailVerified(user.ID, false); err != nil {
+			authLog.ErrorContext(r.Context(), "设置账号待验证状态失败: %v", err)
+			respondJSON(w, http.StatusInternalServerError, AuthResponse{
+				Success: false,
+				Message: "服务器内部错误",
+			})
+			return
+		}
+		
+		if err := sendAccountToken(r.Context(), db, config, user, models.AccountTokenVerifyEmail); err != nil {
+			authLog.ErrorContext(r.Context(), "发送邮箱验证链接失败: %v", err)
+		}
+		
+		respondJSON(w, http.StatusOK, AuthResponse{
+			Success:              true,
+			VerificationRequired: true,
+			Message:              "注册成功，请查收验证邮件完成激活",
+		})
+		return
+	}
+	
+	// 创建会话并生成令牌
+	tokenString, refreshToken, err := issueSession(w, r, db, user)
 	if err != nil {
-		utils.Error("获取用户信息失败: %v", err)
+		authLog.ErrorContext(r.Context(), "生成Token失败: %v", err)
 		respondJSON(w, http.StatusInternalServerError, AuthResponse{
 			Success: false,
 			Message: "服务器内部错误",
@@ -161,9 +193,11 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	respondJSON(w, http.StatusOK, AuthResponse{
-		Success: true,
-		Token:   tokenString,
-		Message: "注册成功",
+		Success:      true,
+		Token:        tokenString,
+		RefreshToken: refreshToken,
+		ExpiresIn:    accessTokenExpiresIn(),
+		Message:      "注册成功",
 		User: &UserResponse{
 			ID:       user.ID,
 			Username: user.Username,
@@ -177,7 +211,7 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 func LoginHandler(w http.ResponseWriter, r *http.Request) {
 	var req AuthRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		utils.Error("登录请求解析失败: %v", err)
+		authLog.ErrorContext(r.Context(), "登录请求解析失败: %v", err)
 		respondJSON(w, http.StatusBadRequest, AuthResponse{
 			Success: false,
 			Message: "无效的请求格式",
@@ -202,23 +236,90 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
-	// 查找用户
 	db := models.GetDB()
-	user, err := models.GetUserByEmail(db, req.Email)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			respondJSON(w, http.StatusUnauthorized, AuthResponse{
+	config := utils.GetConfig()
+	ip := utils.ClientIP(r)
+	
+	// 连续失败过多的账号或IP在验证密码前直接拒绝
+	if !checkLoginAllowed(r.Context(), w, db, config, req.Email, ip) {
+		return
+	}
+	
+	// 启用LDAP时优先使用目录认证，目录中没有的用户（如本地管理员）继续使用本地密码
+	var user *models.User
+	var ldapErr error
+	if config.LDAP.Enabled {
+		user, ldapErr = authenticateLDAP(db, config, req.Email, req.Password)
+		switch {
+		case ldapErr == nil, errors.Is(ldapErr, utils.ErrLDAPUserNotFound):
+		case errors.Is(ldapErr, utils.ErrLDAPInvalidCredentials):
+			loginFailed(r.Context(), w, db, config, req.Email, ip)
+			return
+		case errors.Is(ldapErr, errNoLinkedAccount):
+			respondJSON(w, http.StatusForbidden, AuthResponse{
 				Success: false,
-				Message: "邮箱或密码错误",
+				Message: "该账号尚未开通邮箱，请联系管理员",
 			})
 			return
+		default:
+			authLog.ErrorContext(r.Context(), "LDAP认证失败: %v", ldapErr)
+		}
+	}
+	
+	if user == nil {
+		if localPasswordDisabled() {
+			respondJSON(w, http.StatusForbidden, AuthResponse{
+				Success: false,
+				Message: "已禁用密码登录，请使用单点登录",
+			})
+			return
+		}
+		
+		// 查找用户
+		var err error
+		user, err = db.Users().GetByEmail(req.Email)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				loginFailed(r.Context(), w, db, config, req.Email, ip)
+				return
+			}
+			authLog.ErrorContext(r.Context(), "查询用户失败: %v", err)
+			respondJSON(w, http.StatusInternalServerError, AuthResponse{
+				Success: false,
+				Message: "服务器内部错误",
+			})
+			return
+		}
+		
+		// 目录用户只能通过LDAP认证，目录不可用时不能退回本地密码
+		if config.LDAP.Enabled {
+			linked, err := models.HasUserIdentity(db, user.ID, models.LDAPIssuer(config))
+			if err != nil {
+				authLog.ErrorContext(r.Context(), "查询外部身份失败: %v", err)
+				respondJSON(w, http.StatusInternalServerError, AuthResponse{
+					Success: false,
+					Message: "服务器内部错误",
+				})
+				return
+			}
+			if linked && ldapErr != nil && !errors.Is(ldapErr, utils.ErrLDAPUserNotFound) {
+				respondJSON(w, http.StatusServiceUnavailable, AuthResponse{
+					Success: false,
+					Message: "目录服务暂时不可用，请稍后重试",
+				})
+				return
+			}
+			if linked {
+				loginFailed(r.Context(), w, db, config, req.Email, ip)
+				return
+			}
+		}
+		
+		// 验证密码
+		if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
+			loginFailed(r.Context(), w, db, config, req.Email, ip)
+			return
 		}
-		utils.Error("查询用户失败: %v", err)
-		respondJSON(w, http.StatusInternalServerError, AuthResponse{
-			Success: false,
-			Message: "服务器内部错误",
-		})
-		return
 	}
 	
 	// 检查用户是否激活
@@ -230,31 +331,68 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
-	// 验证密码
-	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
-		respondJSON(w, http.StatusUnauthorized, AuthResponse{
+	// 待验证邮箱的账号不能登录
+	if !user.EmailVerified {
+		respondJSON(w, http.StatusForbidden, AuthResponse{
+			Success:              false,
+			VerificationRequired: true,
+			Message:              "邮箱尚未验证，请先查收验证邮件",
+		})
+		return
+	}
+	
+	// 已启用两步验证（验证器或安全密钥）时只返回临时令牌，第二步通过后再创建会话
+	mfaEnabled, err := models.IsMFAEnabled(db, user.ID)
+	var keyCount int
+	if err == nil {
+		keyCount, err = models.CountWebAuthnCredentials(db, user.ID)
+	}
+	if err != nil {
+		authLog.ErrorContext(r.Context(), "获取两步验证状态失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, AuthResponse{
 			Success: false,
-			Message: "邮箱或密码错误",
+			Message: "服务器内部错误",
 		})
 		return
 	}
 	
-	utils.Info("用户登录: %s (%s)", user.Username, user.Email)
+	var mfaMethods []string
+	if mfaEnabled {
+		mfaMethods = append(mfaMethods, "totp")
+	}
+	if keyCount > 0 {
+		mfaMethods = append(mfaMethods, "webauthn")
+	}
 	
-	// 生成 JWT token
-	config, _ := utils.LoadConfig("config.json")
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id":  user.ID,
-		"username": user.Username,
-		"email":    user.Email,
-		"is_admin": user.IsAdmin,
-		"exp":      time.Now().Add(time.Hour * time.Duration(config.Security.TokenExpiry)).Unix(),
-		"iat":      time.Now().Unix(),
-	})
+	if len(mfaMethods) > 0 {
+		mfaToken, err := utils.GenerateMFAToken(user.ID)
+		if err != nil {
+			authLog.ErrorContext(r.Context(), "生成两步验证令牌失败: %v", err)
+			respondJSON(w, http.StatusInternalServerError, AuthResponse{
+				Success: false,
+				Message: "服务器内部错误",
+			})
+			return
+		}
+		
+		respondJSON(w, http.StatusOK, AuthResponse{
+			Success:     true,
+			MFARequired: true,
+			MFAToken:    mfaToken,
+			MFAMethods:  mfaMethods,
+			Message:     "请完成两步验证",
+		})
+		return
+	}
 	
-	tokenString, err := token.SignedString([]byte(config.Security.JWTSecret))
+	// 不需要两步验证时登录到此完成，清除失败记录；需要时等第二步通过后再清除
+	loginSucceeded(r.Context(), db, req.Email)
+	authLog.InfoContext(r.Context(), "用户登录: %s (%s)", user.Username, user.Email)
+	
+	// 创建会话并生成令牌
+	tokenString, refreshToken, err := issueSession(w, r, db, user)
 	if err != nil {
-		utils.Error("生成Token失败: %v", err)
+		authLog.ErrorContext(r.Context(), "生成Token失败: %v", err)
 		respondJSON(w, http.StatusInternalServerError, AuthResponse{
 			Success: false,
 			Message: "服务器内部错误",
@@ -263,9 +401,12 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	respondJSON(w, http.StatusOK, AuthResponse{
-		Success: true,
-		Token:   tokenString,
-		Message: "登录成功",
+		Success:          true,
+		Token:            tokenString,
+		RefreshToken:     refreshToken,
+		ExpiresIn:        accessTokenExpiresIn(),
+		MFASetupRequired: user.IsAdmin && config.Admin.Require2FA,
+		Message:          "登录成功",
 		User: &UserResponse{
 			ID:       user.ID,
 			Username: user.Username,
@@ -277,8 +418,21 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func LogoutHandler(w http.ResponseWriter, r *http.Request) {
-	// 在实际应用中，这里应该将Token加入黑名单
-	// 由于JWT是无状态的，客户端需要自行删除Token
+	sessionID, _ := r.Context().Value("session_id").(int)
+	
+	// 撤销当前会话，访问令牌和刷新令牌随之失效
+	db := models.GetDB()
+	if err := db.Sessions().Revoke(sessionID); err != nil {
+		authLog.ErrorContext(r.Context(), "撤销会话失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "登出失败",
+		})
+		return
+	}
+	DisconnectSession(sessionID)
+	
+	clearAuthCookies(w, r)
 	
 	respondJSON(w, http.StatusOK, map[string]interface{}{
 		"success": true,
@@ -286,75 +440,170 @@ func LogoutHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func RefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
-	authHeader := r.Header.Get("Authorization")
-	if authHeader == "" {
-		respondJSON(w, http.StatusUnauthorized, AuthResponse{
-			Success: false,
-			Message: "缺少授权Token",
+// LogoutAllHandler 退出所有设备
+func LogoutAllHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(int)
+	
+	db := models.GetDB()
+	count, err := db.Sessions().RevokeAllForUser(userID)
+	if err != nil {
+		authLog.ErrorContext(r.Context(), "撤销用户会话失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "登出失败",
 		})
 		return
 	}
+	DisconnectUser(userID)
+	
+	clearAuthCookies(w, r)
+	authLog.InfoContext(r.Context(), "用户 %d 退出了所有设备 (%d 个会话)", userID, count)
+	
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "已退出所有设备",
+		"revoked": count,
+	})
+}
+
+// refreshReuseGrace 刷新令牌轮换后的宽限期。多个标签页共用同一个刷新令牌Cookie，
+// 宽限期内再次使用旧令牌只返回 409，前端稍后用新Cookie重试；超过宽限期仍视为令牌泄露
+const refreshReuseGrace = 30 * time.Second
+
+// respondRefreshConflict 刷新令牌刚被并发请求轮换，不撤销会话
+func respondRefreshConflict(w http.ResponseWriter) {
+	respondJSON(w, http.StatusConflict, AuthResponse{
+		Success: false,
+		Message: "刷新令牌刚被其他请求更新，请重试",
+	})
+}
+
+func RefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	// 刷新令牌可以放在请求体中，也可以通过Cookie发送
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
 	
-	// 提取Token
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	if tokenString == authHeader {
+	refreshToken := req.RefreshToken
+	if refreshToken == "" {
+		if cookie, err := r.Cookie(refreshTokenCookie); err == nil {
+			refreshToken = cookie.Value
+		}
+	}
+	
+	if refreshToken == "" {
 		respondJSON(w, http.StatusUnauthorized, AuthResponse{
 			Success: false,
-			Message: "无效的Token格式",
+			Message: "缺少刷新令牌",
 		})
 		return
 	}
 	
-	// 解析并验证Token
-	config, _ := utils.LoadConfig("config.json")
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, jwt.NewValidationError("无效的签名方法", jwt.ValidationErrorSignatureInvalid)
-		}
-		return []byte(config.Security.JWTSecret), nil
-	})
+	db := models.GetDB()
+	tokenHash := utils.HashToken(refreshToken)
 	
+	session, err := db.Sessions().GetByTokenHash(tokenHash)
 	if err != nil {
-		utils.Error("Token解析失败: %v", err)
+		if err != sql.ErrNoRows {
+			authLog.ErrorContext(r.Context(), "查询会话失败: %v", err)
+			respondJSON(w, http.StatusInternalServerError, AuthResponse{
+				Success: false,
+				Message: "服务器内部错误",
+			})
+			return
+		}
+		
+		// 已轮换的刷新令牌被再次使用，可能已泄露，撤销整个会话。
+		// 刚轮换不久的令牌通常是另一个标签页同时发起的刷新，此时不撤销，也不清除对方刚设置的新Cookie
+		if retired, retiredAt, err := db.Sessions().GetByRetiredToken(tokenHash); err == nil {
+			if time.Since(retiredAt) < refreshReuseGrace && retired.IsActive() {
+				respondRefreshConflict(w)
+				return
+			}
+			db.Sessions().Revoke(retired.ID)
+			DisconnectSession(retired.ID)
+			authLog.WarnContext(r.Context(), "检测到刷新令牌重用，已撤销会话: 用户ID=%d, 会话ID=%d, IP=%s", retired.UserID, retired.ID, utils.ClientIP(r))
+		}
+		
+		clearAuthCookies(w, r)
 		respondJSON(w, http.StatusUnauthorized, AuthResponse{
 			Success: false,
-			Message: "无效的Token",
+			Message: "刷新令牌无效",
 		})
 		return
 	}
 	
-	if !token.Valid {
+	if !session.IsActive() {
+		clearAuthCookies(w, r)
 		respondJSON(w, http.StatusUnauthorized, AuthResponse{
 			Success: false,
-			Message: "Token已失效",
+			Message: "会话已失效，请重新登录",
 		})
 		return
 	}
 	
 	// 获取用户信息
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		respondJSON(w, http.StatusUnauthorized, AuthResponse{
+	user, err := db.Users().GetByID(session.UserID)
+	if err != nil || !user.IsActive {
+		db.Sessions().Revoke(session.ID)
+		DisconnectSession(session.ID)
+		clearAuthCookies(w, r)
+		respondJSON(w, http.StatusForbidden, AuthResponse{
 			Success: false,
-			Message: "无效的Token声明",
+			Message: "账号已被禁用",
 		})
 		return
 	}
 	
-	// 生成新的Token
-	newToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id":  claims["user_id"],
-		"username": claims["username"],
-		"email":    claims["email"],
-		"is_admin": claims["is_admin"],
-		"exp":      time.Now().Add(time.Hour * time.Duration(config.Security.TokenExpiry)).Unix(),
-		"iat":      time.Now().Unix(),
-	})
+	// 轮换刷新令牌
+	newRefreshToken, err := utils.GenerateRefreshToken()
+	if err != nil {
+		authLog.ErrorContext(r.Context(), "生成刷新令牌失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, AuthResponse{
+			Success: false,
+			Message: "服务器内部错误",
+		})
+		return
+	}
+	
+	err = db.Sessions().RotateToken(session.ID, tokenHash, utils.HashToken(newRefreshToken), utils.ClientIP(r), r.UserAgent())
+	if err != nil {
+		if err == models.ErrRefreshTokenReused {
+			// 另一个请求刚刚用同一个令牌完成了轮换
+			respondRefreshConflict(w)
+			return
+		}
+		authLog.ErrorContext(r.Context(), "轮换刷新令牌失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, AuthResponse{
+			Success: false,
+			Message: "服务器内部错误",
+		})
+		return
+	}
+	
+	// 生成新的访问令牌，角色权限以数据库中的最新状态为准
+	config := utils.GetConfig()
+	scopes, err := models.GetUserPermissions(db, user.ID)
+	if err != nil {
+		authLog.ErrorContext(r.Context(), "获取用户权限失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, AuthResponse{
+			Success: false,
+			Message: "服务器内部错误",
+		})
+		return
+	}
 	
-	newTokenString, err := newToken.SignedString([]byte(config.Security.JWTSecret))
+	newTokenString, err := utils.GenerateAccessToken(config, utils.AccessClaims{
+		UserID:    user.ID,
+		Username:  user.Username,
+		Email:     user.Email,
+		IsAdmin:   user.IsAdmin,
+		SessionID: session.ID,
+		Scopes:    scopes,
+	})
 	if err != nil {
-		utils.Error("生成新Token失败: %v", err)
+		authLog.ErrorContext(r.Context(), "生成新Token失败: %v", err)
 		respondJSON(w, http.StatusInternalServerError, AuthResponse{
 			Success: false,
 			Message: "服务器内部错误",
@@ -362,10 +611,15 @@ func RefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
+	setRefreshCookie(w, r, newRefreshToken, session.ExpiresAt)
+	setAccessCookies(w, r, newTokenString, session.ID, session.ExpiresAt)
+	
 	respondJSON(w, http.StatusOK, AuthResponse{
-		Success: true,
-		Token:   newTokenString,
-		Message: "Token刷新成功",
+		Success:      true,
+		Token:        newTokenString,
+		RefreshToken: newRefreshToken,
+		ExpiresIn:    accessTokenExpiresIn(),
+		Message:      "Token刷新成功",
 	})
 }
 
@@ -373,9 +627,9 @@ func GetProfileHandler(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value("user_id").(int)
 	
 	db := models.GetDB()
-	user, err := models.GetUserByID(db, userID)
+	user, err := db.Users().GetByID(userID)
 	if err != nil {
-		utils.Error("获取用户信息失败: %v", err)
+		authLog.ErrorContext(r.Context(), "获取用户信息失败: %v", err)
 		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
 			"success": false,
 			"message": "获取用户信息失败",
@@ -384,11 +638,7 @@ func GetProfileHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	// 统计未读邮件数量
-	var unreadCount int
-	err = db.QueryRow(`
-		SELECT COUNT(*) FROM emails 
-		WHERE recipient_id = ? AND is_read = 0 AND is_deleted = 0 AND is_draft = 0
-	`, userID).Scan(&unreadCount)
+	unreadCount, err := db.Emails().CountUnread(userID)
 	if err != nil {
 		unreadCount = 0
 	}
@@ -408,6 +658,7 @@ func GetProfileHandler(w http.ResponseWriter, r *http.Request) {
 			"username":      user.Username,
 			"email":         user.Email,
 			"is_admin":      user.IsAdmin,
+			"permissions":   requestPermissions(r),
 			"custom_domain": user.CustomDomain,
 			"storage": map[string]interface{}{
 				"used":       storageUsedMB,
@@ -442,9 +693,9 @@ func UpdateProfileHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	db := models.GetDB()
-	user, err := models.GetUserByID(db, userID)
+	user, err := db.Users().GetByID(userID)
 	if err != nil {
-		utils.Error("获取用户信息失败: %v", err)
+		authLog.ErrorContext(r.Context(), "获取用户信息失败: %v", err)
 		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
 			"success": false,
 			"message": "获取用户信息失败",
@@ -455,7 +706,7 @@ func UpdateProfileHandler(w http.ResponseWriter, r *http.Request) {
 	// 更新用户名（如果提供了新用户名）
 	if updateData.Username != "" && updateData.Username != user.Username {
 		// 检查用户名是否已存在
-		existingUser, err := models.GetUserByUsername(db, updateData.Username)
+		existingUser, err := db.Users().GetByUsername(updateData.Username)
 		if err == nil && existingUser != nil && existingUser.ID != userID {
 			respondJSON(w, http.StatusConflict, map[string]interface{}{
 				"success": false,
@@ -470,8 +721,8 @@ func UpdateProfileHandler(w http.ResponseWriter, r *http.Request) {
 	user.CustomDomain = updateData.CustomDomain
 	
 	// 保存更改
-	if err := models.UpdateUser(db, user); err != nil {
-		utils.Error("更新用户信息失败: %v", err)
+	if err := db.Users().Update(user); err != nil {
+		authLog.ErrorContext(r.Context(), "更新用户信息失败: %v", err)
 		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
 			"success": false,
 			"message": "更新用户信息失败",
@@ -507,20 +758,29 @@ func UpdateDomainHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
-	// 验证域名格式（简单的验证）
-	if req.Domain != "" {
-		if !strings.Contains(req.Domain, ".") {
-			respondJSON(w, http.StatusBadRequest, map[string]interface{}{
-				"success": false,
-				"message": "无效的域名格式",
-			})
-			return
-		}
+	// 验证域名格式，域名会用于申请证书，需要是完整的域名
+	req.Domain = models.NormalizeDomain(req.Domain)
+	if req.Domain != "" && !utils.ValidateDomain(req.Domain) {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "无效的域名格式",
+		})
+		return
 	}
 	
 	db := models.GetDB()
-	if err := models.UpdateCustomDomain(db, userID, req.Domain); err != nil {
-		utils.Error("更新域名失败: %v", err)
+	if err := db.Users().UpdateCustomDomain(userID, req.Domain); err != nil {
+		authLog.ErrorContext(r.Context(), "更新域名失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "更新域名失败",
+		})
+		return
+	}
+	
+	user, err := db.Users().GetByID(userID)
+	if err != nil {
+		authLog.ErrorContext(r.Context(), "获取用户信息失败: %v", err)
 		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
 			"success": false,
 			"message": "更新域名失败",
@@ -529,9 +789,10 @@ func UpdateDomainHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	respondJSON(w, http.StatusOK, map[string]interface{}{
-		"success": true,
-		"message": "域名更新成功",
-		"domain":  req.Domain,
+		"success":      true,
+		"message":      "域名更新成功",
+		"domain":       user.CustomDomain,
+		"verification": domainVerification(user),
 	})
 }
 
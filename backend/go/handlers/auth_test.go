@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"SwiftPost/utils"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRefreshTokenReuse(t *testing.T) {
+	_, db := newTestEnv(t)
+	user := createTestUser(t, db, "alice", "password123")
+	
+	_, refreshToken, err := issueSession(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/login", nil), db, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := db.Sessions().GetByTokenHash(utils.HashToken(refreshToken))
+	if err != nil {
+		t.Fatal(err)
+	}
+	
+	refresh := func(token string) (int, map[string]interface{}) {
+		w, resp := callJSON(t, RefreshTokenHandler, http.MethodPost, "/api/refresh", 0, map[string]string{"refresh_token": token})
+		return w.Code, resp
+	}
+	
+	code, resp := refresh(refreshToken)
+	if code != http.StatusOK {
+		t.Fatalf("第一次刷新返回 %d: %v", code, resp)
+	}
+	
+	// 另一个标签页用同一个旧令牌刷新：返回 409，会话保持有效
+	if code, resp := refresh(refreshToken); code != http.StatusConflict {
+		t.Fatalf("宽限期内重用旧令牌应返回 409，实际为 %d: %v", code, resp)
+	}
+	current, err := db.Sessions().GetByID(session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !current.IsActive() {
+		t.Fatal("宽限期内重用旧令牌不应撤销会话")
+	}
+	
+	// 超过宽限期后再使用旧令牌视为泄露，撤销整个会话
+	if _, err := db.Exec("UPDATE retired_refresh_tokens SET retired_at = ? WHERE token_hash = ?",
+		time.Now().Add(-2*refreshReuseGrace), utils.HashToken(refreshToken)); err != nil {
+		t.Fatal(err)
+	}
+	if code, resp := refresh(refreshToken); code != http.StatusUnauthorized {
+		t.Fatalf("宽限期后重用旧令牌应返回 401，实际为 %d: %v", code, resp)
+	}
+	current, err = db.Sessions().GetByID(session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current.IsActive() {
+		t.Fatal("宽限期后重用旧令牌应撤销会话")
+	}
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"SwiftPost/models"
+	"SwiftPost/utils"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// lookupTXT 查询 DNS TXT 记录
+var lookupTXT = net.DefaultResolver.LookupTXT
+
+// domainVerificationRecord 验证自定义域名需要添加的 DNS TXT 记录。记录值由用户ID和域名计算，
+// 同一个域名被多个用户设置时，只有 DNS 中添加了对应记录的用户能通过验证
+func domainVerificationRecord(userID int, domain string) (name, value string) {
+	sum := sha256.Sum256([]byte(strconv.Itoa(userID) + ":" + domain))
+	return "_swiftpost." + domain, "swiftpost-verification=" + hex.EncodeToString(sum[:16])
+}
+
+// domainVerification 自定义域名的验证状态和需要添加的 DNS 记录，没有设置域名时返回 nil
+func domainVerification(user *models.User) map[string]interface{} {
+	if user.CustomDomain == "" {
+		return nil
+	}
+	
+	name, value := domainVerificationRecord(user.ID, user.CustomDomain)
+	return map[string]interface{}{
+		"verified": user.CustomDomainVerified,
+		"type":     "TXT",
+		"name":     name,
+		"value":    value,
+	}
+}
+
+// GetDomainHandler 获取自定义域名及其验证状态
+func GetDomainHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(int)
+	
+	user, err := models.GetDB().Users().GetByID(userID)
+	if err != nil {
+		respondJSON(w, http.StatusNotFound, map[string]interface{}{
+			"success": false,
+			"message": "用户不存在",
+		})
+		return
+	}
+	
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success":      true,
+		"domain":       user.CustomDomain,
+		"verification": domainVerification(user),
+	})
+}
+
+// VerifyDomainHandler 查询 DNS TXT 记录验证自定义域名，验证通过后才会为该域名申请证书
+func VerifyDomainHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(int)
+	db := models.GetDB()
+	
+	user, err := db.Users().GetByID(userID)
+	if err != nil {
+		respondJSON(w, http.StatusNotFound, map[string]interface{}{
+			"success": false,
+			"message": "用户不存在",
+		})
+		return
+	}
+	if user.CustomDomain == "" {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "尚未设置自定义域名",
+		})
+		return
+	}
+	
+	if !user.CustomDomainVerified {
+		name, value := domainVerificationRecord(user.ID, user.CustomDomain)
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+		
+		records, err := lookupTXT(ctx, name)
+		var dnsErr *net.DNSError
+		if err != nil && !(errors.As(err, &dnsErr) && dnsErr.IsNotFound) {
+			utils.WarnContext(r.Context(), "查询域名 %s 的验证记录失败: %v", user.CustomDomain, err)
+			respondJSON(w, http.StatusBadGateway, map[string]interface{}{
+				"success": false,
+				"message": "DNS 查询失败，请稍后重试",
+			})
+			return
+		}
+		
+		found := false
+		for _, record := range records {
+			if record == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"success":      false,
+				"message":      "未找到验证记录，DNS 记录生效可能需要几分钟",
+				"verification": domainVerification(user),
+			})
+			return
+		}
+		
+		if err := db.Users().SetCustomDomainVerified(user.ID, user.CustomDomain); err != nil {
+			utils.ErrorContext(r.Context(), "更新自定义域名验证状态失败: %v", err)
+			respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+				"success": false,
+				"message": "验证域名失败",
+			})
+			return
+		}
+		user.CustomDomainVerified = true
+		utils.InfoContext(r.Context(), "用户 %d 验证了自定义域名 %s", user.ID, user.CustomDomain)
+	}
+	
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success":      true,
+		"message":      "域名验证成功",
+		"domain":       user.CustomDomain,
+		"verification": domainVerification(user),
+	})
+}
@@ -11,7 +11,6 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -35,7 +34,7 @@ func SendEmailHandler(w http.ResponseWriter, r *http.Request) {
 	
 	// 解析 multipart/form-data 请求
 	if err := r.ParseMultipartForm(32 << 20); err != nil { // 32MB
-		utils.Error("解析表单数据失败: %v", err)
+		utils.ErrorContext(r.Context(), "解析表单数据失败: %v", err)
 		respondJSON(w, http.StatusBadRequest, EmailResponse{
 			Success: false,
 			Message: "请求数据太大或格式错误",
@@ -58,9 +57,9 @@ func SendEmailHandler(w http.ResponseWriter, r *http.Request) {
 	
 	// 获取发件人信息
 	db := models.GetDB()
-	sender, err := models.GetUserByID(db, userID)
+	sender, err := db.Users().GetByID(userID)
 	if err != nil {
-		utils.Error("获取发件人信息失败: %v", err)
+		utils.ErrorContext(r.Context(), "获取发件人信息失败: %v", err)
 		respondJSON(w, http.StatusInternalServerError, EmailResponse{
 			Success: false,
 			Message: "服务器内部错误",
@@ -69,7 +68,7 @@ func SendEmailHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	// 查找收件人
-	recipient, err := models.GetUserByEmail(db, to)
+	recipient, err := db.Users().GetByEmail(to)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			respondJSON(w, http.StatusBadRequest, EmailResponse{
@@ -78,7 +77,7 @@ func SendEmailHandler(w http.ResponseWriter, r *http.Request) {
 			})
 			return
 		}
-		utils.Error("查找收件人失败: %v", err)
+		utils.ErrorContext(r.Context(), "查找收件人失败: %v", err)
 		respondJSON(w, http.StatusInternalServerError, EmailResponse{
 			Success: false,
 			Message: "服务器内部错误",
@@ -104,12 +103,13 @@ func SendEmailHandler(w http.ResponseWriter, r *http.Request) {
 	
 	// 处理附件
 	hasAttachment := false
+	var filePath string
 	file, handler, err := r.FormFile("attachment")
 	if err == nil {
 		defer file.Close()
 		
 		// 检查文件大小
-		config, _ := utils.LoadConfig("config.json")
+		config := utils.GetConfig()
 		if handler.Size > config.Email.MaxEmailSize {
 			respondJSON(w, http.StatusBadRequest, EmailResponse{
 				Success: false,
@@ -121,7 +121,7 @@ func SendEmailHandler(w http.ResponseWriter, r *http.Request) {
 		// 创建附件目录
 		attachmentDir := config.Email.AttachmentPath
 		if err := os.MkdirAll(attachmentDir, 0755); err != nil {
-			utils.Error("创建附件目录失败: %v", err)
+			utils.ErrorContext(r.Context(), "创建附件目录失败: %v", err)
 			respondJSON(w, http.StatusInternalServerError, EmailResponse{
 				Success: false,
 				Message: "服务器内部错误",
@@ -132,12 +132,12 @@ func SendEmailHandler(w http.ResponseWriter, r *http.Request) {
 		// 生成唯一文件名
 		fileExt := filepath.Ext(handler.Filename)
 		fileName := uuid.New().String() + fileExt
-		filePath := filepath.Join(attachmentDir, fileName)
+		filePath = filepath.Join(attachmentDir, fileName)
 		
 		// 保存文件
 		dst, err := os.Create(filePath)
 		if err != nil {
-			utils.Error("创建文件失败: %v", err)
+			utils.ErrorContext(r.Context(), "创建文件失败: %v", err)
 			respondJSON(w, http.StatusInternalServerError, EmailResponse{
 				Success: false,
 				Message: "服务器内部错误",
@@ -147,7 +147,7 @@ func SendEmailHandler(w http.ResponseWriter, r *http.Request) {
 		defer dst.Close()
 		
 		if _, err := io.Copy(dst, file); err != nil {
-			utils.Error("保存文件失败: %v", err)
+			utils.ErrorContext(r.Context(), "保存文件失败: %v", err)
 			respondJSON(w, http.StatusInternalServerError, EmailResponse{
 				Success: false,
 				Message: "服务器内部错误",
@@ -160,9 +160,9 @@ func SendEmailHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	// 保存邮件到数据库
-	emailID, err := models.CreateEmail(db, email)
+	emailID, err := db.Emails().Create(email)
 	if err != nil {
-		utils.Error("保存邮件失败: %v", err)
+		utils.ErrorContext(r.Context(), "保存邮件失败: %v", err)
 		respondJSON(w, http.StatusInternalServerError, EmailResponse{
 			Success: false,
 			Message: "发送邮件失败",
@@ -181,22 +181,22 @@ func SendEmailHandler(w http.ResponseWriter, r *http.Request) {
 			MimeType: handler.Header.Get("Content-Type"),
 		}
 		
-		if _, err := models.CreateAttachment(db, attachment); err != nil {
-			utils.Error("保存附件信息失败: %v", err)
+		if _, err := db.Attachments().Create(attachment); err != nil {
+			utils.ErrorContext(r.Context(), "保存附件信息失败: %v", err)
 			// 继续执行，不返回错误
 		}
 		
 		// 更新用户存储使用量
 		sender.StorageUsed += handler.Size
-		if err := models.UpdateUserStorage(db, sender.ID, sender.StorageUsed); err != nil {
-			utils.Error("更新存储使用量失败: %v", err)
+		if err := db.Users().UpdateStorage(sender.ID, sender.StorageUsed); err != nil {
+			utils.ErrorContext(r.Context(), "更新存储使用量失败: %v", err)
 		}
 	}
 	
-	utils.Info("邮件发送: %s -> %s (主题: %s)", sender.Email, recipient.Email, subject)
+	utils.InfoContext(r.Context(), "邮件发送: %s -> %s (主题: %s)", sender.Email, recipient.Email, subject)
 	
 	// 通过WebSocket通知收件人
-	go notifyNewEmail(recipient.ID, emailID)
+	go notifyNewEmail(recipient.ID, int(emailID))
 	
 	respondJSON(w, http.StatusOK, EmailResponse{
 		Success: true,
@@ -214,24 +214,18 @@ func GetEmailsHandler(w http.ResponseWriter, r *http.Request) {
 		folder = "inbox"
 	}
 	
-	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
-	if page < 1 {
-		page = 1
-	}
-	
-	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
-	if limit < 1 || limit > 100 {
-		limit = 20
+	pageReq, page, err := parsePage(r)
+	if err != nil {
+		respondInvalidCursor(w)
+		return
 	}
 	
-	offset := (page - 1) * limit
-	
 	db := models.GetDB()
 	
 	// 获取邮件列表
-	emails, err := models.GetEmailsByRecipient(db, userID, limit, offset, folder)
+	emails, pageInfo, err := db.Emails().ListByFolder(userID, folder, pageReq)
 	if err != nil {
-		utils.Error("获取邮件列表失败: %v", err)
+		utils.ErrorContext(r.Context(), "获取邮件列表失败: %v", err)
 		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
 			"success": false,
 			"message": "获取邮件列表失败",
@@ -240,38 +234,25 @@ func GetEmailsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	// 获取总数
-	total, err := models.CountEmailsByRecipient(db, userID, folder)
+	total, err := db.Emails().CountByFolder(userID, folder)
 	if err != nil {
-		utils.Error("统计邮件数量失败: %v", err)
+		utils.ErrorContext(r.Context(), "统计邮件数量失败: %v", err)
 		total = len(emails)
 	}
 	
-	// 获取发件人姓名
 	emailList := make([]map[string]interface{}, len(emails))
 	for i, email := range emails {
-		sender, err := models.GetUserByID(db, email.SenderID)
-		senderName := email.SenderEmail
-		if err == nil {
-			senderName = sender.Username
-		}
-		
-		recipient, err := models.GetUserByID(db, email.RecipientID)
-		recipientName := email.RecipientEmail
-		if err == nil {
-			recipientName = recipient.Username
-		}
-		
 		emailList[i] = map[string]interface{}{
 			"id":              email.ID,
 			"uuid":            email.UUID,
 			"sender_id":       email.SenderID,
 			"sender_email":    email.SenderEmail,
-			"sender_name":     senderName,
+			"sender_name":     email.SenderName,
 			"recipient_id":    email.RecipientID,
 			"recipient_email": email.RecipientEmail,
-			"recipient_name":  recipientName,
+			"recipient_name":  email.RecipientName,
 			"subject":         email.Subject,
-			"body_preview":    getBodyPreview(email.Body),
+			"body_preview":    email.Preview,
 			"is_read":         email.IsRead,
 			"is_starred":      email.IsStarred,
 			"has_attachment":  email.HasAttachment,
@@ -281,15 +262,10 @@ func GetEmailsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	respondJSON(w, http.StatusOK, map[string]interface{}{
-		"success": true,
-		"emails":  emailList,
-		"pagination": map[string]interface{}{
-			"page":       page,
-			"limit":      limit,
-			"total":      total,
-			"total_page": (total + limit - 1) / limit,
-		},
-		"folder": folder,
+		"success":    true,
+		"emails":     emailList,
+		"pagination": paginationResponse(pageReq, page, total, pageInfo),
+		"folder":     folder,
 	})
 }
 
@@ -308,7 +284,7 @@ func GetEmailHandler(w http.ResponseWriter, r *http.Request) {
 	db := models.GetDB()
 	
 	// 获取邮件
-	email, err := models.GetEmailByID(db, emailID)
+	email, err := db.Emails().GetByID(emailID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			respondJSON(w, http.StatusNotFound, map[string]interface{}{
@@ -317,7 +293,7 @@ func GetEmailHandler(w http.ResponseWriter, r *http.Request) {
 			})
 			return
 		}
-		utils.Error("获取邮件失败: %v", err)
+		utils.ErrorContext(r.Context(), "获取邮件失败: %v", err)
 		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
 			"success": false,
 			"message": "获取邮件失败",
@@ -336,16 +312,16 @@ func GetEmailHandler(w http.ResponseWriter, r *http.Request) {
 	
 	// 如果是收件人且未读，标记为已读
 	if email.RecipientID == userID && !email.IsRead {
-		if err := models.MarkAsRead(db, email.ID); err != nil {
-			utils.Error("标记邮件已读失败: %v", err)
+		if err := db.Emails().MarkAsRead(email.ID); err != nil {
+			utils.ErrorContext(r.Context(), "标记邮件已读失败: %v", err)
 		} else {
 			email.IsRead = true
 		}
 	}
 	
 	// 获取发件人和收件人信息
-	sender, _ := models.GetUserByID(db, email.SenderID)
-	recipient, _ := models.GetUserByID(db, email.RecipientID)
+	sender, _ := db.Users().GetByID(email.SenderID)
+	recipient, _ := db.Users().GetByID(email.RecipientID)
 	
 	senderName := email.SenderEmail
 	if sender != nil {
@@ -358,7 +334,7 @@ func GetEmailHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	// 获取附件
-	attachments, _ := models.GetAttachmentsByEmail(db, email.ID)
+	attachments, _ := db.Attachments().ListByEmail(email.ID)
 	attachmentList := make([]map[string]interface{}, len(attachments))
 	for i, att := range attachments {
 		attachmentList[i] = map[string]interface{}{
@@ -423,7 +399,7 @@ func UpdateEmailHandler(w http.ResponseWriter, r *http.Request) {
 	db := models.GetDB()
 	
 	// 获取邮件
-	email, err := models.GetEmailByID(db, emailID)
+	email, err := db.Emails().GetByID(emailID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			respondJSON(w, http.StatusNotFound, map[string]interface{}{
@@ -432,7 +408,7 @@ func UpdateEmailHandler(w http.ResponseWriter, r *http.Request) {
 			})
 			return
 		}
-		utils.Error("获取邮件失败: %v", err)
+		utils.ErrorContext(r.Context(), "获取邮件失败: %v", err)
 		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
 			"success": false,
 			"message": "获取邮件失败",
@@ -461,17 +437,9 @@ func UpdateEmailHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	if updated {
-		// 这里应该有一个 UpdateEmail 函数，简化处理
-		_, err = db.Exec(`
-			UPDATE emails SET 
-				is_draft = ?, 
-				is_starred = ?, 
-				updated_at = ?
-			WHERE id = ?
-		`, email.IsDraft, email.IsStarred, time.Now(), email.ID)
-		
+		err = db.Emails().UpdateFlags(email.ID, email.IsDraft, email.IsStarred)
 		if err != nil {
-			utils.Error("更新邮件失败: %v", err)
+			utils.ErrorContext(r.Context(), "更新邮件失败: %v", err)
 			respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
 				"success": false,
 				"message": "更新邮件失败",
@@ -503,7 +471,7 @@ func DeleteEmailHandler(w http.ResponseWriter, r *http.Request) {
 	db := models.GetDB()
 	
 	// 获取邮件
-	email, err := models.GetEmailByID(db, emailID)
+	email, err := db.Emails().GetByID(emailID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			respondJSON(w, http.StatusNotFound, map[string]interface{}{
@@ -512,7 +480,7 @@ func DeleteEmailHandler(w http.ResponseWriter, r *http.Request) {
 			})
 			return
 		}
-		utils.Error("获取邮件失败: %v", err)
+		utils.ErrorContext(r.Context(), "获取邮件失败: %v", err)
 		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
 			"success": false,
 			"message": "获取邮件失败",
@@ -531,8 +499,8 @@ func DeleteEmailHandler(w http.ResponseWriter, r *http.Request) {
 	
 	if permanent {
 		// 永久删除
-		if err := models.DeletePermanently(db, email.ID); err != nil {
-			utils.Error("永久删除邮件失败: %v", err)
+		if err := db.Emails().DeletePermanently(email.ID); err != nil {
+			utils.ErrorContext(r.Context(), "永久删除邮件失败: %v", err)
 			respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
 				"success": false,
 				"message": "删除邮件失败",
@@ -541,8 +509,8 @@ func DeleteEmailHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	} else {
 		// 移动到回收站
-		if err := models.MoveToTrash(db, email.ID); err != nil {
-			utils.Error("移动邮件到回收站失败: %v", err)
+		if err := db.Emails().MoveToTrash(email.ID); err != nil {
+			utils.ErrorContext(r.Context(), "移动邮件到回收站失败: %v", err)
 			respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
 				"success": false,
 				"message": "删除邮件失败",
@@ -572,7 +540,7 @@ func MarkAsReadHandler(w http.ResponseWriter, r *http.Request) {
 	db := models.GetDB()
 	
 	// 获取邮件
-	email, err := models.GetEmailByID(db, emailID)
+	email, err := db.Emails().GetByID(emailID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			respondJSON(w, http.StatusNotFound, map[string]interface{}{
@@ -581,7 +549,7 @@ func MarkAsReadHandler(w http.ResponseWriter, r *http.Request) {
 			})
 			return
 		}
-		utils.Error("获取邮件失败: %v", err)
+		utils.ErrorContext(r.Context(), "获取邮件失败: %v", err)
 		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
 			"success": false,
 			"message": "获取邮件失败",
@@ -599,8 +567,8 @@ func MarkAsReadHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	// 标记为已读
-	if err := models.MarkAsRead(db, email.ID); err != nil {
-		utils.Error("标记邮件已读失败: %v", err)
+	if err := db.Emails().MarkAsRead(email.ID); err != nil {
+		utils.ErrorContext(r.Context(), "标记邮件已读失败: %v", err)
 		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
 			"success": false,
 			"message": "标记邮件失败",
@@ -629,7 +597,7 @@ func ToggleStarHandler(w http.ResponseWriter, r *http.Request) {
 	db := models.GetDB()
 	
 	// 获取邮件
-	email, err := models.GetEmailByID(db, emailID)
+	email, err := db.Emails().GetByID(emailID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			respondJSON(w, http.StatusNotFound, map[string]interface{}{
@@ -638,7 +606,7 @@ func ToggleStarHandler(w http.ResponseWriter, r *http.Request) {
 			})
 			return
 		}
-		utils.Error("获取邮件失败: %v", err)
+		utils.ErrorContext(r.Context(), "获取邮件失败: %v", err)
 		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
 			"success": false,
 			"message": "获取邮件失败",
@@ -656,8 +624,8 @@ func ToggleStarHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	// 切换星标状态
-	if err := models.ToggleStar(db, email.ID); err != nil {
-		utils.Error("切换星标状态失败: %v", err)
+	if err := db.Emails().ToggleStar(email.ID); err != nil {
+		utils.ErrorContext(r.Context(), "切换星标状态失败: %v", err)
 		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
 			"success": false,
 			"message": "标记邮件失败",
@@ -666,7 +634,7 @@ func ToggleStarHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	// 获取更新后的状态
-	updatedEmail, _ := models.GetEmailByID(db, emailID)
+	updatedEmail, _ := db.Emails().GetByID(emailID)
 	
 	respondJSON(w, http.StatusOK, map[string]interface{}{
 		"success": true,
@@ -679,7 +647,7 @@ func UploadAttachmentHandler(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value("user_id").(int)
 	
 	if err := r.ParseMultipartForm(32 << 20); err != nil { // 32MB
-		utils.Error("解析表单数据失败: %v", err)
+		utils.ErrorContext(r.Context(), "解析表单数据失败: %v", err)
 		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
 			"success": false,
 			"message": "请求数据太大或格式错误",
@@ -690,7 +658,7 @@ func UploadAttachmentHandler(w http.ResponseWriter, r *http.Request) {
 	// 获取文件
 	file, handler, err := r.FormFile("file")
 	if err != nil {
-		utils.Error("获取文件失败: %v", err)
+		utils.ErrorContext(r.Context(), "获取文件失败: %v", err)
 		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
 			"success": false,
 			"message": "没有上传文件",
@@ -700,7 +668,7 @@ func UploadAttachmentHandler(w http.ResponseWriter, r *http.Request) {
 	defer file.Close()
 	
 	// 检查文件大小
-	config, _ := utils.LoadConfig("config.json")
+	config := utils.GetConfig()
 	if handler.Size > config.Email.MaxEmailSize {
 		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
 			"success": false,
@@ -711,9 +679,9 @@ func UploadAttachmentHandler(w http.ResponseWriter, r *http.Request) {
 	
 	// 检查用户存储空间
 	db := models.GetDB()
-	user, err := models.GetUserByID(db, userID)
+	user, err := db.Users().GetByID(userID)
 	if err != nil {
-		utils.Error("获取用户信息失败: %v", err)
+		utils.ErrorContext(r.Context(), "获取用户信息失败: %v", err)
 		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
 			"success": false,
 			"message": "服务器内部错误",
@@ -732,7 +700,7 @@ func UploadAttachmentHandler(w http.ResponseWriter, r *http.Request) {
 	// 创建附件目录
 	attachmentDir := config.Email.AttachmentPath
 	if err := os.MkdirAll(attachmentDir, 0755); err != nil {
-		utils.Error("创建附件目录失败: %v", err)
+		utils.ErrorContext(r.Context(), "创建附件目录失败: %v", err)
 		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
 			"success": false,
 			"message": "服务器内部错误",
@@ -748,7 +716,7 @@ func UploadAttachmentHandler(w http.ResponseWriter, r *http.Request) {
 	// 保存文件
 	dst, err := os.Create(filePath)
 	if err != nil {
-		utils.Error("创建文件失败: %v", err)
+		utils.ErrorContext(r.Context(), "创建文件失败: %v", err)
 		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
 			"success": false,
 			"message": "服务器内部错误",
@@ -758,7 +726,7 @@ func UploadAttachmentHandler(w http.ResponseWriter, r *http.Request) {
 	defer dst.Close()
 	
 	if _, err := io.Copy(dst, file); err != nil {
-		utils.Error("保存文件失败: %v", err)
+		utils.ErrorContext(r.Context(), "保存文件失败: %v", err)
 		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
 			"success": false,
 			"message": "服务器内部错误",
@@ -768,8 +736,8 @@ func UploadAttachmentHandler(w http.ResponseWriter, r *http.Request) {
 	
 	// 更新用户存储使用量
 	user.StorageUsed += handler.Size
-	if err := models.UpdateUserStorage(db, user.ID, user.StorageUsed); err != nil {
-		utils.Error("更新存储使用量失败: %v", err)
+	if err := db.Users().UpdateStorage(user.ID, user.StorageUsed); err != nil {
+		utils.ErrorContext(r.Context(), "更新存储使用量失败: %v", err)
 	}
 	
 	respondJSON(w, http.StatusOK, map[string]interface{}{
@@ -793,7 +761,7 @@ func DownloadAttachmentHandler(w http.ResponseWriter, r *http.Request) {
 	db := models.GetDB()
 	
 	// 获取附件信息
-	attachment, err := models.GetAttachmentByUUID(db, attachmentUUID)
+	attachment, err := db.Attachments().GetByUUID(attachmentUUID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			respondJSON(w, http.StatusNotFound, map[string]interface{}{
@@ -802,7 +770,7 @@ func DownloadAttachmentHandler(w http.ResponseWriter, r *http.Request) {
 			})
 			return
 		}
-		utils.Error("获取附件信息失败: %v", err)
+		utils.ErrorContext(r.Context(), "获取附件信息失败: %v", err)
 		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
 			"success": false,
 			"message": "服务器内部错误",
@@ -811,9 +779,9 @@ func DownloadAttachmentHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	// 获取邮件
-	email, err := models.GetEmailByID(db, attachment.EmailID)
+	email, err := db.Emails().GetByID(attachment.EmailID)
 	if err != nil {
-		utils.Error("获取邮件失败: %v", err)
+		utils.ErrorContext(r.Context(), "获取邮件失败: %v", err)
 		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
 			"success": false,
 			"message": "服务器内部错误",
@@ -849,34 +817,6 @@ func DownloadAttachmentHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // 辅助函数
-func getBodyPreview(body string) string {
-	// 移除HTML标签
-	plainText := stripHTML(body)
-	
-	// 截取前100个字符
-	if len(plainText) > 100 {
-		return plainText[:100] + "..."
-	}
-	return plainText
-}
-
-func stripHTML(html string) string {
-	var result strings.Builder
-	var inTag bool
-	
-	for _, c := range html {
-		if c == '<' {
-			inTag = true
-		} else if c == '>' {
-			inTag = false
-		} else if !inTag {
-			result.WriteRune(c)
-		}
-	}
-	
-	return result.String()
-}
-
 func getTimeAgo(t time.Time) string {
 	duration := time.Since(t)
 	
@@ -896,7 +836,7 @@ func getTimeAgo(t time.Time) string {
 }
 
 func notifyNewEmail(recipientID, emailID int) {
-	// 这里应该通过WebSocket通知用户有新邮件
-	// 简化实现，实际应用中应该发送WebSocket消息
+	// 收件人在线时通过WebSocket通知，离线时发送Web Push
 	utils.Debug("新邮件通知: 收件人ID=%d, 邮件ID=%d", recipientID, emailID)
+	NotifyNewEmail(models.GetDB(), emailID)
 }
\ No newline at end of file
@@ -3,9 +3,17 @@ package handlers
 import (
 	"SwiftPost/models"
 	"SwiftPost/utils"
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
+	"regexp"
 	"runtime"
+	"strconv"
 	"time"
 )
 
@@ -15,9 +23,16 @@ type HealthCheckResponse struct {
 	Timestamp time.Time              `json:"timestamp"`
 	Version   string                 `json:"version"`
 	Services  map[string]ServiceInfo `json:"services"`
+	Database  *DatabaseHealth        `json:"database,omitempty"`
 	System    SystemInfo             `json:"system"`
 }
 
+// DatabaseHealth 数据库文件大小和各维护任务最近一次的执行结果
+type DatabaseHealth struct {
+	*models.DatabaseStats
+	Maintenance map[string]*models.MaintenanceRun `json:"maintenance"`
+}
+
 // ServiceInfo 服务信息
 type ServiceInfo struct {
 	Status  string `json:"status"`
@@ -64,6 +79,26 @@ func HealthCheckHandler(w http.ResponseWriter, r *http.Request) {
 		response.Services["database"] = ServiceInfo{
 			Status: "healthy",
 		}
+		
+		stats, err := models.GetDatabaseStats(db)
+		if err == nil {
+			response.Database = &DatabaseHealth{DatabaseStats: stats}
+			response.Database.Maintenance, err = models.GetMaintenanceRuns(db)
+		}
+		if err != nil {
+			utils.ErrorContext(r.Context(), "获取数据库状态失败: %v", err)
+		}
+		
+		// 最近一次完整性检查失败时数据库可能已损坏
+		if response.Database != nil {
+			if check, ok := response.Database.Maintenance[models.MaintenanceIntegrityCheck]; ok && !check.OK {
+				response.Status = "degraded"
+				response.Services["database"] = ServiceInfo{
+					Status:  "unhealthy",
+					Message: check.Result,
+				}
+			}
+		}
 	}
 	
 	// 检查磁盘空间（简化版）
@@ -145,38 +180,29 @@ func GetSystemStatsHandler(w http.ResponseWriter, r *http.Request) {
 	db := models.GetDB()
 	
 	// 获取用户统计
-	var totalUsers, activeUsers, adminUsers int
-	db.QueryRow("SELECT COUNT(*) FROM users").Scan(&totalUsers)
-	db.QueryRow("SELECT COUNT(*) FROM users WHERE is_active = 1").Scan(&activeUsers)
-	db.QueryRow("SELECT COUNT(*) FROM users WHERE is_admin = 1").Scan(&adminUsers)
+	userTotals, err := db.Users().Totals()
+	if err != nil {
+		utils.ErrorContext(r.Context(), "获取用户统计失败: %v", err)
+		userTotals = &models.UserTotals{}
+	}
 	
 	// 获取今日新用户
-	var newToday int
-	today := time.Now().Format("2006-01-02")
-	db.QueryRow("SELECT COUNT(*) FROM users WHERE DATE(created_at) = ?", today).Scan(&newToday)
+	today := startOfDay(time.Now())
+	newToday, _ := db.Users().CountCreatedSince(today)
 	
 	// 获取本周新用户
-	var newThisWeek int
-	weekStart := time.Now().AddDate(0, 0, -int(time.Now().Weekday()))
-	db.QueryRow("SELECT COUNT(*) FROM users WHERE created_at >= ?", weekStart).Scan(&newThisWeek)
-	
-	// 获取邮件统计
-	var totalEmails, unreadEmails int
-	db.QueryRow("SELECT COUNT(*) FROM emails WHERE is_deleted = 0").Scan(&totalEmails)
-	db.QueryRow("SELECT COUNT(*) FROM emails WHERE is_read = 0 AND is_deleted = 0").Scan(&unreadEmails)
+	weekStart := today.AddDate(0, 0, -int(today.Weekday()))
+	newThisWeek, _ := db.Users().CountCreatedSince(weekStart)
 	
-	// 获取今日发送邮件
-	var sentToday int
-	db.QueryRow("SELECT COUNT(*) FROM emails WHERE DATE(created_at) = ? AND is_draft = 0", today).Scan(&sentToday)
+	// 获取邮件统计，Since 为今日发送的邮件
+	emailTotals, err := db.Emails().Totals(today)
+	if err != nil {
+		utils.ErrorContext(r.Context(), "获取邮件统计失败: %v", err)
+		emailTotals = &models.EmailTotals{}
+	}
 	
 	// 获取今日接收邮件
-	var receivedToday int
-	db.QueryRow(`
-		SELECT COUNT(*) FROM emails 
-		WHERE DATE(created_at) = ? AND is_draft = 0 AND recipient_id IN (
-			SELECT id FROM users WHERE is_active = 1
-		)
-	`, today).Scan(&receivedToday)
+	receivedToday, _ := db.Emails().CountDeliveredSince(today)
 	
 	// 获取内存统计
 	var memStats runtime.MemStats
@@ -186,16 +212,16 @@ func GetSystemStatsHandler(w http.ResponseWriter, r *http.Request) {
 		Success: true,
 		Stats: SystemStats{
 			Users: UserStats{
-				Total:       totalUsers,
-				Active:      activeUsers,
-				Admins:      adminUsers,
+				Total:       userTotals.Total,
+				Active:      userTotals.Active,
+				Admins:      userTotals.Admins,
 				NewToday:    newToday,
 				NewThisWeek: newThisWeek,
 			},
 			Emails: EmailStats{
-				Total:         totalEmails,
-				Unread:        unreadEmails,
-				SentToday:     sentToday,
+				Total:         emailTotals.Total,
+				Unread:        emailTotals.Unread,
+				SentToday:     emailTotals.Since,
 				ReceivedToday: receivedToday,
 			},
 			System: RuntimeStats{
@@ -216,34 +242,90 @@ func GetSystemStatsHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
-// MonitoringMiddleware 监控中间件
+// httpLog HTTP 访问日志
+var httpLog = utils.NewLogger("http")
+
+// requestIDPattern 接受的 X-Request-ID 格式，前面的代理已经生成请求ID时沿用它，便于跨服务关联日志
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// newRequestID 生成随机的请求ID
+func newRequestID() string {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b)
+}
+
+// MonitoringMiddleware 监控中间件，为每个请求分配请求ID并记录访问日志。请求ID通过 X-Request-ID
+// 响应头返回，并放入请求的 context，处理请求时用 utils.InfoContext(r.Context(), ...) 等输出的日志都带有该ID
 func MonitoringMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 		
+		requestID := r.Header.Get("X-Request-ID")
+		if !requestIDPattern.MatchString(requestID) {
+			requestID = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", requestID)
+		r = r.WithContext(utils.WithRequestID(r.Context(), requestID))
+		
 		// 创建包装器来捕获状态码
 		rw := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
 		
 		next.ServeHTTP(rw, r)
 		
-		duration := time.Since(start).Seconds()
-		
-		// 记录请求日志
-		utils.Info("请求: %s %s %d %.3fs",
-			r.Method, r.URL.Path, rw.statusCode, duration)
-		
-		// 这里可以添加更多的监控逻辑
-		// 比如记录到数据库、发送到监控系统等
+		level := utils.INFO
+		if rw.statusCode >= 500 {
+			level = utils.ERROR
+		}
+		httpLog.Log(r.Context(), level, "请求",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", rw.statusCode),
+			slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.Int64("bytes", rw.bytes),
+			slog.String("remote", utils.ClientIP(r)),
+		)
 	}
 }
 
-// responseWriter 包装ResponseWriter来捕获状态码
+// responseWriter 包装ResponseWriter来捕获状态码和响应大小
 type responseWriter struct {
 	http.ResponseWriter
 	statusCode int
+	bytes      int64
 }
 
 func (rw *responseWriter) WriteHeader(code int) {
 	rw.statusCode = code
 	rw.ResponseWriter.WriteHeader(code)
-}
\ No newline at end of file
+}
+
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytes += int64(n)
+	return n, err
+}
+
+// Hijack WebSocket 升级需要接管底层连接
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := rw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("ResponseWriter 不支持 Hijack")
+	}
+	rw.statusCode = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
+// Flush 支持流式响应
+func (rw *responseWriter) Flush() {
+	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap 供 http.ResponseController 访问原始的 ResponseWriter
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"SwiftPost/models"
+	"SwiftPost/utils"
+	"database/sql"
+	"net/http"
+	"time"
+	
+	"github.com/gorilla/mux"
+)
+
+// JWKSHandler 公开当前的JWT验证公钥，其他服务可以据此验证 SwiftPost 签发的令牌
+func JWKSHandler(w http.ResponseWriter, r *http.Request) {
+	// 新密钥至少提前一小时发布，缓存时间不能超过这个间隔
+	w.Header().Set("Cache-Control", "public, max-age=600")
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": utils.PublicJWKS(),
+	})
+}
+
+// signingKeyToMap 签名密钥列表的响应格式，不包含私钥
+func signingKeyToMap(key *utils.SigningKey, now time.Time) map[string]interface{} {
+	status := "active"
+	switch {
+	case key.ActivatesAt.After(now):
+		status = "pending"
+	case !key.RetiresAt.After(now):
+		status = "retired"
+	}
+	
+	return map[string]interface{}{
+		"kid":          key.KeyID,
+		"algorithm":    key.Algorithm,
+		"status":       status,
+		"activates_at": key.ActivatesAt.Format("2006-01-02 15:04:05"),
+		"retires_at":   key.RetiresAt.Format("2006-01-02 15:04:05"),
+		"expires_at":   key.ExpiresAt.Format("2006-01-02 15:04:05"),
+	}
+}
+
+// AdminGetSigningKeysHandler 获取JWT签名密钥列表
+func AdminGetSigningKeysHandler(w http.ResponseWriter, r *http.Request) {
+	if !hasPermission(r, models.PermSystemManage) {
+		respondJSON(w, http.StatusForbidden, map[string]interface{}{
+			"success": false,
+			"message": "需要管理员权限",
+		})
+		return
+	}
+	
+	db := models.GetDB()
+	keys, err := models.GetSigningKeys(db)
+	if err != nil {
+		authLog.ErrorContext(r.Context(), "获取签名密钥失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "获取签名密钥失败",
+		})
+		return
+	}
+	
+	now := time.Now()
+	keyList := make([]map[string]interface{}, len(keys))
+	for i, key := range keys {
+		keyList[i] = signingKeyToMap(key, now)
+	}
+	
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"keys":    keyList,
+	})
+}
+
+// AdminRotateSigningKeysHandler 立即轮换签名密钥，之前签发的令牌在宽限期内仍然有效
+func AdminRotateSigningKeysHandler(w http.ResponseWriter, r *http.Request) {
+	adminID := r.Context().Value("user_id").(int)
+	if !hasPermission(r, models.PermSystemManage) {
+		respondJSON(w, http.StatusForbidden, map[string]interface{}{
+			"success": false,
+			"message": "需要管理员权限",
+		})
+		return
+	}
+	
+	config := utils.GetConfig()
+	db := models.GetDB()
+	key, err := models.RotateSigningKeysNow(db, config)
+	if err != nil {
+		authLog.ErrorContext(r.Context(), "轮换签名密钥失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "轮换签名密钥失败",
+		})
+		return
+	}
+	
+	authLog.InfoContext(r.Context(), "管理员 %d 轮换了JWT签名密钥，新密钥 %s", adminID, key.KeyID)
+	
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "签名密钥已轮换",
+		"key":     signingKeyToMap(key, time.Now()),
+	})
+}
+
+// AdminRevokeSigningKeyHandler 删除签名密钥，用它签发的所有令牌立即失效
+func AdminRevokeSigningKeyHandler(w http.ResponseWriter, r *http.Request) {
+	adminID := r.Context().Value("user_id").(int)
+	if !hasPermission(r, models.PermSystemManage) {
+		respondJSON(w, http.StatusForbidden, map[string]interface{}{
+			"success": false,
+			"message": "需要管理员权限",
+		})
+		return
+	}
+	
+	kid := mux.Vars(r)["kid"]
+	config := utils.GetConfig()
+	db := models.GetDB()
+	if err := models.RevokeSigningKey(db, config, kid); err != nil {
+		if err == sql.ErrNoRows {
+			respondJSON(w, http.StatusNotFound, map[string]interface{}{
+				"success": false,
+				"message": "签名密钥不存在",
+			})
+			return
+		}
+		authLog.ErrorContext(r.Context(), "撤销签名密钥失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "撤销签名密钥失败",
+		})
+		return
+	}
+	
+	authLog.WarnContext(r.Context(), "管理员 %d 撤销了JWT签名密钥 %s", adminID, kid)
+	
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "签名密钥已撤销，使用该密钥签发的令牌已失效",
+	})
+}
@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"SwiftPost/models"
+	"SwiftPost/utils"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// ldapSyncMu 避免定时同步和手动同步同时运行
+var ldapSyncMu sync.Mutex
+
+// authenticateLDAP 在目录中按邮箱查找用户并以该用户身份绑定验证密码，成功后返回同步后的本地账号
+// 目录中不存在该用户时返回 utils.ErrLDAPUserNotFound，调用方可以继续尝试本地密码
+func authenticateLDAP(db *models.Database, config *utils.Config, email, password string) (*models.User, error) {
+	dir, err := utils.DialLDAP(config)
+	if err != nil {
+		return nil, err
+	}
+	defer dir.Close()
+	
+	entry, err := dir.FindUser(strings.ToLower(strings.TrimSpace(email)))
+	if err != nil {
+		return nil, err
+	}
+	
+	if err := dir.Authenticate(entry, password); err != nil {
+		return nil, err
+	}
+	
+	user, _, err := provisionLDAPUser(db, config, entry)
+	if err != nil {
+		return nil, err
+	}
+	
+	return user, nil
+}
+
+// provisionLDAPUser 将目录条目同步到本地账号：按已关联的身份或邮箱查找，必要时创建，并同步用户名、邮箱和管理员权限
+// 第二个返回值表示本地账号是否有新建或修改
+func provisionLDAPUser(db *models.Database, config *utils.Config, entry *utils.LDAPEntry) (*models.User, bool, error) {
+	issuer := models.LDAPIssuer(config)
+	preferred := entry.Username
+	if preferred == "" {
+		preferred = strings.SplitN(entry.Email, "@", 2)[0]
+	}
+	
+	var user *models.User
+	identity, err := models.GetUserIdentity(db, issuer, entry.UniqueID)
+	switch {
+	case err == nil:
+		user, err = db.Users().GetByID(identity.UserID)
+		if err != nil {
+			return nil, false, err
+		}
+	case err != sql.ErrNoRows:
+		return nil, false, err
+	default:
+		// 已有同邮箱的本地账号时直接关联，目录是权威来源
+		user, err = db.Users().GetByEmail(entry.Email)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, false, err
+		}
+		if user == nil {
+			if !config.LDAP.AutoCreateUsers {
+				return nil, false, errNoLinkedAccount
+			}
+			user, err = createExternalUser(db, preferred, entry.Email)
+			if err != nil {
+				return nil, false, err
+			}
+			authLog.Info("根据LDAP目录创建用户: %s (%s)", user.Username, user.Email)
+		}
+		
+		if _, err := models.CreateUserIdentity(db, user.ID, issuer, entry.UniqueID, entry.Email); err != nil {
+			return nil, false, err
+		}
+		authLog.Info("LDAP条目已关联到用户 %s: %s", user.Username, entry.DN)
+		return user, true, syncLDAPAttributes(db, config, user, entry, preferred)
+	}
+	
+	before := *user
+	if err := syncLDAPAttributes(db, config, user, entry, preferred); err != nil {
+		return nil, false, err
+	}
+	
+	changed := before.Username != user.Username || before.Email != user.Email || before.IsAdmin != user.IsAdmin
+	return user, changed, nil
+}
+
+// syncLDAPAttributes 用目录中的用户名、邮箱和组成员关系更新本地账号
+func syncLDAPAttributes(db *models.Database, config *utils.Config, user *models.User, entry *utils.LDAPEntry, preferred string) error {
+	changed := false
+	
+	// 目录中的用户名变更时重命名本地账号
+	if !usernameMatches(user.Username, preferred) {
+		username, err := uniqueUsername(db, preferred)
+		if err != nil {
+			return err
+		}
+		authLog.Info("根据LDAP目录重命名用户: %s -> %s", user.Username, username)
+		user.Username = username
+		changed = true
+	}
+	
+	if entry.Email != user.Email {
+		if _, err := db.Users().GetByEmail(entry.Email); err == sql.ErrNoRows {
+			authLog.Info("根据LDAP目录更新用户 %s 的邮箱: %s -> %s", user.Username, user.Email, entry.Email)
+			user.Email = entry.Email
+			changed = true
+		} else if err == nil {
+			authLog.Warn("LDAP用户 %s 的邮箱 %s 已被其他账号使用，跳过更新", entry.DN, entry.Email)
+		} else {
+			return err
+		}
+	}
+	
+	if config.LDAP.AdminGroupDN != "" {
+		isAdmin := entry.InGroup(config.LDAP.AdminGroupDN)
+		if isAdmin != user.IsAdmin {
+			authLog.Info("根据LDAP组同步管理员权限: %s is_admin=%v", user.Username, isAdmin)
+			user.IsAdmin = isAdmin
+			changed = true
+		}
+	}
+	
+	if !changed {
+		return nil
+	}
+	return db.Users().Update(user)
+}
+
+// SyncLDAPUsers 按目录同步本地账号：创建新用户，更新用户名、邮箱和管理员权限，停用已从目录中删除的用户
+// 有条目同步失败时不停用任何用户并返回错误
+func SyncLDAPUsers(db *models.Database, config *utils.Config) error {
+	ldapSyncMu.Lock()
+	defer ldapSyncMu.Unlock()
+	
+	dir, err := utils.DialLDAP(config)
+	if err != nil {
+		return err
+	}
+	entries, err := dir.ListUsers()
+	dir.Close()
+	if err != nil {
+		return err
+	}
+	
+	// 过滤条件配置错误时目录可能返回空结果，此时不能把所有目录用户都停用
+	if len(entries) == 0 {
+		authLog.Warn("LDAP目录未返回任何用户，跳过同步")
+		return nil
+	}
+	
+	// 在同步之前按目录唯一ID记录，单个条目同步失败时对应的账号不会被当作已从目录删除
+	seenSubjects := make(map[string]bool)
+	seenUsers := make(map[int]bool)
+	var updated, deactivated, failed int
+	for _, entry := range entries {
+		seenSubjects[entry.UniqueID] = true
+		user, changed, err := provisionLDAPUser(db, config, entry)
+		if err != nil {
+			if !errors.Is(err, errNoLinkedAccount) {
+				authLog.Error("同步LDAP用户 %s 失败: %v", entry.DN, err)
+				failed++
+			}
+			continue
+		}
+		seenUsers[user.ID] = true
+		if changed {
+			updated++
+		}
+	}
+	
+	// 本次同步有失败时目录或数据库可能处于异常状态，不停用任何用户，等下次同步
+	if failed > 0 {
+		authLog.Warn("LDAP同步有 %d 个用户失败，跳过停用", failed)
+		return fmt.Errorf("%d 个LDAP用户同步失败", failed)
+	}
+	
+	identities, err := models.GetUserIdentitiesByIssuer(db, models.LDAPIssuer(config))
+	if err != nil {
+		return err
+	}
+	for _, identity := range identities {
+		// 目录条目重建后唯一ID会变化，同一账号可能关联了多个目录身份
+		if seenSubjects[identity.Subject] || seenUsers[identity.UserID] {
+			continue
+		}
+		
+		user, err := db.Users().GetByID(identity.UserID)
+		if err != nil || !user.IsActive {
+			continue
+		}
+		
+		user.IsActive = false
+		if err := db.Users().Update(user); err != nil {
+			authLog.Error("停用LDAP用户 %s 失败: %v", user.Username, err)
+			continue
+		}
+		db.Sessions().RevokeAllForUser(user.ID)
+		DisconnectUser(user.ID)
+		deactivated++
+		authLog.Info("LDAP目录中已不存在该用户，已停用: %s (%s)", user.Username, user.Email)
+	}
+	
+	authLog.Info("LDAP同步完成: 目录用户 %d 个，新建或更新 %d 个，停用 %d 个", len(entries), updated, deactivated)
+	return nil
+}
+
+// AdminSyncLDAPHandler 管理员手动触发一次目录同步
+func AdminSyncLDAPHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(int)
+	
+	// 验证管理员权限
+	db := models.GetDB()
+	user, err := db.Users().GetByID(userID)
+	if err != nil || !hasPermission(r, models.PermSystemManage) {
+		respondJSON(w, http.StatusForbidden, map[string]interface{}{
+			"success": false,
+			"message": "需要管理员权限",
+		})
+		return
+	}
+	
+	config := utils.GetConfig()
+	if !config.LDAP.Enabled {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "未启用LDAP认证",
+		})
+		return
+	}
+	
+	if err := SyncLDAPUsers(db, config); err != nil {
+		authLog.ErrorContext(r.Context(), "LDAP同步失败: %v", err)
+		respondJSON(w, http.StatusBadGateway, map[string]interface{}{
+			"success": false,
+			"message": "LDAP同步失败，请检查目录服务器配置",
+		})
+		return
+	}
+	
+	authLog.InfoContext(r.Context(), "管理员 %s 手动执行了LDAP同步", user.Username)
+	
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "LDAP同步完成",
+	})
+}
@@ -0,0 +1,443 @@
+package handlers
+
+import (
+	"SwiftPost/models"
+	"SwiftPost/utils"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+const (
+	ldapStubBaseDN     = "dc=example,dc=com"
+	ldapStubServiceDN  = "cn=swiftpost,ou=services,dc=example,dc=com"
+	ldapStubServicePwd = "service-secret"
+	ldapStubAdminGroup = "cn=mail-admins,ou=groups,dc=example,dc=com"
+)
+
+// ldapStubEntry 目录中的一个条目，属性名使用小写
+type ldapStubEntry struct {
+	dn       string
+	password string
+	attrs    map[string][]string
+}
+
+// ldapStub 只实现 Bind、Search 和 Unbind 的 LDAP 服务器，过滤器支持 and/or/not/等于/存在
+type ldapStub struct {
+	listener net.Listener
+	
+	mu      sync.Mutex
+	entries map[string]*ldapStubEntry
+	binds   []string // 成功绑定的 DN
+}
+
+func newLDAPStub(t *testing.T) *ldapStub {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub := &ldapStub{listener: listener, entries: make(map[string]*ldapStubEntry)}
+	stub.put(ldapStubServiceDN, ldapStubServicePwd, map[string][]string{"objectclass": {"applicationProcess"}})
+	t.Cleanup(func() { listener.Close() })
+	
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go stub.serve(conn)
+		}
+	}()
+	return stub
+}
+
+func (s *ldapStub) url() string {
+	return "ldap://" + s.listener.Addr().String()
+}
+
+func (s *ldapStub) put(dn, password string, attrs map[string][]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[strings.ToLower(dn)] = &ldapStubEntry{dn: dn, password: password, attrs: attrs}
+}
+
+func (s *ldapStub) remove(dn string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, strings.ToLower(dn))
+}
+
+// putPerson 添加一个 inetOrgPerson 用户
+func (s *ldapStub) putPerson(uid, email, password string, groups ...string) string {
+	dn := "uid=" + uid + ",ou=people," + ldapStubBaseDN
+	s.put(dn, password, map[string][]string{
+		"objectclass": {"top", "inetOrgPerson"},
+		"uid":         {uid},
+		"mail":        {email},
+		"entryuuid":   {"uuid-" + uid},
+		"memberof":    groups,
+	})
+	return dn
+}
+
+func (s *ldapStub) boundDNs() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.binds...)
+}
+
+func (s *ldapStub) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		messageID := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+		
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			code := s.bind(op.Children[1].Data.String(), op.Children[2].Data.String())
+			conn.Write(ldapStubResponse(messageID, ldap.ApplicationBindResponse, code).Bytes())
+		case ldap.ApplicationSearchRequest:
+			for _, entry := range s.search(messageID, op) {
+				conn.Write(entry.Bytes())
+			}
+			conn.Write(ldapStubResponse(messageID, ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess).Bytes())
+		case ldap.ApplicationUnbindRequest:
+			return
+		default:
+			conn.Write(ldapStubResponse(messageID, ldap.ApplicationExtendedResponse, ldap.LDAPResultUnwillingToPerform).Bytes())
+		}
+	}
+}
+
+// bind 简单绑定，空DN和空密码为匿名绑定
+func (s *ldapStub) bind(dn, password string) uint16 {
+	if dn == "" && password == "" {
+		return ldap.LDAPResultSuccess
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[strings.ToLower(dn)]
+	if !ok || password == "" || entry.password != password {
+		return ldap.LDAPResultInvalidCredentials
+	}
+	s.binds = append(s.binds, entry.dn)
+	return ldap.LDAPResultSuccess
+}
+
+// search 返回匹配过滤器的条目，每个条目只包含请求的属性，属性名按请求中的写法返回
+func (s *ldapStub) search(messageID int64, op *ber.Packet) []*ber.Packet {
+	baseDN := strings.ToLower(op.Children[0].Data.String())
+	filter := op.Children[6]
+	var requested []string
+	for _, attr := range op.Children[7].Children {
+		requested = append(requested, attr.Data.String())
+	}
+	
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var results []*ber.Packet
+	for key, entry := range s.entries {
+		if !strings.HasSuffix(key, baseDN) || !ldapStubMatch(entry, filter) {
+			continue
+		}
+		attrs := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+		for _, name := range requested {
+			values, ok := entry.attrs[strings.ToLower(name)]
+			if !ok {
+				continue
+			}
+			attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+			attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+			set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+			for _, value := range values {
+				set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "Value"))
+			}
+			attr.AppendChild(set)
+			attrs.AppendChild(attr)
+		}
+		
+		result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+		result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.dn, "DN"))
+		result.AppendChild(attrs)
+		results = append(results, ldapStubEnvelope(messageID, result))
+	}
+	return results
+}
+
+func ldapStubMatch(entry *ldapStubEntry, filter *ber.Packet) bool {
+	switch filter.Tag {
+	case ldap.FilterAnd:
+		for _, child := range filter.Children {
+			if !ldapStubMatch(entry, child) {
+				return false
+			}
+		}
+		return true
+	case ldap.FilterOr:
+		for _, child := range filter.Children {
+			if ldapStubMatch(entry, child) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterNot:
+		return !ldapStubMatch(entry, filter.Children[0])
+	case ldap.FilterEqualityMatch:
+		values := entry.attrs[strings.ToLower(filter.Children[0].Data.String())]
+		for _, value := range values {
+			if strings.EqualFold(value, filter.Children[1].Data.String()) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterPresent:
+		return len(entry.attrs[strings.ToLower(filter.Data.String())]) > 0
+	default:
+		return false
+	}
+}
+
+func ldapStubEnvelope(messageID int64, op *ber.Packet) *ber.Packet {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "MessageID"))
+	packet.AppendChild(op)
+	return packet
+}
+
+func ldapStubResponse(messageID int64, tag ber.Tag, code uint16) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Response")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "ResultCode"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "MatchedDN"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "DiagnosticMessage"))
+	return ldapStubEnvelope(messageID, op)
+}
+
+func newLDAPTestEnv(t *testing.T) (*utils.Config, *models.Database, *ldapStub) {
+	t.Helper()
+	config, db := newTestEnv(t)
+	stub := newLDAPStub(t)
+	config.LDAP.Enabled = true
+	config.LDAP.URL = stub.url()
+	config.LDAP.BindDN = ldapStubServiceDN
+	config.LDAP.BindPassword = ldapStubServicePwd
+	config.LDAP.BaseDN = ldapStubBaseDN
+	config.LDAP.AdminGroupDN = ldapStubAdminGroup
+	return config, db, stub
+}
+
+func TestLDAPAuthenticate(t *testing.T) {
+	config, db, stub := newLDAPTestEnv(t)
+	aliceDN := stub.putPerson("alice", "Alice@Example.com", "alice-password")
+	
+	user, err := authenticateLDAP(db, config, "alice@example.com", "alice-password")
+	if err != nil {
+		t.Fatalf("正确的密码应通过验证: %v", err)
+	}
+	if user.Username != "alice" || user.Email != "alice@example.com" || user.IsAdmin {
+		t.Fatalf("创建的用户不正确: %+v", user)
+	}
+	if identity, err := models.GetUserIdentity(db, models.LDAPIssuer(config), "uuid-alice"); err != nil || identity.UserID != user.ID {
+		t.Fatalf("目录条目未关联到用户: %v", err)
+	}
+	if binds := stub.boundDNs(); len(binds) < 3 || binds[1] != aliceDN || binds[2] != ldapStubServiceDN {
+		t.Fatalf("绑定顺序 = %v，应先以用户身份绑定再恢复服务账号", binds)
+	}
+	
+	// 再次登录找到同一个用户
+	again, err := authenticateLDAP(db, config, "ALICE@example.com", "alice-password")
+	if err != nil || again.ID != user.ID {
+		t.Fatalf("再次登录: %v", err)
+	}
+	
+	tests := []struct {
+		name     string
+		email    string
+		password string
+		want     error
+	}{
+		{"密码错误", "alice@example.com", "wrong", utils.ErrLDAPInvalidCredentials},
+		{"空密码不能匿名绑定", "alice@example.com", "", utils.ErrLDAPInvalidCredentials},
+		{"目录中不存在", "nobody@example.com", "alice-password", utils.ErrLDAPUserNotFound},
+		{"过滤器注入", "*", "alice-password", utils.ErrLDAPUserNotFound},
+	}
+	for _, tt := range tests {
+		if _, err := authenticateLDAP(db, config, tt.email, tt.password); !errors.Is(err, tt.want) {
+			t.Errorf("%s: err = %v，应为 %v", tt.name, err, tt.want)
+		}
+	}
+	
+	// 服务账号密码错误时无法连接目录，不能当作用户密码错误
+	config.LDAP.BindPassword = "wrong"
+	_, err = authenticateLDAP(db, config, "alice@example.com", "alice-password")
+	if err == nil || errors.Is(err, utils.ErrLDAPInvalidCredentials) || errors.Is(err, utils.ErrLDAPUserNotFound) {
+		t.Fatalf("服务账号绑定失败: err = %v", err)
+	}
+}
+
+func TestLDAPAutoCreateDisabled(t *testing.T) {
+	config, db, stub := newLDAPTestEnv(t)
+	config.LDAP.AutoCreateUsers = false
+	stub.putPerson("alice", "alice@example.com", "alice-password")
+	
+	if _, err := authenticateLDAP(db, config, "alice@example.com", "alice-password"); !errors.Is(err, errNoLinkedAccount) {
+		t.Fatalf("err = %v，未开启自动创建时应返回 errNoLinkedAccount", err)
+	}
+	
+	// 已有同邮箱的本地账号时直接关联
+	local := createTestUser(t, db, "alice", "local-password")
+	user, err := authenticateLDAP(db, config, "alice@example.com", "alice-password")
+	if err != nil || user.ID != local.ID {
+		t.Fatalf("应关联到已有的本地账号: %v", err)
+	}
+}
+
+func TestLDAPAdminGroupMapping(t *testing.T) {
+	config, db, stub := newLDAPTestEnv(t)
+	// 目录返回的组 DN 大小写和配置不同
+	stub.putPerson("alice", "alice@example.com", "alice-password", "CN=Mail-Admins,OU=Groups,DC=example,DC=com")
+	stub.putPerson("bob", "bob@example.com", "bob-password", "cn=staff,ou=groups,dc=example,dc=com")
+	
+	alice, err := authenticateLDAP(db, config, "alice@example.com", "alice-password")
+	if err != nil || !alice.IsAdmin {
+		t.Fatalf("管理员组成员应为管理员: %v", err)
+	}
+	bob, err := authenticateLDAP(db, config, "bob@example.com", "bob-password")
+	if err != nil || bob.IsAdmin {
+		t.Fatalf("非管理员组成员不应为管理员: %v", err)
+	}
+	
+	// 从管理员组移除后，下次同步取消管理员权限
+	stub.putPerson("alice", "alice@example.com", "alice-password", "cn=staff,ou=groups,dc=example,dc=com")
+	if err := SyncLDAPUsers(db, config); err != nil {
+		t.Fatal(err)
+	}
+	alice, _ = db.Users().GetByID(alice.ID)
+	if alice.IsAdmin {
+		t.Fatal("离开管理员组后应取消管理员权限")
+	}
+	
+	// 未配置管理员组时不修改本地的管理员设置
+	config.LDAP.AdminGroupDN = ""
+	alice.IsAdmin = true
+	db.Users().Update(alice)
+	if err := SyncLDAPUsers(db, config); err != nil {
+		t.Fatal(err)
+	}
+	alice, _ = db.Users().GetByID(alice.ID)
+	if !alice.IsAdmin {
+		t.Fatal("未配置 admin_group_dn 时不应同步管理员权限")
+	}
+}
+
+func TestSyncLDAPUsers(t *testing.T) {
+	config, db, stub := newLDAPTestEnv(t)
+	stub.putPerson("alice", "alice@example.com", "alice-password")
+	bobDN := stub.putPerson("bob", "bob@example.com", "bob-password")
+	carol := createTestUser(t, db, "carol", "carol-password")
+	
+	if err := SyncLDAPUsers(db, config); err != nil {
+		t.Fatal(err)
+	}
+	bob, err := db.Users().GetByEmail("bob@example.com")
+	if err != nil || !bob.IsActive {
+		t.Fatalf("同步应创建目录用户: %v", err)
+	}
+	if _, err := db.Users().GetByEmail("alice@example.com"); err != nil {
+		t.Fatalf("同步应创建目录用户: %v", err)
+	}
+	
+	// 目录中修改用户名和邮箱后同步到本地账号
+	stub.put("uid=alice,ou=people,"+ldapStubBaseDN, "alice-password", map[string][]string{
+		"objectclass": {"inetOrgPerson"},
+		"uid":         {"alice.smith"},
+		"mail":        {"alice.smith@example.com"},
+		"entryuuid":   {"uuid-alice"},
+	})
+	stub.remove(bobDN)
+	if err := SyncLDAPUsers(db, config); err != nil {
+		t.Fatal(err)
+	}
+	
+	alice, err := db.Users().GetByEmail("alice.smith@example.com")
+	if err != nil || alice.Username != "alice_smith" || !alice.IsActive {
+		t.Fatalf("应更新目录用户的用户名和邮箱: %+v %v", alice, err)
+	}
+	bob, _ = db.Users().GetByID(bob.ID)
+	if bob.IsActive {
+		t.Fatal("已从目录删除的用户应被停用")
+	}
+	carol, _ = db.Users().GetByID(carol.ID)
+	if !carol.IsActive {
+		t.Fatal("本地用户不受目录同步影响")
+	}
+	
+	// 目录返回空结果时不停用任何用户
+	stub.remove("uid=alice,ou=people," + ldapStubBaseDN)
+	if err := SyncLDAPUsers(db, config); err != nil {
+		t.Fatal(err)
+	}
+	alice, _ = db.Users().GetByID(alice.ID)
+	if !alice.IsActive {
+		t.Fatal("目录返回空结果时不应停用用户")
+	}
+}
+
+// TestSyncLDAPUsersPartialFailure 单个条目同步失败时不能把对应账号当作已从目录删除
+func TestSyncLDAPUsersPartialFailure(t *testing.T) {
+	config, db, stub := newLDAPTestEnv(t)
+	stub.putPerson("alice", "alice@example.com", "alice-password")
+	bobDN := stub.putPerson("bob", "bob@example.com", "bob-password")
+	if err := SyncLDAPUsers(db, config); err != nil {
+		t.Fatal(err)
+	}
+	alice, _ := db.Users().GetByEmail("alice@example.com")
+	bob, _ := db.Users().GetByEmail("bob@example.com")
+	
+	// alice 在目录中改名，但写入本地账号失败；同时 bob 已从目录删除
+	stub.put("uid=alice,ou=people,"+ldapStubBaseDN, "alice-password", map[string][]string{
+		"objectclass": {"inetOrgPerson"},
+		"uid":         {"alice.smith"},
+		"mail":        {"alice@example.com"},
+		"entryuuid":   {"uuid-alice"},
+	})
+	stub.remove(bobDN)
+	if _, err := db.Exec(`CREATE TRIGGER fail_alice_update BEFORE UPDATE ON users
+		WHEN NEW.username = 'alice_smith' BEGIN SELECT RAISE(FAIL, 'disk full'); END`); err != nil {
+		t.Fatal(err)
+	}
+	if err := SyncLDAPUsers(db, config); err == nil {
+		t.Fatal("有条目同步失败时应返回错误")
+	}
+	alice, _ = db.Users().GetByID(alice.ID)
+	if !alice.IsActive {
+		t.Fatal("同步失败的目录用户不应被停用")
+	}
+	bob, _ = db.Users().GetByID(bob.ID)
+	if !bob.IsActive {
+		t.Fatal("本次同步有失败时应跳过停用")
+	}
+	
+	// 恢复后再次同步，正常停用已删除的用户
+	if _, err := db.Exec("DROP TRIGGER fail_alice_update"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SyncLDAPUsers(db, config); err != nil {
+		t.Fatal(err)
+	}
+	alice, _ = db.Users().GetByID(alice.ID)
+	bob, _ = db.Users().GetByID(bob.ID)
+	if !alice.IsActive || alice.Username != "alice_smith" || bob.IsActive {
+		t.Fatalf("恢复后应更新 alice 并停用 bob: alice=%+v bob.IsActive=%v", alice, bob.IsActive)
+	}
+}
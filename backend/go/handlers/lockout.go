@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"SwiftPost/models"
+	"SwiftPost/utils"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// respondLoginBlocked 账号或IP被锁定或需要等待时返回429，并通过 Retry-After 告知剩余秒数
+func respondLoginBlocked(w http.ResponseWriter, blocked *models.LoginBlockedError) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(blocked.RetryAfter.Seconds())+1))
+	respondJSON(w, http.StatusTooManyRequests, AuthResponse{
+		Success: false,
+		Message: blocked.Error(),
+	})
+}
+
+// recordLoginFailure 记录一次登录失败。密码错误和两步验证失败计入同一个账号和IP，
+// 知道密码的人也不能无限次猜测验证码
+func recordLoginFailure(ctx context.Context, db *models.Database, config *utils.Config, email, ip string) {
+	if err := models.RecordLoginFailure(db, config, email, ip); err != nil {
+		authLog.ErrorContext(ctx, "记录登录失败次数失败: %v", err)
+	}
+}
+
+// checkLoginAllowed 账号或IP被锁定时返回429并返回 false
+func checkLoginAllowed(ctx context.Context, w http.ResponseWriter, db *models.Database, config *utils.Config, email, ip string) bool {
+	err := models.CheckLoginAllowed(db, config, email, ip)
+	var blocked *models.LoginBlockedError
+	if errors.As(err, &blocked) {
+		respondLoginBlocked(w, blocked)
+		return false
+	}
+	if err != nil {
+		authLog.ErrorContext(ctx, "检查登录限制失败: %v", err)
+	}
+	return true
+}
+
+// loginSucceeded 整个登录流程（包括两步验证）完成后清除该账号的失败记录
+func loginSucceeded(ctx context.Context, db *models.Database, email string) {
+	if err := models.ResetLoginFailures(db, email); err != nil {
+		authLog.ErrorContext(ctx, "清除登录失败记录失败: %v", err)
+	}
+}
+
+// loginFailed 记录一次登录失败并返回统一的错误信息
+func loginFailed(ctx context.Context, w http.ResponseWriter, db *models.Database, config *utils.Config, email, ip string) {
+	recordLoginFailure(ctx, db, config, email, ip)
+	
+	respondJSON(w, http.StatusUnauthorized, AuthResponse{
+		Success: false,
+		Message: "邮箱或密码错误",
+	})
+}
+
+// NotifyLoginLockout 账号或IP因连续登录失败被锁定时，通过系统通知告知所有管理员
+func NotifyLoginLockout(scope, key, ip string, failures int, until time.Time) {
+	db := models.GetDB()
+	adminIDs, err := db.Users().AdminIDs()
+	if err != nil {
+		authLog.Error("获取管理员列表失败: %v", err)
+		return
+	}
+	
+	var message string
+	if scope == models.LoginScopeAccount {
+		message = fmt.Sprintf("账号 %s 连续登录失败 %d 次（来源IP %s），已锁定至 %s",
+			key, failures, ip, until.Format("2006-01-02 15:04:05"))
+	} else {
+		message = fmt.Sprintf("IP %s 连续登录失败 %d 次，已禁止登录至 %s",
+			key, failures, until.Format("2006-01-02 15:04:05"))
+	}
+	
+	notification := WebSocketMessage{
+		Type: MessageTypeSystemNotification,
+		Payload: map[string]interface{}{
+			"title":   "登录安全警告",
+			"message": message,
+			"type":    "warning",
+			"from":    "系统",
+			"time":    time.Now().Format("2006-01-02 15:04:05"),
+			"scope":   scope,
+			"key":     key,
+		},
+		Timestamp: time.Now(),
+	}
+	
+	for _, adminID := range adminIDs {
+		deliverToUser(db, adminID, notification)
+	}
+}
+
+// AdminGetLoginLockoutsHandler 获取当前被锁定的账号和IP
+func AdminGetLoginLockoutsHandler(w http.ResponseWriter, r *http.Request) {
+	// 验证管理员权限
+	db := models.GetDB()
+	if !hasPermission(r, models.PermUsersResetPassword) {
+		respondJSON(w, http.StatusForbidden, map[string]interface{}{
+			"success": false,
+			"message": "需要管理员权限",
+		})
+		return
+	}
+	
+	lockouts, err := models.GetActiveLoginLockouts(db)
+	if err != nil {
+		authLog.ErrorContext(r.Context(), "获取登录锁定列表失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "获取登录锁定列表失败",
+		})
+		return
+	}
+	
+	// 按域名授权的管理员只能看到该域名下账号的锁定
+	permissions := requestPermissions(r)
+	if allDomains, _ := models.PermissionDomains(permissions, models.PermUsersResetPassword); !allDomains {
+		visible := lockouts[:0]
+		for _, lockout := range lockouts {
+			if lockout.Scope == models.LoginScopeAccount &&
+				models.PermissionCoversDomain(permissions, models.PermUsersResetPassword, models.EmailDomain(lockout.Key)) {
+				visible = append(visible, lockout)
+			}
+		}
+		lockouts = visible
+	}
+	
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success":  true,
+		"lockouts": lockouts,
+	})
+}
+
+// AdminUnlockLoginHandler 解除账号或IP的登录锁定
+func AdminUnlockLoginHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(int)
+	
+	// 验证管理员权限
+	db := models.GetDB()
+	user, err := db.Users().GetByID(userID)
+	if err != nil || !hasPermission(r, models.PermUsersResetPassword) {
+		respondJSON(w, http.StatusForbidden, map[string]interface{}{
+			"success": false,
+			"message": "需要管理员权限",
+		})
+		return
+	}
+	
+	var req struct {
+		Scope string `json:"scope"`
+		Key   string `json:"key"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "无效的请求格式",
+		})
+		return
+	}
+	
+	req.Key = strings.TrimSpace(req.Key)
+	if (req.Scope != models.LoginScopeAccount && req.Scope != models.LoginScopeIP) || req.Key == "" {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "必须指定要解锁的账号邮箱或IP",
+		})
+		return
+	}
+	
+	// 解除IP锁定需要不限域名的权限
+	domain := ""
+	if req.Scope == models.LoginScopeAccount {
+		domain = models.EmailDomain(req.Key)
+	}
+	if !models.PermissionCoversDomain(requestPermissions(r), models.PermUsersResetPassword, domain) {
+		respondJSON(w, http.StatusForbidden, map[string]interface{}{
+			"success": false,
+			"message": "没有权限解除该锁定",
+		})
+		return
+	}
+	
+	if err := models.UnlockLogin(db, req.Scope, req.Key); err != nil {
+		if err == sql.ErrNoRows {
+			respondJSON(w, http.StatusNotFound, map[string]interface{}{
+				"success": false,
+				"message": "没有该账号或IP的登录失败记录",
+			})
+			return
+		}
+		authLog.ErrorContext(r.Context(), "解除登录锁定失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "解除登录锁定失败",
+		})
+		return
+	}
+	
+	authLog.InfoContext(r.Context(), "管理员 %s 解除了登录锁定: %s %s", user.Username, req.Scope, req.Key)
+	
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "已解除登录锁定",
+	})
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"SwiftPost/models"
+	"SwiftPost/utils"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// newTestEnv 使用默认配置和临时 SQLite 数据库初始化处理器依赖的全局状态
+func newTestEnv(t *testing.T) (*utils.Config, *models.Database) {
+	t.Helper()
+	config, err := (&utils.ConfigLoader{}).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Database.Path = filepath.Join(t.TempDir(), "swiftpost.db")
+	config.LoginProtection.Enabled = false
+	utils.SetConfig(config)
+	
+	db, err := models.InitDatabase(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := models.RotateSigningKeys(db, config); err != nil {
+		t.Fatal(err)
+	}
+	if err := models.LoadCSRFKey(db); err != nil {
+		t.Fatal(err)
+	}
+	return config, db
+}
+
+// createTestUser 创建一个已启用的普通用户
+func createTestUser(t *testing.T, db *models.Database, username, password string) *models.User {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := db.Users().Create(username, username+"@example.com", string(hash))
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := db.Users().GetByID(int(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// callJSON 直接调用处理器，userID 不为 0 时模拟 AuthMiddleware 写入的用户
+func callJSON(t *testing.T, handler http.HandlerFunc, method, target string, userID int, body interface{}) (*httptest.ResponseRecorder, map[string]interface{}) {
+	t.Helper()
+	r := newJSONRequest(t, method, target, body)
+	if userID != 0 {
+		r = r.WithContext(context.WithValue(r.Context(), "user_id", userID))
+	}
+	return serveJSON(t, handler, r)
+}
+
+// testAdmin 模拟认证中间件写入上下文的管理员身份
+type testAdmin struct {
+	ID          int
+	SuperAdmin  bool
+	Permissions []string
+}
+
+// callAdminJSON 以 admin 的身份调用后台处理器，vars 为路由参数
+func callAdminJSON(t *testing.T, handler http.HandlerFunc, method, target string, admin testAdmin, vars map[string]string, body interface{}) (*httptest.ResponseRecorder, map[string]interface{}) {
+	t.Helper()
+	r := newJSONRequest(t, method, target, body)
+	ctx := context.WithValue(r.Context(), "user_id", admin.ID)
+	ctx = context.WithValue(ctx, "is_admin", admin.SuperAdmin)
+	ctx = context.WithValue(ctx, "permissions", admin.Permissions)
+	r = r.WithContext(ctx)
+	if vars != nil {
+		r = mux.SetURLVars(r, vars)
+	}
+	return serveJSON(t, handler, r)
+}
+
+func newJSONRequest(t *testing.T, method, target string, body interface{}) *http.Request {
+	t.Helper()
+	var reader bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reader).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := httptest.NewRequest(method, target, &reader)
+	r.Header.Set("Content-Type", "application/json")
+	return r
+}
+
+func serveJSON(t *testing.T, handler http.HandlerFunc, r *http.Request) (*httptest.ResponseRecorder, map[string]interface{}) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	handler(w, r)
+	
+	var resp map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("%s %s 返回的不是JSON: %q", r.Method, r.URL, w.Body.String())
+	}
+	return w, resp
+}
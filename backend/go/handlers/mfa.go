@@ -0,0 +1,443 @@
+package handlers
+
+import (
+	"SwiftPost/models"
+	"SwiftPost/utils"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+	
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	totpIssuer        = "SwiftPost"
+	recoveryCodeCount = 10
+)
+
+// MFACodeRequest 验证码或恢复码，二选一
+type MFACodeRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// verifyMFACode 验证TOTP验证码或恢复码，验证码使用后不能再次使用
+func verifyMFACode(ctx context.Context, db *models.Database, mfa *models.UserMFA, req MFACodeRequest) (bool, error) {
+	if req.Code != "" {
+		step, ok := utils.ValidateTOTP(mfa.TOTPSecret, req.Code, time.Now())
+		if !ok {
+			return false, nil
+		}
+		return models.UseTOTPStep(db, mfa.UserID, step)
+	}
+	
+	if req.RecoveryCode != "" {
+		used, err := models.UseRecoveryCode(db, mfa.UserID, utils.NormalizeRecoveryCode(req.RecoveryCode))
+		if used {
+			authLog.InfoContext(ctx, "用户 %d 使用了恢复码登录", mfa.UserID)
+		}
+		return used, err
+	}
+	
+	return false, nil
+}
+
+// LoginMFAHandler 两步登录的第二步：用临时令牌和验证码换取正式会话
+func LoginMFAHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		MFAToken string `json:"mfa_token"`
+		MFACodeRequest
+	}
+	
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.MFAToken == "" {
+		respondJSON(w, http.StatusBadRequest, AuthResponse{
+			Success: false,
+			Message: "无效的请求格式",
+		})
+		return
+	}
+	
+	userID, err := utils.ParseMFAToken(req.MFAToken)
+	if err != nil {
+		respondJSON(w, http.StatusUnauthorized, AuthResponse{
+			Success: false,
+			Message: "验证已过期，请重新登录",
+		})
+		return
+	}
+	
+	db := models.GetDB()
+	user, err := db.Users().GetByID(userID)
+	if err != nil || !user.IsActive {
+		respondJSON(w, http.StatusForbidden, AuthResponse{
+			Success: false,
+			Message: "账号已被禁用",
+		})
+		return
+	}
+	
+	mfa, err := models.GetUserMFA(db, userID)
+	if err != nil || !mfa.Enabled {
+		respondJSON(w, http.StatusBadRequest, AuthResponse{
+			Success: false,
+			Message: "未启用验证器，请使用安全密钥验证",
+		})
+		return
+	}
+	
+	// 验证码错误和密码错误共用失败计数，锁定后同样拒绝
+	config := utils.GetConfig()
+	ip := utils.ClientIP(r)
+	if !checkLoginAllowed(r.Context(), w, db, config, user.Email, ip) {
+		return
+	}
+	
+	ok, err := verifyMFACode(r.Context(), db, mfa, req.MFACodeRequest)
+	if err != nil {
+		authLog.ErrorContext(r.Context(), "两步验证失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, AuthResponse{
+			Success: false,
+			Message: "服务器内部错误",
+		})
+		return
+	}
+	if !ok {
+		recordLoginFailure(r.Context(), db, config, user.Email, ip)
+		authLog.WarnContext(r.Context(), "用户 %d 两步验证失败 (%s)", user.ID, ip)
+		respondJSON(w, http.StatusUnauthorized, AuthResponse{
+			Success: false,
+			Message: "验证码错误",
+		})
+		return
+	}
+	
+	loginSucceeded(r.Context(), db, user.Email)
+	authLog.InfoContext(r.Context(), "用户登录: %s (%s)，已通过两步验证", user.Username, user.Email)
+	
+	tokenString, refreshToken, err := issueSession(w, r, db, user)
+	if err != nil {
+		authLog.ErrorContext(r.Context(), "生成Token失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, AuthResponse{
+			Success: false,
+			Message: "服务器内部错误",
+		})
+		return
+	}
+	
+	respondJSON(w, http.StatusOK, AuthResponse{
+		Success:      true,
+		Token:        tokenString,
+		RefreshToken: refreshToken,
+		ExpiresIn:    accessTokenExpiresIn(),
+		Message:      "登录成功",
+		User: &UserResponse{
+			ID:           user.ID,
+			Username:     user.Username,
+			Email:        user.Email,
+			IsAdmin:      user.IsAdmin,
+			CustomDomain: user.CustomDomain,
+		},
+	})
+}
+
+// GetMFAStatusHandler 获取两步验证状态
+func GetMFAStatusHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(int)
+	isAdmin, _ := r.Context().Value("is_admin").(bool)
+	
+	db := models.GetDB()
+	enabled, err := models.IsMFAEnabled(db, userID)
+	if err != nil {
+		authLog.ErrorContext(r.Context(), "获取两步验证状态失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "获取两步验证状态失败",
+		})
+		return
+	}
+	
+	remaining := 0
+	if enabled {
+		remaining, _ = models.CountUnusedRecoveryCodes(db, userID)
+	}
+	keyCount, _ := models.CountWebAuthnCredentials(db, userID)
+	
+	config := utils.GetConfig()
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success":                  true,
+		"enabled":                  enabled,
+		"webauthn_credentials":     keyCount,
+		"required":                 isAdmin && config.Admin.Require2FA,
+		"recovery_codes_remaining": remaining,
+	})
+}
+
+// SetupMFAHandler 生成新的TOTP密钥，确认验证码后才会启用
+func SetupMFAHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(int)
+	email, _ := r.Context().Value("email").(string)
+	
+	db := models.GetDB()
+	enabled, err := models.IsMFAEnabled(db, userID)
+	if err != nil {
+		authLog.ErrorContext(r.Context(), "获取两步验证状态失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "服务器内部错误",
+		})
+		return
+	}
+	if enabled {
+		respondJSON(w, http.StatusConflict, map[string]interface{}{
+			"success": false,
+			"message": "两步验证已启用",
+		})
+		return
+	}
+	
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		authLog.ErrorContext(r.Context(), "生成TOTP密钥失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "服务器内部错误",
+		})
+		return
+	}
+	
+	if err := models.SavePendingTOTPSecret(db, userID, secret); err != nil {
+		authLog.ErrorContext(r.Context(), "保存TOTP密钥失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "服务器内部错误",
+		})
+		return
+	}
+	
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success":     true,
+		"secret":      secret,
+		"otpauth_uri": utils.TOTPURI(totpIssuer, email, secret),
+		"message":     "请使用验证器应用扫描二维码，然后输入验证码完成启用",
+	})
+}
+
+// EnableMFAHandler 确认验证码并启用两步验证，返回一次性恢复码
+func EnableMFAHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(int)
+	
+	var req MFACodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "请输入验证码",
+		})
+		return
+	}
+	
+	db := models.GetDB()
+	mfa, err := models.GetUserMFA(db, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"success": false,
+				"message": "请先生成两步验证密钥",
+			})
+			return
+		}
+		authLog.ErrorContext(r.Context(), "获取两步验证设置失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "服务器内部错误",
+		})
+		return
+	}
+	if mfa.Enabled {
+		respondJSON(w, http.StatusConflict, map[string]interface{}{
+			"success": false,
+			"message": "两步验证已启用",
+		})
+		return
+	}
+	
+	step, ok := utils.ValidateTOTP(mfa.TOTPSecret, req.Code, time.Now())
+	if !ok {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "验证码错误",
+		})
+		return
+	}
+	
+	codes, err := utils.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		authLog.ErrorContext(r.Context(), "生成恢复码失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "服务器内部错误",
+		})
+		return
+	}
+	
+	if err := models.ReplaceRecoveryCodes(db, userID, codes); err != nil {
+		authLog.ErrorContext(r.Context(), "保存恢复码失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "服务器内部错误",
+		})
+		return
+	}
+	
+	if err := models.EnableTOTP(db, userID, step); err != nil {
+		authLog.ErrorContext(r.Context(), "启用两步验证失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "启用两步验证失败",
+		})
+		return
+	}
+	
+	authLog.InfoContext(r.Context(), "用户 %d 启用了两步验证", userID)
+	
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success":        true,
+		"message":        "两步验证已启用，请妥善保存恢复码",
+		"recovery_codes": codes,
+	})
+}
+
+// DisableMFAHandler 关闭两步验证，需要密码和验证码（或恢复码）
+func DisableMFAHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(int)
+	isAdmin, _ := r.Context().Value("is_admin").(bool)
+	
+	var req struct {
+		Password string `json:"password"`
+		MFACodeRequest
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "无效的请求格式",
+		})
+		return
+	}
+	
+	db := models.GetDB()
+	config := utils.GetConfig()
+	keyCount, _ := models.CountWebAuthnCredentials(db, userID)
+	if isAdmin && config.Admin.Require2FA && keyCount == 0 {
+		respondJSON(w, http.StatusForbidden, map[string]interface{}{
+			"success": false,
+			"message": "管理员账号必须启用两步验证",
+		})
+		return
+	}
+	
+	user, err := db.Users().GetByID(userID)
+	if err != nil {
+		authLog.ErrorContext(r.Context(), "获取用户信息失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "服务器内部错误",
+		})
+		return
+	}
+	
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)) != nil {
+		respondJSON(w, http.StatusUnauthorized, map[string]interface{}{
+			"success": false,
+			"message": "密码错误",
+		})
+		return
+	}
+	
+	mfa, err := models.GetUserMFA(db, userID)
+	if err != nil || !mfa.Enabled {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "两步验证未启用",
+		})
+		return
+	}
+	
+	ok, err := verifyMFACode(r.Context(), db, mfa, req.MFACodeRequest)
+	if err != nil || !ok {
+		respondJSON(w, http.StatusUnauthorized, map[string]interface{}{
+			"success": false,
+			"message": "验证码错误",
+		})
+		return
+	}
+	
+	if err := models.DisableMFA(db, userID); err != nil {
+		authLog.ErrorContext(r.Context(), "关闭两步验证失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "关闭两步验证失败",
+		})
+		return
+	}
+	
+	authLog.InfoContext(r.Context(), "用户 %d 关闭了两步验证", userID)
+	
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "两步验证已关闭",
+	})
+}
+
+// RegenerateRecoveryCodesHandler 重新生成恢复码，旧的恢复码全部作废
+func RegenerateRecoveryCodesHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(int)
+	
+	var req MFACodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "请输入验证码",
+		})
+		return
+	}
+	
+	db := models.GetDB()
+	mfa, err := models.GetUserMFA(db, userID)
+	if err != nil || !mfa.Enabled {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "两步验证未启用",
+		})
+		return
+	}
+	
+	// 只接受验证器的验证码，不能用恢复码换新的恢复码
+	ok, err := verifyMFACode(r.Context(), db, mfa, MFACodeRequest{Code: req.Code})
+	if err != nil || !ok {
+		respondJSON(w, http.StatusUnauthorized, map[string]interface{}{
+			"success": false,
+			"message": "验证码错误",
+		})
+		return
+	}
+	
+	codes, err := utils.GenerateRecoveryCodes(recoveryCodeCount)
+	if err == nil {
+		err = models.ReplaceRecoveryCodes(db, userID, codes)
+	}
+	if err != nil {
+		authLog.ErrorContext(r.Context(), "生成恢复码失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "生成恢复码失败",
+		})
+		return
+	}
+	
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success":        true,
+		"message":        "恢复码已重新生成，旧的恢复码已失效",
+		"recovery_codes": codes,
+	})
+}
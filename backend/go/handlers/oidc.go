@@ -0,0 +1,437 @@
+package handlers
+
+import (
+	"SwiftPost/models"
+	"SwiftPost/utils"
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/oauth2"
+)
+
+const oidcStateTTL = 10 * time.Minute
+
+// oidcStateCookie 保存发起登录的浏览器拿到的 state，回调时必须一致，防止攻击者把自己的登录回调塞给受害者
+const oidcStateCookie = "oidc_state"
+
+var (
+	oidcProvidersMu sync.Mutex
+	oidcProviders   = make(map[string]*oidc.Provider)
+	
+	usernameInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9_]+`)
+)
+
+// oidcClaims ID令牌中用到的标准声明，其余声明（用户名、管理员）按配置从原始声明中读取
+type oidcClaims struct {
+	Email         string `json:"email"`
+	EmailVerified *bool  `json:"email_verified"`
+	Name          string `json:"name"`
+}
+
+// localPasswordDisabled 是否已禁用本地密码，只允许通过单点登录
+func localPasswordDisabled() bool {
+	config := utils.GetConfig()
+	return config != nil && config.OIDC.Enabled && config.OIDC.DisableLocalPassword
+}
+
+// getOIDCProvider 通过发现文档获取身份提供方信息，按 issuer 缓存，JWKS 公钥由提供方按需刷新
+func getOIDCProvider(config *utils.Config) (*oidc.Provider, error) {
+	oidcProvidersMu.Lock()
+	defer oidcProvidersMu.Unlock()
+	
+	if provider, ok := oidcProviders[config.OIDC.IssuerURL]; ok {
+		return provider, nil
+	}
+	
+	// 提供方会保存该上下文用于后续拉取JWKS，不能使用带超时的上下文，只给HTTP客户端设置超时
+	ctx := oidc.ClientContext(context.Background(), &http.Client{Timeout: 10 * time.Second})
+	provider, err := oidc.NewProvider(ctx, config.OIDC.IssuerURL)
+	if err != nil {
+		return nil, err
+	}
+	
+	oidcProviders[config.OIDC.IssuerURL] = provider
+	return provider, nil
+}
+
+func oidcOAuth2Config(config *utils.Config, provider *oidc.Provider) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     config.OIDC.ClientID,
+		ClientSecret: config.OIDC.ClientSecret,
+		RedirectURL:  config.OIDC.RedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       config.OIDC.Scopes,
+	}
+}
+
+// redirectSSOError 单点登录失败时带着错误信息跳回登录页
+func redirectSSOError(w http.ResponseWriter, r *http.Request, message string) {
+	http.Redirect(w, r, "/login#sso_error="+url.QueryEscape(message), http.StatusFound)
+}
+
+// GetOIDCConfigHandler 返回登录页需要的单点登录信息
+func GetOIDCConfigHandler(w http.ResponseWriter, r *http.Request) {
+	config := utils.GetConfig()
+	
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success":                 true,
+		"enabled":                 config.OIDC.Enabled,
+		"provider_name":           config.OIDC.ProviderName,
+		"local_password_disabled": config.OIDC.Enabled && config.OIDC.DisableLocalPassword,
+	})
+}
+
+// OIDCLoginHandler 生成 state、nonce 和 PKCE 校验码后跳转到身份提供方
+func OIDCLoginHandler(w http.ResponseWriter, r *http.Request) {
+	config := utils.GetConfig()
+	if !config.OIDC.Enabled {
+		redirectSSOError(w, r, "未启用单点登录")
+		return
+	}
+	
+	provider, err := getOIDCProvider(config)
+	if err != nil {
+		authLog.ErrorContext(r.Context(), "获取OIDC发现文档失败: %v", err)
+		redirectSSOError(w, r, "无法连接身份提供方")
+		return
+	}
+	
+	state := uuid.NewString()
+	nonce := uuid.NewString()
+	verifier := oauth2.GenerateVerifier()
+	
+	if err := models.SaveOIDCState(models.GetDB(), state, nonce, verifier, time.Now().Add(oidcStateTTL)); err != nil {
+		authLog.ErrorContext(r.Context(), "保存OIDC登录状态失败: %v", err)
+		redirectSSOError(w, r, "服务器内部错误")
+		return
+	}
+	
+	// 身份提供方跳转回来是跨站的顶级导航，SameSite=Lax 时仍会带上这个Cookie
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/api/auth/oidc/",
+		MaxAge:   int(oidcStateTTL / time.Second),
+		HttpOnly: true,
+		Secure:   isSecureRequest(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	
+	authURL := oidcOAuth2Config(config, provider).AuthCodeURL(state,
+		oidc.Nonce(nonce),
+		oauth2.S256ChallengeOption(verifier),
+	)
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// OIDCCallbackHandler 处理身份提供方的回调：校验 state，用授权码换取令牌，验证ID令牌后登录或创建本地账号
+func OIDCCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	config := utils.GetConfig()
+	if !config.OIDC.Enabled {
+		redirectSSOError(w, r, "未启用单点登录")
+		return
+	}
+	
+	query := r.URL.Query()
+	if errCode := query.Get("error"); errCode != "" {
+		authLog.WarnContext(r.Context(), "身份提供方返回错误: %s %s", errCode, query.Get("error_description"))
+		redirectSSOError(w, r, "身份提供方拒绝了登录请求")
+		return
+	}
+	
+	// 不论结果如何都清除 state Cookie，每次登录只能回调一次
+	state := query.Get("state")
+	stateCookie, err := r.Cookie(oidcStateCookie)
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    "",
+		Path:     "/api/auth/oidc/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   isSecureRequest(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	if err != nil || state == "" || subtle.ConstantTimeCompare([]byte(stateCookie.Value), []byte(state)) != 1 {
+		authLog.WarnContext(r.Context(), "OIDC回调的 state 与浏览器Cookie不一致")
+		redirectSSOError(w, r, "登录请求已过期，请重试")
+		return
+	}
+	
+	db := models.GetDB()
+	nonce, verifier, err := models.ConsumeOIDCState(db, state)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			authLog.ErrorContext(r.Context(), "读取OIDC登录状态失败: %v", err)
+		}
+		redirectSSOError(w, r, "登录请求已过期，请重试")
+		return
+	}
+	
+	provider, err := getOIDCProvider(config)
+	if err != nil {
+		authLog.ErrorContext(r.Context(), "获取OIDC发现文档失败: %v", err)
+		redirectSSOError(w, r, "无法连接身份提供方")
+		return
+	}
+	
+	ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+	defer cancel()
+	
+	token, err := oidcOAuth2Config(config, provider).Exchange(ctx, query.Get("code"), oauth2.VerifierOption(verifier))
+	if err != nil {
+		authLog.WarnContext(r.Context(), "OIDC授权码换取令牌失败: %v", err)
+		redirectSSOError(w, r, "单点登录失败")
+		return
+	}
+	
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		authLog.WarnContext(r.Context(), "OIDC令牌响应中缺少 id_token")
+		redirectSSOError(w, r, "单点登录失败")
+		return
+	}
+	
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: config.OIDC.ClientID}).Verify(ctx, rawIDToken)
+	if err != nil {
+		authLog.WarnContext(r.Context(), "OIDC ID令牌验证失败: %v", err)
+		redirectSSOError(w, r, "单点登录失败")
+		return
+	}
+	if idToken.Nonce != nonce {
+		authLog.WarnContext(r.Context(), "OIDC ID令牌 nonce 不匹配: subject=%s", idToken.Subject)
+		redirectSSOError(w, r, "单点登录失败")
+		return
+	}
+	
+	var claims oidcClaims
+	var rawClaims map[string]interface{}
+	err = idToken.Claims(&claims)
+	if err == nil {
+		err = idToken.Claims(&rawClaims)
+	}
+	if err != nil {
+		authLog.WarnContext(r.Context(), "解析OIDC声明失败: %v", err)
+		redirectSSOError(w, r, "单点登录失败")
+		return
+	}
+	claims.Email = strings.ToLower(strings.TrimSpace(claims.Email))
+	
+	user, err := resolveOIDCUser(r.Context(), db, config, idToken, &claims, rawClaims)
+	if err != nil {
+		var message string
+		switch {
+		case errors.Is(err, errNoLinkedAccount):
+			message = "该账号尚未开通邮箱，请联系管理员"
+		case errors.Is(err, errOIDCEmailMissing):
+			message = "身份提供方未返回已验证的邮箱"
+		default:
+			authLog.ErrorContext(r.Context(), "单点登录关联用户失败: %v", err)
+			message = "服务器内部错误"
+		}
+		redirectSSOError(w, r, message)
+		return
+	}
+	
+	if !user.IsActive {
+		redirectSSOError(w, r, "账号已被禁用")
+		return
+	}
+	
+	// 配置了管理员声明时，以身份提供方为准同步管理员权限
+	if config.OIDC.AdminClaim != "" {
+		isAdmin := oidcClaimMatches(rawClaims[config.OIDC.AdminClaim], config.OIDC.AdminValues)
+		if isAdmin != user.IsAdmin {
+			user.IsAdmin = isAdmin
+			if err := db.Users().Update(user); err != nil {
+				authLog.ErrorContext(r.Context(), "同步管理员权限失败: %v", err)
+				redirectSSOError(w, r, "服务器内部错误")
+				return
+			}
+			authLog.InfoContext(r.Context(), "根据单点登录声明同步管理员权限: %s is_admin=%v", user.Username, isAdmin)
+		}
+	}
+	
+	if _, _, err := issueSession(w, r, db, user); err != nil {
+		authLog.ErrorContext(r.Context(), "生成Token失败: %v", err)
+		redirectSSOError(w, r, "服务器内部错误")
+		return
+	}
+	
+	authLog.InfoContext(r.Context(), "用户通过单点登录: %s (%s)", user.Username, user.Email)
+	
+	// 访问令牌不放在URL中，登录页通过刷新令牌Cookie换取
+	http.Redirect(w, r, "/login#sso=1", http.StatusFound)
+}
+
+var (
+	errNoLinkedAccount  = errors.New("没有关联的本地账号")
+	errOIDCEmailMissing = errors.New("缺少已验证的邮箱")
+)
+
+// resolveOIDCUser 查找外部身份对应的本地账号：先按已关联的身份，再按已验证的邮箱，最后按配置自动创建
+func resolveOIDCUser(ctx context.Context, db *models.Database, config *utils.Config, idToken *oidc.IDToken, claims *oidcClaims, rawClaims map[string]interface{}) (*models.User, error) {
+	identity, err := models.GetUserIdentity(db, idToken.Issuer, idToken.Subject)
+	if err == nil {
+		if err := models.TouchUserIdentity(db, identity.ID, claims.Email); err != nil {
+			authLog.WarnContext(ctx, "更新外部身份登录时间失败: %v", err)
+		}
+		return db.Users().GetByID(identity.UserID)
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+	
+	// 只信任身份提供方已验证的邮箱，避免通过伪造邮箱接管本地账号
+	if claims.Email == "" || claims.EmailVerified == nil || !*claims.EmailVerified {
+		return nil, errOIDCEmailMissing
+	}
+	
+	user, err := db.Users().GetByEmail(claims.Email)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	
+	if user == nil {
+		if !config.OIDC.AutoCreateUsers {
+			return nil, errNoLinkedAccount
+		}
+		user, err = createOIDCUser(ctx, db, config, claims, rawClaims)
+		if err != nil {
+			return nil, err
+		}
+	}
+	
+	if _, err := models.CreateUserIdentity(db, user.ID, idToken.Issuer, idToken.Subject, claims.Email); err != nil {
+		return nil, err
+	}
+	authLog.InfoContext(ctx, "外部身份已关联到用户 %s: issuer=%s, subject=%s", user.Username, idToken.Issuer, idToken.Subject)
+	
+	return user, nil
+}
+
+// createOIDCUser 首次单点登录时自动创建本地账号
+func createOIDCUser(ctx context.Context, db *models.Database, config *utils.Config, claims *oidcClaims, rawClaims map[string]interface{}) (*models.User, error) {
+	preferred, _ := rawClaims[config.OIDC.UsernameClaim].(string)
+	if preferred == "" {
+		preferred = strings.SplitN(claims.Email, "@", 2)[0]
+	}
+	
+	user, err := createExternalUser(db, preferred, claims.Email)
+	if err != nil {
+		return nil, err
+	}
+	
+	authLog.InfoContext(ctx, "单点登录自动创建用户: %s (%s)", user.Username, user.Email)
+	return user, nil
+}
+
+// createExternalUser 为外部身份（单点登录、LDAP）创建本地账号，本地密码为随机值，无法用于密码登录
+func createExternalUser(db *models.Database, preferred, email string) (*models.User, error) {
+	username, err := uniqueUsername(db, preferred)
+	if err != nil {
+		return nil, err
+	}
+	
+	randomPassword, err := utils.GenerateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(randomPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	
+	userID, err := db.Users().Create(username, email, string(hashedPassword))
+	if err != nil {
+		return nil, err
+	}
+	
+	return db.Users().GetByID(int(userID))
+}
+
+// sanitizeUsername 把外部名称整理为符合用户名字符规则的形式
+func sanitizeUsername(preferred string) string {
+	base := strings.Trim(usernameInvalidChars.ReplaceAllString(preferred, "_"), "_")
+	if base == "" || (base[0] >= '0' && base[0] <= '9') {
+		base = "u" + base
+	}
+	if len(base) > 16 {
+		base = base[:16]
+	}
+	for len(base) < 3 {
+		base += "_"
+	}
+	return base
+}
+
+// usernameMatches 用户名是否由该外部名称生成（可能带有冲突时追加的数字后缀）
+func usernameMatches(username, preferred string) bool {
+	base := sanitizeUsername(preferred)
+	if !strings.HasPrefix(username, base) {
+		return false
+	}
+	for _, c := range username[len(base):] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// uniqueUsername 把外部名称整理为合法且未被占用的用户名，冲突时追加数字后缀
+func uniqueUsername(db *models.Database, preferred string) (string, error) {
+	base := sanitizeUsername(preferred)
+	
+	for i := 0; i < 100; i++ {
+		candidate := base
+		if i > 0 {
+			candidate = fmt.Sprintf("%s%d", base, i)
+		}
+		if !utils.ValidateUsername(candidate) {
+			continue
+		}
+		
+		_, err := db.Users().GetByUsername(candidate)
+		if err == sql.ErrNoRows {
+			return candidate, nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	
+	return "", fmt.Errorf("无法为 %s 生成可用的用户名", preferred)
+}
+
+// oidcClaimMatches 判断声明值是否命中配置的取值，支持字符串、字符串数组和布尔值
+func oidcClaimMatches(value interface{}, expected []string) bool {
+	switch v := value.(type) {
+	case bool:
+		return v && len(expected) == 0
+	case string:
+		for _, e := range expected {
+			if v == e {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok && oidcClaimMatches(s, expected) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,394 @@
+package handlers
+
+import (
+	"SwiftPost/models"
+	"SwiftPost/utils"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// mockIdP 进程内的 OIDC 身份提供方，提供发现文档、JWKS、授权和令牌端点
+type mockIdP struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	
+	clientID     string
+	clientSecret string
+	
+	mu    sync.Mutex
+	codes map[string]mockAuthorization
+	
+	// 签发ID令牌前修改声明，用于模拟异常的身份提供方
+	tamper func(claims jwt.MapClaims)
+}
+
+// mockAuthorization 授权码绑定的授权请求参数
+type mockAuthorization struct {
+	nonce     string
+	challenge string
+	claims    jwt.MapClaims
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &mockIdP{
+		t:            t,
+		key:          key,
+		clientID:     "swiftpost",
+		clientSecret: "client-secret",
+		codes:        make(map[string]mockAuthorization),
+	}
+	
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", idp.discovery)
+	mux.HandleFunc("/jwks", idp.jwks)
+	mux.HandleFunc("/token", idp.token)
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+func (idp *mockIdP) discovery(w http.ResponseWriter, r *http.Request) {
+	issuer := idp.server.URL
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"issuer":                                issuer,
+		"authorization_endpoint":                issuer + "/authorize",
+		"token_endpoint":                        issuer + "/token",
+		"jwks_uri":                              issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (idp *mockIdP) jwks(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"kid": "test",
+			"n":   base64.RawURLEncoding.EncodeToString(idp.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(idp.key.E)).Bytes()),
+		}},
+	})
+}
+
+// authorize 模拟用户在身份提供方登录并同意授权，返回授权码和回调时带回的 state
+func (idp *mockIdP) authorize(authURL string, claims jwt.MapClaims) (code, state string) {
+	idp.t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		idp.t.Fatal(err)
+	}
+	if !strings.HasPrefix(authURL, idp.server.URL+"/authorize?") {
+		idp.t.Fatalf("跳转地址 %s 不是身份提供方的授权端点", authURL)
+	}
+	query := u.Query()
+	for name, want := range map[string]string{
+		"client_id":             idp.clientID,
+		"response_type":         "code",
+		"code_challenge_method": "S256",
+	} {
+		if got := query.Get(name); got != want {
+			idp.t.Fatalf("授权请求 %s = %q，应为 %q", name, got, want)
+		}
+	}
+	for _, name := range []string{"state", "nonce", "code_challenge"} {
+		if query.Get(name) == "" {
+			idp.t.Fatalf("授权请求缺少 %s", name)
+		}
+	}
+	
+	code = base64.RawURLEncoding.EncodeToString([]byte(query.Get("state")))
+	idp.mu.Lock()
+	idp.codes[code] = mockAuthorization{nonce: query.Get("nonce"), challenge: query.Get("code_challenge"), claims: claims}
+	idp.mu.Unlock()
+	return code, query.Get("state")
+}
+
+// token 授权码只能使用一次，并且要求 code_verifier 与授权请求中的 code_challenge 对应
+func (idp *mockIdP) token(w http.ResponseWriter, r *http.Request) {
+	tokenError := func(code string) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": code})
+	}
+	
+	if id, secret, ok := r.BasicAuth(); !ok || id != idp.clientID || secret != idp.clientSecret {
+		if r.PostFormValue("client_id") != idp.clientID || r.PostFormValue("client_secret") != idp.clientSecret {
+			tokenError("invalid_client")
+			return
+		}
+	}
+	
+	idp.mu.Lock()
+	auth, ok := idp.codes[r.PostFormValue("code")]
+	delete(idp.codes, r.PostFormValue("code"))
+	idp.mu.Unlock()
+	if !ok || r.PostFormValue("grant_type") != "authorization_code" {
+		tokenError("invalid_grant")
+		return
+	}
+	sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != auth.challenge {
+		tokenError("invalid_grant")
+		return
+	}
+	
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":   idp.server.URL,
+		"aud":   idp.clientID,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+		"nonce": auth.nonce,
+	}
+	for name, value := range auth.claims {
+		claims[name] = value
+	}
+	if idp.tamper != nil {
+		idp.tamper(claims)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "test"
+	idToken, err := token.SignedString(idp.key)
+	if err != nil {
+		idp.t.Error(err)
+		tokenError("server_error")
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+func newOIDCTestEnv(t *testing.T) (*utils.Config, *models.Database, *mockIdP) {
+	t.Helper()
+	config, db := newTestEnv(t)
+	idp := newMockIdP(t)
+	config.OIDC.Enabled = true
+	config.OIDC.IssuerURL = idp.server.URL
+	config.OIDC.ClientID = idp.clientID
+	config.OIDC.ClientSecret = idp.clientSecret
+	config.OIDC.RedirectURL = "https://mail.example.com/api/auth/oidc/callback"
+	config.OIDC.Scopes = []string{"openid", "email", "profile"}
+	config.OIDC.UsernameClaim = "preferred_username"
+	config.OIDC.AdminClaim = "groups"
+	config.OIDC.AdminValues = []string{"mail-admins"}
+	config.OIDC.AutoCreateUsers = true
+	return config, db, idp
+}
+
+// startOIDCLogin 请求登录入口，返回跳转到身份提供方的地址和浏览器保存的 state Cookie
+func startOIDCLogin(t *testing.T) (string, *http.Cookie) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	OIDCLoginHandler(w, httptest.NewRequest("GET", "/api/auth/oidc/login", nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("登录入口返回 %d: %s", w.Code, w.Body.String())
+	}
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == oidcStateCookie {
+			if !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode {
+				t.Fatalf("state Cookie 应为 HttpOnly 且 SameSite=Lax: %+v", cookie)
+			}
+			return w.Header().Get("Location"), cookie
+		}
+	}
+	t.Fatal("登录入口没有设置 state Cookie")
+	return "", nil
+}
+
+// oidcCallback 模拟浏览器带着授权码和 state Cookie 回到回调地址，返回跳转地址和是否设置了刷新令牌Cookie
+func oidcCallback(t *testing.T, stateCookie *http.Cookie, code, state string) (string, bool) {
+	t.Helper()
+	target := "/api/auth/oidc/callback?" + url.Values{"code": {code}, "state": {state}}.Encode()
+	r := httptest.NewRequest("GET", target, nil)
+	if stateCookie != nil {
+		r.AddCookie(&http.Cookie{Name: stateCookie.Name, Value: stateCookie.Value})
+	}
+	w := httptest.NewRecorder()
+	OIDCCallbackHandler(w, r)
+	if w.Code != http.StatusFound {
+		t.Fatalf("回调返回 %d: %s", w.Code, w.Body.String())
+	}
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == refreshTokenCookie && cookie.Value != "" {
+			return w.Header().Get("Location"), true
+		}
+	}
+	return w.Header().Get("Location"), false
+}
+
+// loginAs 以 claims 完成一次登录流程，返回回调跳转地址和是否登录成功
+func loginAs(t *testing.T, idp *mockIdP, claims jwt.MapClaims) (string, bool) {
+	t.Helper()
+	location, cookie := startOIDCLogin(t)
+	code, state := idp.authorize(location, claims)
+	return oidcCallback(t, cookie, code, state)
+}
+
+func aliceClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub":                "user-1",
+		"email":              "Alice@Example.com",
+		"email_verified":     true,
+		"preferred_username": "alice",
+		"groups":             []string{"staff", "mail-admins"},
+	}
+}
+
+func TestOIDCLogin(t *testing.T) {
+	_, db, idp := newOIDCTestEnv(t)
+	
+	location, session := loginAs(t, idp, aliceClaims())
+	if location != "/login#sso=1" || !session {
+		t.Fatalf("登录失败: 跳转到 %s，会话 %v", location, session)
+	}
+	
+	user, err := db.Users().GetByEmail("alice@example.com")
+	if err != nil {
+		t.Fatalf("应自动创建用户: %v", err)
+	}
+	if user.Username != "alice" || !user.IsAdmin {
+		t.Fatalf("用户 %s is_admin=%v，应为 alice 且根据 groups 成为管理员", user.Username, user.IsAdmin)
+	}
+	identity, err := models.GetUserIdentity(db, idp.server.URL, "user-1")
+	if err != nil || identity.UserID != user.ID {
+		t.Fatalf("外部身份未关联到用户: %v", err)
+	}
+	
+	// 再次登录按已关联的身份找到同一个用户，并同步取消管理员权限
+	claims := aliceClaims()
+	claims["groups"] = []string{"staff"}
+	if location, session := loginAs(t, idp, claims); location != "/login#sso=1" || !session {
+		t.Fatalf("第二次登录失败: 跳转到 %s", location)
+	}
+	user, _ = db.Users().GetByID(user.ID)
+	if user.IsAdmin {
+		t.Fatal("groups 中不再包含 mail-admins 时应取消管理员权限")
+	}
+	if count, _ := db.Users().Count(); count != 1 {
+		t.Fatalf("用户数量 = %d，不应重复创建", count)
+	}
+}
+
+func TestOIDCUnverifiedEmail(t *testing.T) {
+	_, db, idp := newOIDCTestEnv(t)
+	createTestUser(t, db, "victim", "correct horse battery")
+	
+	claims := aliceClaims()
+	claims["email"] = "victim@example.com"
+	claims["email_verified"] = false
+	if location, session := loginAs(t, idp, claims); session || !strings.HasPrefix(location, "/login#sso_error=") {
+		t.Fatalf("未验证的邮箱不能关联本地账号: 跳转到 %s", location)
+	}
+}
+
+func TestOIDCRejectsBadState(t *testing.T) {
+	_, _, idp := newOIDCTestEnv(t)
+	
+	location, cookie := startOIDCLogin(t)
+	code, state := idp.authorize(location, aliceClaims())
+	for name, bad := range map[string]string{
+		"缺少 state":  "",
+		"伪造的 state": "00000000-0000-0000-0000-000000000000",
+	} {
+		if location, session := oidcCallback(t, cookie, code, bad); session || !strings.HasPrefix(location, "/login#sso_error=") {
+			t.Fatalf("%s: 跳转到 %s，应拒绝登录", name, location)
+		}
+	}
+	
+	// state 只能使用一次，重放成功登录的回调会被拒绝
+	if _, session := oidcCallback(t, cookie, code, state); !session {
+		t.Fatal("正确的 state 应登录成功")
+	}
+	if location, session := oidcCallback(t, cookie, code, state); session || !strings.HasPrefix(location, "/login#sso_error=") {
+		t.Fatalf("重放回调: 跳转到 %s，应拒绝登录", location)
+	}
+}
+
+// TestOIDCRejectsStateFromOtherBrowser 攻击者把自己发起的登录回调发给受害者，受害者浏览器中没有对应的 state Cookie
+func TestOIDCRejectsStateFromOtherBrowser(t *testing.T) {
+	_, _, idp := newOIDCTestEnv(t)
+	
+	attackerLocation, _ := startOIDCLogin(t)
+	code, state := idp.authorize(attackerLocation, aliceClaims())
+	_, victimCookie := startOIDCLogin(t)
+	for name, cookie := range map[string]*http.Cookie{
+		"没有 state Cookie":   nil,
+		"Cookie 属于另一次登录": victimCookie,
+	} {
+		if location, session := oidcCallback(t, cookie, code, state); session || !strings.HasPrefix(location, "/login#sso_error=") {
+			t.Fatalf("%s: 跳转到 %s，应拒绝登录", name, location)
+		}
+	}
+}
+
+func TestOIDCRejectsBadNonce(t *testing.T) {
+	_, db, idp := newOIDCTestEnv(t)
+	idp.tamper = func(claims jwt.MapClaims) {
+		claims["nonce"] = "attacker-nonce"
+	}
+	
+	if location, session := loginAs(t, idp, aliceClaims()); session || !strings.HasPrefix(location, "/login#sso_error=") {
+		t.Fatalf("nonce 不匹配: 跳转到 %s，应拒绝登录", location)
+	}
+	if count, _ := db.Users().Count(); count != 0 {
+		t.Fatal("nonce 不匹配时不应创建用户")
+	}
+}
+
+func TestOIDCRejectsBadIDToken(t *testing.T) {
+	tests := map[string]func(jwt.MapClaims){
+		"audience 不匹配": func(claims jwt.MapClaims) { claims["aud"] = "other-client" },
+		"issuer 不匹配":   func(claims jwt.MapClaims) { claims["iss"] = "https://evil.example.com" },
+		"已过期":          func(claims jwt.MapClaims) { claims["exp"] = time.Now().Add(-time.Hour).Unix() },
+	}
+	for name, tamper := range tests {
+		_, _, idp := newOIDCTestEnv(t)
+		idp.tamper = tamper
+		if location, session := loginAs(t, idp, aliceClaims()); session || !strings.HasPrefix(location, "/login#sso_error=") {
+			t.Fatalf("%s: 跳转到 %s，应拒绝登录", name, location)
+		}
+	}
+}
+
+func TestOIDCRejectsPKCEMismatch(t *testing.T) {
+	_, _, idp := newOIDCTestEnv(t)
+	
+	// 攻击者把自己会话中截获的授权码注入到受害者的回调中，
+	// 受害者会话的 code_verifier 与该授权码绑定的 code_challenge 不匹配
+	attackerLocation, _ := startOIDCLogin(t)
+	stolenCode, _ := idp.authorize(attackerLocation, aliceClaims())
+	victimLocation, victimCookie := startOIDCLogin(t)
+	_, victimState := idp.authorize(victimLocation, aliceClaims())
+	if location, session := oidcCallback(t, victimCookie, stolenCode, victimState); session || !strings.HasPrefix(location, "/login#sso_error=") {
+		t.Fatalf("PKCE 不匹配: 跳转到 %s，应拒绝登录", location)
+	}
+}
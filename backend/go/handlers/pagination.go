@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"SwiftPost/models"
+	"net/http"
+	"strconv"
+)
+
+// parsePage 解析列表的分页参数。带 cursor 时按游标翻页，否则按 page 和 limit 计算偏移量，
+// 返回的页码只用于偏移量分页的响应
+func parsePage(r *http.Request) (models.Page, int, error) {
+	query := r.URL.Query()
+	
+	page, _ := strconv.Atoi(query.Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	
+	p := models.Page{Limit: limit, Offset: (page - 1) * limit}
+	if cursor := query.Get("cursor"); cursor != "" {
+		c, err := models.DecodeCursor(cursor)
+		if err != nil {
+			return p, page, err
+		}
+		p.Cursor = c
+	}
+	
+	return p, page, nil
+}
+
+// paginationResponse 列表响应中的分页信息，游标为空字符串表示该方向没有更多记录
+func paginationResponse(p models.Page, page, total int, info *models.PageInfo) map[string]interface{} {
+	return map[string]interface{}{
+		"page":        page,
+		"limit":       p.Limit,
+		"total":       total,
+		"total_page":  (total + p.Limit - 1) / p.Limit,
+		"next_cursor": info.NextCursor,
+		"prev_cursor": info.PrevCursor,
+	}
+}
+
+// respondInvalidCursor 分页游标无法解析时返回 400
+func respondInvalidCursor(w http.ResponseWriter) {
+	respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+		"success": false,
+		"message": "无效的分页游标",
+	})
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"SwiftPost/models"
+	"encoding/json"
+	"net/http"
+)
+
+// GetPresenceSettingsHandler 获取在线状态设置
+func GetPresenceSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(int)
+	
+	db := models.GetDB()
+	settings, err := models.GetPresenceSettings(db, userID)
+	if err != nil {
+		wsLog.ErrorContext(r.Context(), "获取在线状态设置失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "获取在线状态设置失败",
+		})
+		return
+	}
+	
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success":  true,
+		"settings": settings,
+	})
+}
+
+// UpdatePresenceSettingsHandler 更新在线状态设置（隐身）
+func UpdatePresenceSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(int)
+	
+	var req struct {
+		AppearOffline *bool `json:"appear_offline"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.AppearOffline == nil {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "无效的请求格式",
+		})
+		return
+	}
+	
+	db := models.GetDB()
+	settings, err := models.GetPresenceSettings(db, userID)
+	if err != nil {
+		wsLog.ErrorContext(r.Context(), "获取在线状态设置失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "获取在线状态设置失败",
+		})
+		return
+	}
+	
+	changed := settings.AppearOffline != *req.AppearOffline
+	settings.AppearOffline = *req.AppearOffline
+	
+	if err := models.UpdatePresenceSettings(db, settings); err != nil {
+		wsLog.ErrorContext(r.Context(), "更新在线状态设置失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "更新在线状态设置失败",
+		})
+		return
+	}
+	
+	// 用户在线时立即让联系人看到状态变化
+	if changed && IsUserOnline(userID) {
+		status := "online"
+		if settings.AppearOffline {
+			status = "offline"
+		}
+		go sendPresence(db, userID, status)
+	}
+	
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success":  true,
+		"message":  "在线状态设置已更新",
+		"settings": settings,
+	})
+}
@@ -0,0 +1,338 @@
+package handlers
+
+import (
+	"SwiftPost/models"
+	"SwiftPost/utils"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// pushLog Web Push 推送的日志
+var pushLog = utils.NewLogger("push")
+
+// PushSubscriptionRequest 浏览器 PushSubscription.toJSON() 的格式
+type PushSubscriptionRequest struct {
+	Endpoint string `json:"endpoint"`
+	Keys     struct {
+		P256dh string `json:"p256dh"`
+		Auth   string `json:"auth"`
+	} `json:"keys"`
+}
+
+// GetVAPIDPublicKeyHandler 获取 VAPID 公钥，供浏览器订阅推送
+func GetVAPIDPublicKeyHandler(w http.ResponseWriter, r *http.Request) {
+	config := utils.GetConfig()
+	if !config.Push.Enabled || config.Push.VAPIDPublicKey == "" {
+		respondJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
+			"success": false,
+			"message": "推送通知未启用",
+		})
+		return
+	}
+	
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success":    true,
+		"public_key": config.Push.VAPIDPublicKey,
+	})
+}
+
+// SubscribePushHandler 注册推送订阅
+func SubscribePushHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(int)
+	
+	var req PushSubscriptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "无效的请求格式",
+		})
+		return
+	}
+	
+	// 推送时服务器会向该地址发送请求，只接受公网上的 https 地址
+	if err := utils.ValidatePushEndpoint(r.Context(), utils.GetConfig(), req.Endpoint); err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	
+	if req.Keys.P256dh == "" || req.Keys.Auth == "" {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "缺少订阅密钥",
+		})
+		return
+	}
+	
+	// 提前校验密钥，避免投递时才发现订阅无效
+	if _, err := utils.EncryptPushPayload(req.Keys.P256dh, req.Keys.Auth, []byte("{}")); err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "无效的订阅密钥",
+		})
+		return
+	}
+	
+	db := models.GetDB()
+	sub := &models.PushSubscription{
+		UserID:    userID,
+		Endpoint:  req.Endpoint,
+		P256dh:    req.Keys.P256dh,
+		Auth:      req.Keys.Auth,
+		UserAgent: r.UserAgent(),
+	}
+	
+	if err := models.SavePushSubscription(db, sub); err != nil {
+		pushLog.ErrorContext(r.Context(), "保存推送订阅失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "保存推送订阅失败",
+		})
+		return
+	}
+	
+	pushLog.InfoContext(r.Context(), "用户 %d 注册了推送订阅", userID)
+	
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "推送订阅成功",
+	})
+}
+
+// UnsubscribePushHandler 取消推送订阅
+func UnsubscribePushHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(int)
+	
+	var req struct {
+		Endpoint string `json:"endpoint"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Endpoint == "" {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "无效的请求格式",
+		})
+		return
+	}
+	
+	db := models.GetDB()
+	if err := models.DeletePushSubscription(db, userID, req.Endpoint); err != nil {
+		pushLog.ErrorContext(r.Context(), "删除推送订阅失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "取消推送订阅失败",
+		})
+		return
+	}
+	
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "已取消推送订阅",
+	})
+}
+
+// GetNotificationPreferencesHandler 获取通知偏好
+func GetNotificationPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(int)
+	
+	db := models.GetDB()
+	prefs, err := models.GetNotificationPreferences(db, userID)
+	if err != nil {
+		pushLog.ErrorContext(r.Context(), "获取通知偏好失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "获取通知偏好失败",
+		})
+		return
+	}
+	
+	subs, err := models.GetPushSubscriptionsByUser(db, userID)
+	if err != nil {
+		pushLog.ErrorContext(r.Context(), "获取推送订阅失败: %v", err)
+	}
+	
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success":       true,
+		"preferences":   prefs,
+		"subscriptions": len(subs),
+	})
+}
+
+// UpdateNotificationPreferencesHandler 更新通知偏好
+func UpdateNotificationPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(int)
+	
+	var req struct {
+		PushEnabled    *bool `json:"push_enabled"`
+		NotifyNewEmail *bool `json:"notify_new_email"`
+		NotifySystem   *bool `json:"notify_system"`
+		ShowPreview    *bool `json:"show_preview"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "无效的请求格式",
+		})
+		return
+	}
+	
+	db := models.GetDB()
+	prefs, err := models.GetNotificationPreferences(db, userID)
+	if err != nil {
+		pushLog.ErrorContext(r.Context(), "获取通知偏好失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "获取通知偏好失败",
+		})
+		return
+	}
+	
+	if req.PushEnabled != nil {
+		prefs.PushEnabled = *req.PushEnabled
+	}
+	if req.NotifyNewEmail != nil {
+		prefs.NotifyNewEmail = *req.NotifyNewEmail
+	}
+	if req.NotifySystem != nil {
+		prefs.NotifySystem = *req.NotifySystem
+	}
+	if req.ShowPreview != nil {
+		prefs.ShowPreview = *req.ShowPreview
+	}
+	
+	if err := models.UpdateNotificationPreferences(db, prefs); err != nil {
+		pushLog.ErrorContext(r.Context(), "更新通知偏好失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "更新通知偏好失败",
+		})
+		return
+	}
+	
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success":     true,
+		"message":     "通知偏好已更新",
+		"preferences": prefs,
+	})
+}
+
+// deliverToUser 用户在线时通过 WebSocket 发送，离线时回退到 Web Push
+func deliverToUser(db *models.Database, userID int, message WebSocketMessage) {
+	if IsUserOnline(userID) {
+		SendToUser(userID, message)
+		return
+	}
+	
+	go pushToUser(db, userID, message)
+}
+
+// pushToUser 根据用户的通知偏好，把 WebSocket 事件转成推送消息发送到所有订阅
+func pushToUser(db *models.Database, userID int, message WebSocketMessage) {
+	config := utils.GetConfig()
+	if !config.Push.Enabled || config.Push.VAPIDPrivateKey == "" {
+		return
+	}
+	
+	prefs, err := models.GetNotificationPreferences(db, userID)
+	if err != nil {
+		pushLog.Error("获取通知偏好失败: %v", err)
+		return
+	}
+	
+	notification, urgency, ok := buildPushNotification(message, prefs)
+	if !ok {
+		return
+	}
+	
+	subs, err := models.GetPushSubscriptionsByUser(db, userID)
+	if err != nil {
+		pushLog.Error("获取推送订阅失败: %v", err)
+		return
+	}
+	if len(subs) == 0 {
+		return
+	}
+	
+	payload, err := json.Marshal(notification)
+	if err != nil {
+		pushLog.Error("序列化推送内容失败: %v", err)
+		return
+	}
+	
+	for _, sub := range subs {
+		target := utils.PushTarget{
+			Endpoint: sub.Endpoint,
+			P256dh:   sub.P256dh,
+			Auth:     sub.Auth,
+		}
+		
+		status, err := utils.SendWebPush(config, target, payload, urgency)
+		if err != nil {
+			if utils.IsPushSubscriptionGone(status) {
+				// 订阅已过期，删除
+				models.DeletePushSubscriptionByID(db, sub.ID)
+				pushLog.Debug("推送订阅已失效并删除: 用户ID=%d, 订阅ID=%d", userID, sub.ID)
+				continue
+			}
+			pushLog.Error("发送推送失败: 用户ID=%d, 订阅ID=%d: %v", userID, sub.ID, err)
+			continue
+		}
+		
+		models.TouchPushSubscription(db, sub.ID)
+	}
+	
+	pushLog.Debug("推送通知已发送: 用户ID=%d, 类型=%s, 订阅数=%d", userID, message.Type, len(subs))
+}
+
+// buildPushNotification 生成 Service Worker 使用的通知内容
+func buildPushNotification(message WebSocketMessage, prefs *models.NotificationPreferences) (map[string]interface{}, string, bool) {
+	if !prefs.PushEnabled {
+		return nil, "", false
+	}
+	
+	payload, _ := message.Payload.(map[string]interface{})
+	
+	switch message.Type {
+	case MessageTypeNewEmail:
+		if !prefs.NotifyNewEmail {
+			return nil, "", false
+		}
+		
+		// 推送内容会经过第三方推送服务，默认不包含邮件正文预览
+		body := "来自 " + stringValue(payload["sender_name"])
+		if prefs.ShowPreview {
+			body = stringValue(payload["subject"]) + "\n" + stringValue(payload["preview"])
+		}
+		
+		return map[string]interface{}{
+			"type":      MessageTypeNewEmail,
+			"title":     "SwiftPost 新邮件",
+			"body":      body,
+			"email_id":  payload["email_id"],
+			"url":       "/dashboard",
+			"timestamp": message.Timestamp.Format(time.RFC3339),
+		}, "high", true
+	
+	case MessageTypeSystemNotification:
+		if !prefs.NotifySystem {
+			return nil, "", false
+		}
+		
+		return map[string]interface{}{
+			"type":      MessageTypeSystemNotification,
+			"title":     stringValue(payload["title"]),
+			"body":      stringValue(payload["message"]),
+			"url":       "/dashboard",
+			"timestamp": message.Timestamp.Format(time.RFC3339),
+		}, "normal", true
+	}
+	
+	return nil, "", false
+}
+
+func stringValue(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
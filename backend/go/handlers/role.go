@@ -0,0 +1,544 @@
+package handlers
+
+import (
+	"SwiftPost/models"
+	"SwiftPost/utils"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	
+	"github.com/gorilla/mux"
+)
+
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{1,31}$`)
+
+// requestPermissions 当前请求拥有的后台权限，由认证中间件根据访问令牌的 scope 写入上下文
+func requestPermissions(r *http.Request) []string {
+	permissions, _ := r.Context().Value("permissions").([]string)
+	return permissions
+}
+
+// hasPermission 处理函数内再次检查权限，避免路由遗漏权限中间件时越权
+func hasPermission(r *http.Request, permission string) bool {
+	return models.HasPermission(requestPermissions(r), permission)
+}
+
+// isSuperAdmin 当前用户是否为超级管理员（users.is_admin）
+func isSuperAdmin(r *http.Request) bool {
+	isAdmin, _ := r.Context().Value("is_admin").(bool)
+	return isAdmin
+}
+
+// canManageUser 是否可以对目标用户执行操作
+// 按域名授权的权限只能管理该域名下的用户，超级管理员只能由超级管理员管理
+func canManageUser(r *http.Request, permission string, target *models.User) bool {
+	if isSuperAdmin(r) {
+		return true
+	}
+	if target.IsAdmin {
+		return false
+	}
+	return models.PermissionCoversDomain(requestPermissions(r), permission, models.EmailDomain(target.Email))
+}
+
+// canManageUserID 同 canManageUser，目标用户不存在时视为无权操作
+func canManageUserID(db *models.Database, r *http.Request, permission string, userID int) bool {
+	if isSuperAdmin(r) {
+		return true
+	}
+	target, err := db.Users().GetByID(userID)
+	if err != nil {
+		return false
+	}
+	return canManageUser(r, permission, target)
+}
+
+// respondUserForbidden 目标用户不在当前管理员的管理范围内
+func respondUserForbidden(w http.ResponseWriter) {
+	respondJSON(w, http.StatusForbidden, map[string]interface{}{
+		"success": false,
+		"message": "没有权限管理该用户",
+	})
+}
+
+// normalizePermissions 校验并去重角色权限，只能授予自己拥有的权限
+func normalizePermissions(r *http.Request, requested []string) ([]string, string) {
+	seen := make(map[string]bool)
+	permissions := []string{}
+	for _, permission := range requested {
+		permission = strings.TrimSpace(permission)
+		if !models.ValidPermission(permission) {
+			return nil, "无效的权限: " + permission
+		}
+		if !models.PermissionCoversDomain(requestPermissions(r), permission, "") {
+			return nil, "不能授予自己没有的权限: " + permission
+		}
+		if !seen[permission] {
+			seen[permission] = true
+			permissions = append(permissions, permission)
+		}
+	}
+	return permissions, ""
+}
+
+// revokeRoleSessions 角色的权限写在访问令牌中，角色变更后让相关用户重新登录以获取新的权限
+func revokeRoleSessions(ctx context.Context, db *models.Database, userIDs []int) {
+	for _, userID := range userIDs {
+		if _, err := db.Sessions().RevokeAllForUser(userID); err != nil {
+			utils.ErrorContext(ctx, "撤销用户 %d 的会话失败: %v", userID, err)
+		}
+		DisconnectUser(userID)
+	}
+}
+
+// AdminGetRolesHandler 获取全部角色和可分配的权限
+func AdminGetRolesHandler(w http.ResponseWriter, r *http.Request) {
+	if !hasPermission(r, models.PermRolesManage) {
+		respondJSON(w, http.StatusForbidden, map[string]interface{}{
+			"success": false,
+			"message": "需要管理员权限",
+		})
+		return
+	}
+	
+	roles, err := models.GetRoles(models.GetDB())
+	if err != nil {
+		utils.ErrorContext(r.Context(), "获取角色列表失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "获取角色列表失败",
+		})
+		return
+	}
+	
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success":     true,
+		"roles":       roles,
+		"permissions": models.ValidPermissions,
+	})
+}
+
+// AdminCreateRoleHandler 创建自定义角色
+func AdminCreateRoleHandler(w http.ResponseWriter, r *http.Request) {
+	adminID := r.Context().Value("user_id").(int)
+	if !hasPermission(r, models.PermRolesManage) {
+		respondJSON(w, http.StatusForbidden, map[string]interface{}{
+			"success": false,
+			"message": "需要管理员权限",
+		})
+		return
+	}
+	
+	var req struct {
+		Name        string   `json:"name"`
+		Description string   `json:"description"`
+		Permissions []string `json:"permissions"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "无效的请求格式",
+		})
+		return
+	}
+	
+	req.Name = strings.TrimSpace(req.Name)
+	if !roleNamePattern.MatchString(req.Name) {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "角色名称只能包含小写字母、数字和下划线，以字母开头，长度2到32个字符",
+		})
+		return
+	}
+	
+	permissions, message := normalizePermissions(r, req.Permissions)
+	if message == "" && len(permissions) == 0 {
+		message = "至少需要选择一个权限"
+	}
+	if message != "" {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": message,
+		})
+		return
+	}
+	
+	db := models.GetDB()
+	if _, err := models.GetRoleByName(db, req.Name); err == nil {
+		respondJSON(w, http.StatusConflict, map[string]interface{}{
+			"success": false,
+			"message": "角色名称已存在",
+		})
+		return
+	}
+	
+	role := &models.Role{
+		Name:        req.Name,
+		Description: strings.TrimSpace(req.Description),
+		Permissions: permissions,
+	}
+	id, err := models.CreateRole(db, role)
+	if err != nil {
+		utils.ErrorContext(r.Context(), "创建角色失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "创建角色失败",
+		})
+		return
+	}
+	
+	role, err = models.GetRoleByID(db, int(id))
+	if err != nil {
+		utils.ErrorContext(r.Context(), "获取角色失败: %v", err)
+	}
+	
+	utils.InfoContext(r.Context(), "管理员 %d 创建了角色 %s: %s", adminID, req.Name, strings.Join(permissions, " "))
+	
+	respondJSON(w, http.StatusCreated, map[string]interface{}{
+		"success": true,
+		"message": "角色已创建",
+		"role":    role,
+	})
+}
+
+// getRoleFromRequest 读取路径中的角色ID并获取角色，失败时已写入响应
+func getRoleFromRequest(w http.ResponseWriter, r *http.Request, db *models.Database) (*models.Role, bool) {
+	roleID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "无效的角色ID",
+		})
+		return nil, false
+	}
+	
+	role, err := models.GetRoleByID(db, roleID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondJSON(w, http.StatusNotFound, map[string]interface{}{
+				"success": false,
+				"message": "角色不存在",
+			})
+			return nil, false
+		}
+		utils.ErrorContext(r.Context(), "获取角色失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "获取角色失败",
+		})
+		return nil, false
+	}
+	
+	if role.Builtin {
+		respondJSON(w, http.StatusForbidden, map[string]interface{}{
+			"success": false,
+			"message": models.ErrBuiltinRole.Error(),
+		})
+		return nil, false
+	}
+	return role, true
+}
+
+// AdminUpdateRoleHandler 修改自定义角色的描述和权限，拥有该角色的用户需要重新登录
+func AdminUpdateRoleHandler(w http.ResponseWriter, r *http.Request) {
+	adminID := r.Context().Value("user_id").(int)
+	if !hasPermission(r, models.PermRolesManage) {
+		respondJSON(w, http.StatusForbidden, map[string]interface{}{
+			"success": false,
+			"message": "需要管理员权限",
+		})
+		return
+	}
+	
+	db := models.GetDB()
+	role, ok := getRoleFromRequest(w, r, db)
+	if !ok {
+		return
+	}
+	
+	var req struct {
+		Description *string  `json:"description"`
+		Permissions []string `json:"permissions"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "无效的请求格式",
+		})
+		return
+	}
+	
+	if req.Description != nil {
+		role.Description = strings.TrimSpace(*req.Description)
+	}
+	if req.Permissions != nil {
+		permissions, message := normalizePermissions(r, req.Permissions)
+		if message == "" && len(permissions) == 0 {
+			message = "至少需要选择一个权限"
+		}
+		if message != "" {
+			respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"success": false,
+				"message": message,
+			})
+			return
+		}
+		role.Permissions = permissions
+	}
+	
+	userIDs, err := models.GetRoleUserIDs(db, role.ID)
+	if err == nil {
+		err = models.UpdateRole(db, role)
+	}
+	if err != nil {
+		utils.ErrorContext(r.Context(), "修改角色失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "修改角色失败",
+		})
+		return
+	}
+	
+	if req.Permissions != nil {
+		revokeRoleSessions(r.Context(), db, userIDs)
+	}
+	
+	utils.InfoContext(r.Context(), "管理员 %d 修改了角色 %s: %s", adminID, role.Name, strings.Join(role.Permissions, " "))
+	
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "角色已更新",
+		"role":    role,
+	})
+}
+
+// AdminDeleteRoleHandler 删除自定义角色，拥有该角色的用户需要重新登录
+func AdminDeleteRoleHandler(w http.ResponseWriter, r *http.Request) {
+	adminID := r.Context().Value("user_id").(int)
+	if !hasPermission(r, models.PermRolesManage) {
+		respondJSON(w, http.StatusForbidden, map[string]interface{}{
+			"success": false,
+			"message": "需要管理员权限",
+		})
+		return
+	}
+	
+	db := models.GetDB()
+	role, ok := getRoleFromRequest(w, r, db)
+	if !ok {
+		return
+	}
+	
+	userIDs, err := models.GetRoleUserIDs(db, role.ID)
+	if err == nil {
+		err = models.DeleteRole(db, role)
+	}
+	if err != nil {
+		utils.ErrorContext(r.Context(), "删除角色失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "删除角色失败",
+		})
+		return
+	}
+	
+	revokeRoleSessions(r.Context(), db, userIDs)
+	
+	utils.InfoContext(r.Context(), "管理员 %d 删除了角色 %s", adminID, role.Name)
+	
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "角色已删除",
+	})
+}
+
+// AdminGetUserRolesHandler 获取用户被分配的角色及其生效的权限
+func AdminGetUserRolesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "无效的用户ID",
+		})
+		return
+	}
+	
+	db := models.GetDB()
+	if !hasPermission(r, models.PermUsersRead) {
+		respondJSON(w, http.StatusForbidden, map[string]interface{}{
+			"success": false,
+			"message": "需要管理员权限",
+		})
+		return
+	}
+	if !canManageUserID(db, r, models.PermUsersRead, userID) {
+		respondUserForbidden(w)
+		return
+	}
+	
+	roles, err := models.GetUserRoles(db, userID)
+	if err != nil {
+		utils.ErrorContext(r.Context(), "获取用户角色失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "获取用户角色失败",
+		})
+		return
+	}
+	
+	permissions, err := models.GetUserPermissions(db, userID)
+	if err != nil {
+		utils.ErrorContext(r.Context(), "获取用户权限失败: %v", err)
+	}
+	
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success":     true,
+		"user_id":     userID,
+		"roles":       roles,
+		"permissions": permissions,
+	})
+}
+
+// AdminSetUserRolesHandler 替换用户被分配的角色，用户需要重新登录后才能使用新的权限
+func AdminSetUserRolesHandler(w http.ResponseWriter, r *http.Request) {
+	adminID := r.Context().Value("user_id").(int)
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "无效的用户ID",
+		})
+		return
+	}
+	
+	if !hasPermission(r, models.PermRolesManage) {
+		respondJSON(w, http.StatusForbidden, map[string]interface{}{
+			"success": false,
+			"message": "需要管理员权限",
+		})
+		return
+	}
+	
+	if adminID == userID {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "不能修改自己的角色",
+		})
+		return
+	}
+	
+	var req struct {
+		Roles []struct {
+			Role   string `json:"role"`
+			Domain string `json:"domain"`
+		} `json:"roles"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "无效的请求格式",
+		})
+		return
+	}
+	
+	db := models.GetDB()
+	user, err := db.Users().GetByID(userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondJSON(w, http.StatusNotFound, map[string]interface{}{
+				"success": false,
+				"message": "用户不存在",
+			})
+			return
+		}
+		utils.ErrorContext(r.Context(), "获取用户信息失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "获取用户信息失败",
+		})
+		return
+	}
+	if !canManageUser(r, models.PermRolesManage, user) {
+		respondUserForbidden(w)
+		return
+	}
+	
+	assignments := []models.UserRole{}
+	names := []string{}
+	for _, item := range req.Roles {
+		role, err := models.GetRoleByName(db, strings.TrimSpace(item.Role))
+		if err != nil {
+			respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"success": false,
+				"message": "角色不存在: " + item.Role,
+			})
+			return
+		}
+		
+		domain := strings.ToLower(strings.TrimSpace(item.Domain))
+		if domain == "" && role.Name == models.RoleDomainAdmin {
+			respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"success": false,
+				"message": "域管理员角色必须指定域名",
+			})
+			return
+		}
+		v := utils.NewValidator()
+		v.ValidDomain("domain", domain)
+		if !v.Valid() {
+			respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"success": false,
+				"message": "无效的域名: " + item.Domain,
+			})
+			return
+		}
+		
+		// 只能分配自己在该域名范围内拥有的权限，限定域名的角色不能包含全局权限
+		for _, permission := range role.Permissions {
+			if domain != "" && !models.DomainScopedPermission(permission) {
+				respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+					"success": false,
+					"message": "角色包含全局权限，不能限定域名: " + permission,
+				})
+				return
+			}
+			if !models.PermissionCoversDomain(requestPermissions(r), permission, domain) {
+				respondJSON(w, http.StatusForbidden, map[string]interface{}{
+					"success": false,
+					"message": "不能授予自己没有的权限: " + permission,
+				})
+				return
+			}
+		}
+		
+		assignments = append(assignments, models.UserRole{RoleID: role.ID, RoleName: role.Name, Domain: domain})
+		if domain != "" {
+			names = append(names, role.Name+"@"+domain)
+		} else {
+			names = append(names, role.Name)
+		}
+	}
+	
+	if err := models.SetUserRoles(db, userID, assignments); err != nil {
+		utils.ErrorContext(r.Context(), "设置用户角色失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "设置用户角色失败",
+		})
+		return
+	}
+	
+	revokeRoleSessions(r.Context(), db, []int{userID})
+	
+	utils.InfoContext(r.Context(), "管理员 %d 设置了用户 %d 的角色: %s", adminID, userID, strings.Join(names, " "))
+	
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "用户角色已更新，重新登录后生效",
+		"roles":   assignments,
+	})
+}
@@ -0,0 +1,234 @@
+package handlers
+
+import (
+	"SwiftPost/models"
+	"SwiftPost/utils"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+	
+	"github.com/gorilla/mux"
+)
+
+const (
+	refreshTokenCookie = "refresh_token"
+	accessTokenCookie  = "token"
+	csrfTokenCookie    = "csrf_token"
+)
+
+// issueSession 为用户创建服务端会话，返回访问令牌和刷新令牌，并设置刷新令牌Cookie
+func issueSession(w http.ResponseWriter, r *http.Request, db *models.Database, user *models.User) (string, string, error) {
+	config := utils.GetConfig()
+	
+	refreshToken, err := utils.GenerateRefreshToken()
+	if err != nil {
+		return "", "", err
+	}
+	
+	expiresAt := time.Now().Add(utils.SessionTTL(config))
+	sessionID, err := db.Sessions().Create(&models.Session{
+		UserID:    user.ID,
+		TokenHash: utils.HashToken(refreshToken),
+		IPAddress: utils.ClientIP(r),
+		UserAgent: r.UserAgent(),
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return "", "", err
+	}
+	
+	scopes, err := models.GetUserPermissions(db, user.ID)
+	if err != nil {
+		return "", "", err
+	}
+	
+	accessToken, err := utils.GenerateAccessToken(config, utils.AccessClaims{
+		UserID:    user.ID,
+		Username:  user.Username,
+		Email:     user.Email,
+		IsAdmin:   user.IsAdmin,
+		SessionID: int(sessionID),
+		Scopes:    scopes,
+	})
+	if err != nil {
+		return "", "", err
+	}
+	
+	setRefreshCookie(w, r, refreshToken, expiresAt)
+	setAccessCookies(w, r, accessToken, int(sessionID), expiresAt)
+	return accessToken, refreshToken, nil
+}
+
+// setRefreshCookie 刷新令牌只通过 HttpOnly Cookie 发送给 /api/ 下的接口
+func setRefreshCookie(w http.ResponseWriter, r *http.Request, refreshToken string, expiresAt time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     refreshTokenCookie,
+		Value:    refreshToken,
+		Path:     "/api/",
+		Expires:  expiresAt,
+		HttpOnly: true,
+		Secure:   isSecureRequest(r),
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// setAccessCookies 设置页面请求使用的访问令牌Cookie，以及前端读取后放在 X-CSRF-Token 请求头中的CSRF令牌
+// 访问令牌Cookie使用 SameSite=Lax，从外部链接打开页面时仍然可以登录，但跨站提交的请求不会带上它
+func setAccessCookies(w http.ResponseWriter, r *http.Request, accessToken string, sessionID int, expiresAt time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     accessTokenCookie,
+		Value:    accessToken,
+		Path:     "/",
+		Expires:  expiresAt,
+		HttpOnly: true,
+		Secure:   isSecureRequest(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfTokenCookie,
+		Value:    utils.CSRFToken(sessionID),
+		Path:     "/",
+		Expires:  expiresAt,
+		Secure:   isSecureRequest(r),
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// clearAuthCookies 清除登录相关的Cookie
+func clearAuthCookies(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     refreshTokenCookie,
+		Value:    "",
+		Path:     "/api/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   isSecureRequest(r),
+		SameSite: http.SameSiteStrictMode,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     accessTokenCookie,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   isSecureRequest(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfTokenCookie,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		Secure:   isSecureRequest(r),
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// isSecureRequest 请求是否通过 HTTPS 到达，X-Forwarded-Proto 只在请求来自可信代理时采用
+func isSecureRequest(r *http.Request) bool {
+	return r.TLS != nil || (utils.FromTrustedProxy(r) && r.Header.Get("X-Forwarded-Proto") == "https")
+}
+
+// accessTokenExpiresIn 访问令牌有效期（秒），返回给客户端用于提前刷新
+func accessTokenExpiresIn() int {
+	config := utils.GetConfig()
+	return int(utils.AccessTokenTTL(config).Seconds())
+}
+
+// sessionToMap 会话列表的响应格式
+func sessionToMap(config *utils.Config, session *models.Session, currentSessionID int) map[string]interface{} {
+	return map[string]interface{}{
+		"id":           session.ID,
+		"ip_address":   session.IPAddress,
+		"user_agent":   session.UserAgent,
+		"location":     utils.ApproximateLocation(config, session.IPAddress),
+		"created_at":   session.CreatedAt.Format("2006-01-02 15:04:05"),
+		"last_seen_at": session.LastSeenAt.Format("2006-01-02 15:04:05"),
+		"last_seen":    getTimeAgo(session.LastSeenAt),
+		"expires_at":   session.ExpiresAt.Format("2006-01-02 15:04:05"),
+		"current":      session.ID == currentSessionID,
+	}
+}
+
+// listSessions 生成用户的活跃会话列表
+func listSessions(db *models.Database, userID, currentSessionID int) ([]map[string]interface{}, error) {
+	sessions, err := db.Sessions().ListActiveByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	
+	config := utils.GetConfig()
+	sessionList := make([]map[string]interface{}, len(sessions))
+	for i, session := range sessions {
+		sessionList[i] = sessionToMap(config, session, currentSessionID)
+	}
+	
+	return sessionList, nil
+}
+
+// GetSessionsHandler 获取当前用户已登录的设备
+func GetSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(int)
+	sessionID, _ := r.Context().Value("session_id").(int)
+	
+	db := models.GetDB()
+	sessionList, err := listSessions(db, userID, sessionID)
+	if err != nil {
+		authLog.ErrorContext(r.Context(), "获取会话列表失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "获取会话列表失败",
+		})
+		return
+	}
+	
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success":  true,
+		"sessions": sessionList,
+	})
+}
+
+// RevokeSessionHandler 注销当前用户的某个设备
+func RevokeSessionHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(int)
+	currentSessionID, _ := r.Context().Value("session_id").(int)
+	
+	sessionID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "无效的会话ID",
+		})
+		return
+	}
+	
+	db := models.GetDB()
+	if err := db.Sessions().RevokeForUser(userID, sessionID); err != nil {
+		if err == sql.ErrNoRows {
+			respondJSON(w, http.StatusNotFound, map[string]interface{}{
+				"success": false,
+				"message": "会话不存在",
+			})
+			return
+		}
+		authLog.ErrorContext(r.Context(), "撤销会话失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "撤销会话失败",
+		})
+		return
+	}
+	DisconnectSession(sessionID)
+	
+	if sessionID == currentSessionID {
+		clearAuthCookies(w, r)
+	}
+	
+	authLog.InfoContext(r.Context(), "用户 %d 注销了会话 %d", userID, sessionID)
+	
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "设备已退出登录",
+	})
+}
@@ -15,9 +15,9 @@ func GetUserStatsHandler(w http.ResponseWriter, r *http.Request) {
 	db := models.GetDB()
 	
 	// 获取用户信息
-	user, err := models.GetUserByID(db, userID)
+	user, err := db.Users().GetByID(userID)
 	if err != nil {
-		utils.Error("获取用户信息失败: %v", err)
+		utils.ErrorContext(r.Context(), "获取用户信息失败: %v", err)
 		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
 			"success": false,
 			"message": "获取用户信息失败",
@@ -25,87 +25,32 @@ func GetUserStatsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
-	// 统计收件箱邮件
-	var inboxCount, unreadCount, sentCount, starredCount, draftCount, trashCount int
-	
-	// 收件箱统计
-	db.QueryRow(`
-		SELECT COUNT(*) FROM emails 
-		WHERE recipient_id = ? AND is_deleted = 0 AND is_draft = 0
-	`, userID).Scan(&inboxCount)
-	
-	// 未读邮件统计
-	db.QueryRow(`
-		SELECT COUNT(*) FROM emails 
-		WHERE recipient_id = ? AND is_read = 0 AND is_deleted = 0 AND is_draft = 0
-	`, userID).Scan(&unreadCount)
-	
-	// 已发送邮件统计
-	db.QueryRow(`
-		SELECT COUNT(*) FROM emails 
-		WHERE sender_id = ? AND is_deleted = 0 AND is_draft = 0
-	`, userID).Scan(&sentCount)
-	
-	// 星标邮件统计
-	db.QueryRow(`
-		SELECT COUNT(*) FROM emails 
-		WHERE (sender_id = ? OR recipient_id = ?) 
-		  AND is_starred = 1 AND is_deleted = 0
-	`, userID, userID).Scan(&starredCount)
-	
-	// 草稿统计
-	db.QueryRow(`
-		SELECT COUNT(*) FROM emails 
-		WHERE sender_id = ? AND is_draft = 1 AND is_deleted = 0
-	`, userID).Scan(&draftCount)
-	
-	// 回收站统计
-	db.QueryRow(`
-		SELECT COUNT(*) FROM emails 
-		WHERE (sender_id = ? OR recipient_id = ?) AND is_deleted = 1
-	`, userID, userID).Scan(&trashCount)
+	// 统计各文件夹邮件
+	inboxCount, _ := db.Emails().CountByFolder(userID, "inbox")
+	unreadCount, _ := db.Emails().CountUnread(userID)
+	sentCount, _ := db.Emails().CountByFolder(userID, "sent")
+	starredCount, _ := db.Emails().CountByFolder(userID, "starred")
+	draftCount, _ := db.Emails().CountByFolder(userID, "drafts")
+	trashCount, _ := db.Emails().CountByFolder(userID, "trash")
 	
 	// 统计今日邮件
 	var todaySent, todayReceived int
-	today := time.Now().Format("2006-01-02")
-	
-	db.QueryRow(`
-		SELECT COUNT(*) FROM emails 
-		WHERE sender_id = ? AND DATE(created_at) = ? AND is_deleted = 0 AND is_draft = 0
-	`, userID, today).Scan(&todaySent)
-	
-	db.QueryRow(`
-		SELECT COUNT(*) FROM emails 
-		WHERE recipient_id = ? AND DATE(created_at) = ? AND is_deleted = 0 AND is_draft = 0
-	`, userID, today).Scan(&todayReceived)
+	today := startOfDay(time.Now())
+	if activity, err := db.Emails().Activity(userID, today); err == nil {
+		todaySent, todayReceived = activity.Sent, activity.Received
+	}
 	
-	// 统计最近7天邮件活动
+	// 统计最近7天邮件活动，最近的日期在前
 	var last7Days []map[string]interface{}
 	
-	rows, err := db.Query(`
-		SELECT DATE(created_at) as date, 
-		       SUM(CASE WHEN sender_id = ? THEN 1 ELSE 0 END) as sent,
-		       SUM(CASE WHEN recipient_id = ? THEN 1 ELSE 0 END) as received
-		FROM emails 
-		WHERE (sender_id = ? OR recipient_id = ?) 
-		  AND created_at >= DATE('now', '-7 days')
-		  AND is_deleted = 0 AND is_draft = 0
-		GROUP BY DATE(created_at)
-		ORDER BY date DESC
-	`, userID, userID, userID, userID)
-	
+	daily, err := db.Emails().DailyActivity(userID, today.AddDate(0, 0, -7))
 	if err == nil {
-		defer rows.Close()
-		for rows.Next() {
-			var date string
-			var sent, received int
-			if err := rows.Scan(&date, &sent, &received); err == nil {
-				last7Days = append(last7Days, map[string]interface{}{
-					"date":     date,
-					"sent":     sent,
-					"received": received,
-				})
-			}
+		for i := len(daily) - 1; i >= 0; i-- {
+			last7Days = append(last7Days, map[string]interface{}{
+				"date":     daily[i].Date,
+				"sent":     daily[i].Sent,
+				"received": daily[i].Received,
+			})
 		}
 	}
 	
@@ -118,21 +63,14 @@ func GetUserStatsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	// 获取附件统计
-	var attachmentCount int64
-	var attachmentSize int64
-	db.QueryRow(`
-		SELECT COUNT(*), COALESCE(SUM(file_size), 0) 
-		FROM attachments a
-		JOIN emails e ON a.email_id = e.id
-		WHERE e.sender_id = ? OR e.recipient_id = ?
-	`, userID, userID).Scan(&attachmentCount, &attachmentSize)
+	attachmentCount, _ := db.Attachments().CountByUser(userID)
+	attachmentSize, _ := db.Attachments().TotalSizeByUser(userID)
 	
 	// 获取活跃时间
 	var lastLoginTime string
-	db.QueryRow(`
-		SELECT MAX(created_at) FROM sessions 
-		WHERE user_id = ? AND expires_at > ?
-	`, userID, time.Now()).Scan(&lastLoginTime)
+	if lastLogin, err := db.Sessions().LastLoginAt(userID); err == nil {
+		lastLoginTime = lastLogin.Format("2006-01-02 15:04:05")
+	}
 	
 	respondJSON(w, http.StatusOK, map[string]interface{}{
 		"success": true,
@@ -177,30 +115,28 @@ func GetUserStatsHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// GetSystemStatsHandler 获取系统统计信息（公开）
-func GetSystemStatsHandler(w http.ResponseWriter, r *http.Request) {
+// GetPublicSystemStatsHandler 获取系统统计信息（公开）
+func GetPublicSystemStatsHandler(w http.ResponseWriter, r *http.Request) {
 	db := models.GetDB()
 	
 	// 获取基本统计
-	var totalUsers, activeUsers, totalEmails, todayEmails int
-	
-	db.QueryRow("SELECT COUNT(*) FROM users").Scan(&totalUsers)
-	db.QueryRow("SELECT COUNT(*) FROM users WHERE is_active = 1").Scan(&activeUsers)
-	db.QueryRow("SELECT COUNT(*) FROM emails WHERE is_deleted = 0").Scan(&totalEmails)
+	userTotals, err := db.Users().Totals()
+	if err != nil {
+		utils.ErrorContext(r.Context(), "获取用户统计失败: %v", err)
+		userTotals = &models.UserTotals{}
+	}
 	
-	today := time.Now().Format("2006-01-02")
-	db.QueryRow(`
-		SELECT COUNT(*) FROM emails 
-		WHERE DATE(created_at) = ? AND is_deleted = 0 AND is_draft = 0
-	`, today).Scan(&todayEmails)
+	emailTotals, err := db.Emails().Totals(startOfDay(time.Now()))
+	if err != nil {
+		utils.ErrorContext(r.Context(), "获取邮件统计失败: %v", err)
+		emailTotals = &models.EmailTotals{}
+	}
 	
 	// 获取存储统计
-	var totalStorageUsed, totalStorageCapacity int64
-	db.QueryRow("SELECT COALESCE(SUM(storage_used), 0) FROM users").Scan(&totalStorageUsed)
-	db.QueryRow("SELECT COALESCE(SUM(max_storage), 0) FROM users").Scan(&totalStorageCapacity)
+	totalStorageUsed, totalStorageCapacity := userTotals.StorageUsed, userTotals.StorageCapacity
 	
 	// 获取系统运行时间（从配置或环境变量）
-	config, _ := utils.LoadConfig("config.json")
+	config := utils.GetConfig()
 	
 	stats := map[string]interface{}{
 		"system": map[string]interface{}{
@@ -211,13 +147,13 @@ func GetSystemStatsHandler(w http.ResponseWriter, r *http.Request) {
 			"uptime":        "0 days", // 实际应该从启动时间计算
 		},
 		"users": map[string]interface{}{
-			"total":   totalUsers,
-			"active":  activeUsers,
+			"total":   userTotals.Total,
+			"active":  userTotals.Active,
 			"online":  0, // WebSocket在线用户数
 		},
 		"emails": map[string]interface{}{
-			"total":  totalEmails,
-			"today":  todayEmails,
+			"total":  emailTotals.Total,
+			"today":  emailTotals.Since,
 		},
 		"storage": map[string]interface{}{
 			"used":      float64(totalStorageUsed) / (1024 * 1024 * 1024), // GB
@@ -242,7 +178,6 @@ func GetActivityFeedHandler(w http.ResponseWriter, r *http.Request) {
 	
 	// 获取分页参数
 	limit := 20
-	page := 1
 	
 	db := models.GetDB()
 	
@@ -250,90 +185,53 @@ func GetActivityFeedHandler(w http.ResponseWriter, r *http.Request) {
 	activities := []map[string]interface{}{}
 	
 	// 查询发送的邮件
-	rows, err := db.Query(`
-		SELECT 'sent' as type, subject, recipient_email, created_at
-		FROM emails 
-		WHERE sender_id = ? AND is_deleted = 0 AND is_draft = 0
-		ORDER BY created_at DESC
-		LIMIT ?
-	`, userID, limit)
-	
+	sent, _, err := db.Emails().ListByFolder(userID, "sent", models.Page{Limit: limit})
 	if err == nil {
-		defer rows.Close()
-		for rows.Next() {
-			var activityType, subject, recipientEmail string
-			var createdAt time.Time
-			if err := rows.Scan(&activityType, &subject, &recipientEmail, &createdAt); err == nil {
-				activities = append(activities, map[string]interface{}{
-					"type":        activityType,
-					"title":       "发送邮件",
-					"description": subject,
-					"details":     "给 " + recipientEmail,
-					"time":        createdAt.Format("2006-01-02 15:04:05"),
-					"time_ago":    getTimeAgo(createdAt),
-					"icon":        "fas fa-paper-plane",
-					"color":       "primary",
-				})
-			}
+		for _, email := range sent {
+			activities = append(activities, map[string]interface{}{
+				"type":        "sent",
+				"title":       "发送邮件",
+				"description": email.Subject,
+				"details":     "给 " + email.RecipientEmail,
+				"time":        email.CreatedAt.Format("2006-01-02 15:04:05"),
+				"time_ago":    getTimeAgo(email.CreatedAt),
+				"icon":        "fas fa-paper-plane",
+				"color":       "primary",
+			})
 		}
 	}
 	
 	// 查询收到的邮件
-	rows, err = db.Query(`
-		SELECT 'received' as type, subject, sender_email, created_at
-		FROM emails 
-		WHERE recipient_id = ? AND is_deleted = 0 AND is_draft = 0
-		ORDER BY created_at DESC
-		LIMIT ?
-	`, userID, limit)
-	
+	received, _, err := db.Emails().ListByFolder(userID, "inbox", models.Page{Limit: limit})
 	if err == nil {
-		defer rows.Close()
-		for rows.Next() {
-			var activityType, subject, senderEmail string
-			var createdAt time.Time
-			if err := rows.Scan(&activityType, &subject, &senderEmail, &createdAt); err == nil {
-				activities = append(activities, map[string]interface{}{
-					"type":        activityType,
-					"title":       "收到邮件",
-					"description": subject,
-					"details":     "来自 " + senderEmail,
-					"time":        createdAt.Format("2006-01-02 15:04:05"),
-					"time_ago":    getTimeAgo(createdAt),
-					"icon":        "fas fa-envelope",
-					"color":       "success",
-				})
-			}
+		for _, email := range received {
+			activities = append(activities, map[string]interface{}{
+				"type":        "received",
+				"title":       "收到邮件",
+				"description": email.Subject,
+				"details":     "来自 " + email.SenderEmail,
+				"time":        email.CreatedAt.Format("2006-01-02 15:04:05"),
+				"time_ago":    getTimeAgo(email.CreatedAt),
+				"icon":        "fas fa-envelope",
+				"color":       "success",
+			})
 		}
 	}
 	
 	// 查询附件上传
-	rows, err = db.Query(`
-		SELECT 'attachment' as type, a.filename, e.subject, a.created_at
-		FROM attachments a
-		JOIN emails e ON a.email_id = e.id
-		WHERE e.sender_id = ?
-		ORDER BY a.created_at DESC
-		LIMIT ?
-	`, userID, limit/2)
-	
+	attachments, err := db.Attachments().ListRecentBySender(userID, limit/2)
 	if err == nil {
-		defer rows.Close()
-		for rows.Next() {
-			var activityType, filename, subject string
-			var createdAt time.Time
-			if err := rows.Scan(&activityType, &filename, &subject, &createdAt); err == nil {
-				activities = append(activities, map[string]interface{}{
-					"type":        activityType,
-					"title":       "上传附件",
-					"description": filename,
-					"details":     "邮件: " + subject,
-					"time":        createdAt.Format("2006-01-02 15:04:05"),
-					"time_ago":    getTimeAgo(createdAt),
-					"icon":        "fas fa-paperclip",
-					"color":       "warning",
-				})
-			}
+		for _, attachment := range attachments {
+			activities = append(activities, map[string]interface{}{
+				"type":        "attachment",
+				"title":       "上传附件",
+				"description": attachment.Filename,
+				"details":     "邮件: " + attachment.EmailSubject,
+				"time":        attachment.CreatedAt.Format("2006-01-02 15:04:05"),
+				"time_ago":    getTimeAgo(attachment.CreatedAt),
+				"icon":        "fas fa-paperclip",
+				"color":       "warning",
+			})
 		}
 	}
 	
@@ -379,30 +277,17 @@ func GetStorageAnalysisHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	// 计算邮件占用空间（估算）
-	var emailCount int
-	var emailSize int64
-	db.QueryRow(`
-		SELECT COUNT(*), SUM(LENGTH(body)) 
-		FROM emails 
-		WHERE (sender_id = ? OR recipient_id = ?) AND is_deleted = 0
-	`, userID, userID).Scan(&emailCount, &emailSize)
+	emailCount, emailSize, _ := db.Emails().BodySizeByUser(userID)
 	
 	if emailSize == 0 {
 		emailSize = int64(emailCount) * 1024 // 每封邮件估算1KB
 	}
 	
 	// 计算附件占用空间
-	var attachmentCount int64
-	var attachmentSize int64
-	db.QueryRow(`
-		SELECT COUNT(*), COALESCE(SUM(file_size), 0) 
-		FROM attachments a
-		JOIN emails e ON a.email_id = e.id
-		WHERE e.sender_id = ? OR e.recipient_id = ?
-	`, userID, userID).Scan(&attachmentCount, &attachmentSize)
+	attachmentSize, _ := db.Attachments().TotalSizeByUser(userID)
 	
 	// 获取用户总存储
-	user, err := models.GetUserByID(db, userID)
+	user, err := db.Users().GetByID(userID)
 	if err == nil {
 		totalUsed := user.StorageUsed
 		otherSize := totalUsed - emailSize - attachmentSize
@@ -440,29 +325,14 @@ func GetStorageAnalysisHandler(w http.ResponseWriter, r *http.Request) {
 		}
 		
 		// 获取存储使用趋势（最近30天）
-		rows, err := db.Query(`
-			SELECT DATE(created_at) as date,
-			       COALESCE(SUM(file_size), 0) as daily_size
-			FROM attachments a
-			JOIN emails e ON a.email_id = e.id
-			WHERE (e.sender_id = ? OR e.recipient_id = ?)
-			  AND a.created_at >= DATE('now', '-30 days')
-			GROUP BY DATE(created_at)
-			ORDER BY date
-		`, userID, userID)
-		
+		daily, err := db.Attachments().DailySizeByUser(userID, startOfDay(time.Now()).AddDate(0, 0, -30))
 		if err == nil {
-			defer rows.Close()
 			trend := []map[string]interface{}{}
-			for rows.Next() {
-				var date string
-				var dailySize int64
-				if err := rows.Scan(&date, &dailySize); err == nil {
-					trend = append(trend, map[string]interface{}{
-						"date": date,
-						"size": float64(dailySize) / (1024 * 1024),
-					})
-				}
+			for _, day := range daily {
+				trend = append(trend, map[string]interface{}{
+					"date": day.Date,
+					"size": float64(day.Size) / (1024 * 1024),
+				})
 			}
 			analysis["trend"] = trend
 		}
@@ -490,41 +360,27 @@ func GetEmailAnalyticsHandler(w http.ResponseWriter, r *http.Request) {
 		"charts": map[string]interface{}{},
 	}
 	
-	// 根据时间段构建SQL条件
-	var dateCondition string
+	// 根据时间段计算起始时间
+	today := startOfDay(time.Now())
+	var since time.Time
 	switch period {
 	case "day":
-		dateCondition = "DATE(created_at) = DATE('now')"
+		since = today
 	case "week":
-		dateCondition = "created_at >= DATE('now', '-7 days')"
+		since = today.AddDate(0, 0, -7)
 	case "month":
-		dateCondition = "created_at >= DATE('now', '-30 days')"
+		since = today.AddDate(0, 0, -30)
 	case "year":
-		dateCondition = "created_at >= DATE('now', '-365 days')"
+		since = today.AddDate(0, 0, -365)
 	default:
-		dateCondition = "created_at >= DATE('now', '-30 days')"
-	}
-	
-	// 获取发送和接收统计
-	var sentCount, receivedCount int
-	db.QueryRow(`
-		SELECT 
-			SUM(CASE WHEN sender_id = ? THEN 1 ELSE 0 END),
-			SUM(CASE WHEN recipient_id = ? THEN 1 ELSE 0 END)
-		FROM emails 
-		WHERE (sender_id = ? OR recipient_id = ?)
-		  AND `+dateCondition+`
-		  AND is_deleted = 0 AND is_draft = 0
-	`, userID, userID, userID, userID).Scan(&sentCount, &receivedCount)
-	
-	// 获取阅读率
-	var readCount int
-	db.QueryRow(`
-		SELECT COUNT(*) FROM emails 
-		WHERE recipient_id = ? AND is_read = 1
-		  AND `+dateCondition+`
-		  AND is_deleted = 0 AND is_draft = 0
-	`, userID).Scan(&readCount)
+		since = today.AddDate(0, 0, -30)
+	}
+	
+	// 获取发送、接收和已读统计
+	var sentCount, receivedCount, readCount int
+	if activity, err := db.Emails().Activity(userID, since); err == nil {
+		sentCount, receivedCount, readCount = activity.Sent, activity.Received, activity.Read
+	}
 	
 	readRate := 0.0
 	if receivedCount > 0 {
@@ -533,63 +389,27 @@ func GetEmailAnalyticsHandler(w http.ResponseWriter, r *http.Request) {
 	
 	// 获取热门联系人
 	topContacts := []map[string]interface{}{}
-	rows, err := db.Query(`
-		SELECT 
-			CASE 
-				WHEN sender_id = ? THEN recipient_email
-				ELSE sender_email
-			END as contact_email,
-			COUNT(*) as email_count
-		FROM emails 
-		WHERE (sender_id = ? OR recipient_id = ?)
-		  AND `+dateCondition+`
-		  AND is_deleted = 0 AND is_draft = 0
-		GROUP BY contact_email
-		ORDER BY email_count DESC
-		LIMIT 10
-	`, userID, userID, userID)
-	
+	contacts, err := db.Emails().TopContacts(userID, since, 10)
 	if err == nil {
-		defer rows.Close()
-		for rows.Next() {
-			var contactEmail string
-			var emailCount int
-			if err := rows.Scan(&contactEmail, &emailCount); err == nil {
-				topContacts = append(topContacts, map[string]interface{}{
-					"email": contactEmail,
-					"count": emailCount,
-				})
-			}
+		for _, contact := range contacts {
+			topContacts = append(topContacts, map[string]interface{}{
+				"email": contact.Email,
+				"count": contact.Count,
+			})
 		}
 	}
 	
 	// 获取时间段内每天的邮件数量
 	dailyStats := []map[string]interface{}{}
-	rows, err = db.Query(`
-		SELECT DATE(created_at) as date,
-		       SUM(CASE WHEN sender_id = ? THEN 1 ELSE 0 END) as sent,
-		       SUM(CASE WHEN recipient_id = ? THEN 1 ELSE 0 END) as received
-		FROM emails 
-		WHERE (sender_id = ? OR recipient_id = ?)
-		  AND `+dateCondition+`
-		  AND is_deleted = 0 AND is_draft = 0
-		GROUP BY DATE(created_at)
-		ORDER BY date
-	`, userID, userID, userID, userID)
-	
+	daily, err := db.Emails().DailyActivity(userID, since)
 	if err == nil {
-		defer rows.Close()
-		for rows.Next() {
-			var date string
-			var sent, received int
-			if err := rows.Scan(&date, &sent, &received); err == nil {
-				dailyStats = append(dailyStats, map[string]interface{}{
-					"date":     date,
-					"sent":     sent,
-					"received": received,
-					"total":    sent + received,
-				})
-			}
+		for _, day := range daily {
+			dailyStats = append(dailyStats, map[string]interface{}{
+				"date":     day.Date,
+				"sent":     day.Sent,
+				"received": day.Received,
+				"total":    day.Sent + day.Received,
+			})
 		}
 	}
 	
@@ -618,7 +438,7 @@ func GetEmailAnalyticsHandler(w http.ResponseWriter, r *http.Request) {
 	
 	analytics["charts"] = map[string]interface{}{
 		"daily": dailyStats,
-		"by_hour": getEmailByHour(db, userID, dateCondition),
+		"by_hour": getEmailByHour(db, userID, since),
 	}
 	
 	respondJSON(w, http.StatusOK, map[string]interface{}{
@@ -628,7 +448,7 @@ func GetEmailAnalyticsHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // getEmailByHour 获取按小时分布的邮件统计
-func getEmailByHour(db *models.Database, userID int, dateCondition string) []map[string]interface{} {
+func getEmailByHour(db *models.Database, userID int, since time.Time) []map[string]interface{} {
 	hourlyStats := make([]map[string]interface{}, 24)
 	
 	// 初始化24小时
@@ -641,32 +461,16 @@ func getEmailByHour(db *models.Database, userID int, dateCondition string) []map
 		}
 	}
 	
-	rows, err := db.Query(`
-		SELECT 
-			strftime('%H', created_at) as hour,
-			SUM(CASE WHEN sender_id = ? THEN 1 ELSE 0 END) as sent,
-			SUM(CASE WHEN recipient_id = ? THEN 1 ELSE 0 END) as received
-		FROM emails 
-		WHERE (sender_id = ? OR recipient_id = ?)
-		  AND `+dateCondition+`
-		  AND is_deleted = 0 AND is_draft = 0
-		GROUP BY strftime('%H', created_at)
-	`, userID, userID, userID, userID)
-	
+	hourly, err := db.Emails().HourlyActivity(userID, since)
 	if err == nil {
-		defer rows.Close()
-		for rows.Next() {
-			var hourStr string
-			var sent, received int
-			if err := rows.Scan(&hourStr, &sent, &received); err == nil {
-				hour, _ := strconv.Atoi(hourStr)
-				if hour >= 0 && hour < 24 {
-					hourlyStats[hour] = map[string]interface{}{
-						"hour":     hour,
-						"sent":     sent,
-						"received": received,
-						"total":    sent + received,
-					}
+		for _, activity := range hourly {
+			hour := activity.Hour
+			if hour >= 0 && hour < 24 {
+				hourlyStats[hour] = map[string]interface{}{
+					"hour":     hour,
+					"sent":     activity.Sent,
+					"received": activity.Received,
+					"total":    activity.Sent + activity.Received,
 				}
 			}
 		}
@@ -675,14 +479,19 @@ func getEmailByHour(db *models.Database, userID int, dateCondition string) []map
 	return hourlyStats
 }
 
+// startOfDay 返回 t 所在日期的零点（本地时间）
+func startOfDay(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
+
 // CleanupOldDataHandler 清理旧数据
 func CleanupOldDataHandler(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value("user_id").(int)
 	
 	// 验证管理员权限
 	db := models.GetDB()
-	user, err := models.GetUserByID(db, userID)
-	if err != nil || !user.IsAdmin {
+	if !hasPermission(r, models.PermSystemManage) {
 		respondJSON(w, http.StatusForbidden, map[string]interface{}{
 			"success": false,
 			"message": "需要管理员权限",
@@ -720,31 +529,21 @@ func CleanupOldDataHandler(w http.ResponseWriter, r *http.Request) {
 	if !params.DryRun {
 		// 实际删除操作
 		// 1. 删除旧的会话记录
-		res, err := db.Exec(`
-			DELETE FROM sessions 
-			WHERE expires_at < ?
-		`, deleteBefore)
-		
+		deletedSessions, err := db.Sessions().DeleteExpired(time.Duration(params.DaysOld) * 24 * time.Hour)
 		if err == nil {
-			rowsAffected, _ := res.RowsAffected()
-			results["deleted"].(map[string]int)["sessions"] = int(rowsAffected)
+			results["deleted"].(map[string]int)["sessions"] = int(deletedSessions)
 		}
 		
 		// 2. 删除已删除的邮件（保留30天）
 		emailDeleteBefore := time.Now().AddDate(0, 0, -30)
-		res, err = db.Exec(`
-			DELETE FROM emails 
-			WHERE is_deleted = 1 AND updated_at < ?
-		`, emailDeleteBefore)
-		
+		deletedEmails, err := db.Emails().PurgeTrash(emailDeleteBefore)
 		if err == nil {
-			rowsAffected, _ := res.RowsAffected()
-			results["deleted"].(map[string]int)["emails"] = int(rowsAffected)
+			results["deleted"].(map[string]int)["emails"] = int(deletedEmails)
 		}
 		
 		// 3. 清理空的临时文件（这里需要实现文件系统清理）
 		
-		utils.Info("管理员 %d 执行了数据清理操作: %v", userID, results)
+		utils.InfoContext(r.Context(), "管理员 %d 执行了数据清理操作: %v", userID, results)
 	}
 	
 	respondJSON(w, http.StatusOK, map[string]interface{}{
@@ -4,6 +4,7 @@ import (
 	"SwiftPost/models"
 	"SwiftPost/utils"
 	"bytes"
+	"context"
 	"database/sql"
 	"fmt"
 	"html/template"
@@ -28,12 +29,8 @@ type TemplateData struct {
 
 var templates *template.Template
 
-func init() {
-	// 加载模板
-	loadTemplates()
-}
-
-func loadTemplates() {
+// LoadTemplates 加载页面模板，启动服务器时调用。子命令不需要模板，也不会输出加载信息
+func LoadTemplates() {
 	templates = template.New("").Funcs(template.FuncMap{
 		"formatTime": func(t time.Time) string {
 			return t.Format("2006-01-02 15:04:05")
@@ -138,7 +135,7 @@ func createDefaultTemplates() {
 	templates.Parse(baseTemplate)
 }
 
-func renderTemplate(w http.ResponseWriter, name string, data *TemplateData) {
+func renderTemplate(ctx context.Context, w http.ResponseWriter, name string, data *TemplateData) {
 	// 设置默认值
 	if data == nil {
 		data = &TemplateData{}
@@ -152,7 +149,7 @@ func renderTemplate(w http.ResponseWriter, name string, data *TemplateData) {
 	var buf bytes.Buffer
 	err := templates.ExecuteTemplate(&buf, name, data)
 	if err != nil {
-		utils.Error("执行模板失败: %v", err)
+		utils.ErrorContext(ctx, "执行模板失败: %v", err)
 		http.Error(w, "内部服务器错误", http.StatusInternalServerError)
 		return
 	}
@@ -165,72 +162,56 @@ func IndexHandler(w http.ResponseWriter, r *http.Request) {
 	data := &TemplateData{
 		Title: "安全邮件服务",
 	}
-	renderTemplate(w, "index.html", data)
+	renderTemplate(r.Context(), w, "index.html", data)
 }
 
 func LoginPageHandler(w http.ResponseWriter, r *http.Request) {
 	data := &TemplateData{
 		Title: "用户登录",
 	}
-	renderTemplate(w, "login.html", data)
+	renderTemplate(r.Context(), w, "login.html", data)
 }
 
 func RegisterPageHandler(w http.ResponseWriter, r *http.Request) {
 	data := &TemplateData{
 		Title: "用户注册",
 	}
-	renderTemplate(w, "register.html", data)
+	renderTemplate(r.Context(), w, "register.html", data)
 }
 
 func DashboardHandler(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value("user_id").(int)
 	
 	db := models.GetDB()
-	user, err := models.GetUserByID(db, userID)
+	user, err := db.Users().GetByID(userID)
 	if err != nil {
-		utils.Error("获取用户信息失败: %v", err)
+		utils.ErrorContext(r.Context(), "获取用户信息失败: %v", err)
 		http.Error(w, "内部服务器错误", http.StatusInternalServerError)
 		return
 	}
 	
 	// 获取统计数据
-	var unreadCount int
-	err = db.QueryRow(`
-		SELECT COUNT(*) FROM emails 
-		WHERE recipient_id = ? AND is_read = 0 AND is_deleted = 0 AND is_draft = 0
-	`, userID).Scan(&unreadCount)
+	unreadCount, err := db.Emails().CountUnread(userID)
 	if err != nil {
 		unreadCount = 0
 	}
 	
 	// 获取收件箱邮件
-	emails, err := models.GetEmailsByRecipient(db, userID, 10, 0, "inbox")
+	emails, _, err := db.Emails().ListByFolder(userID, "inbox", models.Page{Limit: 10})
 	if err != nil {
-		utils.Error("获取邮件失败: %v", err)
+		utils.ErrorContext(r.Context(), "获取邮件失败: %v", err)
 		emails = []*models.Email{}
 	}
 	
-	// 获取发件人信息
 	emailData := make([]map[string]interface{}, len(emails))
 	for i, email := range emails {
-		sender, _ := models.GetUserByID(db, email.SenderID)
-		senderName := email.SenderEmail
-		if sender != nil {
-			senderName = sender.Username
-		}
-		
-		bodyPreview := getBodyPreview(email.Body)
-		if len(bodyPreview) > 100 {
-			bodyPreview = bodyPreview[:100] + "..."
-		}
-		
 		emailData[i] = map[string]interface{}{
 			"id":              email.ID,
 			"uuid":            email.UUID,
-			"sender_name":     senderName,
+			"sender_name":     email.SenderName,
 			"sender_email":    email.SenderEmail,
 			"subject":         email.Subject,
-			"body_preview":    bodyPreview,
+			"body_preview":    email.Preview,
 			"is_read":         email.IsRead,
 			"is_starred":      email.IsStarred,
 			"has_attachment":  email.HasAttachment,
@@ -258,7 +239,7 @@ func DashboardHandler(w http.ResponseWriter, r *http.Request) {
 		},
 	}
 	
-	renderTemplate(w, "dashboard.html", data)
+	renderTemplate(r.Context(), w, "dashboard.html", data)
 }
 
 func EmailViewHandler(w http.ResponseWriter, r *http.Request) {
@@ -268,13 +249,13 @@ func EmailViewHandler(w http.ResponseWriter, r *http.Request) {
 	db := models.GetDB()
 	
 	// 获取邮件
-	email, err := models.GetEmailByID(db, emailID)
+	email, err := db.Emails().GetByID(emailID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			http.Error(w, "邮件不存在", http.StatusNotFound)
 			return
 		}
-		utils.Error("获取邮件失败: %v", err)
+		utils.ErrorContext(r.Context(), "获取邮件失败: %v", err)
 		http.Error(w, "内部服务器错误", http.StatusInternalServerError)
 		return
 	}
@@ -286,9 +267,9 @@ func EmailViewHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	// 获取用户信息
-	user, _ := models.GetUserByID(db, userID)
-	sender, _ := models.GetUserByID(db, email.SenderID)
-	recipient, _ := models.GetUserByID(db, email.RecipientID)
+	user, _ := db.Users().GetByID(userID)
+	sender, _ := db.Users().GetByID(email.SenderID)
+	recipient, _ := db.Users().GetByID(email.RecipientID)
 	
 	senderName := email.SenderEmail
 	if sender != nil {
@@ -302,12 +283,12 @@ func EmailViewHandler(w http.ResponseWriter, r *http.Request) {
 	
 	// 如果是收件人且未读，标记为已读
 	if email.RecipientID == userID && !email.IsRead {
-		models.MarkAsRead(db, email.ID)
+		db.Emails().MarkAsRead(email.ID)
 		email.IsRead = true
 	}
 	
 	// 获取附件
-	attachments, _ := models.GetAttachmentsByEmail(db, email.ID)
+	attachments, _ := db.Attachments().ListByEmail(email.ID)
 	
 	data := &TemplateData{
 		Title: email.Subject,
@@ -334,36 +315,28 @@ func EmailViewHandler(w http.ResponseWriter, r *http.Request) {
 		},
 	}
 	
-	renderTemplate(w, "email.html", data)
+	renderTemplate(r.Context(), w, "email.html", data)
 }
 
 func ProfileHandler(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value("user_id").(int)
 	
 	db := models.GetDB()
-	user, err := models.GetUserByID(db, userID)
+	user, err := db.Users().GetByID(userID)
 	if err != nil {
-		utils.Error("获取用户信息失败: %v", err)
+		utils.ErrorContext(r.Context(), "获取用户信息失败: %v", err)
 		http.Error(w, "内部服务器错误", http.StatusInternalServerError)
 		return
 	}
 	
 	// 统计未读邮件
-	var unreadCount int
-	err = db.QueryRow(`
-		SELECT COUNT(*) FROM emails 
-		WHERE recipient_id = ? AND is_read = 0 AND is_deleted = 0 AND is_draft = 0
-	`, userID).Scan(&unreadCount)
+	unreadCount, err := db.Emails().CountUnread(userID)
 	if err != nil {
 		unreadCount = 0
 	}
 	
 	// 统计已发送邮件
-	var sentCount int
-	err = db.QueryRow(`
-		SELECT COUNT(*) FROM emails 
-		WHERE sender_id = ? AND is_deleted = 0 AND is_draft = 0
-	`, userID).Scan(&sentCount)
+	sentCount, err := db.Emails().CountByFolder(userID, "sent")
 	if err != nil {
 		sentCount = 0
 	}
@@ -394,48 +367,47 @@ func ProfileHandler(w http.ResponseWriter, r *http.Request) {
 		},
 	}
 	
-	renderTemplate(w, "profile.html", data)
+	renderTemplate(r.Context(), w, "profile.html", data)
 }
 
 func AdminHandler(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value("user_id").(int)
 	
 	db := models.GetDB()
-	user, err := models.GetUserByID(db, userID)
+	user, err := db.Users().GetByID(userID)
 	if err != nil {
-		utils.Error("获取用户信息失败: %v", err)
+		utils.ErrorContext(r.Context(), "获取用户信息失败: %v", err)
 		http.Error(w, "内部服务器错误", http.StatusInternalServerError)
 		return
 	}
 	
-	if !user.IsAdmin {
+	if len(requestPermissions(r)) == 0 {
 		http.Error(w, "需要管理员权限", http.StatusForbidden)
 		return
 	}
 	
 	// 获取用户统计
-	userCount, err := models.CountUsers(db)
+	userCount, err := db.Users().Count()
 	if err != nil {
 		userCount = 0
 	}
 	
 	// 获取邮件统计
-	emailCount, err := models.CountAllEmails(db)
+	emailCount, err := db.Emails().Count()
 	if err != nil {
 		emailCount = 0
 	}
 	
 	// 获取最近的用户
-	recentUsers, err := models.GetAllUsers(db, 10, 0)
+	recentUsers, _, err := db.Users().List(models.Page{Limit: 10})
 	if err != nil {
 		recentUsers = []*models.User{}
 	}
 	
 	// 获取系统存储使用情况
 	var totalStorageUsed int64
-	err = db.QueryRow("SELECT SUM(storage_used) FROM users").Scan(&totalStorageUsed)
-	if err != nil {
-		totalStorageUsed = 0
+	if totals, err := db.Users().Totals(); err == nil {
+		totalStorageUsed = totals.StorageUsed
 	}
 	
 	data := &TemplateData{
@@ -452,11 +424,11 @@ func AdminHandler(w http.ResponseWriter, r *http.Request) {
 		},
 	}
 	
-	renderTemplate(w, "admin.html", data)
+	renderTemplate(r.Context(), w, "admin.html", data)
 }
 
 func BlockedHandler(w http.ResponseWriter, r *http.Request) {
-	config, _ := utils.LoadConfig("config.json")
+	config := utils.GetConfig()
 	
 	data := &TemplateData{
 		Title:         "访问受限",
@@ -464,12 +436,12 @@ func BlockedHandler(w http.ResponseWriter, r *http.Request) {
 		MainDomain:    config.Server.Domain + ":" + config.Server.Port,
 	}
 	
-	renderTemplate(w, "blocked.html", data)
+	renderTemplate(r.Context(), w, "blocked.html", data)
 }
 
 func CustomDomainHandler(w http.ResponseWriter, r *http.Request) {
 	// 检查是否是主域名
-	config, _ := utils.LoadConfig("config.json")
+	config := utils.GetConfig()
 	mainDomain := config.Server.Domain
 	
 	if r.Host == mainDomain+":"+config.Server.Port || 
@@ -502,50 +474,3 @@ func CustomDomainHandler(w http.ResponseWriter, r *http.Request) {
 	// 自定义域名访问，显示阻止页面
 	BlockedHandler(w, r)
 }
-
-// 辅助函数
-func getBodyPreview(body string) string {
-	// 移除HTML标签
-	plainText := stripHTML(body)
-	
-	// 截取前100个字符
-	if len(plainText) > 100 {
-		return plainText[:100] + "..."
-	}
-	return plainText
-}
-
-func stripHTML(html string) string {
-	var result strings.Builder
-	var inTag bool
-	
-	for _, c := range html {
-		if c == '<' {
-			inTag = true
-		} else if c == '>' {
-			inTag = false
-		} else if !inTag {
-			result.WriteRune(c)
-		}
-	}
-	
-	return result.String()
-}
-
-func getTimeAgo(t time.Time) string {
-	duration := time.Since(t)
-	
-	if duration < time.Minute {
-		return "刚刚"
-	} else if duration < time.Hour {
-		return fmt.Sprintf("%d分钟前", int(duration.Minutes()))
-	} else if duration < 24*time.Hour {
-		return fmt.Sprintf("%d小时前", int(duration.Hours()))
-	} else if duration < 30*24*time.Hour {
-		return fmt.Sprintf("%d天前", int(duration.Hours()/24))
-	} else if duration < 365*24*time.Hour {
-		return fmt.Sprintf("%d个月前", int(duration.Hours()/(24*30)))
-	} else {
-		return fmt.Sprintf("%d年前", int(duration.Hours()/(24*365)))
-	}
-}
\ No newline at end of file
@@ -0,0 +1,743 @@
+package handlers
+
+import (
+	"SwiftPost/models"
+	"SwiftPost/utils"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	webAuthnCeremonyRegistration = "registration"
+	webAuthnCeremonyLogin        = "login"
+	maxCredentialNameLength      = 64
+)
+
+// webAuthnUser 把用户和已注册的凭据适配为 webauthn.User
+type webAuthnUser struct {
+	user  *models.User
+	creds []*models.WebAuthnCredential
+}
+
+func (u *webAuthnUser) WebAuthnID() []byte {
+	return webAuthnUserHandle(u.user.ID)
+}
+
+func (u *webAuthnUser) WebAuthnName() string {
+	return u.user.Email
+}
+
+func (u *webAuthnUser) WebAuthnDisplayName() string {
+	return u.user.Username
+}
+
+func (u *webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, 0, len(u.creds))
+	for _, cred := range u.creds {
+		credentials = append(credentials, toWebAuthnCredential(cred))
+	}
+	return credentials
+}
+
+// webAuthnUserHandle 认证器中保存的用户句柄，无用户名登录时据此找回用户
+func webAuthnUserHandle(userID int) []byte {
+	return []byte(strconv.Itoa(userID))
+}
+
+// toWebAuthnCredential 把数据库中的凭据转换为 webauthn 库使用的结构
+func toWebAuthnCredential(cred *models.WebAuthnCredential) webauthn.Credential {
+	var transports []protocol.AuthenticatorTransport
+	for _, t := range strings.Split(cred.Transports, ",") {
+		if t != "" {
+			transports = append(transports, protocol.AuthenticatorTransport(t))
+		}
+	}
+	
+	return webauthn.Credential{
+		ID:              cred.CredentialID,
+		PublicKey:       cred.PublicKey,
+		AttestationType: cred.AttestationType,
+		Transport:       transports,
+		Flags:           webauthn.NewCredentialFlags(protocol.AuthenticatorFlags(cred.Flags)),
+		Authenticator: webauthn.Authenticator{
+			AAGUID:    cred.AAGUID,
+			SignCount: cred.SignCount,
+		},
+	}
+}
+
+// loadWebAuthnUser 加载用户及其凭据
+func loadWebAuthnUser(db *models.Database, userID int) (*webAuthnUser, error) {
+	user, err := db.Users().GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	
+	creds, err := models.GetWebAuthnCredentialsByUser(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	
+	return &webAuthnUser{user: user, creds: creds}, nil
+}
+
+// webAuthnOrigins 允许发起WebAuthn请求的来源，未配置时根据域名和端口推导
+func webAuthnOrigins(config *utils.Config) []string {
+	if len(config.WebAuthn.RPOrigins) > 0 {
+		return config.WebAuthn.RPOrigins
+	}
+	
+	domain := config.Server.Domain
+	port := config.Server.Port
+	origins := []string{"https://" + domain}
+	if port != "" && port != "443" {
+		origins = append(origins, fmt.Sprintf("https://%s:%s", domain, port))
+	}
+	if !config.Server.SSL.Enabled {
+		if port == "" || port == "80" {
+			origins = append(origins, "http://"+domain)
+		} else {
+			origins = append(origins, fmt.Sprintf("http://%s:%s", domain, port))
+		}
+	}
+	return origins
+}
+
+// newWebAuthn 根据配置创建依赖方（RP）实例
+func newWebAuthn(config *utils.Config) (*webauthn.WebAuthn, error) {
+	rpID := config.WebAuthn.RPID
+	if rpID == "" {
+		rpID = config.Server.Domain
+	}
+	
+	displayName := config.WebAuthn.RPDisplayName
+	if displayName == "" {
+		displayName = "SwiftPost"
+	}
+	
+	timeout := webAuthnTimeout(config)
+	return webauthn.New(&webauthn.Config{
+		RPID:          rpID,
+		RPDisplayName: displayName,
+		RPOrigins:     webAuthnOrigins(config),
+		Timeouts: webauthn.TimeoutsConfig{
+			Login:        webauthn.TimeoutConfig{Enforce: true, Timeout: timeout, TimeoutUVD: timeout},
+			Registration: webauthn.TimeoutConfig{Enforce: true, Timeout: timeout, TimeoutUVD: timeout},
+		},
+	})
+}
+
+func webAuthnTimeout(config *utils.Config) time.Duration {
+	if config.WebAuthn.Timeout <= 0 {
+		return 5 * time.Minute
+	}
+	return time.Duration(config.WebAuthn.Timeout) * time.Second
+}
+
+// saveWebAuthnChallenge 保存流程数据，返回交给客户端的挑战ID
+func saveWebAuthnChallenge(db *models.Database, config *utils.Config, userID int, ceremony string, session *webauthn.SessionData) (string, error) {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return "", err
+	}
+	
+	id := uuid.New().String()
+	expiresAt := time.Now().Add(webAuthnTimeout(config))
+	if err := models.SaveWebAuthnChallenge(db, id, userID, ceremony, string(data), expiresAt); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// loadWebAuthnChallenge 取出流程数据，挑战只能使用一次
+func loadWebAuthnChallenge(db *models.Database, id, ceremony string) (int, *webauthn.SessionData, error) {
+	userID, data, err := models.ConsumeWebAuthnChallenge(db, id, ceremony)
+	if err != nil {
+		return 0, nil, err
+	}
+	
+	var session webauthn.SessionData
+	if err := json.Unmarshal([]byte(data), &session); err != nil {
+		return 0, nil, err
+	}
+	return userID, &session, nil
+}
+
+// GetWebAuthnCredentialsHandler 列出当前用户的安全密钥和通行密钥
+func GetWebAuthnCredentialsHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(int)
+	
+	creds, err := models.GetWebAuthnCredentialsByUser(models.GetDB(), userID)
+	if err != nil {
+		authLog.ErrorContext(r.Context(), "获取WebAuthn凭据失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "获取安全密钥失败",
+		})
+		return
+	}
+	
+	if creds == nil {
+		creds = []*models.WebAuthnCredential{}
+	}
+	
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success":     true,
+		"credentials": creds,
+	})
+}
+
+// BeginWebAuthnRegistrationHandler 开始注册安全密钥，返回传给 navigator.credentials.create 的参数
+func BeginWebAuthnRegistrationHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(int)
+	
+	config := utils.GetConfig()
+	wa, err := newWebAuthn(config)
+	if err != nil {
+		authLog.ErrorContext(r.Context(), "WebAuthn配置无效: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "安全密钥功能配置错误",
+		})
+		return
+	}
+	
+	db := models.GetDB()
+	waUser, err := loadWebAuthnUser(db, userID)
+	if err != nil {
+		authLog.ErrorContext(r.Context(), "获取用户信息失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "服务器内部错误",
+		})
+		return
+	}
+	
+	// 已注册的凭据不允许重复注册；尽量创建可发现凭据，以便用于无密码登录
+	creation, session, err := wa.BeginRegistration(waUser,
+		webauthn.WithExclusions(webauthn.Credentials(waUser.WebAuthnCredentials()).CredentialDescriptors()),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementPreferred),
+	)
+	if err != nil {
+		authLog.ErrorContext(r.Context(), "开始注册安全密钥失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "服务器内部错误",
+		})
+		return
+	}
+	
+	challengeID, err := saveWebAuthnChallenge(db, config, userID, webAuthnCeremonyRegistration, session)
+	if err != nil {
+		authLog.ErrorContext(r.Context(), "保存WebAuthn挑战失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "服务器内部错误",
+		})
+		return
+	}
+	
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success":      true,
+		"challenge_id": challengeID,
+		"options":      creation,
+	})
+}
+
+// FinishWebAuthnRegistrationHandler 验证认证器的注册响应并保存凭据
+func FinishWebAuthnRegistrationHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(int)
+	
+	var req struct {
+		ChallengeID string          `json:"challenge_id"`
+		Name        string          `json:"name"`
+		Credential  json.RawMessage `json:"credential"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ChallengeID == "" || len(req.Credential) == 0 {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "无效的请求格式",
+		})
+		return
+	}
+	
+	req.Name = strings.TrimSpace(req.Name)
+	if len([]rune(req.Name)) > maxCredentialNameLength {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "名称不能超过64个字符",
+		})
+		return
+	}
+	
+	db := models.GetDB()
+	ownerID, session, err := loadWebAuthnChallenge(db, req.ChallengeID, webAuthnCeremonyRegistration)
+	if err != nil || ownerID != userID {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "注册已过期，请重试",
+		})
+		return
+	}
+	
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(req.Credential)
+	if err != nil {
+		authLog.WarnContext(r.Context(), "解析安全密钥注册响应失败: %v", err)
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "无效的安全密钥响应",
+		})
+		return
+	}
+	
+	config := utils.GetConfig()
+	wa, err := newWebAuthn(config)
+	if err != nil {
+		authLog.ErrorContext(r.Context(), "WebAuthn配置无效: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "安全密钥功能配置错误",
+		})
+		return
+	}
+	
+	waUser, err := loadWebAuthnUser(db, userID)
+	if err != nil {
+		authLog.ErrorContext(r.Context(), "获取用户信息失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "服务器内部错误",
+		})
+		return
+	}
+	
+	credential, err := wa.CreateCredential(waUser, *session, parsed)
+	if err != nil {
+		authLog.WarnContext(r.Context(), "安全密钥注册验证失败: %v", err)
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "安全密钥验证失败",
+		})
+		return
+	}
+	
+	if req.Name == "" {
+		req.Name = fmt.Sprintf("安全密钥 %d", len(waUser.creds)+1)
+	}
+	
+	transports := make([]string, 0, len(credential.Transport))
+	for _, t := range credential.Transport {
+		transports = append(transports, string(t))
+	}
+	
+	id, err := models.CreateWebAuthnCredential(db, &models.WebAuthnCredential{
+		UserID:          userID,
+		CredentialID:    credential.ID,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		AAGUID:          credential.Authenticator.AAGUID,
+		SignCount:       credential.Authenticator.SignCount,
+		Transports:      strings.Join(transports, ","),
+		Flags:           uint8(credential.Flags.ProtocolValue()),
+		Name:            req.Name,
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE") {
+			respondJSON(w, http.StatusConflict, map[string]interface{}{
+				"success": false,
+				"message": "该安全密钥已注册",
+			})
+			return
+		}
+		authLog.ErrorContext(r.Context(), "保存WebAuthn凭据失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "保存安全密钥失败",
+		})
+		return
+	}
+	
+	authLog.InfoContext(r.Context(), "用户 %d 注册了安全密钥: %s", userID, req.Name)
+	
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "安全密钥已添加",
+		"id":      id,
+	})
+}
+
+// RenameWebAuthnCredentialHandler 重命名安全密钥
+func RenameWebAuthnCredentialHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(int)
+	credID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "无效的安全密钥ID",
+		})
+		return
+	}
+	
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "无效的请求格式",
+		})
+		return
+	}
+	
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len([]rune(req.Name)) > maxCredentialNameLength {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "名称不能为空且不能超过64个字符",
+		})
+		return
+	}
+	
+	if err := models.RenameWebAuthnCredential(models.GetDB(), userID, credID, req.Name); err != nil {
+		if err == sql.ErrNoRows {
+			respondJSON(w, http.StatusNotFound, map[string]interface{}{
+				"success": false,
+				"message": "安全密钥不存在",
+			})
+			return
+		}
+		authLog.ErrorContext(r.Context(), "重命名WebAuthn凭据失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "重命名失败",
+		})
+		return
+	}
+	
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "安全密钥已重命名",
+	})
+}
+
+// DeleteWebAuthnCredentialHandler 删除安全密钥，需要验证密码
+func DeleteWebAuthnCredentialHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(int)
+	isAdmin, _ := r.Context().Value("is_admin").(bool)
+	credID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "无效的安全密钥ID",
+		})
+		return
+	}
+	
+	var req struct {
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "无效的请求格式",
+		})
+		return
+	}
+	
+	db := models.GetDB()
+	user, err := db.Users().GetByID(userID)
+	if err != nil {
+		authLog.ErrorContext(r.Context(), "获取用户信息失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "服务器内部错误",
+		})
+		return
+	}
+	
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)) != nil {
+		respondJSON(w, http.StatusUnauthorized, map[string]interface{}{
+			"success": false,
+			"message": "密码错误",
+		})
+		return
+	}
+	
+	// 管理员被要求启用两步验证时，不能删除最后一个第二因素
+	config := utils.GetConfig()
+	if isAdmin && config.Admin.Require2FA {
+		totpEnabled, _ := models.IsMFAEnabled(db, userID)
+		count, _ := models.CountWebAuthnCredentials(db, userID)
+		if !totpEnabled && count <= 1 {
+			respondJSON(w, http.StatusForbidden, map[string]interface{}{
+				"success": false,
+				"message": "管理员账号必须启用两步验证",
+			})
+			return
+		}
+	}
+	
+	if err := models.DeleteWebAuthnCredential(db, userID, credID); err != nil {
+		if err == sql.ErrNoRows {
+			respondJSON(w, http.StatusNotFound, map[string]interface{}{
+				"success": false,
+				"message": "安全密钥不存在",
+			})
+			return
+		}
+		authLog.ErrorContext(r.Context(), "删除WebAuthn凭据失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "删除安全密钥失败",
+		})
+		return
+	}
+	
+	authLog.InfoContext(r.Context(), "用户 %d 删除了安全密钥 %d", userID, credID)
+	
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "安全密钥已删除",
+	})
+}
+
+// BeginWebAuthnLoginHandler 开始安全密钥登录
+// 携带 mfa_token 时作为密码登录后的第二步，否则为无密码（通行密钥）登录
+func BeginWebAuthnLoginHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		MFAToken string `json:"mfa_token"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"success": false,
+				"message": "无效的请求格式",
+			})
+			return
+		}
+	}
+	
+	config := utils.GetConfig()
+	wa, err := newWebAuthn(config)
+	if err != nil {
+		authLog.ErrorContext(r.Context(), "WebAuthn配置无效: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "安全密钥功能配置错误",
+		})
+		return
+	}
+	
+	db := models.GetDB()
+	userID := 0
+	var assertion *protocol.CredentialAssertion
+	var session *webauthn.SessionData
+	
+	if req.MFAToken != "" {
+		userID, err = utils.ParseMFAToken(req.MFAToken)
+		if err != nil {
+			respondJSON(w, http.StatusUnauthorized, map[string]interface{}{
+				"success": false,
+				"message": "验证已过期，请重新登录",
+			})
+			return
+		}
+		
+		waUser, err := loadWebAuthnUser(db, userID)
+		if err != nil {
+			authLog.ErrorContext(r.Context(), "获取用户信息失败: %v", err)
+			respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+				"success": false,
+				"message": "服务器内部错误",
+			})
+			return
+		}
+		if len(waUser.creds) == 0 {
+			respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"success": false,
+				"message": "未注册安全密钥",
+			})
+			return
+		}
+		
+		assertion, session, err = wa.BeginLogin(waUser)
+	} else {
+		// 无密码登录只依赖认证器，必须验证用户身份（PIN或生物识别）
+		assertion, session, err = wa.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+	}
+	if err != nil {
+		authLog.ErrorContext(r.Context(), "开始安全密钥登录失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "服务器内部错误",
+		})
+		return
+	}
+	
+	challengeID, err := saveWebAuthnChallenge(db, config, userID, webAuthnCeremonyLogin, session)
+	if err != nil {
+		authLog.ErrorContext(r.Context(), "保存WebAuthn挑战失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "服务器内部错误",
+		})
+		return
+	}
+	
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success":      true,
+		"challenge_id": challengeID,
+		"options":      assertion,
+	})
+}
+
+// FinishWebAuthnLoginHandler 验证认证器的断言并创建会话
+func FinishWebAuthnLoginHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ChallengeID string          `json:"challenge_id"`
+		Credential  json.RawMessage `json:"credential"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ChallengeID == "" || len(req.Credential) == 0 {
+		respondJSON(w, http.StatusBadRequest, AuthResponse{
+			Success: false,
+			Message: "无效的请求格式",
+		})
+		return
+	}
+	
+	db := models.GetDB()
+	userID, session, err := loadWebAuthnChallenge(db, req.ChallengeID, webAuthnCeremonyLogin)
+	if err != nil {
+		respondJSON(w, http.StatusUnauthorized, AuthResponse{
+			Success: false,
+			Message: "验证已过期，请重新登录",
+		})
+		return
+	}
+	
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(req.Credential)
+	if err != nil {
+		authLog.WarnContext(r.Context(), "解析安全密钥登录响应失败: %v", err)
+		respondJSON(w, http.StatusBadRequest, AuthResponse{
+			Success: false,
+			Message: "无效的安全密钥响应",
+		})
+		return
+	}
+	
+	config := utils.GetConfig()
+	wa, err := newWebAuthn(config)
+	if err != nil {
+		authLog.ErrorContext(r.Context(), "WebAuthn配置无效: %v", err)
+		respondJSON(w, http.StatusInternalServerError, AuthResponse{
+			Success: false,
+			Message: "服务器内部错误",
+		})
+		return
+	}
+	
+	var waUser *webAuthnUser
+	var credential *webauthn.Credential
+	if userID != 0 {
+		waUser, err = loadWebAuthnUser(db, userID)
+		if err == nil {
+			credential, err = wa.ValidateLogin(waUser, *session, parsed)
+		}
+	} else {
+		var user webauthn.User
+		user, credential, err = wa.ValidatePasskeyLogin(func(rawID, userHandle []byte) (webauthn.User, error) {
+			cred, err := models.GetWebAuthnCredentialByCredentialID(db, rawID)
+			if err != nil {
+				return nil, err
+			}
+			if !bytes.Equal(userHandle, webAuthnUserHandle(cred.UserID)) {
+				return nil, errors.New("用户句柄与凭据不匹配")
+			}
+			return loadWebAuthnUser(db, cred.UserID)
+		}, *session, parsed)
+		if err == nil {
+			waUser = user.(*webAuthnUser)
+		}
+	}
+	if err != nil {
+		authLog.WarnContext(r.Context(), "安全密钥登录验证失败: %v", err)
+		respondJSON(w, http.StatusUnauthorized, AuthResponse{
+			Success: false,
+			Message: "安全密钥验证失败",
+		})
+		return
+	}
+	
+	// 签名计数器回退说明凭据可能被复制，拒绝登录
+	if credential.Authenticator.CloneWarning {
+		authLog.WarnContext(r.Context(), "用户 %d 的安全密钥签名计数器异常，可能已被复制", waUser.user.ID)
+		respondJSON(w, http.StatusUnauthorized, AuthResponse{
+			Success: false,
+			Message: "安全密钥验证失败",
+		})
+		return
+	}
+	
+	for _, cred := range waUser.creds {
+		if bytes.Equal(cred.CredentialID, credential.ID) {
+			if err := models.UpdateWebAuthnCredentialUsage(db, cred.ID, credential.Authenticator.SignCount, uint8(credential.Flags.ProtocolValue())); err != nil {
+				authLog.ErrorContext(r.Context(), "更新WebAuthn凭据失败: %v", err)
+			}
+			break
+		}
+	}
+	
+	user := waUser.user
+	if !user.IsActive {
+		respondJSON(w, http.StatusForbidden, AuthResponse{
+			Success: false,
+			Message: "账号已被禁用",
+		})
+		return
+	}
+	
+	loginSucceeded(r.Context(), db, user.Email)
+	if userID != 0 {
+		authLog.InfoContext(r.Context(), "用户登录: %s (%s)，已通过安全密钥验证", user.Username, user.Email)
+	} else {
+		authLog.InfoContext(r.Context(), "用户登录: %s (%s)，使用通行密钥", user.Username, user.Email)
+	}
+	
+	tokenString, refreshToken, err := issueSession(w, r, db, user)
+	if err != nil {
+		authLog.ErrorContext(r.Context(), "生成Token失败: %v", err)
+		respondJSON(w, http.StatusInternalServerError, AuthResponse{
+			Success: false,
+			Message: "服务器内部错误",
+		})
+		return
+	}
+	
+	respondJSON(w, http.StatusOK, AuthResponse{
+		Success:      true,
+		Token:        tokenString,
+		RefreshToken: refreshToken,
+		ExpiresIn:    accessTokenExpiresIn(),
+		Message:      "登录成功",
+		User: &UserResponse{
+			ID:           user.ID,
+			Username:     user.Username,
+			Email:        user.Email,
+			IsAdmin:      user.IsAdmin,
+			CustomDomain: user.CustomDomain,
+		},
+	})
+}
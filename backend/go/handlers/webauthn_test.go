@@ -0,0 +1,333 @@
+package handlers
+
+import (
+	"SwiftPost/models"
+	"SwiftPost/utils"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+	
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+)
+
+const (
+	testRPID   = "localhost"
+	testOrigin = "https://localhost"
+)
+
+// softAuthenticator 用 Go 实现的软件认证器，支持 none 证明和 ES256 签名
+type softAuthenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+	signCount    uint32
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credentialID := make([]byte, 32)
+	rand.Read(credentialID)
+	return &softAuthenticator{key: key, credentialID: credentialID}
+}
+
+// authData 拼装认证器数据：rpIdHash | flags | signCount [| 凭据数据]
+func (a *softAuthenticator) authData(attested bool) []byte {
+	rpIDHash := sha256.Sum256([]byte(testRPID))
+	flags := protocol.FlagUserPresent | protocol.FlagUserVerified
+	if attested {
+		flags |= protocol.FlagAttestedCredentialData
+	}
+	
+	data := append([]byte{}, rpIDHash[:]...)
+	data = append(data, byte(flags))
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	if !attested {
+		return data
+	}
+	
+	data = append(data, make([]byte, 16)...) // AAGUID
+	data = binary.BigEndian.AppendUint16(data, uint16(len(a.credentialID)))
+	data = append(data, a.credentialID...)
+	coseKey, _ := webauthncbor.Marshal(map[int]interface{}{
+		1:  2,  // kty: EC2
+		3:  -7, // alg: ES256
+		-1: 1,  // crv: P-256
+		-2: a.key.PublicKey.X.FillBytes(make([]byte, 32)),
+		-3: a.key.PublicKey.Y.FillBytes(make([]byte, 32)),
+	})
+	return append(data, coseKey...)
+}
+
+func clientData(t *testing.T, ceremony, challenge string) []byte {
+	t.Helper()
+	data, err := json.Marshal(map[string]string{
+		"type":      ceremony,
+		"challenge": challenge,
+		"origin":    testOrigin,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// register 按 navigator.credentials.create 的返回格式生成注册响应
+func (a *softAuthenticator) register(t *testing.T, options map[string]interface{}) map[string]interface{} {
+	t.Helper()
+	publicKey := options["publicKey"].(map[string]interface{})
+	user := publicKey["user"].(map[string]interface{})
+	handle, err := base64.RawURLEncoding.DecodeString(user["id"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.userHandle = handle
+	
+	attestation, err := webauthncbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": a.authData(true),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	
+	id := base64.RawURLEncoding.EncodeToString(a.credentialID)
+	return map[string]interface{}{
+		"id":    id,
+		"rawId": id,
+		"type":  "public-key",
+		"response": map[string]interface{}{
+			"clientDataJSON":    base64.RawURLEncoding.EncodeToString(clientData(t, "webauthn.create", publicKey["challenge"].(string))),
+			"attestationObject": base64.RawURLEncoding.EncodeToString(attestation),
+			"transports":        []string{"usb"},
+		},
+	}
+}
+
+// assert 按 navigator.credentials.get 的返回格式生成断言，签名计数器由调用方控制
+func (a *softAuthenticator) assert(t *testing.T, options map[string]interface{}) map[string]interface{} {
+	t.Helper()
+	publicKey := options["publicKey"].(map[string]interface{})
+	authData := a.authData(false)
+	clientDataJSON := clientData(t, "webauthn.get", publicKey["challenge"].(string))
+	
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	
+	id := base64.RawURLEncoding.EncodeToString(a.credentialID)
+	return map[string]interface{}{
+		"id":    id,
+		"rawId": id,
+		"type":  "public-key",
+		"response": map[string]interface{}{
+			"clientDataJSON":    base64.RawURLEncoding.EncodeToString(clientDataJSON),
+			"authenticatorData": base64.RawURLEncoding.EncodeToString(authData),
+			"signature":         base64.RawURLEncoding.EncodeToString(signature),
+			"userHandle":        base64.RawURLEncoding.EncodeToString(a.userHandle),
+		},
+	}
+}
+
+func newWebAuthnTestEnv(t *testing.T) (*models.Database, *models.User, *softAuthenticator) {
+	t.Helper()
+	config, db := newTestEnv(t)
+	config.WebAuthn.RPID = testRPID
+	config.WebAuthn.RPOrigins = []string{testOrigin}
+	
+	user := createTestUser(t, db, "alice", "correct horse battery")
+	authenticator := newSoftAuthenticator(t)
+	authenticator.signCount = 1
+	
+	w, begin := callJSON(t, BeginWebAuthnRegistrationHandler, "POST", "/api/user/webauthn/register/begin", user.ID, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("开始注册: %d %v", w.Code, begin)
+	}
+	w, finish := callJSON(t, FinishWebAuthnRegistrationHandler, "POST", "/api/user/webauthn/register/finish", user.ID, map[string]interface{}{
+		"challenge_id": begin["challenge_id"],
+		"name":         "软件密钥",
+		"credential":   authenticator.register(t, begin["options"].(map[string]interface{})),
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("完成注册: %d %v", w.Code, finish)
+	}
+	return db, user, authenticator
+}
+
+// beginLogin 开始登录，mfaToken 为空时为通行密钥登录
+func beginLogin(t *testing.T, mfaToken string) (string, map[string]interface{}) {
+	t.Helper()
+	var body interface{}
+	if mfaToken != "" {
+		body = map[string]string{"mfa_token": mfaToken}
+	}
+	w, resp := callJSON(t, BeginWebAuthnLoginHandler, "POST", "/api/login/webauthn/begin", 0, body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("开始登录: %d %v", w.Code, resp)
+	}
+	return resp["challenge_id"].(string), resp["options"].(map[string]interface{})
+}
+
+func finishLogin(t *testing.T, challengeID string, credential map[string]interface{}) (int, map[string]interface{}) {
+	t.Helper()
+	w, resp := callJSON(t, FinishWebAuthnLoginHandler, "POST", "/api/login/webauthn/finish", 0, map[string]interface{}{
+		"challenge_id": challengeID,
+		"credential":   credential,
+	})
+	return w.Code, resp
+}
+
+func TestWebAuthnRegistration(t *testing.T) {
+	db, user, authenticator := newWebAuthnTestEnv(t)
+	
+	creds, err := models.GetWebAuthnCredentialsByUser(db, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(creds) != 1 {
+		t.Fatalf("凭据数量 = %d，应为 1", len(creds))
+	}
+	cred := creds[0]
+	if string(cred.CredentialID) != string(authenticator.credentialID) || cred.SignCount != 1 || cred.Name != "软件密钥" || cred.Transports != "usb" {
+		t.Fatalf("保存的凭据不正确: %+v", cred)
+	}
+	if string(authenticator.userHandle) != strconv.Itoa(user.ID) {
+		t.Fatalf("用户句柄 = %q，应为用户ID", authenticator.userHandle)
+	}
+	
+	// 同一个认证器不能重复注册
+	w, begin := callJSON(t, BeginWebAuthnRegistrationHandler, "POST", "/api/user/webauthn/register/begin", user.ID, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("开始注册: %d %v", w.Code, begin)
+	}
+	w, _ = callJSON(t, FinishWebAuthnRegistrationHandler, "POST", "/api/user/webauthn/register/finish", user.ID, map[string]interface{}{
+		"challenge_id": begin["challenge_id"],
+		"credential":   authenticator.register(t, begin["options"].(map[string]interface{})),
+	})
+	if w.Code != http.StatusConflict {
+		t.Fatalf("重复注册返回 %d，应为 409", w.Code)
+	}
+}
+
+func TestWebAuthnRegistrationWrongOrigin(t *testing.T) {
+	config, db := newTestEnv(t)
+	config.WebAuthn.RPID = testRPID
+	config.WebAuthn.RPOrigins = []string{"https://mail.example.com"}
+	user := createTestUser(t, db, "alice", "correct horse battery")
+	
+	_, begin := callJSON(t, BeginWebAuthnRegistrationHandler, "POST", "/api/user/webauthn/register/begin", user.ID, nil)
+	w, _ := callJSON(t, FinishWebAuthnRegistrationHandler, "POST", "/api/user/webauthn/register/finish", user.ID, map[string]interface{}{
+		"challenge_id": begin["challenge_id"],
+		"credential":   newSoftAuthenticator(t).register(t, begin["options"].(map[string]interface{})),
+	})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("来源不匹配时返回 %d，应为 400", w.Code)
+	}
+}
+
+func TestWebAuthnPasskeyLogin(t *testing.T) {
+	db, user, authenticator := newWebAuthnTestEnv(t)
+	
+	authenticator.signCount = 2
+	challengeID, options := beginLogin(t, "")
+	code, resp := finishLogin(t, challengeID, authenticator.assert(t, options))
+	if code != http.StatusOK || resp["token"] == "" {
+		t.Fatalf("通行密钥登录: %d %v", code, resp)
+	}
+	if got := resp["user"].(map[string]interface{})["id"]; got != float64(user.ID) {
+		t.Fatalf("登录用户 = %v，应为 %d", got, user.ID)
+	}
+	
+	creds, _ := models.GetWebAuthnCredentialsByUser(db, user.ID)
+	if creds[0].SignCount != 2 {
+		t.Fatalf("签名计数器 = %d，应更新为 2", creds[0].SignCount)
+	}
+}
+
+func TestWebAuthnSecondFactorLogin(t *testing.T) {
+	_, user, authenticator := newWebAuthnTestEnv(t)
+	
+	mfaToken, err := utils.GenerateMFAToken(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authenticator.signCount = 5
+	challengeID, options := beginLogin(t, mfaToken)
+	allowed := options["publicKey"].(map[string]interface{})["allowCredentials"].([]interface{})
+	if len(allowed) != 1 {
+		t.Fatalf("allowCredentials = %v，应只包含已注册的凭据", allowed)
+	}
+	code, resp := finishLogin(t, challengeID, authenticator.assert(t, options))
+	if code != http.StatusOK {
+		t.Fatalf("两步验证登录: %d %v", code, resp)
+	}
+	
+	// 其他认证器的断言不能用于该用户
+	other := newSoftAuthenticator(t)
+	other.userHandle = authenticator.userHandle
+	challengeID, options = beginLogin(t, mfaToken)
+	if code, _ := finishLogin(t, challengeID, other.assert(t, options)); code != http.StatusUnauthorized {
+		t.Fatalf("未注册的认证器返回 %d，应为 401", code)
+	}
+}
+
+func TestWebAuthnSignCountRollback(t *testing.T) {
+	db, user, authenticator := newWebAuthnTestEnv(t)
+	
+	authenticator.signCount = 10
+	challengeID, options := beginLogin(t, "")
+	if code, resp := finishLogin(t, challengeID, authenticator.assert(t, options)); code != http.StatusOK {
+		t.Fatalf("登录: %d %v", code, resp)
+	}
+	
+	// 复制出来的认证器计数器落后于服务端记录，应拒绝登录
+	for _, count := range []uint32{10, 3} {
+		authenticator.signCount = count
+		challengeID, options = beginLogin(t, "")
+		if code, _ := finishLogin(t, challengeID, authenticator.assert(t, options)); code != http.StatusUnauthorized {
+			t.Fatalf("签名计数器为 %d 时返回 %d，应为 401", count, code)
+		}
+	}
+	
+	creds, _ := models.GetWebAuthnCredentialsByUser(db, user.ID)
+	if creds[0].SignCount != 10 {
+		t.Fatalf("签名计数器 = %d，被拒绝的登录不应更新", creds[0].SignCount)
+	}
+}
+
+func TestWebAuthnReplay(t *testing.T) {
+	_, _, authenticator := newWebAuthnTestEnv(t)
+	
+	authenticator.signCount = 2
+	challengeID, options := beginLogin(t, "")
+	assertion := authenticator.assert(t, options)
+	if code, resp := finishLogin(t, challengeID, assertion); code != http.StatusOK {
+		t.Fatalf("登录: %d %v", code, resp)
+	}
+	
+	// 挑战只能使用一次
+	if code, _ := finishLogin(t, challengeID, assertion); code != http.StatusUnauthorized {
+		t.Fatalf("重放同一挑战返回 %d，应为 401", code)
+	}
+	
+	// 截获的断言签名的是旧挑战，不能用于新的挑战
+	challengeID, _ = beginLogin(t, "")
+	if code, _ := finishLogin(t, challengeID, assertion); code != http.StatusUnauthorized {
+		t.Fatalf("重放断言返回 %d，应为 401", code)
+	}
+}
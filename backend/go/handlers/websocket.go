@@ -3,15 +3,19 @@ package handlers
 import (
 	"SwiftPost/models"
 	"SwiftPost/utils"
-	"encoding/json"
-	"log"
+	"fmt"
+	"math/rand"
 	"net/http"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
 )
 
+// wsLog WebSocket 连接和实时消息的日志
+var wsLog = utils.NewLogger("websocket")
+
 // WebSocket消息类型
 const (
 	MessageTypeNewEmail   = "new_email"
@@ -21,6 +25,7 @@ const (
 	MessageTypePresence   = "presence"
 	MessageTypeError      = "error"
 	MessageTypeInfo       = "info"
+	MessageTypeSystemNotification = "system_notification"
 )
 
 // WebSocket消息结构
@@ -30,11 +35,12 @@ type WebSocketMessage struct {
 	Timestamp time.Time `json:"timestamp"`
 }
 
-// 客户端结构
+// 客户端结构，SessionID 为建立连接时使用的登录会话，会话撤销后连接随之断开
 type WebSocketClient struct {
-	ID     string
-	UserID int
-	Conn   *websocket.Conn
+	ID        string
+	UserID    int
+	SessionID int
+	Conn      *websocket.Conn
 	Send   chan WebSocketMessage
 	Mutex  sync.Mutex
 }
@@ -65,9 +71,10 @@ func StartWebSocketManager() {
 		case client := <-manager.Register:
 			manager.Mutex.Lock()
 			manager.Clients[client.ID] = client
+			firstClient := countUserClients(client.UserID) == 1
 			manager.Mutex.Unlock()
 			
-			utils.Debug("WebSocket客户端注册: %s (用户ID: %d)", client.ID, client.UserID)
+			wsLog.Debug("WebSocket客户端注册: %s (用户ID: %d)", client.ID, client.UserID)
 			
 			// 发送欢迎消息
 			welcomeMsg := WebSocketMessage{
@@ -77,39 +84,29 @@ func StartWebSocketManager() {
 			}
 			client.Send <- welcomeMsg
 			
-			// 广播用户上线通知
-			presenceMsg := WebSocketMessage{
-				Type: MessageTypePresence,
-				Payload: map[string]interface{}{
-					"user_id":  client.UserID,
-					"status":   "online",
-					"client_id": client.ID,
-				},
-				Timestamp: time.Now(),
+			// 通知联系人用户上线（同一用户的其他连接已通知过），并发送联系人当前状态
+			if firstClient {
+				go broadcastPresence(models.GetDB(), client.UserID, "online")
 			}
-			manager.Broadcast <- presenceMsg
+			go sendPresenceSnapshot(models.GetDB(), client)
 			
 		case client := <-manager.Unregister:
 			manager.Mutex.Lock()
+			removed := false
 			if _, ok := manager.Clients[client.ID]; ok {
 				close(client.Send)
 				delete(manager.Clients, client.ID)
+				removed = true
 			}
+			lastClient := removed && countUserClients(client.UserID) == 0
 			manager.Mutex.Unlock()
 			
-			utils.Debug("WebSocket客户端注销: %s", client.ID)
+			wsLog.Debug("WebSocket客户端注销: %s", client.ID)
 			
-			// 广播用户下线通知
-			presenceMsg := WebSocketMessage{
-				Type: MessageTypePresence,
-				Payload: map[string]interface{}{
-					"user_id":  client.UserID,
-					"status":   "offline",
-					"client_id": client.ID,
-				},
-				Timestamp: time.Now(),
+			// 用户的所有连接都断开后才通知联系人下线
+			if lastClient {
+				go broadcastPresence(models.GetDB(), client.UserID, "offline")
 			}
-			manager.Broadcast <- presenceMsg
 			
 		case message := <-manager.Broadcast:
 			manager.Mutex.RLock()
@@ -144,6 +141,138 @@ func SendToUser(userID int, message WebSocketMessage) {
 	}
 }
 
+// closeClients 断开满足条件的连接。连接关闭后读协程退出并走正常的注销流程，
+// 之后不会再收到新邮件等推送
+func closeClients(match func(*WebSocketClient) bool) int {
+	manager.Mutex.RLock()
+	var clients []*WebSocketClient
+	for _, client := range manager.Clients {
+		if match(client) {
+			clients = append(clients, client)
+		}
+	}
+	manager.Mutex.RUnlock()
+	
+	closeMsg := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "会话已失效")
+	for _, client := range clients {
+		client.Conn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(time.Second))
+		client.Conn.Close()
+	}
+	return len(clients)
+}
+
+// DisconnectSession 断开使用该会话建立的 WebSocket 连接，会话被撤销时调用
+func DisconnectSession(sessionID int) {
+	if n := closeClients(func(c *WebSocketClient) bool { return c.SessionID == sessionID }); n > 0 {
+		wsLog.Info("会话 %d 已撤销，断开 %d 个WebSocket连接", sessionID, n)
+	}
+}
+
+// DisconnectUser 断开用户的所有 WebSocket 连接，撤销用户全部会话或停用账号时调用
+func DisconnectUser(userID int) {
+	if n := closeClients(func(c *WebSocketClient) bool { return c.UserID == userID }); n > 0 {
+		wsLog.Info("用户 %d 的会话已全部失效，断开 %d 个WebSocket连接", userID, n)
+	}
+}
+
+// DisconnectAllExcept 断开除指定会话外的所有 WebSocket 连接，强制所有用户重新登录时调用
+func DisconnectAllExcept(sessionID int) {
+	if n := closeClients(func(c *WebSocketClient) bool { return c.SessionID != sessionID }); n > 0 {
+		wsLog.Info("已断开 %d 个WebSocket连接", n)
+	}
+}
+
+// 发送消息给特定客户端连接
+func sendToClient(clientID string, message WebSocketMessage) {
+	manager.Mutex.RLock()
+	defer manager.Mutex.RUnlock()
+	
+	if client, ok := manager.Clients[clientID]; ok {
+		select {
+		case client.Send <- message:
+		default:
+		}
+	}
+}
+
+// 统计用户的连接数，调用方需持有锁
+func countUserClients(userID int) int {
+	count := 0
+	for _, client := range manager.Clients {
+		if client.UserID == userID {
+			count++
+		}
+	}
+	return count
+}
+
+// 把用户的在线状态发送给在线的联系人，开启隐身的用户不广播
+func broadcastPresence(db *models.Database, userID int, status string) {
+	settings, err := models.GetPresenceSettings(db, userID)
+	if err != nil {
+		wsLog.Error("获取在线状态设置失败: %v", err)
+		return
+	}
+	if settings.AppearOffline {
+		return
+	}
+	
+	sendPresence(db, userID, status)
+}
+
+// 把在线状态发送给在线的联系人，不检查隐身设置
+func sendPresence(db *models.Database, userID int, status string) {
+	contacts, err := models.GetContactIDs(db, userID)
+	if err != nil {
+		wsLog.Error("获取联系人失败: %v", err)
+		return
+	}
+	
+	presenceMsg := WebSocketMessage{
+		Type: MessageTypePresence,
+		Payload: map[string]interface{}{
+			"user_id": userID,
+			"status":  status,
+		},
+		Timestamp: time.Now(),
+	}
+	
+	for _, contactID := range contacts {
+		if IsUserOnline(contactID) {
+			SendToUser(contactID, presenceMsg)
+		}
+	}
+}
+
+// 向新连接发送其联系人的当前在线状态
+func sendPresenceSnapshot(db *models.Database, client *WebSocketClient) {
+	contacts, err := models.GetContactIDs(db, client.UserID)
+	if err != nil {
+		wsLog.Error("获取联系人失败: %v", err)
+		return
+	}
+	
+	for _, contactID := range contacts {
+		if !IsUserOnline(contactID) {
+			continue
+		}
+		
+		settings, err := models.GetPresenceSettings(db, contactID)
+		if err != nil || settings.AppearOffline {
+			continue
+		}
+		
+		sendToClient(client.ID, WebSocketMessage{
+			Type: MessageTypePresence,
+			Payload: map[string]interface{}{
+				"user_id": contactID,
+				"status":  "online",
+			},
+			Timestamp: time.Now(),
+		})
+	}
+}
+
 // 发送消息给除发送者外的所有用户
 func BroadcastExcluding(senderID string, message WebSocketMessage) {
 	manager.Mutex.RLock()
@@ -168,36 +297,41 @@ func WebSocketHandler(w http.ResponseWriter, r *http.Request, db *models.Databas
 	token := r.URL.Query().Get("token")
 	
 	if userIDStr == "" || token == "" {
-		utils.Error("WebSocket连接缺少参数")
+		wsLog.ErrorContext(r.Context(), "WebSocket连接缺少参数")
 		http.Error(w, "缺少参数", http.StatusBadRequest)
 		return
 	}
 	
-	// 验证Token（简化版，实际应该使用JWT验证）
-	// 这里为了简化，只做基本验证
-	config, _ := utils.LoadConfig("config.json")
-	if token != config.Security.JWTSecret {
-		utils.Error("WebSocket连接Token无效")
+	// 验证访问令牌及其会话，用户ID必须与令牌一致
+	claims, err := utils.ParseAccessToken(token)
+	if err != nil || strconv.Itoa(claims.UserID) != userIDStr {
+		wsLog.ErrorContext(r.Context(), "WebSocket连接Token无效: %v", err)
 		http.Error(w, "无效的Token", http.StatusUnauthorized)
 		return
 	}
+	if _, err := db.Sessions().Validate(claims.SessionID, claims.UserID); err != nil {
+		wsLog.ErrorContext(r.Context(), "WebSocket连接会话无效: %v", err)
+		http.Error(w, "会话已失效", http.StatusUnauthorized)
+		return
+	}
 	
 	// 升级HTTP连接到WebSocket
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		utils.Error("WebSocket升级失败: %v", err)
+		wsLog.ErrorContext(r.Context(), "WebSocket升级失败: %v", err)
 		return
 	}
 	
 	// 生成客户端ID
 	clientID := generateClientID()
-	userID, _ := strconv.Atoi(userIDStr)
+	userID := claims.UserID
 	
 	// 创建客户端
 	client := &WebSocketClient{
-		ID:     clientID,
-		UserID: userID,
-		Conn:   conn,
+		ID:        clientID,
+		UserID:    userID,
+		SessionID: claims.SessionID,
+		Conn:      conn,
 		Send:   make(chan WebSocketMessage, 256),
 	}
 	
@@ -208,7 +342,7 @@ func WebSocketHandler(w http.ResponseWriter, r *http.Request, db *models.Databas
 	go client.writePump()
 	go client.readPump(db)
 	
-	utils.Info("WebSocket连接建立: %s (用户ID: %d)", clientID, userID)
+	wsLog.InfoContext(r.Context(), "WebSocket连接建立: %s (用户ID: %d)", clientID, userID)
 }
 
 // 生成客户端ID
@@ -239,7 +373,7 @@ func (c *WebSocketClient) writePump() {
 			c.Mutex.Unlock()
 			
 			if err != nil {
-				log.Printf("WebSocket写错误: %v", err)
+				wsLog.Error("WebSocket写错误: %v", err)
 				return
 			}
 			
@@ -268,7 +402,7 @@ func (c *WebSocketClient) readPump(db *models.Database) {
 		err := c.Conn.ReadJSON(&msg)
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				utils.Error("WebSocket读错误: %v", err)
+				wsLog.Error("WebSocket读错误: %v", err)
 			}
 			break
 		}
@@ -282,14 +416,28 @@ func (c *WebSocketClient) readPump(db *models.Database) {
 func (c *WebSocketClient) handleMessage(msg WebSocketMessage, db *models.Database) {
 	switch msg.Type {
 	case MessageTypeTyping:
-		// 处理输入状态
+		// 处理输入状态：只在双方处于同一封邮件的回复会话时转发
 		if payload, ok := msg.Payload.(map[string]interface{}); ok {
 			toUserID, ok := payload["to_user_id"].(float64)
-			if ok {
+			emailID, hasEmail := payload["email_id"].(float64)
+			if ok && hasEmail {
+				shared, err := models.IsEmailBetweenUsers(db, int(emailID), c.UserID, int(toUserID))
+				if err != nil || !shared {
+					wsLog.Debug("忽略输入状态: 用户 %d 与用户 %d 不在同一会话", c.UserID, int(toUserID))
+					return
+				}
+				
+				// 隐身用户的输入状态会暴露在线，不转发
+				settings, err := models.GetPresenceSettings(db, c.UserID)
+				if err != nil || settings.AppearOffline {
+					return
+				}
+				
 				typingMsg := WebSocketMessage{
 					Type: MessageTypeTyping,
 					Payload: map[string]interface{}{
 						"from_user_id": c.UserID,
+						"email_id":     int(emailID),
 						"is_typing":    payload["is_typing"],
 					},
 					Timestamp: time.Now(),
@@ -302,17 +450,10 @@ func (c *WebSocketClient) handleMessage(msg WebSocketMessage, db *models.Databas
 		// 处理在线状态更新
 		if payload, ok := msg.Payload.(map[string]interface{}); ok {
 			status, _ := payload["status"].(string)
-			
-			presenceMsg := WebSocketMessage{
-				Type: MessageTypePresence,
-				Payload: map[string]interface{}{
-					"user_id": c.UserID,
-					"status":  status,
-					"client_id": c.ID,
-				},
-				Timestamp: time.Now(),
+			switch status {
+			case "online", "away", "busy", "offline":
+				go broadcastPresence(db, c.UserID, status)
 			}
-			manager.Broadcast <- presenceMsg
 		}
 		
 	case "ping":
@@ -337,16 +478,16 @@ func (c *WebSocketClient) handleMessage(msg WebSocketMessage, db *models.Databas
 
 // 发送新邮件通知
 func NotifyNewEmail(db *models.Database, emailID int) {
-	email, err := models.GetEmailByID(db, emailID)
+	email, err := db.Emails().GetByID(emailID)
 	if err != nil {
-		utils.Error("获取邮件信息失败: %v", err)
+		wsLog.Error("获取邮件信息失败: %v", err)
 		return
 	}
 	
 	// 获取发件人信息
-	sender, err := models.GetUserByID(db, email.SenderID)
+	sender, err := db.Users().GetByID(email.SenderID)
 	if err != nil {
-		utils.Error("获取发件人信息失败: %v", err)
+		wsLog.Error("获取发件人信息失败: %v", err)
 		sender = &models.User{Username: "未知用户"}
 	}
 	
@@ -359,22 +500,22 @@ func NotifyNewEmail(db *models.Database, emailID int) {
 			"sender_name":   sender.Username,
 			"sender_email":  email.SenderEmail,
 			"subject":       email.Subject,
-			"preview":       getBodyPreview(email.Body),
+			"preview":       email.Preview,
 			"has_attachment": email.HasAttachment,
 			"created_at":    email.CreatedAt,
 		},
 		Timestamp: time.Now(),
 	}
 	
-	// 发送给收件人
-	SendToUser(email.RecipientID, notification)
+	// 发送给收件人，离线时通过 Web Push 通知
+	deliverToUser(db, email.RecipientID, notification)
 	
-	utils.Debug("新邮件通知已发送: 邮件ID=%d, 收件人ID=%d", email.ID, email.RecipientID)
+	wsLog.Debug("新邮件通知已发送: 邮件ID=%d, 收件人ID=%d", email.ID, email.RecipientID)
 }
 
 // 发送邮件已读通知
 func NotifyEmailRead(db *models.Database, emailID int, readerID int) {
-	email, err := models.GetEmailByID(db, emailID)
+	email, err := db.Emails().GetByID(emailID)
 	if err != nil {
 		return
 	}
@@ -431,10 +572,3 @@ func IsUserOnline(userID int) bool {
 func init() {
 	go StartWebSocketManager()
 }
-
-// 需要导入的包
-import (
-	"fmt"
-	"math/rand"
-	"strconv"
-)
\ No newline at end of file
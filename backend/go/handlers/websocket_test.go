@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"SwiftPost/models"
+	"SwiftPost/utils"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	
+	"github.com/gorilla/websocket"
+)
+
+// dialWebSocket 用新登录的会话建立 WebSocket 连接，读掉欢迎消息，返回连接和会话ID
+func dialWebSocket(t *testing.T, server *httptest.Server, db *models.Database, user *models.User) (*websocket.Conn, int) {
+	t.Helper()
+	accessToken, _, err := issueSession(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/login", nil), db, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := utils.ParseAccessToken(accessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?user_id=" + strconv.Itoa(user.ID) + "&token=" + accessToken
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	
+	var welcome WebSocketMessage
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if err := conn.ReadJSON(&welcome); err != nil {
+		t.Fatalf("没有收到欢迎消息: %v", err)
+	}
+	return conn, claims.SessionID
+}
+
+// expectClosed 连接应在短时间内被服务端以会话失效关闭，期间不应收到新邮件推送
+func expectClosed(t *testing.T, conn *websocket.Conn) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		var msg WebSocketMessage
+		err := conn.ReadJSON(&msg)
+		if err == nil {
+			if msg.Type == MessageTypeNewEmail {
+				t.Fatal("会话撤销后不应再收到新邮件推送")
+			}
+			continue
+		}
+		var closeErr *websocket.CloseError
+		if !errors.As(err, &closeErr) || closeErr.Code != websocket.ClosePolicyViolation {
+			t.Fatalf("连接应因会话失效关闭，实际为 %v", err)
+		}
+		return
+	}
+}
+
+// expectMessage 连接仍然打开并能收到推送
+func expectMessage(t *testing.T, conn *websocket.Conn, messageType string) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		var msg WebSocketMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("连接应保持打开: %v", err)
+		}
+		if msg.Type == messageType {
+			return
+		}
+	}
+}
+
+func TestWebSocketClosedOnSessionRevoke(t *testing.T) {
+	_, db := newTestEnv(t)
+	user := createTestUser(t, db, "alice", "password123")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		WebSocketHandler(w, r, db, websocket.Upgrader{})
+	}))
+	defer server.Close()
+	
+	first, firstSession := dialWebSocket(t, server, db, user)
+	second, _ := dialWebSocket(t, server, db, user)
+	
+	// 退出当前会话只断开这个会话的连接
+	r := httptest.NewRequest(http.MethodPost, "/api/logout", nil)
+	r = r.WithContext(context.WithValue(context.WithValue(r.Context(), "user_id", user.ID), "session_id", firstSession))
+	w := httptest.NewRecorder()
+	LogoutHandler(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("退出登录返回 %d: %s", w.Code, w.Body.String())
+	}
+	expectClosed(t, first)
+	
+	SendToUser(user.ID, WebSocketMessage{Type: MessageTypeNewEmail, Timestamp: time.Now()})
+	expectMessage(t, second, MessageTypeNewEmail)
+	
+	// 退出所有设备后其余连接也断开
+	if w, resp := callJSON(t, LogoutAllHandler, http.MethodPost, "/api/logout-all", user.ID, nil); w.Code != http.StatusOK {
+		t.Fatalf("退出所有设备返回 %d: %v", w.Code, resp)
+	}
+	SendToUser(user.ID, WebSocketMessage{Type: MessageTypeNewEmail, Timestamp: time.Now()})
+	expectClosed(t, second)
+}
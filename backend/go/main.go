@@ -6,20 +6,18 @@ import (
 	"SwiftPost/models"
 	"SwiftPost/utils"
 	"context"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
-	"os/exec"
 	"os/signal"
-	"runtime"
-	"strings"
+	"path/filepath"
 	"syscall"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
-	"golang.org/x/crypto/acme/autocert"
 )
 
 var (
@@ -43,200 +41,94 @@ func printBanner() {
 	fmt.Println()
 }
 
-func startPythonService(config *utils.Config) (*exec.Cmd, error) {
-	utils.PrintColored("🐍 启动 Python 数据库服务...", 0, utils.ColorYellow)
-	
-	// 获取当前目录
-	wd, err := os.Getwd()
-	if err != nil {
-		return nil, err
-	}
-	
-	// 构建 Python 脚本路径
-	var pythonScript string
-	if runtime.GOOS == "windows" {
-		pythonScript = wd + "\\start.py"
-	} else {
-		pythonScript = wd + "/start.py"
-	}
-	
-	// 检查 Python 脚本是否存在
-	if _, err := os.Stat(pythonScript); os.IsNotExist(err) {
-		// 如果 start.py 不存在，使用内置的 Python 代码
-		utils.PrintColored("📝 生成 Python 数据库脚本...", 0, utils.ColorYellow)
-		pythonCode := `#!/usr/bin/env python3
-import sys
-import os
-import time
-import sqlite3
-from pathlib import Path
-
-def init_database():
-    db_path = "data/swiftpost.db"
-    os.makedirs(os.path.dirname(db_path), exist_ok=True)
-    
-    conn = sqlite3.connect(db_path)
-    cursor = conn.cursor()
-    
-    cursor.execute('''
-    CREATE TABLE IF NOT EXISTS users (
-        id INTEGER PRIMARY KEY AUTOINCREMENT,
-        username TEXT UNIQUE NOT NULL,
-        email TEXT UNIQUE NOT NULL,
-        password_hash TEXT NOT NULL,
-        is_admin BOOLEAN DEFAULT 0,
-        custom_domain TEXT,
-        storage_used INTEGER DEFAULT 0,
-        max_storage INTEGER DEFAULT 1073741824,
-        is_active BOOLEAN DEFAULT 1,
-        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-        updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-    )''')
-    
-    cursor.execute('''
-    CREATE TABLE IF NOT EXISTS emails (
-        id INTEGER PRIMARY KEY AUTOINCREMENT,
-        uuid TEXT UNIQUE NOT NULL,
-        sender_id INTEGER NOT NULL,
-        recipient_id INTEGER NOT NULL,
-        sender_email TEXT NOT NULL,
-        recipient_email TEXT NOT NULL,
-        subject TEXT NOT NULL,
-        body TEXT NOT NULL,
-        is_read BOOLEAN DEFAULT 0,
-        is_starred BOOLEAN DEFAULT 0,
-        is_deleted BOOLEAN DEFAULT 0,
-        is_draft BOOLEAN DEFAULT 0,
-        has_attachment BOOLEAN DEFAULT 0,
-        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-        updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-        FOREIGN KEY (sender_id) REFERENCES users (id),
-        FOREIGN KEY (recipient_id) REFERENCES users (id)
-    )''')
-    
-    cursor.execute('CREATE INDEX IF NOT EXISTS idx_emails_recipient ON emails(recipient_id, created_at DESC)')
-    cursor.execute('CREATE INDEX IF NOT EXISTS idx_users_email ON users(email)')
-    
-    conn.commit()
-    conn.close()
-    return db_path
-
-def monitor_database():
-    db_path = "data/swiftpost.db"
-    
-    while True:
-        try:
-            conn = sqlite3.connect(db_path)
-            cursor = conn.cursor()
-            cursor.execute('SELECT 1')
-            conn.close()
-            time.sleep(10)
-        except KeyboardInterrupt:
-            print("\\n🔄 数据库监控已停止")
-            break
-        except Exception as e:
-            print(f"❌ 数据库连接错误: {e}")
-            time.sleep(5)
-
-if __name__ == "__main__":
-    print("=" * 50)
-    print("🚀 SwiftPost 数据库服务")
-    print("=" * 50)
-    
-    if len(sys.argv) > 1 and sys.argv[1] == "--child":
-        print("📊 数据库服务已启动")
-        db_path = init_database()
-        print(f"✅ 数据库初始化完成: {db_path}")
-        monitor_database()
-    else:
-        print("❌ 此脚本只能作为子进程启动")
-        sys.exit(1)`
-		
-		// 写入 Python 脚本
-		if err := os.WriteFile(pythonScript, []byte(pythonCode), 0755); err != nil {
-			return nil, err
-		}
+func main() {
+	// 子命令
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrateCommand(os.Args[2:]))
 	}
-	
-	// 启动 Python 进程
-	var cmd *exec.Cmd
-	if runtime.GOOS == "windows" {
-		cmd = exec.Command("python", pythonScript, "--child")
-	} else {
-		cmd = exec.Command("python3", pythonScript, "--child")
+	if len(os.Args) > 1 && os.Args[1] == "bench" {
+		os.Exit(runBenchCommand(os.Args[2:]))
 	}
-	
-	// 设置输出
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	
-	// 启动进程
-	if err := cmd.Start(); err != nil {
-		// 尝试另一种方式
-		utils.PrintColored("⚠️  尝试使用 python3 启动...", 0, utils.ColorYellow)
-		if runtime.GOOS == "windows" {
-			cmd = exec.Command("py", pythonScript, "--child")
-		} else {
-			cmd = exec.Command("python", pythonScript, "--child")
-		}
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		
-		if err := cmd.Start(); err != nil {
-			return nil, fmt.Errorf("无法启动 Python 服务: %v", err)
-		}
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		os.Exit(runConfigCommand(os.Args[2:]))
 	}
 	
-	// 等待一小段时间确保 Python 服务启动
-	time.Sleep(2 * time.Second)
+	// 命令行参数：-config 指定配置文件，其余参数覆盖同名的配置项，如 -server.port 8080
+	flags := flag.NewFlagSet("swiftpost", flag.ExitOnError)
+	configFile := flags.String("config", utils.DefaultConfigFile(), "配置文件（.json、.yaml 或 .toml）")
+	configFlags := utils.ConfigFlags(flags)
+	flags.Parse(os.Args[1:])
 	
-	utils.PrintColored("✅ Python 数据库服务已启动", 0, utils.ColorGreen)
-	return cmd, nil
-}
-
-func main() {
 	// 显示启动横幅
 	printBanner()
 	
-	// 加载配置
+	// 加载配置：默认值、配置文件、SWIFTPOST_* 环境变量、命令行参数，后者覆盖前者
 	utils.PrintColored("📋 加载配置文件...", 0, utils.ColorYellow)
-	config, err := utils.LoadConfig("config.json")
+	loader := &utils.ConfigLoader{File: *configFile, Env: os.Environ(), Flags: configFlags}
+	config, err := loader.Load()
 	if err != nil {
 		utils.PrintColored(fmt.Sprintf("❌ 无法加载配置: %v", err), 0, utils.ColorRed)
 		log.Fatal(err)
 	}
-	utils.PrintColored("✅ 配置加载完成", 0, utils.ColorGreen)
+	
+	// 检查配置，生产环境中仍在使用不安全的默认配置时拒绝启动
+	warnings, err := utils.CheckConfig(config)
+	for _, warning := range warnings {
+		utils.PrintColored("⚠️  "+warning.String(), 0, utils.ColorYellow)
+	}
+	if err != nil {
+		utils.PrintColored("❌ "+err.Error(), 0, utils.ColorRed)
+		os.Exit(1)
+	}
+	
+	// 日志输出到标准输出或按大小和时间轮转的日志文件
+	if err := utils.ConfigureLogging(config); err != nil {
+		utils.PrintColored(fmt.Sprintf("❌ 无法初始化日志: %v", err), 0, utils.ColorRed)
+		os.Exit(1)
+	}
+	if config.Logging.Dir != "" {
+		utils.PrintColored("📝 日志写入: "+filepath.Join(config.Logging.Dir, "swiftpost.log"), 0, utils.ColorCyan)
+	}
+	
+	// 生成 Web Push 使用的 VAPID 密钥
+	if err := utils.EnsureVAPIDKeys(config, *configFile); err != nil {
+		utils.PrintColored(fmt.Sprintf("⚠️  VAPID 密钥生成失败，推送通知不可用: %v", err), 0, utils.ColorYellow)
+	}
+	utils.SetConfig(config)
+	utils.PrintColored("✅ 配置加载完成: "+*configFile, 0, utils.ColorGreen)
+	
+	// 加载页面模板
+	handlers.LoadTemplates()
+	
+	// 配置文件修改或收到 SIGHUP 时重新加载配置，需要重启才能生效的配置项保持不变
+	if watcher, err := utils.WatchConfigFile(loader); err != nil {
+		utils.PrintColored(fmt.Sprintf("⚠️  无法监听配置文件，修改后需要发送 SIGHUP 重新加载: %v", err), 0, utils.ColorYellow)
+	} else {
+		defer watcher.Close()
+	}
+	go func() {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		for range hup {
+			if err := utils.ReloadConfig(loader); err != nil {
+				utils.Error("重新加载配置失败: %v", err)
+			}
+		}
+	}()
 	
 	// 创建数据目录
-	if err := os.MkdirAll("data/emails", 0755); err != nil {
+	if err := os.MkdirAll(config.Email.StoragePath, 0755); err != nil {
 		utils.PrintColored(fmt.Sprintf("❌ 无法创建数据目录: %v", err), 0, utils.ColorRed)
 		log.Fatal(err)
 	}
-	if err := os.MkdirAll("data/attachments", 0755); err != nil {
+	if err := os.MkdirAll(config.Email.AttachmentPath, 0755); err != nil {
 		utils.PrintColored(fmt.Sprintf("❌ 无法创建附件目录: %v", err), 0, utils.ColorRed)
 		log.Fatal(err)
 	}
 	
-	// 启动 Python 数据库服务
-	var pythonCmd *exec.Cmd
-	if config.Database.PythonEnabled {
-		pythonCmd, err = startPythonService(config)
-		if err != nil {
-			utils.PrintColored(fmt.Sprintf("⚠️  Python 服务启动失败: %v", err), 0, utils.ColorYellow)
-			utils.PrintColored("ℹ️  继续使用 Go 内置数据库功能", 0, utils.ColorBlue)
-		} else {
-			defer func() {
-				if pythonCmd != nil && pythonCmd.Process != nil {
-					utils.PrintColored("🔄 停止 Python 服务...", 0, utils.ColorYellow)
-					pythonCmd.Process.Kill()
-				}
-			}()
-		}
-	}
-	
 	// 初始化数据库
 	utils.PrintColored("🗄️  初始化数据库连接...", 0, utils.ColorYellow)
-	db, err := models.InitDatabase(config.Database.Path)
+	db, err := models.InitDatabase(config)
 	if err != nil {
 		utils.PrintColored(fmt.Sprintf("❌ 无法初始化数据库: %v", err), 0, utils.ColorRed)
 		log.Fatal(err)
@@ -244,11 +136,89 @@ func main() {
 	defer db.Close()
 	utils.PrintColored("✅ 数据库连接已建立", 0, utils.ColorGreen)
 	
+	// 数据库维护：完整性检查、WAL 检查点、ANALYZE 和 VACUUM，按配置的间隔执行
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for {
+			models.RunDatabaseMaintenance(db, utils.GetConfig())
+			<-ticker.C
+		}
+	}()
+	
 	// 设置第一个用户为管理员
 	if config.Admin.FirstUserAdmin {
 		models.SetFirstUserAsAdmin(db)
 	}
 	
+	// 加载JWT签名密钥，第一次启动时生成
+	if err := models.RotateSigningKeys(db, config); err != nil {
+		utils.PrintColored(fmt.Sprintf("❌ 无法加载JWT签名密钥: %v", err), 0, utils.ColorRed)
+		log.Fatal(err)
+	}
+	
+	// 加载CSRF令牌的HMAC密钥，第一次启动时生成
+	if err := models.LoadCSRFKey(db); err != nil {
+		utils.PrintColored(fmt.Sprintf("❌ 无法加载CSRF密钥: %v", err), 0, utils.ColorRed)
+		log.Fatal(err)
+	}
+	
+	// 定期轮换JWT签名密钥，新密钥在当前密钥退役前提前发布
+	go func() {
+		ticker := time.NewTicker(10 * time.Minute)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := models.RotateSigningKeys(db, utils.GetConfig()); err != nil {
+				utils.Error("轮换JWT签名密钥失败: %v", err)
+			}
+		}
+	}()
+	
+	// 账号或IP因连续登录失败被锁定时通知管理员
+	models.OnLoginLocked = handlers.NotifyLoginLockout
+	
+	// 定期清理过期和已撤销的会话，以及过期的安全密钥挑战
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for range ticker.C {
+			if count, err := db.Sessions().DeleteExpired(7*24*time.Hour); err != nil {
+				utils.Error("清理过期会话失败: %v", err)
+			} else if count > 0 {
+				utils.Info("已清理 %d 个过期会话", count)
+			}
+			if _, err := models.DeleteExpiredWebAuthnChallenges(db); err != nil {
+				utils.Error("清理过期的安全密钥挑战失败: %v", err)
+			}
+			if _, err := models.DeleteExpiredOIDCStates(db); err != nil {
+				utils.Error("清理过期的单点登录状态失败: %v", err)
+			}
+			if _, err := models.DeleteExpiredAccountTokens(db); err != nil {
+				utils.Error("清理过期的账号令牌失败: %v", err)
+			}
+			if _, err := models.DeleteStaleLoginThrottles(db); err != nil {
+				utils.Error("清理登录失败记录失败: %v", err)
+			}
+		}
+	}()
+	
+	// 定期从LDAP目录同步用户
+	if config.LDAP.Enabled && config.LDAP.SyncInterval > 0 {
+		go func() {
+			ticker := time.NewTicker(time.Duration(config.LDAP.SyncInterval) * time.Minute)
+			defer ticker.Stop()
+			for {
+				syncConfig := utils.GetConfig()
+				if syncConfig.LDAP.Enabled {
+					if err := handlers.SyncLDAPUsers(db, syncConfig); err != nil {
+						utils.Error("LDAP同步失败: %v", err)
+					}
+				}
+				<-ticker.C
+			}
+		}()
+	}
+	
 	// 创建路由器
 	router := mux.NewRouter()
 	
@@ -256,6 +226,12 @@ func main() {
 	fs := http.FileServer(http.Dir("frontend/static"))
 	router.PathPrefix("/static/").Handler(http.StripPrefix("/static/", fs))
 	
+	// Service Worker 需要在根路径下提供，才能接收整个站点的推送
+	router.HandleFunc("/service-worker.js", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/javascript")
+		http.ServeFile(w, r, "frontend/static/js/service-worker.js")
+	}).Methods("GET")
+	
 	// WebSocket 升级器
 	upgrader := websocket.Upgrader{
 		ReadBufferSize:  1024,
@@ -271,12 +247,41 @@ func main() {
 	// 创建 HTTP 服务器
 	server := &http.Server{
 		Addr:         config.Server.Host + ":" + config.Server.Port,
-		Handler:      router,
+		Handler:      handlers.MonitoringMiddleware(router.ServeHTTP),
+		ErrorLog:     utils.NewStdLogger("http", utils.WARN),
 		WriteTimeout: 15 * time.Second,
 		ReadTimeout:  15 * time.Second,
 		IdleTimeout:  60 * time.Second,
 	}
 	
+	// 启用 ACME 时证书由 autocert 管理，另外监听一个 HTTP 端口响应 HTTP-01 验证，其他请求重定向到 HTTPS
+	acmeConfig := config.Server.SSL.ACME
+	var challengeServer *http.Server
+	if config.Server.SSL.Enabled && acmeConfig.Enabled {
+		manager, err := newCertManager(config, db)
+		if err != nil {
+			utils.PrintColored(fmt.Sprintf("❌ 无法初始化 ACME: %v", err), 0, utils.ColorRed)
+			log.Fatal(err)
+		}
+		server.TLSConfig = manager.TLSConfig()
+		challengeServer = &http.Server{
+			Addr:         config.Server.Host + ":" + acmeConfig.HTTPPort,
+			Handler:      manager.HTTPHandler(httpsRedirectHandler(config.Server.Port)),
+			ErrorLog:     utils.NewStdLogger("tls", utils.WARN),
+			WriteTimeout: 15 * time.Second,
+			ReadTimeout:  15 * time.Second,
+			IdleTimeout:  60 * time.Second,
+		}
+		
+		go func() {
+			utils.PrintColored(fmt.Sprintf("🔐 ACME 自动证书已启用，HTTP-01 验证地址: %s，证书缓存: %s", challengeServer.Addr, acmeConfig.CacheDir), 0, utils.ColorGreen)
+			if err := challengeServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				utils.PrintColored(fmt.Sprintf("❌ HTTP-01 验证服务器错误: %v", err), 0, utils.ColorRed)
+				log.Fatal(err)
+			}
+		}()
+	}
+	
 	// 启动服务器协程
 	go func() {
 		utils.PrintColored("🌐 启动 HTTP 服务器...", 0, utils.ColorYellow)
@@ -286,10 +291,11 @@ func main() {
 		
 		if config.Server.SSL.Enabled {
 			utils.PrintColored("🔒 SSL/TLS 已启用", 0, utils.ColorGreen)
-			if err := server.ListenAndServeTLS(
-				config.Server.SSL.Cert,
-				config.Server.SSL.Key,
-			); err != nil && err != http.ErrServerClosed {
+			certFile, keyFile := config.Server.SSL.Cert, config.Server.SSL.Key
+			if acmeConfig.Enabled {
+				certFile, keyFile = "", ""
+			}
+			if err := server.ListenAndServeTLS(certFile, keyFile); err != nil && err != http.ErrServerClosed {
 				utils.PrintColored(fmt.Sprintf("❌ HTTPS 服务器错误: %v", err), 0, utils.ColorRed)
 				log.Fatal(err)
 			}
@@ -316,19 +322,27 @@ func main() {
 	if err := server.Shutdown(ctx); err != nil {
 		utils.PrintColored(fmt.Sprintf("❌ 服务器关闭错误: %v", err), 0, utils.ColorRed)
 	}
+	if challengeServer != nil {
+		if err := challengeServer.Shutdown(ctx); err != nil {
+			utils.PrintColored(fmt.Sprintf("❌ HTTP-01 验证服务器关闭错误: %v", err), 0, utils.ColorRed)
+		}
+	}
 	
 	utils.PrintColored("👋 SwiftPost 服务已停止", 0, utils.ColorGreen)
 	os.Exit(0)
 }
 
 func registerRoutes(router *mux.Router, db *models.Database, upgrader websocket.Upgrader) {
+	// 跨域处理在限流之前，预检请求不计入限流，被限流的响应也带有跨域响应头
+	router.Use(middleware.CORSMiddleware, middleware.RateLimitMiddleware)
+	
 	// HTML 页面路由
 	router.HandleFunc("/", handlers.IndexHandler).Methods("GET")
 	router.HandleFunc("/login", handlers.LoginPageHandler).Methods("GET")
 	router.HandleFunc("/register", handlers.RegisterPageHandler).Methods("GET")
 	router.HandleFunc("/dashboard", middleware.AuthMiddleware(handlers.DashboardHandler)).Methods("GET")
 	router.HandleFunc("/email/{id}", middleware.AuthMiddleware(handlers.EmailViewHandler)).Methods("GET")
-	router.HandleFunc("/admin", middleware.AuthMiddleware(middleware.AdminMiddleware(handlers.AdminHandler))).Methods("GET")
+	router.HandleFunc("/admin", middleware.AuthMiddleware(middleware.RequireAnyPermission(handlers.AdminHandler))).Methods("GET")
 	router.HandleFunc("/profile", middleware.AuthMiddleware(handlers.ProfileHandler)).Methods("GET")
 	router.HandleFunc("/blocked", handlers.BlockedHandler).Methods("GET")
 	
@@ -336,40 +350,101 @@ func registerRoutes(router *mux.Router, db *models.Database, upgrader websocket.
 	// 认证相关
 	router.HandleFunc("/api/register", handlers.RegisterHandler).Methods("POST")
 	router.HandleFunc("/api/login", handlers.LoginHandler).Methods("POST")
+	router.HandleFunc("/api/login/mfa", handlers.LoginMFAHandler).Methods("POST")
+	router.HandleFunc("/api/login/webauthn/begin", handlers.BeginWebAuthnLoginHandler).Methods("POST")
+	router.HandleFunc("/api/login/webauthn/finish", handlers.FinishWebAuthnLoginHandler).Methods("POST")
+	router.HandleFunc("/api/auth/oidc/config", handlers.GetOIDCConfigHandler).Methods("GET")
+	router.HandleFunc("/api/auth/oidc/login", handlers.OIDCLoginHandler).Methods("GET")
+	router.HandleFunc("/api/auth/oidc/callback", handlers.OIDCCallbackHandler).Methods("GET")
 	router.HandleFunc("/api/logout", middleware.AuthMiddleware(handlers.LogoutHandler)).Methods("POST")
+	router.HandleFunc("/api/logout/all", middleware.AuthMiddleware(handlers.LogoutAllHandler)).Methods("POST")
 	router.HandleFunc("/api/refresh", handlers.RefreshTokenHandler).Methods("POST")
+	router.HandleFunc("/api/password/forgot", handlers.ForgotPasswordHandler).Methods("POST")
+	router.HandleFunc("/api/password/reset", handlers.ResetPasswordHandler).Methods("POST")
+	router.HandleFunc("/api/email/verify", handlers.VerifyEmailHandler).Methods("POST")
+	router.HandleFunc("/api/email/verify/resend", handlers.ResendVerificationHandler).Methods("POST")
 	
 	// 用户相关
 	router.HandleFunc("/api/user/profile", middleware.AuthMiddleware(handlers.GetProfileHandler)).Methods("GET")
 	router.HandleFunc("/api/user/profile", middleware.AuthMiddleware(handlers.UpdateProfileHandler)).Methods("PUT")
 	router.HandleFunc("/api/user/stats", middleware.AuthMiddleware(handlers.GetUserStatsHandler)).Methods("GET")
+	router.HandleFunc("/api/user/domain", middleware.AuthMiddleware(handlers.GetDomainHandler)).Methods("GET")
 	router.HandleFunc("/api/user/domain", middleware.AuthMiddleware(handlers.UpdateDomainHandler)).Methods("PUT")
+	router.HandleFunc("/api/user/domain/verify", middleware.AuthMiddleware(handlers.VerifyDomainHandler)).Methods("POST")
+	router.HandleFunc("/api/user/notifications", middleware.AuthMiddleware(handlers.GetNotificationPreferencesHandler)).Methods("GET")
+	router.HandleFunc("/api/user/notifications", middleware.AuthMiddleware(handlers.UpdateNotificationPreferencesHandler)).Methods("PUT")
+	router.HandleFunc("/api/user/presence", middleware.AuthMiddleware(handlers.GetPresenceSettingsHandler)).Methods("GET")
+	router.HandleFunc("/api/user/presence", middleware.AuthMiddleware(handlers.UpdatePresenceSettingsHandler)).Methods("PUT")
+	router.HandleFunc("/api/user/sessions", middleware.AuthMiddleware(handlers.GetSessionsHandler)).Methods("GET")
+	router.HandleFunc("/api/user/sessions/{id}", middleware.AuthMiddleware(handlers.RevokeSessionHandler)).Methods("DELETE")
+	router.HandleFunc("/api/user/2fa", middleware.AuthMiddleware(handlers.GetMFAStatusHandler)).Methods("GET")
+	router.HandleFunc("/api/user/2fa/setup", middleware.AuthMiddleware(handlers.SetupMFAHandler)).Methods("POST")
+	router.HandleFunc("/api/user/2fa/enable", middleware.AuthMiddleware(handlers.EnableMFAHandler)).Methods("POST")
+	router.HandleFunc("/api/user/2fa/disable", middleware.AuthMiddleware(handlers.DisableMFAHandler)).Methods("POST")
+	router.HandleFunc("/api/user/2fa/recovery-codes", middleware.AuthMiddleware(handlers.RegenerateRecoveryCodesHandler)).Methods("POST")
+	router.HandleFunc("/api/user/webauthn/credentials", middleware.AuthMiddleware(handlers.GetWebAuthnCredentialsHandler)).Methods("GET")
+	router.HandleFunc("/api/user/webauthn/credentials/{id}", middleware.AuthMiddleware(handlers.RenameWebAuthnCredentialHandler)).Methods("PUT")
+	router.HandleFunc("/api/user/webauthn/credentials/{id}", middleware.AuthMiddleware(handlers.DeleteWebAuthnCredentialHandler)).Methods("DELETE")
+	router.HandleFunc("/api/user/webauthn/register/begin", middleware.AuthMiddleware(handlers.BeginWebAuthnRegistrationHandler)).Methods("POST")
+	router.HandleFunc("/api/user/webauthn/register/finish", middleware.AuthMiddleware(handlers.FinishWebAuthnRegistrationHandler)).Methods("POST")
+	router.HandleFunc("/api/user/tokens", middleware.AuthMiddleware(handlers.GetTokensHandler)).Methods("GET")
+	router.HandleFunc("/api/user/tokens", middleware.AuthMiddleware(handlers.CreateTokenHandler)).Methods("POST")
+	router.HandleFunc("/api/user/tokens/{id}", middleware.AuthMiddleware(handlers.DeleteTokenHandler)).Methods("DELETE")
+	router.HandleFunc("/api/user/app-passwords", middleware.AuthMiddleware(handlers.GetAppPasswordsHandler)).Methods("GET")
+	router.HandleFunc("/api/user/app-passwords", middleware.AuthMiddleware(handlers.CreateAppPasswordHandler)).Methods("POST")
+	router.HandleFunc("/api/user/app-passwords/{id}", middleware.AuthMiddleware(handlers.DeleteAppPasswordHandler)).Methods("DELETE")
+	
+	// 推送通知
+	router.HandleFunc("/api/push/vapid-public-key", handlers.GetVAPIDPublicKeyHandler).Methods("GET")
+	router.HandleFunc("/api/push/subscribe", middleware.AuthMiddleware(handlers.SubscribePushHandler)).Methods("POST")
+	router.HandleFunc("/api/push/unsubscribe", middleware.AuthMiddleware(handlers.UnsubscribePushHandler)).Methods("POST")
 	
 	// 邮件相关
-	router.HandleFunc("/api/emails", middleware.AuthMiddleware(handlers.GetEmailsHandler)).Methods("GET")
-	router.HandleFunc("/api/emails/send", middleware.AuthMiddleware(handlers.SendEmailHandler)).Methods("POST")
-	router.HandleFunc("/api/emails/{id}", middleware.AuthMiddleware(handlers.GetEmailHandler)).Methods("GET")
-	router.HandleFunc("/api/emails/{id}", middleware.AuthMiddleware(handlers.UpdateEmailHandler)).Methods("PUT")
-	router.HandleFunc("/api/emails/{id}", middleware.AuthMiddleware(handlers.DeleteEmailHandler)).Methods("DELETE")
-	router.HandleFunc("/api/emails/{id}/read", middleware.AuthMiddleware(handlers.MarkAsReadHandler)).Methods("PUT")
-	router.HandleFunc("/api/emails/{id}/star", middleware.AuthMiddleware(handlers.ToggleStarHandler)).Methods("PUT")
+	router.HandleFunc("/api/emails", middleware.APIAuthMiddleware(middleware.RequireScope(models.ScopeMailRead, handlers.GetEmailsHandler))).Methods("GET")
+	router.HandleFunc("/api/emails/send", middleware.APIAuthMiddleware(middleware.RequireScope(models.ScopeMailSend, middleware.SendRateLimit(handlers.SendEmailHandler)))).Methods("POST")
+	router.HandleFunc("/api/emails/{id}", middleware.APIAuthMiddleware(middleware.RequireScope(models.ScopeMailRead, handlers.GetEmailHandler))).Methods("GET")
+	router.HandleFunc("/api/emails/{id}", middleware.APIAuthMiddleware(middleware.RequireScope(models.ScopeMailWrite, handlers.UpdateEmailHandler))).Methods("PUT")
+	router.HandleFunc("/api/emails/{id}", middleware.APIAuthMiddleware(middleware.RequireScope(models.ScopeMailWrite, handlers.DeleteEmailHandler))).Methods("DELETE")
+	router.HandleFunc("/api/emails/{id}/read", middleware.APIAuthMiddleware(middleware.RequireScope(models.ScopeMailWrite, handlers.MarkAsReadHandler))).Methods("PUT")
+	router.HandleFunc("/api/emails/{id}/star", middleware.APIAuthMiddleware(middleware.RequireScope(models.ScopeMailWrite, handlers.ToggleStarHandler))).Methods("PUT")
 	
 	// 附件相关
-	router.HandleFunc("/api/attachments/upload", middleware.AuthMiddleware(handlers.UploadAttachmentHandler)).Methods("POST")
-	router.HandleFunc("/api/attachments/{id}/download", middleware.AuthMiddleware(handlers.DownloadAttachmentHandler)).Methods("GET")
+	router.HandleFunc("/api/attachments/upload", middleware.APIAuthMiddleware(middleware.RequireScope(models.ScopeMailSend, handlers.UploadAttachmentHandler))).Methods("POST")
+	router.HandleFunc("/api/attachments/{id}/download", middleware.APIAuthMiddleware(middleware.RequireScope(models.ScopeMailRead, handlers.DownloadAttachmentHandler))).Methods("GET")
 	
 	// 管理员相关
-	router.HandleFunc("/api/admin/users", middleware.AuthMiddleware(middleware.AdminMiddleware(handlers.AdminGetUsersHandler))).Methods("GET")
-	router.HandleFunc("/api/admin/users/{id}", middleware.AuthMiddleware(middleware.AdminMiddleware(handlers.AdminUpdateUserHandler))).Methods("PUT")
-	router.HandleFunc("/api/admin/users/{id}", middleware.AuthMiddleware(middleware.AdminMiddleware(handlers.AdminDeleteUserHandler))).Methods("DELETE")
-	router.HandleFunc("/api/admin/stats", middleware.AuthMiddleware(middleware.AdminMiddleware(handlers.AdminGetStatsHandler))).Methods("GET")
-	router.HandleFunc("/api/admin/emails", middleware.AuthMiddleware(middleware.AdminMiddleware(handlers.AdminGetEmailsHandler))).Methods("GET")
+	router.HandleFunc("/api/admin/users", middleware.APIAuthMiddleware(middleware.RequireScope(models.ScopeAdmin, middleware.RequirePermission(models.PermUsersRead, handlers.AdminGetUsersHandler)))).Methods("GET")
+	router.HandleFunc("/api/admin/users/{id}", middleware.APIAuthMiddleware(middleware.RequireScope(models.ScopeAdmin, middleware.RequirePermission(models.PermUsersWrite, handlers.AdminUpdateUserHandler)))).Methods("PUT")
+	router.HandleFunc("/api/admin/users/{id}", middleware.APIAuthMiddleware(middleware.RequireScope(models.ScopeAdmin, middleware.RequirePermission(models.PermUsersDelete, handlers.AdminDeleteUserHandler)))).Methods("DELETE")
+	router.HandleFunc("/api/admin/users/{id}/sessions", middleware.APIAuthMiddleware(middleware.RequireScope(models.ScopeAdmin, middleware.RequirePermission(models.PermUsersRead, handlers.AdminGetUserSessionsHandler)))).Methods("GET")
+	router.HandleFunc("/api/admin/users/{id}/sessions", middleware.APIAuthMiddleware(middleware.RequireScope(models.ScopeAdmin, middleware.RequirePermission(models.PermUsersResetPassword, handlers.AdminRevokeUserSessionsHandler)))).Methods("DELETE")
+	router.HandleFunc("/api/admin/users/{id}/2fa", middleware.APIAuthMiddleware(middleware.RequireScope(models.ScopeAdmin, middleware.RequirePermission(models.PermUsersResetPassword, handlers.AdminResetUserMFAHandler)))).Methods("DELETE")
+	router.HandleFunc("/api/admin/sessions/revoke", middleware.APIAuthMiddleware(middleware.RequireScope(models.ScopeAdmin, middleware.RequirePermission(models.PermSystemManage, handlers.AdminForceReloginHandler)))).Methods("POST")
+	router.HandleFunc("/api/admin/stats", middleware.APIAuthMiddleware(middleware.RequireScope(models.ScopeAdmin, middleware.RequirePermission(models.PermStatsRead, handlers.AdminGetStatsHandler)))).Methods("GET")
+	router.HandleFunc("/api/admin/emails", middleware.APIAuthMiddleware(middleware.RequireScope(models.ScopeAdmin, middleware.RequirePermission(models.PermMailReadAll, handlers.AdminGetEmailsHandler)))).Methods("GET")
+	router.HandleFunc("/api/admin/notifications", middleware.APIAuthMiddleware(middleware.RequireScope(models.ScopeAdmin, middleware.RequirePermission(models.PermNotificationsSend, handlers.AdminSendSystemNotificationHandler)))).Methods("POST")
+	router.HandleFunc("/api/admin/ldap/sync", middleware.APIAuthMiddleware(middleware.RequireScope(models.ScopeAdmin, middleware.RequirePermission(models.PermSystemManage, handlers.AdminSyncLDAPHandler)))).Methods("POST")
+	router.HandleFunc("/api/admin/lockouts", middleware.APIAuthMiddleware(middleware.RequireScope(models.ScopeAdmin, middleware.RequirePermission(models.PermUsersResetPassword, handlers.AdminGetLoginLockoutsHandler)))).Methods("GET")
+	router.HandleFunc("/api/admin/lockouts/unlock", middleware.APIAuthMiddleware(middleware.RequireScope(models.ScopeAdmin, middleware.RequirePermission(models.PermUsersResetPassword, handlers.AdminUnlockLoginHandler)))).Methods("POST")
+	router.HandleFunc("/api/admin/users/{id}/password", middleware.APIAuthMiddleware(middleware.RequireScope(models.ScopeAdmin, middleware.RequirePermission(models.PermUsersResetPassword, handlers.AdminResetUserPasswordHandler)))).Methods("POST")
+	router.HandleFunc("/api/admin/users/{id}/roles", middleware.APIAuthMiddleware(middleware.RequireScope(models.ScopeAdmin, middleware.RequirePermission(models.PermUsersRead, handlers.AdminGetUserRolesHandler)))).Methods("GET")
+	router.HandleFunc("/api/admin/users/{id}/roles", middleware.APIAuthMiddleware(middleware.RequireScope(models.ScopeAdmin, middleware.RequirePermission(models.PermRolesManage, handlers.AdminSetUserRolesHandler)))).Methods("PUT")
+	router.HandleFunc("/api/admin/roles", middleware.APIAuthMiddleware(middleware.RequireScope(models.ScopeAdmin, middleware.RequirePermission(models.PermRolesManage, handlers.AdminGetRolesHandler)))).Methods("GET")
+	router.HandleFunc("/api/admin/roles", middleware.APIAuthMiddleware(middleware.RequireScope(models.ScopeAdmin, middleware.RequirePermission(models.PermRolesManage, handlers.AdminCreateRoleHandler)))).Methods("POST")
+	router.HandleFunc("/api/admin/roles/{id}", middleware.APIAuthMiddleware(middleware.RequireScope(models.ScopeAdmin, middleware.RequirePermission(models.PermRolesManage, handlers.AdminUpdateRoleHandler)))).Methods("PUT")
+	router.HandleFunc("/api/admin/roles/{id}", middleware.APIAuthMiddleware(middleware.RequireScope(models.ScopeAdmin, middleware.RequirePermission(models.PermRolesManage, handlers.AdminDeleteRoleHandler)))).Methods("DELETE")
+	router.HandleFunc("/api/admin/keys", middleware.APIAuthMiddleware(middleware.RequireScope(models.ScopeAdmin, middleware.RequirePermission(models.PermSystemManage, handlers.AdminGetSigningKeysHandler)))).Methods("GET")
+	router.HandleFunc("/api/admin/keys/rotate", middleware.APIAuthMiddleware(middleware.RequireScope(models.ScopeAdmin, middleware.RequirePermission(models.PermSystemManage, handlers.AdminRotateSigningKeysHandler)))).Methods("POST")
+	router.HandleFunc("/api/admin/keys/{kid}", middleware.APIAuthMiddleware(middleware.RequireScope(models.ScopeAdmin, middleware.RequirePermission(models.PermSystemManage, handlers.AdminRevokeSigningKeyHandler)))).Methods("DELETE")
 	
 	// WebSocket 路由
 	router.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
 		handlers.WebSocketHandler(w, r, db, upgrader)
 	})
 	
+	// 其他服务通过公钥验证 SwiftPost 签发的令牌
+	router.HandleFunc("/.well-known/jwks.json", handlers.JWKSHandler).Methods("GET")
+	
 	// 健康检查
 	router.HandleFunc("/health", handlers.HealthCheckHandler).Methods("GET")
 	router.HandleFunc("/api/health", handlers.HealthCheckHandler).Methods("GET")
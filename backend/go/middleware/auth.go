@@ -1,24 +1,30 @@
 package middleware
 
 import (
+	"SwiftPost/models"
 	"SwiftPost/utils"
 	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
 	"strings"
-
-	"github.com/dgrijalva/jwt-go"
 )
 
+// authLog 认证和CSRF校验的日志，与 handlers 中的 auth 子系统共用级别
+var authLog = utils.NewLogger("auth")
+
 // AuthMiddleware 验证JWT令牌
 func AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
+		fromCookie := authHeader == ""
+		if fromCookie {
 			// 尝试从Cookie获取
 			cookie, err := r.Cookie("token")
 			if err != nil {
-				// 重定向到登录页面
-				http.Redirect(w, r, "/login", http.StatusFound)
+				unauthorized(w, r, "需要认证")
 				return
 			}
 			authHeader = "Bearer " + cookie.Value
@@ -26,70 +32,175 @@ func AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 
 		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 		if tokenString == authHeader {
-			http.Redirect(w, r, "/login", http.StatusFound)
+			unauthorized(w, r, "无效的Token格式")
 			return
 		}
 
-		config, _ := utils.LoadConfig("config.json")
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, jwt.NewValidationError("无效的签名方法", jwt.ValidationErrorSignatureInvalid)
-			}
-			return []byte(config.Security.JWTSecret), nil
-		})
-
-		if err != nil || !token.Valid {
-			utils.Error("Token验证失败: %v", err)
-			http.Redirect(w, r, "/login", http.StatusFound)
+		// 个人访问令牌只能用于声明了权限范围的API接口
+		if utils.IsPersonalAccessToken(tokenString) {
+			respondJSON(w, http.StatusForbidden, map[string]interface{}{
+				"success": false,
+				"message": "个人访问令牌无权访问此接口",
+			})
 			return
 		}
 
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			http.Redirect(w, r, "/login", http.StatusFound)
+		ctx, err := authenticate(r, tokenString)
+		if err != nil {
+			authLog.ErrorContext(r.Context(), "Token验证失败: %v", err)
+			unauthorized(w, r, "无效的Token")
 			return
 		}
 
-		// 提取用户信息
-		userIDFloat, ok := claims["user_id"].(float64)
-		if !ok {
-			http.Redirect(w, r, "/login", http.StatusFound)
+		// 浏览器会自动带上Cookie，写请求需要校验CSRF令牌
+		if fromCookie && !checkCSRF(w, r, ctx) {
 			return
 		}
-		userID := int(userIDFloat)
 
-		username, _ := claims["username"].(string)
-		email, _ := claims["email"].(string)
-		isAdmin, _ := claims["is_admin"].(bool)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}
+}
+
+// authenticate 验证访问令牌及其会话，会话被撤销或用户被禁用时令牌立即失效
+func authenticate(r *http.Request, tokenString string) (context.Context, error) {
+	if utils.IsPersonalAccessToken(tokenString) {
+		return authenticatePersonalAccessToken(r, tokenString)
+	}
 
-		// 将用户信息添加到上下文
-		ctx := context.WithValue(r.Context(), "user_id", userID)
-		ctx = context.WithValue(ctx, "username", username)
-		ctx = context.WithValue(ctx, "email", email)
-		ctx = context.WithValue(ctx, "is_admin", isAdmin)
+	claims, err := utils.ParseAccessToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
 
-		next.ServeHTTP(w, r.WithContext(ctx))
+	db := models.GetDB()
+	isAdmin, err := db.Sessions().Validate(claims.SessionID, claims.UserID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("会话已失效或用户已被禁用")
+		}
+		return nil, err
 	}
+	db.Sessions().Touch(claims.SessionID)
+
+	// 将用户信息添加到上下文，管理员状态以数据库为准
+	ctx := context.WithValue(r.Context(), "user_id", claims.UserID)
+	ctx = context.WithValue(ctx, "username", claims.Username)
+	ctx = context.WithValue(ctx, "email", claims.Email)
+	ctx = context.WithValue(ctx, "is_admin", isAdmin)
+	ctx = context.WithValue(ctx, "session_id", claims.SessionID)
+	ctx = context.WithValue(ctx, "permissions", effectivePermissions(isAdmin, claims.Scopes))
+
+	return ctx, nil
 }
 
-// AdminMiddleware 检查是否是管理员
-func AdminMiddleware(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		isAdmin, ok := r.Context().Value("is_admin").(bool)
-		if !ok || !isAdmin {
-			http.Error(w, "需要管理员权限", http.StatusForbidden)
-			return
+// authenticatePersonalAccessToken 验证个人访问令牌，上下文中带上令牌的权限范围
+func authenticatePersonalAccessToken(r *http.Request, tokenString string) (context.Context, error) {
+	db := models.GetDB()
+	token, user, err := models.ValidatePersonalAccessToken(db, utils.HashToken(tokenString))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("个人访问令牌无效、已过期或用户已被禁用")
 		}
-		next.ServeHTTP(w, r)
+		return nil, err
 	}
+	models.TouchPersonalAccessToken(db, token.ID, utils.ClientIP(r))
+
+	return withUser(r.Context(), user, token.ID, token.Scopes), nil
+}
+
+// authenticateAppPassword 使用 HTTP Basic 认证和应用专用密码登录，只授予读写和发送邮件的权限
+func authenticateAppPassword(r *http.Request, email, password string) (context.Context, error) {
+	config := utils.GetConfig()
+	allowPassword := !(config.OIDC.Enabled && config.OIDC.DisableLocalPassword)
+
+	user, err := models.AuthenticateProtocolLogin(models.GetDB(), config, email, password, utils.ClientIP(r), allowPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	return withUser(r.Context(), user, 0, []string{models.ScopeMailRead, models.ScopeMailWrite, models.ScopeMailSend}), nil
+}
+
+// withUser 将非会话凭据对应的用户信息添加到上下文
+func withUser(parent context.Context, user *models.User, tokenID int, scopes []string) context.Context {
+	ctx := context.WithValue(parent, "user_id", user.ID)
+	ctx = context.WithValue(ctx, "username", user.Username)
+	ctx = context.WithValue(ctx, "email", user.Email)
+	ctx = context.WithValue(ctx, "is_admin", user.IsAdmin)
+	ctx = context.WithValue(ctx, "token_id", tokenID)
+	ctx = context.WithValue(ctx, "token_scopes", scopes)
+
+	// 只有带 admin 权限范围的凭据才能使用用户角色授予的后台权限
+	var permissions []string
+	if hasScope(scopes, models.ScopeAdmin) {
+		granted, err := models.GetUserPermissions(models.GetDB(), user.ID)
+		if err != nil {
+			authLog.ErrorContext(parent, "获取用户权限失败: %v", err)
+		}
+		permissions = effectivePermissions(user.IsAdmin, granted)
+	}
+	ctx = context.WithValue(ctx, "permissions", permissions)
+	return ctx
+}
+
+// effectivePermissions 超级管理员拥有全部权限，其他用户使用角色授予的权限
+func effectivePermissions(isAdmin bool, granted []string) []string {
+	if isAdmin {
+		return []string{models.PermissionAll}
+	}
+	return granted
+}
+
+// unauthorized API请求返回401，页面请求重定向到登录页面
+func unauthorized(w http.ResponseWriter, r *http.Request, message string) {
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		respondJSON(w, http.StatusUnauthorized, map[string]interface{}{
+			"success": false,
+			"message": message,
+		})
+		return
+	}
+	http.Redirect(w, r, "/login", http.StatusFound)
 }
 
 // APIAuthMiddleware API认证中间件
+// 接受会话令牌、个人访问令牌，以及使用应用专用密码的 HTTP Basic 认证
 func APIAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if email, password, ok := r.BasicAuth(); ok {
+			ctx, err := authenticateAppPassword(r, email, password)
+			if err != nil {
+				authLog.WarnContext(r.Context(), "API Basic认证失败: %s: %v", email, err)
+				var blocked *models.LoginBlockedError
+				if errors.As(err, &blocked) {
+					w.Header().Set("Retry-After", strconv.Itoa(int(blocked.RetryAfter.Seconds())+1))
+					respondJSON(w, http.StatusTooManyRequests, map[string]interface{}{
+						"success": false,
+						"message": blocked.Error(),
+					})
+					return
+				}
+				w.Header().Set("WWW-Authenticate", `Basic realm="SwiftPost"`)
+				respondJSON(w, http.StatusUnauthorized, map[string]interface{}{
+					"success": false,
+					"message": "邮箱或密码错误",
+				})
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
 		authHeader := r.Header.Get("Authorization")
+		fromCookie := authHeader == ""
+		if fromCookie {
+			// 页面中的附件下载链接等请求只带Cookie
+			if cookie, err := r.Cookie("token"); err == nil {
+				authHeader = "Bearer " + cookie.Value
+			}
+		}
 		if authHeader == "" {
-			utils.Error("API请求缺少认证头")
+			authLog.ErrorContext(r.Context(), "API请求缺少认证头")
 			respondJSON(w, http.StatusUnauthorized, map[string]interface{}{
 				"success": false,
 				"message": "需要认证",
@@ -99,7 +210,7 @@ func APIAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 
 		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 		if tokenString == authHeader {
-			utils.Error("API请求Token格式错误")
+			authLog.ErrorContext(r.Context(), "API请求Token格式错误")
 			respondJSON(w, http.StatusUnauthorized, map[string]interface{}{
 				"success": false,
 				"message": "无效的Token格式",
@@ -107,16 +218,9 @@ func APIAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
-		config, _ := utils.LoadConfig("config.json")
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, jwt.NewValidationError("无效的签名方法", jwt.ValidationErrorSignatureInvalid)
-			}
-			return []byte(config.Security.JWTSecret), nil
-		})
-
-		if err != nil || !token.Valid {
-			utils.Error("API Token验证失败: %v", err)
+		ctx, err := authenticate(r, tokenString)
+		if err != nil {
+			authLog.ErrorContext(r.Context(), "API Token验证失败: %v", err)
 			respondJSON(w, http.StatusUnauthorized, map[string]interface{}{
 				"success": false,
 				"message": "无效的Token",
@@ -124,48 +228,67 @@ func APIAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			respondJSON(w, http.StatusUnauthorized, map[string]interface{}{
-				"success": false,
-				"message": "无效的Token声明",
-			})
+		if fromCookie && !checkCSRF(w, r, ctx) {
 			return
 		}
 
-		// 提取用户信息
-		userIDFloat, ok := claims["user_id"].(float64)
-		if !ok {
-			respondJSON(w, http.StatusUnauthorized, map[string]interface{}{
-				"success": false,
-				"message": "无效的用户ID",
-			})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}
+}
+
+// RequirePermission 要求当前用户拥有指定的后台权限，超级管理员拥有全部权限
+// 按域名授权的权限在这里放行，由处理函数检查操作对象是否属于该域名
+func RequirePermission(permission string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		permissions, _ := r.Context().Value("permissions").([]string)
+		if !models.HasPermission(permissions, permission) {
+			forbidden(w, r, "没有权限执行此操作: "+permission)
 			return
 		}
-		userID := int(userIDFloat)
-
-		username, _ := claims["username"].(string)
-		email, _ := claims["email"].(string)
-		isAdmin, _ := claims["is_admin"].(bool)
+		if adminMFAMissing(r) {
+			forbidden(w, r, "管理员账号需要启用两步验证")
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+}
 
-		// 将用户信息添加到上下文
-		ctx := context.WithValue(r.Context(), "user_id", userID)
-		ctx = context.WithValue(ctx, "username", username)
-		ctx = context.WithValue(ctx, "email", email)
-		ctx = context.WithValue(ctx, "is_admin", isAdmin)
+// RequireAnyPermission 要求当前用户拥有任意一项后台权限，用于管理后台页面
+func RequireAnyPermission(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		permissions, _ := r.Context().Value("permissions").([]string)
+		if len(permissions) == 0 {
+			forbidden(w, r, "需要管理员权限")
+			return
+		}
+		if adminMFAMissing(r) {
+			forbidden(w, r, "管理员账号需要启用两步验证")
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+}
 
-		next.ServeHTTP(w, r.WithContext(ctx))
+// forbidden API请求返回JSON格式的403，页面请求返回纯文本
+func forbidden(w http.ResponseWriter, r *http.Request, message string) {
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		respondJSON(w, http.StatusForbidden, map[string]interface{}{
+			"success": false,
+			"message": message,
+		})
+		return
 	}
+	http.Error(w, message, http.StatusForbidden)
 }
 
-// APIAdminMiddleware API管理员中间件
-func APIAdminMiddleware(next http.HandlerFunc) http.HandlerFunc {
+// RequireScope 个人访问令牌和应用专用密码必须包含指定的权限范围，会话令牌不受限制
+func RequireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		isAdmin, ok := r.Context().Value("is_admin").(bool)
-		if !ok || !isAdmin {
+		scopes, ok := r.Context().Value("token_scopes").([]string)
+		if ok && !hasScope(scopes, scope) {
 			respondJSON(w, http.StatusForbidden, map[string]interface{}{
 				"success": false,
-				"message": "需要管理员权限",
+				"message": "访问令牌缺少权限: " + scope,
 			})
 			return
 		}
@@ -173,11 +296,34 @@ func APIAdminMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+func hasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// adminMFAMissing 配置要求管理员启用两步验证，而当前管理员既未启用验证器也未注册安全密钥
+// 拥有后台权限的角色同样视为管理员
+func adminMFAMissing(r *http.Request) bool {
+	config := utils.GetConfig()
+	if !config.Admin.Require2FA {
+		return false
+	}
+
+	userID, _ := r.Context().Value("user_id").(int)
+	enabled, err := models.HasSecondFactor(models.GetDB(), userID)
+	if err != nil {
+		authLog.ErrorContext(r.Context(), "获取两步验证状态失败: %v", err)
+		return true
+	}
+	return !enabled
+}
+
 func respondJSON(w http.ResponseWriter, status int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 	json.NewEncoder(w).Encode(data)
 }
-
-// 需要导入 encoding/json
-import "encoding/json"
\ No newline at end of file
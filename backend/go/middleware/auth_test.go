@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"SwiftPost/models"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireScope(t *testing.T) {
+	readOnly := []string{models.ScopeMailRead}
+	tests := []struct {
+		name   string
+		scopes []string
+		scope  string
+		want   int
+	}{
+		{"只读令牌读取邮件", readOnly, models.ScopeMailRead, http.StatusOK},
+		{"只读令牌修改邮件", readOnly, models.ScopeMailWrite, http.StatusForbidden},
+		{"只读令牌发送邮件", readOnly, models.ScopeMailSend, http.StatusForbidden},
+		{"读写令牌修改邮件", []string{models.ScopeMailRead, models.ScopeMailWrite}, models.ScopeMailWrite, http.StatusOK},
+		{"会话不受令牌权限限制", nil, models.ScopeMailWrite, http.StatusOK},
+	}
+	for _, tt := range tests {
+		handler := RequireScope(tt.scope, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})
+		r := httptest.NewRequest("DELETE", "/api/emails/1", nil)
+		if tt.scopes != nil {
+			r = r.WithContext(context.WithValue(r.Context(), "token_scopes", tt.scopes))
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+		if w.Code != tt.want {
+			t.Errorf("%s: 状态码 = %d，应为 %d", tt.name, w.Code, tt.want)
+		}
+	}
+}
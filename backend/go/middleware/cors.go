@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"SwiftPost/utils"
+	"net/http"
+	"strings"
+)
+
+const (
+	corsAllowMethods  = "GET, POST, PUT, DELETE, OPTIONS"
+	corsAllowHeaders  = "Authorization, Content-Type, X-Requested-With, X-CSRF-Token"
+	corsExposeHeaders = "X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset, Retry-After"
+	corsMaxAge        = "600"
+)
+
+// corsAllowedOrigin 检查来源是否在 cors_origins 中，返回应写入 Access-Control-Allow-Origin 的值
+// 配置为 * 时允许任意来源但不允许携带Cookie，明确列出的来源才会允许携带凭据
+func corsAllowedOrigin(origins, origin string) (string, bool) {
+	for _, allowed := range strings.Split(origins, ",") {
+		allowed = strings.TrimRight(strings.TrimSpace(allowed), "/")
+		switch {
+		case allowed == "*":
+			return "*", true
+		case allowed != "" && strings.EqualFold(allowed, origin):
+			return origin, true
+		}
+	}
+	return "", false
+}
+
+// CORSMiddleware 按 cors_origins 处理跨域请求和预检请求
+func CORSMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		config := utils.GetConfig()
+		origins := config.Security.CorsOrigins
+		if origins == "" {
+			origins = "*"
+		}
+
+		w.Header().Add("Vary", "Origin")
+		allowOrigin, ok := corsAllowedOrigin(origins, origin)
+		if !ok {
+			// 不在允许列表中的来源不返回跨域响应头，由浏览器拦截；同源请求不受影响
+			if preflight {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", allowOrigin)
+		if allowOrigin != "*" {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if preflight {
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+			w.Header().Set("Access-Control-Allow-Methods", corsAllowMethods)
+			w.Header().Set("Access-Control-Allow-Headers", corsAllowHeaders)
+			w.Header().Set("Access-Control-Max-Age", corsMaxAge)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		w.Header().Set("Access-Control-Expose-Headers", corsExposeHeaders)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"SwiftPost/utils"
+	"context"
+	"net/http"
+)
+
+// CSRFHeader 使用Cookie认证的写请求必须在该请求头中带上 csrf_token Cookie 的值
+const CSRFHeader = "X-CSRF-Token"
+
+// csrfSafeMethod 只读请求不需要CSRF校验
+func csrfSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// checkCSRF 校验Cookie认证的写请求，CSRF令牌与当前会话绑定；通过 Authorization 请求头认证的客户端不需要校验
+func checkCSRF(w http.ResponseWriter, r *http.Request, ctx context.Context) bool {
+	if csrfSafeMethod(r.Method) {
+		return true
+	}
+
+	sessionID, _ := ctx.Value("session_id").(int)
+	if utils.ValidCSRFToken(sessionID, r.Header.Get(CSRFHeader)) {
+		return true
+	}
+
+	authLog.WarnContext(r.Context(), "CSRF校验失败: %s %s (%s)", r.Method, r.URL.Path, utils.ClientIP(r))
+	respondJSON(w, http.StatusForbidden, map[string]interface{}{
+		"success": false,
+		"message": "CSRF校验失败，请刷新页面后重试",
+	})
+	return false
+}
@@ -0,0 +1,194 @@
+package middleware
+
+import (
+	"SwiftPost/utils"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// httpLog 与 MonitoringMiddleware 的访问日志使用同一个 http 子系统
+var httpLog = utils.NewLogger("http")
+
+// 限流的路由分类
+const (
+	rateClassAPI  = "api"
+	rateClassAuth = "auth"
+	rateClassSend = "send"
+)
+
+// tokenBucket 令牌桶，tokens 按容量和周期匀速补充
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter 内存中的令牌桶集合，键为 路由分类 + 用户或IP
+type rateLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+var limiter = &rateLimiter{buckets: make(map[string]*tokenBucket)}
+
+// rateLimitResult 一次限流检查的结果，用于设置响应头
+type rateLimitResult struct {
+	allowed    bool
+	limit      int
+	remaining  int
+	reset      time.Duration // 令牌桶恢复为满的剩余时间
+	retryAfter time.Duration // 被拒绝时下一个令牌可用的剩余时间
+}
+
+// take 从桶中取出一个令牌，桶的容量为 limit，每 period 补满一次
+func (l *rateLimiter) take(key string, limit int, period time.Duration) rateLimitResult {
+	now := time.Now()
+	rate := float64(limit) / period.Seconds()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// 定期清理已经补满的桶，避免长时间运行后占用过多内存
+	if now.Sub(l.lastSweep) > 10*time.Minute {
+		for k, b := range l.buckets {
+			if now.Sub(b.last) > time.Hour {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(limit), last: now}
+		l.buckets[key] = b
+	} else {
+		b.tokens = math.Min(float64(limit), b.tokens+now.Sub(b.last).Seconds()*rate)
+		b.last = now
+	}
+
+	result := rateLimitResult{limit: limit}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.allowed = true
+	} else {
+		result.retryAfter = time.Duration((1 - b.tokens) / rate * float64(time.Second))
+	}
+	result.remaining = int(b.tokens)
+	result.reset = time.Duration((float64(limit) - b.tokens) / rate * float64(time.Second))
+	return result
+}
+
+// writeRateLimitHeaders 设置 X-RateLimit-* 响应头，被拒绝时返回429和 Retry-After
+func writeRateLimitHeaders(w http.ResponseWriter, result rateLimitResult) bool {
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(result.limit))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(result.remaining))
+	w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(result.reset).Unix(), 10))
+	if result.allowed {
+		return true
+	}
+
+	seconds := int(math.Ceil(result.retryAfter.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	respondJSON(w, http.StatusTooManyRequests, map[string]interface{}{
+		"success": false,
+		"message": fmt.Sprintf("请求过于频繁，请在 %d 秒后重试", seconds),
+	})
+	return false
+}
+
+// routeRateClass 认证类接口单独按IP限流，其余API和WebSocket按用户限流，页面和静态文件不限流
+func routeRateClass(path string) string {
+	switch {
+	case path == "/api/login" || strings.HasPrefix(path, "/api/login/"),
+		path == "/api/register",
+		path == "/api/refresh",
+		strings.HasPrefix(path, "/api/password/"),
+		strings.HasPrefix(path, "/api/email/verify"),
+		strings.HasPrefix(path, "/api/auth/"):
+		return rateClassAuth
+	case strings.HasPrefix(path, "/api/"), path == "/ws":
+		return rateClassAPI
+	}
+	return ""
+}
+
+// rateLimitIdentity 已登录的请求按用户计数，其余按客户端IP计数
+// 只信任签名有效的访问令牌，避免他人用伪造的凭据耗尽某个用户的配额
+func rateLimitIdentity(r *http.Request, config *utils.Config) string {
+	tokenString := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if tokenString == r.Header.Get("Authorization") {
+		tokenString = r.URL.Query().Get("token")
+		if cookie, err := r.Cookie("token"); err == nil && tokenString == "" {
+			tokenString = cookie.Value
+		}
+	}
+
+	if tokenString != "" && !utils.IsPersonalAccessToken(tokenString) {
+		if claims, err := utils.ParseAccessToken(tokenString); err == nil {
+			return "user:" + strconv.Itoa(claims.UserID)
+		}
+	}
+	return "ip:" + utils.ClientIP(r)
+}
+
+// RateLimitMiddleware 按路由分类对API请求限流，认证类接口按IP、其余接口按用户
+func RateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		class := routeRateClass(r.URL.Path)
+		if class == "" || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		config := utils.GetConfig()
+
+		var key string
+		limit := config.Security.RateLimit
+		if class == rateClassAuth {
+			key = class + ":ip:" + utils.ClientIP(r)
+			limit = config.Security.AuthRateLimit
+			if limit <= 0 {
+				limit = 20
+			}
+		} else {
+			key = class + ":" + rateLimitIdentity(r, config)
+			if limit <= 0 {
+				limit = 100
+			}
+		}
+
+		if !writeRateLimitHeaders(w, limiter.take(key, limit, time.Minute)) {
+			httpLog.WarnContext(r.Context(), "请求被限流: %s %s (%s)", r.Method, r.URL.Path, key)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// SendRateLimit 限制每个用户每小时发送的邮件数，需要放在认证中间件之后
+func SendRateLimit(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := r.Context().Value("user_id").(int)
+
+		config := utils.GetConfig()
+		limit := config.Security.SendRateLimit
+		if limit <= 0 {
+			limit = 100
+		}
+
+		key := rateClassSend + ":user:" + strconv.Itoa(userID)
+		if !writeRateLimitHeaders(w, limiter.take(key, limit, time.Hour)) {
+			httpLog.WarnContext(r.Context(), "用户 %d 发送邮件过于频繁，已限流", userID)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
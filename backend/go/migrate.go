@@ -0,0 +1,155 @@
+package main
+
+import (
+	"SwiftPost/models"
+	"SwiftPost/utils"
+	"flag"
+	"fmt"
+	"os"
+)
+
+const migrateUsage = `用法: swiftpost migrate <命令> [参数]
+
+命令:
+  status                    显示每个迁移的应用情况和当前结构版本
+  up [--to N] [--dry-run]   应用未执行的迁移，默认升级到最新版本
+  down [--steps N | --to N] [--dry-run] [--force]
+                            回退已应用的迁移，默认回退最近的一个
+
+--dry-run 只打印将要执行的SQL，不修改数据库
+--force   允许回退初始迁移 0001，会删除所有表和数据
+-config   配置文件，默认为 SWIFTPOST_CONFIG 或 config.json
+`
+
+// runMigrateCommand 执行 swiftpost migrate 子命令，返回进程退出码
+func runMigrateCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return 2
+	}
+	
+	command := args[0]
+	flags := flag.NewFlagSet("migrate "+command, flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, migrateUsage) }
+	dryRun := flags.Bool("dry-run", false, "只打印SQL，不修改数据库")
+	target := flags.Int("to", -1, "目标版本")
+	steps := flags.Int("steps", 1, "回退的迁移数量")
+	force := flags.Bool("force", false, "允许回退初始迁移，会删除所有表和数据")
+	configFile := flags.String("config", utils.DefaultConfigFile(), "配置文件")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+	
+	config, err := utils.LoadConfig(*configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ 无法加载配置: %v\n", err)
+		return 1
+	}
+	
+	db, err := models.OpenDatabase(config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	defer db.Close()
+	
+	switch command {
+	case "status":
+		err = migrateStatus(db)
+	case "up":
+		err = migrateUp(db, *target, *dryRun)
+	case "down":
+		err = migrateDown(db, *target, *steps, *dryRun, *force)
+	default:
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return 2
+	}
+	
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func migrateStatus(db *models.Database) error {
+	statuses, current, err := models.GetMigrationStatus(db)
+	if statuses == nil {
+		return err
+	}
+	
+	fmt.Printf("当前结构版本: %d\n\n", current)
+	for _, status := range statuses {
+		applied := "未应用"
+		if status.AppliedAt != nil {
+			applied = "已应用 " + status.AppliedAt.Local().Format("2006-01-02 15:04:05")
+		}
+		fmt.Printf("  %04d  %-32s %s\n", status.Version, status.Name, applied)
+	}
+	
+	// 数据库比程序新时仍然显示已知的迁移，再返回错误
+	return err
+}
+
+func migrateUp(db *models.Database, target int, dryRun bool) error {
+	if target < 0 {
+		target = 0
+	}
+	
+	pending, err := models.PendingMigrations(db, target)
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		fmt.Println("✅ 数据库已是最新版本")
+		return nil
+	}
+	
+	for _, migration := range pending {
+		if dryRun {
+			fmt.Println(models.MigrationSQL(migration, true))
+			continue
+		}
+		if err := models.ApplyMigration(db, migration); err != nil {
+			return err
+		}
+		fmt.Printf("✅ 已应用 %04d_%s\n", migration.Version, migration.Name)
+	}
+	return nil
+}
+
+// baselineMigration 初始迁移，回退它会删除所有表
+const baselineMigration = 1
+
+func migrateDown(db *models.Database, target, steps int, dryRun, force bool) error {
+	rollback, err := models.RollbackMigrations(db, max(target, 0))
+	if err != nil {
+		return err
+	}
+	
+	// 没有指定目标版本时按数量回退
+	if target < 0 && steps < len(rollback) {
+		rollback = rollback[:max(steps, 0)]
+	}
+	if len(rollback) == 0 {
+		fmt.Println("没有需要回退的迁移")
+		return nil
+	}
+	
+	// 在回退任何迁移之前检查，避免回退到一半才停下
+	if last := rollback[len(rollback)-1]; last.Version == baselineMigration && !dryRun && !force {
+		return fmt.Errorf("回退 %04d_%s 会删除所有表和数据，确认后加上 --force 重新执行", last.Version, last.Name)
+	}
+	
+	for _, migration := range rollback {
+		if dryRun {
+			fmt.Println(models.MigrationSQL(migration, false))
+			continue
+		}
+		if err := models.RevertMigration(db, migration); err != nil {
+			return err
+		}
+		fmt.Printf("✅ 已回退 %04d_%s\n", migration.Version, migration.Name)
+	}
+	return nil
+}
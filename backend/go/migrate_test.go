@@ -0,0 +1,68 @@
+package main
+
+import (
+	"SwiftPost/models"
+	"SwiftPost/utils"
+	"path/filepath"
+	"testing"
+)
+
+func newTestDB(t *testing.T) *models.Database {
+	t.Helper()
+	config, err := (&utils.ConfigLoader{}).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Database.Path = filepath.Join(t.TempDir(), "swiftpost.db")
+	db, err := models.InitDatabase(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func schemaVersion(t *testing.T, db *models.Database) int {
+	t.Helper()
+	_, current, err := models.GetMigrationStatus(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return current
+}
+
+func TestMigrateDownRefusesBaseline(t *testing.T) {
+	db := newTestDB(t)
+	latest := schemaVersion(t, db)
+	
+	// 回退到 0 或按数量回退到初始迁移时，没有 --force 不回退任何迁移
+	if err := migrateDown(db, 0, 1, false, false); err == nil {
+		t.Fatal("没有 --force 时回退初始迁移应当失败")
+	}
+	if err := migrateDown(db, -1, latest, false, false); err == nil {
+		t.Fatal("没有 --force 时按数量回退到初始迁移应当失败")
+	}
+	if got := schemaVersion(t, db); got != latest {
+		t.Fatalf("结构版本 = %d，拒绝回退时不应修改数据库", got)
+	}
+	
+	// 只打印SQL时不需要 --force
+	if err := migrateDown(db, 0, 1, true, false); err != nil {
+		t.Fatalf("--dry-run: %v", err)
+	}
+	
+	// 不涉及初始迁移的回退不受影响
+	if err := migrateDown(db, 1, 1, false, false); err != nil {
+		t.Fatalf("回退到版本 1: %v", err)
+	}
+	if got := schemaVersion(t, db); got != 1 {
+		t.Fatalf("结构版本 = %d，应为 1", got)
+	}
+	
+	if err := migrateDown(db, 0, 1, false, true); err != nil {
+		t.Fatalf("--force: %v", err)
+	}
+	if got := schemaVersion(t, db); got != 0 {
+		t.Fatalf("结构版本 = %d，应为 0", got)
+	}
+}
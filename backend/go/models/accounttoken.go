@@ -0,0 +1,78 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// 账号令牌的用途
+const (
+	AccountTokenPasswordReset = "password_reset"
+	AccountTokenVerifyEmail   = "verify_email"
+)
+
+// CreateAccountToken 记录新签发的账号令牌，email 为发送令牌时的邮箱地址，用于按地址限流
+func CreateAccountToken(db *Database, id string, userID int, purpose, email string, expiresAt time.Time) error {
+	query := `
+	INSERT INTO account_tokens (id, user_id, purpose, email, expires_at, created_at)
+	VALUES (?, ?, ?, ?, ?, ?)
+	`
+	
+	_, err := db.Exec(query, id, userID, purpose, email, expiresAt, time.Now())
+	return err
+}
+
+// CountRecentAccountTokens 统计某个地址在指定时间之后签发的同类令牌数量
+func CountRecentAccountTokens(db *Database, email, purpose string, since time.Time) (int, error) {
+	var count int
+	err := db.QueryRow(
+		"SELECT COUNT(*) FROM account_tokens WHERE email = ? AND purpose = ? AND created_at > ?",
+		email, purpose, since,
+	).Scan(&count)
+	return count, err
+}
+
+// ConsumeAccountToken 将令牌标记为已使用，令牌不存在、已使用、已过期或不属于该用户时返回 sql.ErrNoRows
+func ConsumeAccountToken(db *Database, id string, userID int, purpose string) error {
+	now := time.Now()
+	result, err := db.Exec(`
+	UPDATE account_tokens SET used_at = ?
+	WHERE id = ? AND user_id = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?
+	`, now, id, userID, purpose, now)
+	if err != nil {
+		return err
+	}
+	
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	
+	return nil
+}
+
+// InvalidateAccountTokens 作废用户尚未使用的同类令牌，例如密码重置成功后作废其他重置链接
+func InvalidateAccountTokens(db *Database, userID int, purpose string) error {
+	_, err := db.Exec(
+		"UPDATE account_tokens SET used_at = ? WHERE user_id = ? AND purpose = ? AND used_at IS NULL",
+		time.Now(), userID, purpose,
+	)
+	return err
+}
+
+// DeleteExpiredAccountTokens 清理过期的账号令牌，保留最近一天的记录用于限流
+func DeleteExpiredAccountTokens(db *Database) (int64, error) {
+	now := time.Now()
+	result, err := db.Exec(
+		"DELETE FROM account_tokens WHERE expires_at < ? AND created_at < ?",
+		now, now.Add(-24*time.Hour),
+	)
+	if err != nil {
+		return 0, err
+	}
+	
+	return result.RowsAffected()
+}
@@ -0,0 +1,349 @@
+package models
+
+import (
+	"SwiftPost/utils"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+	
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 个人访问令牌的权限范围
+const (
+	ScopeMailRead  = "mail:read"
+	ScopeMailWrite = "mail:write" // 标记已读、星标、移动和删除邮件
+	ScopeMailSend  = "mail:send"
+	ScopeAdmin     = "admin"
+)
+
+// ValidScopes 可授予个人访问令牌的全部权限范围
+var ValidScopes = []string{ScopeMailRead, ScopeMailWrite, ScopeMailSend, ScopeAdmin}
+
+// ErrInvalidCredentials 协议登录的邮箱或密码错误
+var ErrInvalidCredentials = errors.New("邮箱或密码错误")
+
+type PersonalAccessToken struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"user_id"`
+	Name       string     `json:"name"`
+	TokenHash  string     `json:"-"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP string     `json:"last_used_ip,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// HasScope 令牌是否包含指定的权限范围
+func (t *PersonalAccessToken) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type AppPassword struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"user_id"`
+	Name       string     `json:"name"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP string     `json:"last_used_ip,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func scanPersonalAccessToken(scanner interface{ Scan(...interface{}) error }) (*PersonalAccessToken, error) {
+	var token PersonalAccessToken
+	var scopes string
+	var expiresAt, lastUsedAt sql.NullTime
+	
+	err := scanner.Scan(
+		&token.ID, &token.UserID, &token.Name, &token.TokenHash, &token.Prefix, &scopes,
+		&expiresAt, &lastUsedAt, &token.LastUsedIP, &token.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	
+	token.Scopes = strings.Fields(scopes)
+	if expiresAt.Valid {
+		token.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		token.LastUsedAt = &lastUsedAt.Time
+	}
+	
+	return &token, nil
+}
+
+const personalAccessTokenColumns = `
+	id, user_id, name, token_hash, prefix, scopes, expires_at, last_used_at, COALESCE(last_used_ip, ''), created_at
+`
+
+// CreatePersonalAccessToken 保存新的个人访问令牌，只保存令牌的摘要
+func CreatePersonalAccessToken(db *Database, token *PersonalAccessToken) (int64, error) {
+	query := `
+	INSERT INTO personal_access_tokens (user_id, name, token_hash, prefix, scopes, expires_at, created_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+	
+	var expiresAt interface{}
+	if token.ExpiresAt != nil {
+		expiresAt = *token.ExpiresAt
+	}
+	
+	return insertReturningID(db, query,
+		token.UserID, token.Name, token.TokenHash, token.Prefix, strings.Join(token.Scopes, " "), expiresAt, time.Now(),
+	)
+}
+
+// GetPersonalAccessTokensByUser 获取用户的全部个人访问令牌
+func GetPersonalAccessTokensByUser(db *Database, userID int) ([]*PersonalAccessToken, error) {
+	query := `SELECT ` + personalAccessTokenColumns + ` FROM personal_access_tokens WHERE user_id = ? ORDER BY id DESC`
+	
+	rows, err := db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	
+	var tokens []*PersonalAccessToken
+	for rows.Next() {
+		token, err := scanPersonalAccessToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	
+	return tokens, rows.Err()
+}
+
+// ValidatePersonalAccessToken 根据摘要查找有效的令牌，令牌过期或用户被禁用时返回 sql.ErrNoRows
+func ValidatePersonalAccessToken(db *Database, tokenHash string) (*PersonalAccessToken, *User, error) {
+	token, err := scanPersonalAccessToken(db.QueryRow(
+		`SELECT `+personalAccessTokenColumns+` FROM personal_access_tokens WHERE token_hash = ?`, tokenHash,
+	))
+	if err != nil {
+		return nil, nil, err
+	}
+	
+	if token.ExpiresAt != nil && token.ExpiresAt.Before(time.Now()) {
+		return nil, nil, sql.ErrNoRows
+	}
+	
+	user, err := db.Users().GetByID(token.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !user.IsActive {
+		return nil, nil, sql.ErrNoRows
+	}
+	
+	return token, user, nil
+}
+
+// TouchPersonalAccessToken 记录令牌最后使用的时间和IP，一分钟内最多写一次
+func TouchPersonalAccessToken(db *Database, id int, ip string) error {
+	now := time.Now()
+	query := `
+	UPDATE personal_access_tokens SET last_used_at = ?, last_used_ip = ?
+	WHERE id = ? AND (last_used_at IS NULL OR last_used_at < ?)
+	`
+	
+	_, err := db.Exec(query, now, ip, id, now.Add(-time.Minute))
+	return err
+}
+
+// DeletePersonalAccessToken 撤销令牌，令牌不存在或不属于该用户时返回 sql.ErrNoRows
+func DeletePersonalAccessToken(db *Database, userID, id int) error {
+	result, err := db.Exec("DELETE FROM personal_access_tokens WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return err
+	}
+	
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	
+	return nil
+}
+
+// CreateAppPassword 保存新的应用专用密码，只保存密码的摘要
+func CreateAppPassword(db *Database, userID int, name, passwordHash string) (int64, error) {
+	query := `INSERT INTO app_passwords (user_id, name, password_hash, created_at) VALUES (?, ?, ?, ?)`
+	
+	return insertReturningID(db, query, userID, name, passwordHash, time.Now())
+}
+
+// GetAppPasswordsByUser 获取用户的全部应用专用密码
+func GetAppPasswordsByUser(db *Database, userID int) ([]*AppPassword, error) {
+	query := `
+	SELECT id, user_id, name, last_used_at, COALESCE(last_used_ip, ''), created_at
+	FROM app_passwords WHERE user_id = ? ORDER BY id DESC
+	`
+	
+	rows, err := db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	
+	var passwords []*AppPassword
+	for rows.Next() {
+		var p AppPassword
+		var lastUsedAt sql.NullTime
+		if err := rows.Scan(&p.ID, &p.UserID, &p.Name, &lastUsedAt, &p.LastUsedIP, &p.CreatedAt); err != nil {
+			return nil, err
+		}
+		if lastUsedAt.Valid {
+			p.LastUsedAt = &lastUsedAt.Time
+		}
+		passwords = append(passwords, &p)
+	}
+	
+	return passwords, rows.Err()
+}
+
+// DeleteAppPassword 撤销应用专用密码，密码不存在或不属于该用户时返回 sql.ErrNoRows
+func DeleteAppPassword(db *Database, userID, id int) error {
+	result, err := db.Exec("DELETE FROM app_passwords WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return err
+	}
+	
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	
+	return nil
+}
+
+// useAppPassword 匹配应用专用密码并记录使用情况
+func useAppPassword(db *Database, userID int, passwordHash, ip string) (bool, error) {
+	var id int
+	err := db.QueryRow(
+		"SELECT id FROM app_passwords WHERE user_id = ? AND password_hash = ?", userID, passwordHash,
+	).Scan(&id)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	
+	_, err = db.Exec("UPDATE app_passwords SET last_used_at = ?, last_used_ip = ? WHERE id = ?", time.Now(), ip, id)
+	return true, err
+}
+
+// AuthenticateProtocolLogin 验证邮件客户端等协议登录（用户名+密码）
+// 应用专用密码始终可用；已启用两步验证、关联了LDAP目录或 allowPassword 为 false（禁用本地密码）时不能使用主密码
+func AuthenticateProtocolLogin(db *Database, config *utils.Config, email, password, ip string, allowPassword bool) (*User, error) {
+	// 与网页登录共用账号和IP的失败计数和锁定状态
+	if err := CheckLoginAllowed(db, config, email, ip); err != nil {
+		return nil, err
+	}
+	
+	user, err := authenticateProtocolCredentials(db, config, email, password, ip, allowPassword)
+	switch err {
+	case nil:
+		if err := ResetLoginFailures(db, email); err != nil {
+			dbLog.Error("清除登录失败记录失败: %v", err)
+		}
+	case ErrInvalidCredentials:
+		if err := RecordLoginFailure(db, config, email, ip); err != nil {
+			dbLog.Error("记录登录失败次数失败: %v", err)
+		}
+	}
+	
+	return user, err
+}
+
+// authenticateProtocolCredentials 校验协议登录的凭据，失败计数由调用方处理
+func authenticateProtocolCredentials(db *Database, config *utils.Config, email, password, ip string, allowPassword bool) (*User, error) {
+	user, err := db.Users().GetByEmail(email)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !user.IsActive || !user.EmailVerified {
+		return nil, ErrInvalidCredentials
+	}
+	
+	ok, err := useAppPassword(db, user.ID, utils.HashAppPassword(password), ip)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return user, nil
+	}
+	if !allowPassword {
+		return nil, ErrInvalidCredentials
+	}
+	
+	hasSecondFactor, err := HasSecondFactor(db, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if hasSecondFactor {
+		return nil, ErrInvalidCredentials
+	}
+	
+	// 目录用户的密码由LDAP管理，本地保存的密码可能早已过期
+	if config.LDAP.Enabled {
+		linked, err := HasUserIdentity(db, user.ID, LDAPIssuer(config))
+		if err != nil {
+			return nil, err
+		}
+		if linked {
+			return nil, ErrInvalidCredentials
+		}
+	}
+	
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+		return nil, ErrInvalidCredentials
+	}
+	
+	return user, nil
+}
+
+// DeleteUserAPICredentials 删除用户的全部个人访问令牌和应用专用密码，返回各自删除的数量
+func DeleteUserAPICredentials(db *Database, userID int) (tokens, appPasswords int64, err error) {
+	return deleteAPICredentials(db, " WHERE user_id = ?", userID)
+}
+
+// DeleteAllAPICredentials 删除所有用户的个人访问令牌和应用专用密码，用于安全事件响应
+func DeleteAllAPICredentials(db *Database) (tokens, appPasswords int64, err error) {
+	return deleteAPICredentials(db, "")
+}
+
+func deleteAPICredentials(db *Database, where string, args ...interface{}) (tokens, appPasswords int64, err error) {
+	result, err := db.Exec("DELETE FROM personal_access_tokens"+where, args...)
+	if err != nil {
+		return 0, 0, err
+	}
+	if tokens, err = result.RowsAffected(); err != nil {
+		return 0, 0, err
+	}
+	
+	result, err = db.Exec("DELETE FROM app_passwords"+where, args...)
+	if err != nil {
+		return tokens, 0, err
+	}
+	appPasswords, err = result.RowsAffected()
+	return tokens, appPasswords, err
+}
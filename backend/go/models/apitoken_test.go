@@ -0,0 +1,48 @@
+package models
+
+import (
+	"SwiftPost/utils"
+	"testing"
+	
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestProtocolLoginRejectsLDAPUserPassword(t *testing.T) {
+	config := newTestConfig(t)
+	config.LoginProtection.Enabled = false
+	config.LDAP.Enabled = true
+	config.LDAP.BaseDN = "dc=example,dc=com"
+	db := newTestDB(t, config)
+	
+	hash, err := bcrypt.GenerateFromPassword([]byte("local-password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := map[string]int{}
+	for _, name := range []string{"alice", "bob"} {
+		id, err := db.Users().Create(name, name+"@example.com", string(hash))
+		if err != nil {
+			t.Fatal(err)
+		}
+		users[name] = int(id)
+	}
+	if _, err := CreateUserIdentity(db, users["alice"], LDAPIssuer(config), "uuid-alice", "alice@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CreateAppPassword(db, users["alice"], "thunderbird", utils.HashAppPassword("alice-app-password")); err != nil {
+		t.Fatal(err)
+	}
+	
+	// 目录用户的本地密码不能用于协议登录
+	if _, err := AuthenticateProtocolLogin(db, config, "alice@example.com", "local-password", "127.0.0.1", true); err != ErrInvalidCredentials {
+		t.Fatalf("目录用户使用本地密码应被拒绝，实际为 %v", err)
+	}
+	// 应用专用密码仍然可用
+	if user, err := AuthenticateProtocolLogin(db, config, "alice@example.com", "alice-app-password", "127.0.0.1", true); err != nil || user.ID != users["alice"] {
+		t.Fatalf("目录用户应能使用应用专用密码登录: %v", err)
+	}
+	// 未关联目录的本地用户不受影响
+	if user, err := AuthenticateProtocolLogin(db, config, "bob@example.com", "local-password", "127.0.0.1", true); err != nil || user.ID != users["bob"] {
+		t.Fatalf("本地用户应能使用密码登录: %v", err)
+	}
+}
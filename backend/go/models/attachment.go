@@ -1,7 +1,6 @@
 package models
 
 import (
-	"database/sql"
 	"time"
 )
 
@@ -16,73 +15,59 @@ type Attachment struct {
 	CreatedAt time.Time `json:"created_at"`
 }
 
-func CreateAttachment(db *Database, attachment *Attachment) (int64, error) {
-	query := `
-	INSERT INTO attachments (email_id, uuid, filename, filepath, file_size, mime_type, created_at)
-	VALUES (?, ?, ?, ?, ?, ?, ?)
-	`
-	
-	result, err := db.Exec(query,
-		attachment.EmailID, attachment.UUID, attachment.Filename,
-		attachment.Filepath, attachment.FileSize, attachment.MimeType,
-		time.Now(),
-	)
-	
-	if err != nil {
-		return 0, err
-	}
-	
-	return result.LastInsertId()
-}
+const attachmentColumns = `a.id, a.email_id, a.uuid, a.filename, a.filepath, a.file_size, a.mime_type, a.created_at`
 
-func GetAttachmentByID(db *Database, id int) (*Attachment, error) {
+func scanAttachment(row interface{ Scan(...interface{}) error }, extra ...interface{}) (*Attachment, error) {
 	var attachment Attachment
-	query := `
-	SELECT id, email_id, uuid, filename, filepath, file_size, mime_type, created_at
-	FROM attachments WHERE id = ?
-	`
-	
-	err := db.QueryRow(query, id).Scan(
+	dest := []interface{}{
 		&attachment.ID, &attachment.EmailID, &attachment.UUID,
 		&attachment.Filename, &attachment.Filepath, &attachment.FileSize,
 		&attachment.MimeType, &attachment.CreatedAt,
-	)
+	}
 	
-	if err != nil {
+	if err := row.Scan(append(dest, extra...)...); err != nil {
 		return nil, err
 	}
 	
 	return &attachment, nil
 }
 
-func GetAttachmentByUUID(db *Database, uuid string) (*Attachment, error) {
-	var attachment Attachment
+// sqlAttachmentRepository AttachmentRepository 的SQL实现
+type sqlAttachmentRepository struct {
+	db *Database
+}
+
+func (r *sqlAttachmentRepository) Create(attachment *Attachment) (int64, error) {
 	query := `
-	SELECT id, email_id, uuid, filename, filepath, file_size, mime_type, created_at
-	FROM attachments WHERE uuid = ?
+	INSERT INTO attachments (email_id, uuid, filename, filepath, file_size, mime_type, created_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
 	`
 	
-	err := db.QueryRow(query, uuid).Scan(
-		&attachment.ID, &attachment.EmailID, &attachment.UUID,
-		&attachment.Filename, &attachment.Filepath, &attachment.FileSize,
-		&attachment.MimeType, &attachment.CreatedAt,
+	return insertReturningID(r.db, query,
+		attachment.EmailID, attachment.UUID, attachment.Filename,
+		attachment.Filepath, attachment.FileSize, attachment.MimeType,
+		time.Now(),
 	)
-	
-	if err != nil {
-		return nil, err
-	}
-	
-	return &attachment, nil
 }
 
-func GetAttachmentsByEmail(db *Database, emailID int) ([]*Attachment, error) {
+func (r *sqlAttachmentRepository) GetByID(id int) (*Attachment, error) {
+	query := `SELECT ` + attachmentColumns + ` FROM attachments a WHERE a.id = ?`
+	return scanAttachment(r.db.QueryRow(query, id))
+}
+
+func (r *sqlAttachmentRepository) GetByUUID(uuid string) (*Attachment, error) {
+	query := `SELECT ` + attachmentColumns + ` FROM attachments a WHERE a.uuid = ?`
+	return scanAttachment(r.db.QueryRow(query, uuid))
+}
+
+func (r *sqlAttachmentRepository) ListByEmail(emailID int) ([]*Attachment, error) {
 	query := `
-	SELECT id, email_id, uuid, filename, filepath, file_size, mime_type, created_at
-	FROM attachments WHERE email_id = ?
-	ORDER BY created_at DESC
+	SELECT ` + attachmentColumns + `
+	FROM attachments a WHERE a.email_id = ?
+	ORDER BY a.created_at DESC
 	`
 	
-	rows, err := db.Query(query, emailID)
+	rows, err := r.db.queryStmt(query, emailID)
 	if err != nil {
 		return nil, err
 	}
@@ -90,28 +75,23 @@ func GetAttachmentsByEmail(db *Database, emailID int) ([]*Attachment, error) {
 	
 	var attachments []*Attachment
 	for rows.Next() {
-		var attachment Attachment
-		err := rows.Scan(
-			&attachment.ID, &attachment.EmailID, &attachment.UUID,
-			&attachment.Filename, &attachment.Filepath, &attachment.FileSize,
-			&attachment.MimeType, &attachment.CreatedAt,
-		)
+		attachment, err := scanAttachment(rows)
 		if err != nil {
 			return nil, err
 		}
-		attachments = append(attachments, &attachment)
+		attachments = append(attachments, attachment)
 	}
 	
-	return attachments, nil
+	return attachments, rows.Err()
 }
 
-func DeleteAttachment(db *Database, id int) error {
+func (r *sqlAttachmentRepository) Delete(id int) error {
 	query := `DELETE FROM attachments WHERE id = ?`
-	_, err := db.Exec(query, id)
+	_, err := r.db.Exec(query, id)
 	return err
 }
 
-func CountAttachmentsByUser(db *Database, userID int) (int, error) {
+func (r *sqlAttachmentRepository) CountByUser(userID int) (int, error) {
 	query := `
 	SELECT COUNT(*) FROM attachments a
 	JOIN emails e ON a.email_id = e.id
@@ -119,11 +99,11 @@ func CountAttachmentsByUser(db *Database, userID int) (int, error) {
 	`
 	
 	var count int
-	err := db.QueryRow(query, userID, userID).Scan(&count)
+	err := r.db.QueryRow(query, userID, userID).Scan(&count)
 	return count, err
 }
 
-func GetTotalAttachmentSizeByUser(db *Database, userID int) (int64, error) {
+func (r *sqlAttachmentRepository) TotalSizeByUser(userID int) (int64, error) {
 	query := `
 	SELECT COALESCE(SUM(a.file_size), 0) FROM attachments a
 	JOIN emails e ON a.email_id = e.id
@@ -131,6 +111,69 @@ func GetTotalAttachmentSizeByUser(db *Database, userID int) (int64, error) {
 	`
 	
 	var totalSize int64
-	err := db.QueryRow(query, userID, userID).Scan(&totalSize)
+	err := r.db.QueryRow(query, userID, userID).Scan(&totalSize)
 	return totalSize, err
-}
\ No newline at end of file
+}
+
+func (r *sqlAttachmentRepository) Totals() (count int, size int64, err error) {
+	err = r.db.QueryRow("SELECT COUNT(*), COALESCE(SUM(file_size), 0) FROM attachments").Scan(&count, &size)
+	return count, size, err
+}
+
+func (r *sqlAttachmentRepository) ListRecentBySender(userID, limit int) ([]*SentAttachment, error) {
+	query := `
+	SELECT ` + attachmentColumns + `, e.subject
+	FROM attachments a
+	JOIN emails e ON a.email_id = e.id
+	WHERE e.sender_id = ?
+	ORDER BY a.created_at DESC
+	LIMIT ?
+	`
+	
+	rows, err := r.db.Query(query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	
+	var attachments []*SentAttachment
+	for rows.Next() {
+		var subject string
+		attachment, err := scanAttachment(rows, &subject)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, &SentAttachment{Attachment: *attachment, EmailSubject: subject})
+	}
+	
+	return attachments, rows.Err()
+}
+
+func (r *sqlAttachmentRepository) DailySizeByUser(userID int, since time.Time) ([]*DailySize, error) {
+	day := r.db.dialect.dateOf("a.created_at")
+	query := `
+	SELECT ` + day + ` AS day, COALESCE(SUM(a.file_size), 0)
+	FROM attachments a
+	JOIN emails e ON a.email_id = e.id
+	WHERE (e.sender_id = ? OR e.recipient_id = ?) AND a.created_at >= ?
+	GROUP BY ` + day + `
+	ORDER BY day
+	`
+	
+	rows, err := r.db.Query(query, userID, userID, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	
+	var sizes []*DailySize
+	for rows.Next() {
+		size := &DailySize{}
+		if err := rows.Scan(&size.Date, &size.Size); err != nil {
+			return nil, err
+		}
+		sizes = append(sizes, size)
+	}
+	
+	return sizes, rows.Err()
+}
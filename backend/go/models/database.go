@@ -3,155 +3,248 @@ package models
 import (
 	"database/sql"
 	"fmt"
-	"os"
-	"path/filepath"
-
-	_ "github.com/mattn/go-sqlite3"
+	"sync"
 	"SwiftPost/utils"
 )
 
+// dbLog 数据库连接、迁移和维护任务的日志
+var dbLog = utils.NewLogger("db")
+
+// 支持的数据库驱动
+const (
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+)
+
+// Database 数据库连接，查询中统一使用 ? 占位符，执行前按方言转换。
+// 内嵌的 DB 是写连接池，Exec、Begin 和 INSERT ... RETURNING 都走写连接；
+// Query 和 QueryRow 走 reader，SQLite 下是独立的只读连接池，PostgreSQL 下和 DB 是同一个
 type Database struct {
 	*sql.DB
+	reader  *sql.DB
+	dialect dialect
+	
+	// 预编译语句缓存，键为 preparedKey
+	stmts sync.Map
+	
+	users       UserRepository
+	emails      EmailRepository
+	attachments AttachmentRepository
+	sessions    SessionRepository
+}
+
+// Tx 数据库事务，和 Database 一样会转换占位符
+type Tx struct {
+	*sql.Tx
+	dialect dialect
 }
 
 var dbInstance *Database
 
-func InitDatabase(path string) (*Database, error) {
-	// 确保目录存在
-	dir := filepath.Dir(path)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return nil, fmt.Errorf("无法创建数据库目录: %v", err)
+// DatabaseDriver 配置的数据库驱动，未配置时使用 SQLite
+func DatabaseDriver(config *utils.Config) string {
+	if config.Database.Driver == "" {
+		return DriverSQLite
+	}
+	return config.Database.Driver
+}
+
+// OpenDatabase 按配置的驱动打开数据库连接，不执行迁移
+func OpenDatabase(config *utils.Config) (*Database, error) {
+	var writer, reader *sql.DB
+	var d dialect
+	var err error
+	switch driver := DatabaseDriver(config); driver {
+	case DriverSQLite:
+		writer, reader, err = openSQLite(config.Database.Path)
+		d = sqliteDialect{}
+	case DriverPostgres:
+		writer, err = openPostgres(config.Database.DSN)
+		reader = writer
+		d = postgresDialect{}
+	default:
+		return nil, fmt.Errorf("不支持的数据库驱动: %s", driver)
 	}
-	
-	// 打开数据库连接
-	sqlDB, err := sql.Open("sqlite3", path)
 	if err != nil {
-		return nil, fmt.Errorf("无法打开数据库: %v", err)
+		return nil, err
 	}
 	
-	// 测试连接
-	if err := sqlDB.Ping(); err != nil {
-		return nil, fmt.Errorf("数据库连接失败: %v", err)
+	return newDatabase(writer, reader, d), nil
+}
+
+func newDatabase(writer, reader *sql.DB, d dialect) *Database {
+	db := &Database{DB: writer, reader: reader, dialect: d}
+	db.users = &sqlUserRepository{db: db}
+	db.emails = &sqlEmailRepository{db: db}
+	db.attachments = &sqlAttachmentRepository{db: db}
+	db.sessions = &sqlSessionRepository{db: db}
+	return db
+}
+
+// InitDatabase 打开数据库并应用未执行的迁移，数据库结构比程序新时拒绝启动
+func InitDatabase(config *utils.Config) (*Database, error) {
+	db, err := OpenDatabase(config)
+	if err != nil {
+		return nil, err
 	}
 	
-	// 设置连接池
-	sqlDB.SetMaxOpenConns(25)
-	sqlDB.SetMaxIdleConns(5)
-	sqlDB.SetConnMaxLifetime(1800) // 30分钟
-	
-	// 创建数据库实例
-	dbInstance = &Database{sqlDB}
+	if err := MigrateUp(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("数据库迁移失败: %v", err)
+	}
 	
-	// 初始化表
-	if err := initTables(dbInstance); err != nil {
-		return nil, fmt.Errorf("初始化表失败: %v", err)
+	if err := seedBuiltinRoles(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("写入内置角色失败: %v", err)
 	}
 	
+	dbInstance = db
 	utils.PrintSuccess("数据库初始化完成")
 	return dbInstance, nil
 }
 
-func initTables(db *Database) error {
-	// 创建用户表
-	_, err := db.Exec(`
-	CREATE TABLE IF NOT EXISTS users (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		username TEXT UNIQUE NOT NULL,
-		email TEXT UNIQUE NOT NULL,
-		password_hash TEXT NOT NULL,
-		is_admin BOOLEAN DEFAULT 0,
-		custom_domain TEXT,
-		storage_used INTEGER DEFAULT 0,
-		max_storage INTEGER DEFAULT 1073741824,
-		is_active BOOLEAN DEFAULT 1,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-	)
-	`)
-	if err != nil {
-		return fmt.Errorf("创建用户表失败: %v", err)
+// Driver 当前连接使用的数据库驱动
+func (db *Database) Driver() string {
+	return db.dialect.name()
+}
+
+// Users 用户数据
+func (db *Database) Users() UserRepository {
+	return db.users
+}
+
+// Emails 邮件数据
+func (db *Database) Emails() EmailRepository {
+	return db.emails
+}
+
+// Attachments 附件数据
+func (db *Database) Attachments() AttachmentRepository {
+	return db.attachments
+}
+
+// Sessions 登录会话数据
+func (db *Database) Sessions() SessionRepository {
+	return db.sessions
+}
+
+func (db *Database) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return db.DB.Exec(db.dialect.rebind(query), args...)
+}
+
+func (db *Database) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return db.reader.Query(db.dialect.rebind(query), args...)
+}
+
+func (db *Database) QueryRow(query string, args ...interface{}) *sql.Row {
+	return db.reader.QueryRow(db.dialect.rebind(query), args...)
+}
+
+// Close 关闭预编译语句和读写连接池
+func (db *Database) Close() error {
+	db.stmts.Range(func(key, stmt interface{}) bool {
+		stmt.(*sql.Stmt).Close()
+		return true
+	})
+	if db.reader != db.DB {
+		db.reader.Close()
+	}
+	return db.DB.Close()
+}
+
+// preparedKey 预编译语句缓存的键，同一条SQL在读、写连接池上分别预编译
+type preparedKey struct {
+	pool  *sql.DB
+	query string
+}
+
+// prepare 返回缓存的预编译语句，第一次使用时编译
+func (db *Database) prepare(pool *sql.DB, query string) (*sql.Stmt, error) {
+	key := preparedKey{pool: pool, query: query}
+	if stmt, ok := db.stmts.Load(key); ok {
+		return stmt.(*sql.Stmt), nil
 	}
 	
-	// 创建邮件表
-	_, err = db.Exec(`
-	CREATE TABLE IF NOT EXISTS emails (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		uuid TEXT UNIQUE NOT NULL,
-		sender_id INTEGER NOT NULL,
-		recipient_id INTEGER NOT NULL,
-		sender_email TEXT NOT NULL,
-		recipient_email TEXT NOT NULL,
-		subject TEXT NOT NULL,
-		body TEXT NOT NULL,
-		is_read BOOLEAN DEFAULT 0,
-		is_starred BOOLEAN DEFAULT 0,
-		is_deleted BOOLEAN DEFAULT 0,
-		is_draft BOOLEAN DEFAULT 0,
-		has_attachment BOOLEAN DEFAULT 0,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY (sender_id) REFERENCES users (id),
-		FOREIGN KEY (recipient_id) REFERENCES users (id)
-	)
-	`)
+	stmt, err := pool.Prepare(db.dialect.rebind(query))
 	if err != nil {
-		return fmt.Errorf("创建邮件表失败: %v", err)
+		return nil, err
 	}
-	
-	// 创建附件表
-	_, err = db.Exec(`
-	CREATE TABLE IF NOT EXISTS attachments (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		email_id INTEGER NOT NULL,
-		uuid TEXT UNIQUE NOT NULL,
-		filename TEXT NOT NULL,
-		filepath TEXT NOT NULL,
-		file_size INTEGER,
-		mime_type TEXT,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY (email_id) REFERENCES emails (id)
-	)
-	`)
+	if actual, loaded := db.stmts.LoadOrStore(key, stmt); loaded {
+		// 并发请求已经编译过这条语句
+		stmt.Close()
+		return actual.(*sql.Stmt), nil
+	}
+	return stmt, nil
+}
+
+// queryStmt 和 Query 相同，但使用预编译语句，用于请求路径上的热点查询
+func (db *Database) queryStmt(query string, args ...interface{}) (*sql.Rows, error) {
+	stmt, err := db.prepare(db.reader, query)
 	if err != nil {
-		return fmt.Errorf("创建附件表失败: %v", err)
+		return nil, err
 	}
-	
-	// 创建会话表
-	_, err = db.Exec(`
-	CREATE TABLE IF NOT EXISTS sessions (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		user_id INTEGER NOT NULL,
-		session_token TEXT UNIQUE NOT NULL,
-		ip_address TEXT,
-		user_agent TEXT,
-		expires_at TIMESTAMP NOT NULL,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY (user_id) REFERENCES users (id)
-	)
-	`)
+	return stmt.Query(args...)
+}
+
+// queryRowStmt 和 QueryRow 相同，但使用预编译语句，编译失败时退回普通查询以便由 Scan 返回错误
+func (db *Database) queryRowStmt(query string, args ...interface{}) *sql.Row {
+	stmt, err := db.prepare(db.reader, query)
 	if err != nil {
-		return fmt.Errorf("创建会话表失败: %v", err)
+		return db.QueryRow(query, args...)
 	}
-	
-	// 创建索引
-	indexes := []string{
-		`CREATE INDEX IF NOT EXISTS idx_emails_recipient ON emails(recipient_id, created_at DESC)`,
-		`CREATE INDEX IF NOT EXISTS idx_emails_sender ON emails(sender_id, created_at DESC)`,
-		`CREATE INDEX IF NOT EXISTS idx_users_email ON users(email)`,
-		`CREATE INDEX IF NOT EXISTS idx_users_username ON users(username)`,
-		`CREATE INDEX IF NOT EXISTS idx_emails_uuid ON emails(uuid)`,
-		`CREATE INDEX IF NOT EXISTS idx_sessions_token ON sessions(session_token)`,
-		`CREATE INDEX IF NOT EXISTS idx_attachments_email ON attachments(email_id)`,
+	return stmt.QueryRow(args...)
+}
+
+// execStmt 和 Exec 相同，但使用写连接池上的预编译语句
+func (db *Database) execStmt(query string, args ...interface{}) (sql.Result, error) {
+	stmt, err := db.prepare(db.DB, query)
+	if err != nil {
+		return nil, err
 	}
-	
-	for _, index := range indexes {
-		if _, err := db.Exec(index); err != nil {
-			return fmt.Errorf("创建索引失败: %v", err)
-		}
+	return stmt.Exec(args...)
+}
+
+// writeRow 在写连接上执行返回结果行的语句，例如 INSERT ... RETURNING 和 PRAGMA wal_checkpoint
+func (db *Database) writeRow(query string, args ...interface{}) *sql.Row {
+	stmt, err := db.prepare(db.DB, query)
+	if err != nil {
+		return db.DB.QueryRow(db.dialect.rebind(query), args...)
 	}
-	
-	utils.PrintSuccess("数据库表创建完成")
-	return nil
+	return stmt.QueryRow(args...)
+}
+
+func (db *Database) Begin() (*Tx, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{Tx: tx, dialect: db.dialect}, nil
+}
+
+func (tx *Tx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return tx.Tx.Exec(tx.dialect.rebind(query), args...)
+}
+
+func (tx *Tx) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return tx.Tx.Query(tx.dialect.rebind(query), args...)
+}
+
+func (tx *Tx) QueryRow(query string, args ...interface{}) *sql.Row {
+	return tx.Tx.QueryRow(tx.dialect.rebind(query), args...)
+}
+
+// writeRow 事务本身就在写连接上
+func (tx *Tx) writeRow(query string, args ...interface{}) *sql.Row {
+	return tx.QueryRow(query, args...)
+}
+
+// insertReturningID 执行 INSERT 并返回新记录的ID，PostgreSQL 驱动不支持 LastInsertId，统一使用 RETURNING
+func insertReturningID(q interface {
+	writeRow(query string, args ...interface{}) *sql.Row
+}, query string, args ...interface{}) (int64, error) {
+	var id int64
+	err := q.writeRow(query+" RETURNING id", args...).Scan(&id)
+	return id, err
 }
 
 func GetDB() *Database {
@@ -162,28 +255,28 @@ func SetFirstUserAsAdmin(db *Database) {
 	var count int
 	err := db.QueryRow("SELECT COUNT(*) FROM users").Scan(&count)
 	if err != nil {
-		utils.Error("查询用户数量失败: %v", err)
+		dbLog.Error("查询用户数量失败: %v", err)
 		return
 	}
 	
 	if count == 0 {
-		utils.Info("数据库中没有用户，跳过管理员设置")
+		dbLog.Info("数据库中没有用户，跳过管理员设置")
 		return
 	}
 	
 	// 检查是否已有管理员
 	var adminCount int
-	err = db.QueryRow("SELECT COUNT(*) FROM users WHERE is_admin = 1").Scan(&adminCount)
+	err = db.QueryRow("SELECT COUNT(*) FROM users WHERE is_admin = TRUE").Scan(&adminCount)
 	if err != nil {
-		utils.Error("查询管理员数量失败: %v", err)
+		dbLog.Error("查询管理员数量失败: %v", err)
 		return
 	}
 	
 	if adminCount == 0 {
 		// 设置第一个用户为管理员
-		_, err = db.Exec("UPDATE users SET is_admin = 1 WHERE id = (SELECT MIN(id) FROM users)")
+		_, err = db.Exec("UPDATE users SET is_admin = TRUE WHERE id = (SELECT MIN(id) FROM users)")
 		if err != nil {
-			utils.Error("设置管理员失败: %v", err)
+			dbLog.Error("设置管理员失败: %v", err)
 			return
 		}
 		utils.PrintSuccess("已将第一个用户设置为管理员")
@@ -0,0 +1,106 @@
+package models
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// benchListSeed BenchmarkList 预先写入收件箱的邮件数量
+const benchListSeed = 1000
+
+// newBenchDB 通过 OpenDatabase 打开 WAL 模式、单写连接加只读连接池的 SQLite 数据库，并创建收发双方
+func newBenchDB(b *testing.B) (db *Database, sender, recipient *User) {
+	b.Helper()
+	db = newTestDB(b, newTestConfig(b))
+	
+	users := make([]*User, 2)
+	for i, name := range []string{"sender", "recipient"} {
+		id, err := db.Users().Create(name, name+"@example.com", "hash")
+		if err != nil {
+			b.Fatal(err)
+		}
+		if users[i], err = db.Users().GetByID(int(id)); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return db, users[0], users[1]
+}
+
+func benchSend(db *Database, sender, recipient *User, n int) error {
+	_, err := db.Emails().Create(&Email{
+		SenderID: sender.ID, RecipientID: recipient.ID,
+		SenderEmail: sender.Email, RecipientEmail: recipient.Email,
+		Subject: "bench " + strconv.Itoa(n),
+		Body:    "<p>benchmark message body with a little <b>markup</b> in it</p>",
+	})
+	return err
+}
+
+// BenchmarkSend 多个 goroutine 同时写入邮件，写操作都经过单个写连接排队
+func BenchmarkSend(b *testing.B) {
+	db, sender, recipient := newBenchDB(b)
+	
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		n := 0
+		for pb.Next() {
+			n++
+			if err := benchSend(db, sender, recipient, n); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+// BenchmarkList 并发读取收件箱第一页，while-sending 同时有一个 goroutine 持续写入
+func BenchmarkList(b *testing.B) {
+	for _, writing := range []bool{false, true} {
+		name := "idle"
+		if writing {
+			name = "while-sending"
+		}
+		b.Run(name, func(b *testing.B) {
+			db, sender, recipient := newBenchDB(b)
+			for i := 0; i < benchListSeed; i++ {
+				if err := benchSend(db, sender, recipient, i); err != nil {
+					b.Fatal(err)
+				}
+			}
+			
+			stop := make(chan struct{})
+			var wg sync.WaitGroup
+			if writing {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for n := 0; ; n++ {
+						select {
+						case <-stop:
+							return
+						default:
+						}
+						if err := benchSend(db, sender, recipient, n); err != nil {
+							b.Error(err)
+							return
+						}
+					}
+				}()
+			}
+			
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if _, _, err := db.Emails().ListByFolder(recipient.ID, "inbox", Page{Limit: 50}); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+			b.StopTimer()
+			close(stop)
+			wg.Wait()
+		})
+	}
+}
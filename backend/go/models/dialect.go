@@ -0,0 +1,29 @@
+package models
+
+// dialect 屏蔽 SQLite 和 PostgreSQL 之间的SQL差异，通用的查询直接写在各个 repository 中，
+// 只有占位符、日期函数和数据库管理相关的语句需要由方言提供
+type dialect interface {
+	// name 驱动名称，也是迁移脚本所在的目录名
+	name() string
+	
+	// rebind 把查询中的 ? 占位符转换成驱动要求的格式
+	rebind(query string) string
+	
+	// dateOf 把时间列格式化成 YYYY-MM-DD 文本的表达式
+	dateOf(column string) string
+	
+	// hourOf 取时间列小时数（0-23）的表达式，结果为整数
+	hourOf(column string) string
+	
+	// emailDomain 取邮箱地址 @ 之后部分的表达式
+	emailDomain(column string) string
+	
+	// tableExists 表是否已经存在
+	tableExists(db *Database, table string) (bool, error)
+	
+	// migrationsTable 创建迁移记录表的SQL
+	migrationsTable() string
+	
+	// databaseStats 数据库占用的空间
+	databaseStats(db *Database) (*DatabaseStats, error)
+}
@@ -0,0 +1,105 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	
+	_ "github.com/lib/pq"
+)
+
+type postgresDialect struct{}
+
+// openPostgres 按连接串连接 PostgreSQL，例如 postgres://swiftpost:密码@localhost/swiftpost?sslmode=disable
+func openPostgres(dsn string) (*sql.DB, error) {
+	if dsn == "" {
+		return nil, fmt.Errorf("使用 PostgreSQL 时必须配置 database.dsn")
+	}
+	
+	sqlDB, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("无法打开数据库: %v", err)
+	}
+	
+	if err := sqlDB.Ping(); err != nil {
+		sqlDB.Close()
+		return nil, fmt.Errorf("数据库连接失败: %v", err)
+	}
+	
+	sqlDB.SetMaxOpenConns(25)
+	sqlDB.SetMaxIdleConns(5)
+	sqlDB.SetConnMaxLifetime(30 * time.Minute)
+	
+	return sqlDB, nil
+}
+
+func (postgresDialect) name() string {
+	return DriverPostgres
+}
+
+// rebind 把 ? 依次替换成 $1、$2…，引号内的问号保持不变
+func (postgresDialect) rebind(query string) string {
+	if !strings.Contains(query, "?") {
+		return query
+	}
+	
+	var sb strings.Builder
+	sb.Grow(len(query) + 16)
+	n := 0
+	var quote rune
+	for _, c := range query {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '?':
+			n++
+			sb.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		sb.WriteRune(c)
+	}
+	return sb.String()
+}
+
+func (postgresDialect) dateOf(column string) string {
+	return "TO_CHAR(" + column + ", 'YYYY-MM-DD')"
+}
+
+func (postgresDialect) hourOf(column string) string {
+	return "CAST(EXTRACT(HOUR FROM " + column + ") AS INTEGER)"
+}
+
+func (postgresDialect) emailDomain(column string) string {
+	return "split_part(" + column + ", '@', 2)"
+}
+
+func (postgresDialect) tableExists(db *Database, table string) (bool, error) {
+	var exists bool
+	err := db.QueryRow("SELECT to_regclass(?) IS NOT NULL", table).Scan(&exists)
+	return exists, err
+}
+
+func (postgresDialect) migrationsTable() string {
+	return `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL
+	)
+	`
+}
+
+// databaseStats PostgreSQL 的空间由服务器管理，这里只报告数据库总大小
+func (postgresDialect) databaseStats(db *Database) (*DatabaseStats, error) {
+	stats := &DatabaseStats{}
+	if err := db.QueryRow("SELECT pg_database_size(current_database())").Scan(&stats.SizeBytes); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
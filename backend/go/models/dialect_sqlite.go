@@ -0,0 +1,165 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+	
+	_ "github.com/mattn/go-sqlite3"
+)
+
+type sqliteDialect struct{}
+
+// SQLite 连接参数：WAL 模式下读写互不阻塞，写锁被占用时最多等待 busy_timeout 毫秒，
+// 写事务用 BEGIN IMMEDIATE 在开始时就获取写锁，避免读事务升级成写事务时死锁
+const (
+	sqliteBusyTimeout = 5000
+	sqliteWriterDSN   = "?_journal_mode=WAL&_synchronous=NORMAL&_busy_timeout=%d&_foreign_keys=on&_txlock=immediate"
+	sqliteReaderDSN   = "?_busy_timeout=%d&_foreign_keys=on&_query_only=true"
+)
+
+// openSQLite 打开 SQLite 数据库文件，目录不存在时自动创建。
+// 返回只有一个连接的写连接池和只读连接池：SQLite 同一时间只允许一个写入者，
+// 多个写连接只会互相等待直到 database is locked，串行的写连接由 database/sql 排队
+func openSQLite(path string) (writer, reader *sql.DB, err error) {
+	// 确保目录存在
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, nil, fmt.Errorf("无法创建数据库目录: %v", err)
+	}
+	
+	// 先打开写连接，由它把数据库切换到 WAL 模式
+	writer, err = sql.Open("sqlite3", path+fmt.Sprintf(sqliteWriterDSN, sqliteBusyTimeout))
+	if err != nil {
+		return nil, nil, fmt.Errorf("无法打开数据库: %v", err)
+	}
+	writer.SetMaxOpenConns(1)
+	writer.SetMaxIdleConns(1)
+	writer.SetConnMaxLifetime(0)
+	
+	// 测试连接
+	if err := writer.Ping(); err != nil {
+		writer.Close()
+		return nil, nil, fmt.Errorf("数据库连接失败: %v", err)
+	}
+	
+	reader, err = sql.Open("sqlite3", path+fmt.Sprintf(sqliteReaderDSN, sqliteBusyTimeout))
+	if err != nil {
+		writer.Close()
+		return nil, nil, fmt.Errorf("无法打开数据库: %v", err)
+	}
+	readers := max(4, runtime.NumCPU())
+	reader.SetMaxOpenConns(readers)
+	reader.SetMaxIdleConns(readers)
+	reader.SetConnMaxLifetime(30 * time.Minute)
+	
+	if err := reader.Ping(); err != nil {
+		writer.Close()
+		reader.Close()
+		return nil, nil, fmt.Errorf("数据库连接失败: %v", err)
+	}
+	
+	return writer, reader, nil
+}
+
+func (sqliteDialect) name() string {
+	return DriverSQLite
+}
+
+func (sqliteDialect) rebind(query string) string {
+	return query
+}
+
+func (sqliteDialect) dateOf(column string) string {
+	return "DATE(" + column + ")"
+}
+
+func (sqliteDialect) hourOf(column string) string {
+	return "CAST(strftime('%H', " + column + ") AS INTEGER)"
+}
+
+func (sqliteDialect) emailDomain(column string) string {
+	return "substr(" + column + ", instr(" + column + ", '@') + 1)"
+}
+
+func (sqliteDialect) tableExists(db *Database, table string) (bool, error) {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&count)
+	return count > 0, err
+}
+
+func (sqliteDialect) migrationsTable() string {
+	return `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMP NOT NULL
+	)
+	`
+}
+
+// databaseStats 通过 PRAGMA 获取数据库大小，WAL 文件大小从磁盘读取
+func (sqliteDialect) databaseStats(db *Database) (*DatabaseStats, error) {
+	stats := &DatabaseStats{}
+	var pageCount, pageSize, freePages int64
+	if err := db.QueryRow("PRAGMA page_count").Scan(&pageCount); err != nil {
+		return nil, err
+	}
+	if err := db.QueryRow("PRAGMA page_size").Scan(&pageSize); err != nil {
+		return nil, err
+	}
+	if err := db.QueryRow("PRAGMA freelist_count").Scan(&freePages); err != nil {
+		return nil, err
+	}
+	if err := db.QueryRow("PRAGMA journal_mode").Scan(&stats.JournalMode); err != nil {
+		return nil, err
+	}
+	
+	stats.SizeBytes = pageCount * pageSize
+	stats.FreeBytes = freePages * pageSize
+	
+	var seq int
+	var name, file string
+	if err := db.QueryRow("SELECT seq, name, file FROM pragma_database_list WHERE name = 'main'").Scan(&seq, &name, &file); err == nil && file != "" {
+		if info, err := os.Stat(file + "-wal"); err == nil {
+			stats.WALBytes = info.Size()
+		}
+	}
+	
+	return stats, nil
+}
+
+// addColumnIfMissing 为已存在的表补充新列
+func addColumnIfMissing(tx *Tx, table, column, definition string) error {
+	rows, err := tx.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return fmt.Errorf("读取表结构失败: %v", err)
+	}
+	defer rows.Close()
+	
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			colType    string
+			notNull    int
+			defaultVal sql.NullString
+			pk         int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultVal, &pk); err != nil {
+			return fmt.Errorf("读取表结构失败: %v", err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	rows.Close()
+	
+	if _, err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)); err != nil {
+		return fmt.Errorf("添加列 %s.%s 失败: %v", table, column, err)
+	}
+	return nil
+}
@@ -1,8 +1,9 @@
 package models
 
 import (
-	"database/sql"
+	"strings"
 	"time"
+	"unicode/utf8"
 	"github.com/google/uuid"
 )
 
@@ -17,6 +18,7 @@ type Email struct {
 	RecipientName   string    `json:"recipient_name"`
 	Subject         string    `json:"subject"`
 	Body            string    `json:"body"`
+	Preview         string    `json:"preview"`
 	IsRead          bool      `json:"is_read"`
 	IsStarred       bool      `json:"is_starred"`
 	IsDeleted       bool      `json:"is_deleted"`
@@ -31,51 +33,43 @@ type EmailWithDetails struct {
 	Attachments []Attachment `json:"attachments,omitempty"`
 }
 
-func CreateEmail(db *Database, email *Email) (int64, error) {
-	if email.UUID == "" {
-		email.UUID = uuid.New().String()
+// emailPreviewLength 邮件摘要保留的字符数
+const emailPreviewLength = 100
+
+// EmailPreview 去掉正文中的HTML标签，截取前100个字符作为列表中显示的摘要
+func EmailPreview(body string) string {
+	var sb strings.Builder
+	inTag := false
+	for _, c := range body {
+		if c == '<' {
+			inTag = true
+		} else if c == '>' {
+			inTag = false
+		} else if !inTag {
+			sb.WriteRune(c)
+		}
 	}
 	
-	query := `
-	INSERT INTO emails (
-		uuid, sender_id, recipient_id, sender_email, recipient_email,
-		subject, body, is_read, is_starred, is_deleted, is_draft,
-		has_attachment, created_at, updated_at
-	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`
-	
-	result, err := db.Exec(query,
-		email.UUID, email.SenderID, email.RecipientID,
-		email.SenderEmail, email.RecipientEmail,
-		email.Subject, email.Body,
-		email.IsRead, email.IsStarred, email.IsDeleted, email.IsDraft,
-		email.HasAttachment, time.Now(), time.Now(),
-	)
-	
-	if err != nil {
-		return 0, err
+	text := strings.TrimSpace(sb.String())
+	if utf8.RuneCountInString(text) <= emailPreviewLength {
+		return text
 	}
-	
-	return result.LastInsertId()
+	return string([]rune(text)[:emailPreviewLength]) + "..."
 }
 
-func GetEmailByID(db *Database, id int) (*Email, error) {
+const emailColumns = `e.id, e.uuid, e.sender_id, e.recipient_id, e.sender_email, e.recipient_email,
+	       e.subject, e.body, e.preview, e.is_read, e.is_starred, e.is_deleted, e.is_draft,
+	       e.has_attachment, e.created_at, e.updated_at`
+
+func scanEmail(row interface{ Scan(...interface{}) error }) (*Email, error) {
 	var email Email
-	query := `
-	SELECT id, uuid, sender_id, recipient_id, sender_email, recipient_email,
-	       subject, body, is_read, is_starred, is_deleted, is_draft,
-	       has_attachment, created_at, updated_at
-	FROM emails WHERE id = ?
-	`
-	
-	err := db.QueryRow(query, id).Scan(
+	err := row.Scan(
 		&email.ID, &email.UUID, &email.SenderID, &email.RecipientID,
 		&email.SenderEmail, &email.RecipientEmail,
-		&email.Subject, &email.Body,
+		&email.Subject, &email.Body, &email.Preview,
 		&email.IsRead, &email.IsStarred, &email.IsDeleted, &email.IsDraft,
 		&email.HasAttachment, &email.CreatedAt, &email.UpdatedAt,
 	)
-	
 	if err != nil {
 		return nil, err
 	}
@@ -83,23 +77,26 @@ func GetEmailByID(db *Database, id int) (*Email, error) {
 	return &email, nil
 }
 
-func GetEmailByUUID(db *Database, emailUUID string) (*Email, error) {
+// emailSummaryColumns 列表查询的列，不读取正文，收发件人名称关联用户表获得，
+// 用户已删除时使用邮箱地址
+const emailSummaryColumns = `e.id, e.uuid, e.sender_id, e.recipient_id, e.sender_email, e.recipient_email,
+	       COALESCE(su.username, e.sender_email), COALESCE(ru.username, e.recipient_email),
+	       e.subject, e.preview, e.is_read, e.is_starred, e.is_deleted, e.is_draft,
+	       e.has_attachment, e.created_at, e.updated_at`
+
+const emailSummaryJoins = `LEFT JOIN users su ON su.id = e.sender_id
+	LEFT JOIN users ru ON ru.id = e.recipient_id`
+
+func scanEmailSummary(row interface{ Scan(...interface{}) error }) (*Email, error) {
 	var email Email
-	query := `
-	SELECT id, uuid, sender_id, recipient_id, sender_email, recipient_email,
-	       subject, body, is_read, is_starred, is_deleted, is_draft,
-	       has_attachment, created_at, updated_at
-	FROM emails WHERE uuid = ?
-	`
-	
-	err := db.QueryRow(query, emailUUID).Scan(
+	err := row.Scan(
 		&email.ID, &email.UUID, &email.SenderID, &email.RecipientID,
 		&email.SenderEmail, &email.RecipientEmail,
-		&email.Subject, &email.Body,
+		&email.SenderName, &email.RecipientName,
+		&email.Subject, &email.Preview,
 		&email.IsRead, &email.IsStarred, &email.IsDeleted, &email.IsDraft,
 		&email.HasAttachment, &email.CreatedAt, &email.UpdatedAt,
 	)
-	
 	if err != nil {
 		return nil, err
 	}
@@ -107,203 +104,387 @@ func GetEmailByUUID(db *Database, emailUUID string) (*Email, error) {
 	return &email, nil
 }
 
-func GetEmailsByRecipient(db *Database, recipientID int, limit, offset int, folder string) ([]*Email, error) {
-	var query string
-	var args []interface{}
-	
+// emailFolderFilter 文件夹对应的查询条件，条件中的占位符都是用户ID
+func emailFolderFilter(userID int, folder string) (string, []interface{}) {
 	switch folder {
-	case "inbox":
-		query = `
-		SELECT e.id, e.uuid, e.sender_id, e.recipient_id, e.sender_email, e.recipient_email,
-		       e.subject, e.body, e.is_read, e.is_starred, e.is_deleted, e.is_draft,
-		       e.has_attachment, e.created_at, e.updated_at
-		FROM emails e
-		WHERE e.recipient_id = ? AND e.is_deleted = 0 AND e.is_draft = 0
-		ORDER BY e.created_at DESC
-		LIMIT ? OFFSET ?
-		`
-		args = []interface{}{recipientID, limit, offset}
 	case "sent":
-		query = `
-		SELECT e.id, e.uuid, e.sender_id, e.recipient_id, e.sender_email, e.recipient_email,
-		       e.subject, e.body, e.is_read, e.is_starred, e.is_deleted, e.is_draft,
-		       e.has_attachment, e.created_at, e.updated_at
-		FROM emails e
-		WHERE e.sender_id = ? AND e.is_deleted = 0 AND e.is_draft = 0
-		ORDER BY e.created_at DESC
-		LIMIT ? OFFSET ?
-		`
-		args = []interface{}{recipientID, limit, offset}
+		return "e.sender_id = ? AND e.is_deleted = FALSE AND e.is_draft = FALSE", []interface{}{userID}
 	case "starred":
-		query = `
-		SELECT e.id, e.uuid, e.sender_id, e.recipient_id, e.sender_email, e.recipient_email,
-		       e.subject, e.body, e.is_read, e.is_starred, e.is_deleted, e.is_draft,
-		       e.has_attachment, e.created_at, e.updated_at
-		FROM emails e
-		WHERE (e.sender_id = ? OR e.recipient_id = ?) 
-		  AND e.is_starred = 1 AND e.is_deleted = 0
-		ORDER BY e.created_at DESC
-		LIMIT ? OFFSET ?
-		`
-		args = []interface{}{recipientID, recipientID, limit, offset}
+		return "(e.sender_id = ? OR e.recipient_id = ?) AND e.is_starred = TRUE AND e.is_deleted = FALSE", []interface{}{userID, userID}
 	case "drafts":
-		query = `
-		SELECT e.id, e.uuid, e.sender_id, e.recipient_id, e.sender_email, e.recipient_email,
-		       e.subject, e.body, e.is_read, e.is_starred, e.is_deleted, e.is_draft,
-		       e.has_attachment, e.created_at, e.updated_at
-		FROM emails e
-		WHERE e.sender_id = ? AND e.is_draft = 1 AND e.is_deleted = 0
-		ORDER BY e.created_at DESC
-		LIMIT ? OFFSET ?
-		`
-		args = []interface{}{recipientID, limit, offset}
+		return "e.sender_id = ? AND e.is_draft = TRUE AND e.is_deleted = FALSE", []interface{}{userID}
 	case "trash":
-		query = `
-		SELECT e.id, e.uuid, e.sender_id, e.recipient_id, e.sender_email, e.recipient_email,
-		       e.subject, e.body, e.is_read, e.is_starred, e.is_deleted, e.is_draft,
-		       e.has_attachment, e.created_at, e.updated_at
-		FROM emails e
-		WHERE (e.sender_id = ? OR e.recipient_id = ?) AND e.is_deleted = 1
-		ORDER BY e.created_at DESC
-		LIMIT ? OFFSET ?
-		`
-		args = []interface{}{recipientID, recipientID, limit, offset}
+		return "(e.sender_id = ? OR e.recipient_id = ?) AND e.is_deleted = TRUE", []interface{}{userID, userID}
 	default: // inbox
-		query = `
-		SELECT e.id, e.uuid, e.sender_id, e.recipient_id, e.sender_email, e.recipient_email,
-		       e.subject, e.body, e.is_read, e.is_starred, e.is_deleted, e.is_draft,
-		       e.has_attachment, e.created_at, e.updated_at
-		FROM emails e
-		WHERE e.recipient_id = ? AND e.is_deleted = 0 AND e.is_draft = 0
-		ORDER BY e.created_at DESC
-		LIMIT ? OFFSET ?
-		`
-		args = []interface{}{recipientID, limit, offset}
+		return "e.recipient_id = ? AND e.is_deleted = FALSE AND e.is_draft = FALSE", []interface{}{userID}
 	}
+}
+
+// sqlEmailRepository EmailRepository 的SQL实现
+type sqlEmailRepository struct {
+	db *Database
+}
+
+func (r *sqlEmailRepository) Create(email *Email) (int64, error) {
+	if email.UUID == "" {
+		email.UUID = uuid.New().String()
+	}
+	email.Preview = EmailPreview(email.Body)
 	
-	rows, err := db.Query(query, args...)
+	query := `
+	INSERT INTO emails (
+		uuid, sender_id, recipient_id, sender_email, recipient_email,
+		subject, body, preview, is_read, is_starred, is_deleted, is_draft,
+		has_attachment, created_at, updated_at
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	
+	return insertReturningID(r.db, query,
+		email.UUID, email.SenderID, email.RecipientID,
+		email.SenderEmail, email.RecipientEmail,
+		email.Subject, email.Body, email.Preview,
+		email.IsRead, email.IsStarred, email.IsDeleted, email.IsDraft,
+		email.HasAttachment, time.Now(), time.Now(),
+	)
+}
+
+func (r *sqlEmailRepository) GetByID(id int) (*Email, error) {
+	query := `SELECT ` + emailColumns + ` FROM emails e WHERE e.id = ?`
+	return scanEmail(r.db.queryRowStmt(query, id))
+}
+
+func (r *sqlEmailRepository) GetByUUID(emailUUID string) (*Email, error) {
+	query := `SELECT ` + emailColumns + ` FROM emails e WHERE e.uuid = ?`
+	return scanEmail(r.db.QueryRow(query, emailUUID))
+}
+
+// list 按条件分页查询邮件摘要，按创建时间倒序。where 来自固定的几种条件，可以缓存预编译语句
+func (r *sqlEmailRepository) list(where string, args []interface{}, page Page) ([]*Email, *PageInfo, error) {
+	where, args, order := page.keyset("e.", where, args)
+	query := `SELECT ` + emailSummaryColumns + ` FROM emails e
+	` + emailSummaryJoins + `
+	WHERE ` + where + `
+	ORDER BY ` + order + `
+	LIMIT ? OFFSET ?`
+	
+	rows, err := r.db.queryStmt(query, args...)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer rows.Close()
 	
-	var emails []*Email
+	emails := []*Email{}
 	for rows.Next() {
-		var email Email
-		err := rows.Scan(
-			&email.ID, &email.UUID, &email.SenderID, &email.RecipientID,
-			&email.SenderEmail, &email.RecipientEmail,
-			&email.Subject, &email.Body,
-			&email.IsRead, &email.IsStarred, &email.IsDeleted, &email.IsDraft,
-			&email.HasAttachment, &email.CreatedAt, &email.UpdatedAt,
-		)
+		email, err := scanEmailSummary(rows)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
-		emails = append(emails, &email)
+		emails = append(emails, email)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
 	}
 	
-	return emails, nil
+	emails, info := paginate(page, emails, emailCursor)
+	return emails, info, nil
 }
 
-func CountEmailsByRecipient(db *Database, recipientID int, folder string) (int, error) {
-	var query string
-	var args []interface{}
-	
-	switch folder {
-	case "inbox":
-		query = `SELECT COUNT(*) FROM emails WHERE recipient_id = ? AND is_deleted = 0 AND is_draft = 0`
-		args = []interface{}{recipientID}
-	case "sent":
-		query = `SELECT COUNT(*) FROM emails WHERE sender_id = ? AND is_deleted = 0 AND is_draft = 0`
-		args = []interface{}{recipientID}
-	case "starred":
-		query = `SELECT COUNT(*) FROM emails WHERE (sender_id = ? OR recipient_id = ?) AND is_starred = 1 AND is_deleted = 0`
-		args = []interface{}{recipientID, recipientID}
-	case "drafts":
-		query = `SELECT COUNT(*) FROM emails WHERE sender_id = ? AND is_draft = 1 AND is_deleted = 0`
-		args = []interface{}{recipientID}
-	case "trash":
-		query = `SELECT COUNT(*) FROM emails WHERE (sender_id = ? OR recipient_id = ?) AND is_deleted = 1`
-		args = []interface{}{recipientID, recipientID}
-	default:
-		query = `SELECT COUNT(*) FROM emails WHERE recipient_id = ? AND is_deleted = 0 AND is_draft = 0`
-		args = []interface{}{recipientID}
-	}
-	
+// emailCursor 邮件在列表中的位置
+func emailCursor(email *Email) Cursor {
+	return Cursor{CreatedAt: email.CreatedAt, ID: email.ID}
+}
+
+func (r *sqlEmailRepository) count(where string, args ...interface{}) (int, error) {
 	var count int
-	err := db.QueryRow(query, args...).Scan(&count)
+	err := r.db.queryRowStmt("SELECT COUNT(*) FROM emails e WHERE "+where, args...).Scan(&count)
 	return count, err
 }
 
-func MarkAsRead(db *Database, emailID int) error {
-	query := `UPDATE emails SET is_read = 1, updated_at = ? WHERE id = ?`
-	_, err := db.Exec(query, time.Now(), emailID)
+func (r *sqlEmailRepository) ListByFolder(userID int, folder string, page Page) ([]*Email, *PageInfo, error) {
+	where, args := emailFolderFilter(userID, folder)
+	return r.list(where, args, page)
+}
+
+func (r *sqlEmailRepository) CountByFolder(userID int, folder string) (int, error) {
+	where, args := emailFolderFilter(userID, folder)
+	return r.count(where, args...)
+}
+
+// CountUnread 统计收件箱中的未读邮件
+func (r *sqlEmailRepository) CountUnread(userID int) (int, error) {
+	return r.count("e.recipient_id = ? AND e.is_read = FALSE AND e.is_deleted = FALSE AND e.is_draft = FALSE", userID)
+}
+
+func (r *sqlEmailRepository) MarkAsRead(emailID int) error {
+	query := `UPDATE emails SET is_read = TRUE, updated_at = ? WHERE id = ?`
+	_, err := r.db.execStmt(query, time.Now(), emailID)
 	return err
 }
 
-func ToggleStar(db *Database, emailID int) error {
+func (r *sqlEmailRepository) ToggleStar(emailID int) error {
 	query := `UPDATE emails SET is_starred = NOT is_starred, updated_at = ? WHERE id = ?`
-	_, err := db.Exec(query, time.Now(), emailID)
+	_, err := r.db.Exec(query, time.Now(), emailID)
+	return err
+}
+
+// UpdateFlags 更新邮件的草稿和星标状态
+func (r *sqlEmailRepository) UpdateFlags(emailID int, isDraft, isStarred bool) error {
+	query := `UPDATE emails SET is_draft = ?, is_starred = ?, updated_at = ? WHERE id = ?`
+	_, err := r.db.Exec(query, isDraft, isStarred, time.Now(), emailID)
 	return err
 }
 
-func MoveToTrash(db *Database, emailID int) error {
-	query := `UPDATE emails SET is_deleted = 1, updated_at = ? WHERE id = ?`
-	_, err := db.Exec(query, time.Now(), emailID)
+func (r *sqlEmailRepository) MoveToTrash(emailID int) error {
+	query := `UPDATE emails SET is_deleted = TRUE, updated_at = ? WHERE id = ?`
+	_, err := r.db.Exec(query, time.Now(), emailID)
 	return err
 }
 
-func DeletePermanently(db *Database, emailID int) error {
+func (r *sqlEmailRepository) DeletePermanently(emailID int) error {
 	// 先删除附件
-	_, err := db.Exec(`DELETE FROM attachments WHERE email_id = ?`, emailID)
+	_, err := r.db.Exec(`DELETE FROM attachments WHERE email_id = ?`, emailID)
 	if err != nil {
 		return err
 	}
 	
 	// 再删除邮件
 	query := `DELETE FROM emails WHERE id = ?`
-	_, err = db.Exec(query, emailID)
+	_, err = r.db.Exec(query, emailID)
 	return err
 }
 
-func GetAllEmails(db *Database, limit, offset int) ([]*Email, error) {
-	query := `
-	SELECT id, uuid, sender_id, recipient_id, sender_email, recipient_email,
-	       subject, body, is_read, is_starred, is_deleted, is_draft,
-	       has_attachment, created_at, updated_at
-	FROM emails
-	ORDER BY created_at DESC
-	LIMIT ? OFFSET ?
-	`
+func (r *sqlEmailRepository) PurgeTrash(before time.Time) (int64, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	
+	if _, err := tx.Exec(`
+	DELETE FROM attachments WHERE email_id IN (
+		SELECT id FROM emails WHERE is_deleted = TRUE AND updated_at < ?
+	)
+	`, before); err != nil {
+		return 0, err
+	}
+	
+	result, err := tx.Exec("DELETE FROM emails WHERE is_deleted = TRUE AND updated_at < ?", before)
+	if err != nil {
+		return 0, err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	
+	return deleted, tx.Commit()
+}
+
+func (r *sqlEmailRepository) List(page Page) ([]*Email, *PageInfo, error) {
+	return r.list("1 = 1", nil, page)
+}
+
+func (r *sqlEmailRepository) Count() (int, error) {
+	var count int
+	err := r.db.QueryRow("SELECT COUNT(*) FROM emails").Scan(&count)
+	return count, err
+}
+
+// searchFilter 在主题、正文和收发件人地址中搜索关键字，不区分大小写，不含回收站
+func searchFilter(keyword string) (string, []interface{}) {
+	pattern := "%" + keyword + "%"
+	where := `(LOWER(e.subject) LIKE LOWER(?) OR LOWER(e.body) LIKE LOWER(?)
+	       OR LOWER(e.sender_email) LIKE LOWER(?) OR LOWER(e.recipient_email) LIKE LOWER(?))
+	  AND e.is_deleted = FALSE`
+	return where, []interface{}{pattern, pattern, pattern, pattern}
+}
+
+func (r *sqlEmailRepository) Search(keyword string, page Page) ([]*Email, *PageInfo, error) {
+	where, args := searchFilter(keyword)
+	return r.list(where, args, page)
+}
+
+func (r *sqlEmailRepository) CountSearch(keyword string) (int, error) {
+	where, args := searchFilter(keyword)
+	return r.count(where, args...)
+}
+
+// CountByUsers 分别按发件人和收件人分组统计，两个分组都能使用对应的索引
+func (r *sqlEmailRepository) CountByUsers(userIDs []int) (map[int]*UserEmailCounts, error) {
+	counts := make(map[int]*UserEmailCounts, len(userIDs))
+	if len(userIDs) == 0 {
+		return counts, nil
+	}
+	
+	placeholders := make([]string, len(userIDs))
+	args := make([]interface{}, 0, 2*len(userIDs))
+	for i, id := range userIDs {
+		placeholders[i] = "?"
+		args = append(args, id)
+		counts[id] = &UserEmailCounts{}
+	}
+	args = append(args, args...)
+	in := "(" + strings.Join(placeholders, ", ") + ")"
 	
-	rows, err := db.Query(query, limit, offset)
+	rows, err := r.db.Query(`
+	SELECT sender_id, COUNT(*), 0 FROM emails
+	WHERE sender_id IN `+in+` AND is_deleted = FALSE
+	GROUP BY sender_id
+	UNION ALL
+	SELECT recipient_id, 0, COUNT(*) FROM emails
+	WHERE recipient_id IN `+in+` AND is_deleted = FALSE
+	GROUP BY recipient_id
+	`, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	
-	var emails []*Email
 	for rows.Next() {
-		var email Email
-		err := rows.Scan(
-			&email.ID, &email.UUID, &email.SenderID, &email.RecipientID,
-			&email.SenderEmail, &email.RecipientEmail,
-			&email.Subject, &email.Body,
-			&email.IsRead, &email.IsStarred, &email.IsDeleted, &email.IsDraft,
-			&email.HasAttachment, &email.CreatedAt, &email.UpdatedAt,
-		)
-		if err != nil {
+		var userID, sent, received int
+		if err := rows.Scan(&userID, &sent, &received); err != nil {
 			return nil, err
 		}
-		emails = append(emails, &email)
+		if c, ok := counts[userID]; ok {
+			c.Sent += sent
+			c.Received += received
+		}
 	}
 	
-	return emails, nil
+	return counts, rows.Err()
 }
 
-func CountAllEmails(db *Database) (int, error) {
+func (r *sqlEmailRepository) Totals(since time.Time) (*EmailTotals, error) {
+	totals := &EmailTotals{}
+	err := r.db.QueryRow(`
+	SELECT COUNT(*),
+	       COALESCE(SUM(CASE WHEN is_read = FALSE THEN 1 ELSE 0 END), 0),
+	       COALESCE(SUM(CASE WHEN created_at >= ? AND is_draft = FALSE THEN 1 ELSE 0 END), 0)
+	FROM emails
+	WHERE is_deleted = FALSE
+	`, since).Scan(&totals.Total, &totals.Unread, &totals.Since)
+	if err != nil {
+		return nil, err
+	}
+	
+	return totals, nil
+}
+
+// CountDeliveredSince 统计 since 之后投递给启用账号的邮件
+func (r *sqlEmailRepository) CountDeliveredSince(since time.Time) (int, error) {
+	return r.count(`e.created_at >= ? AND e.is_draft = FALSE AND e.recipient_id IN (
+		SELECT id FROM users WHERE is_active = TRUE
+	)`, since)
+}
+
+// CountActiveUsersSince 统计 since 之后发送或收到过邮件的用户数
+func (r *sqlEmailRepository) CountActiveUsersSince(since time.Time) (int, error) {
 	var count int
-	err := db.QueryRow("SELECT COUNT(*) FROM emails").Scan(&count)
+	err := r.db.QueryRow(`
+	SELECT COUNT(DISTINCT user_id) FROM (
+		SELECT sender_id AS user_id FROM emails WHERE created_at >= ?
+		UNION
+		SELECT recipient_id AS user_id FROM emails WHERE created_at >= ?
+	) active_users
+	`, since, since).Scan(&count)
 	return count, err
-}
\ No newline at end of file
+}
+
+// activityColumns 收发数量的统计列，占位符依次为发件人、收件人、收件人
+const activityColumns = `COALESCE(SUM(CASE WHEN sender_id = ? THEN 1 ELSE 0 END), 0),
+	       COALESCE(SUM(CASE WHEN recipient_id = ? THEN 1 ELSE 0 END), 0),
+	       COALESCE(SUM(CASE WHEN recipient_id = ? AND is_read = TRUE THEN 1 ELSE 0 END), 0)`
+
+// activityFilter 用户 since 之后已发送的邮件，占位符依次为发件人、收件人、起始时间
+const activityFilter = `(sender_id = ? OR recipient_id = ?)
+	  AND created_at >= ?
+	  AND is_deleted = FALSE AND is_draft = FALSE`
+
+func (r *sqlEmailRepository) Activity(userID int, since time.Time) (*EmailActivity, error) {
+	activity := &EmailActivity{}
+	err := r.db.QueryRow(`SELECT `+activityColumns+` FROM emails WHERE `+activityFilter,
+		userID, userID, userID, userID, userID, since,
+	).Scan(&activity.Sent, &activity.Received, &activity.Read)
+	if err != nil {
+		return nil, err
+	}
+	
+	return activity, nil
+}
+
+// groupedActivity 按 group 表达式分组统计收发数量
+func (r *sqlEmailRepository) groupedActivity(group string, userID int, since time.Time, scan func(*EmailActivity) []interface{}) ([]*EmailActivity, error) {
+	rows, err := r.db.Query(`
+	SELECT `+group+` AS grp, `+activityColumns+`
+	FROM emails
+	WHERE `+activityFilter+`
+	GROUP BY `+group+`
+	ORDER BY grp
+	`, userID, userID, userID, userID, userID, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	
+	var activities []*EmailActivity
+	for rows.Next() {
+		activity := &EmailActivity{}
+		if err := rows.Scan(append(scan(activity), &activity.Sent, &activity.Received, &activity.Read)...); err != nil {
+			return nil, err
+		}
+		activities = append(activities, activity)
+	}
+	
+	return activities, rows.Err()
+}
+
+// DailyActivity 按天统计收发数量，按日期升序
+func (r *sqlEmailRepository) DailyActivity(userID int, since time.Time) ([]*EmailActivity, error) {
+	return r.groupedActivity(r.db.dialect.dateOf("created_at"), userID, since, func(a *EmailActivity) []interface{} {
+		return []interface{}{&a.Date}
+	})
+}
+
+// HourlyActivity 按一天中的小时统计收发数量，没有邮件的小时不返回
+func (r *sqlEmailRepository) HourlyActivity(userID int, since time.Time) ([]*EmailActivity, error) {
+	return r.groupedActivity(r.db.dialect.hourOf("created_at"), userID, since, func(a *EmailActivity) []interface{} {
+		return []interface{}{&a.Hour}
+	})
+}
+
+// TopContacts 往来邮件最多的联系人
+func (r *sqlEmailRepository) TopContacts(userID int, since time.Time, limit int) ([]*ContactCount, error) {
+	rows, err := r.db.Query(`
+	SELECT CASE WHEN sender_id = ? THEN recipient_email ELSE sender_email END AS contact_email,
+	       COUNT(*) AS email_count
+	FROM emails
+	WHERE `+activityFilter+`
+	GROUP BY contact_email
+	ORDER BY email_count DESC
+	LIMIT ?
+	`, userID, userID, userID, since, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	
+	var contacts []*ContactCount
+	for rows.Next() {
+		contact := &ContactCount{}
+		if err := rows.Scan(&contact.Email, &contact.Count); err != nil {
+			return nil, err
+		}
+		contacts = append(contacts, contact)
+	}
+	
+	return contacts, rows.Err()
+}
+
+func (r *sqlEmailRepository) BodySizeByUser(userID int) (count int, size int64, err error) {
+	err = r.db.QueryRow(`
+	SELECT COUNT(*), COALESCE(SUM(LENGTH(body)), 0)
+	FROM emails
+	WHERE (sender_id = ? OR recipient_id = ?) AND is_deleted = FALSE
+	`, userID, userID).Scan(&count, &size)
+	return count, size, err
+}
@@ -0,0 +1,95 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// benchMailboxSize BenchmarkMailbox 预先写入的邮件数量
+const benchMailboxSize = 10000
+
+// benchBody 大约 2KB 的 HTML 正文，列表只需要摘要，不应读取整段正文
+var benchBody = "<div><p>" + strings.Repeat("Quarterly figures and meeting notes for the team. ", 40) + "</p></div>"
+
+// seedMailbox 写入 benchMailboxSize 封邮件，收发方向交替，每 10 封有一封主题包含 invoice
+func seedMailbox(b *testing.B) (db *Database, sender, recipient *User) {
+	b.Helper()
+	db, sender, recipient = newBenchDB(b)
+	
+	for i := 0; i < benchMailboxSize; i++ {
+		from, to := sender, recipient
+		if i%4 == 0 {
+			from, to = recipient, sender
+		}
+		subject := "status update " + strconv.Itoa(i)
+		if i%10 == 0 {
+			subject = "invoice " + strconv.Itoa(i)
+		}
+		_, err := db.Emails().Create(&Email{
+			SenderID: from.ID, RecipientID: to.ID,
+			SenderEmail: from.Email, RecipientEmail: to.Email,
+			Subject: subject, Body: benchBody,
+			IsRead: i%3 == 0, IsStarred: i%50 == 0,
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	return db, sender, recipient
+}
+
+// BenchmarkMailbox 在一万封邮件的邮箱中读取列表页、翻页和搜索
+func BenchmarkMailbox(b *testing.B) {
+	db, _, recipient := seedMailbox(b)
+	
+	first, info, err := db.Emails().ListByFolder(recipient.ID, "inbox", Page{Limit: 50})
+	if err != nil || len(first) != 50 || info.NextCursor == "" {
+		b.Fatalf("收件箱第一页不正确: %d 封, err=%v", len(first), err)
+	}
+	middle, err := db.Emails().GetByID(first[0].ID - benchMailboxSize/2)
+	if err != nil {
+		b.Fatal(err)
+	}
+	deep := &Cursor{CreatedAt: middle.CreatedAt, ID: middle.ID}
+	
+	benchmarks := []struct {
+		name string
+		run  func() error
+	}{
+		{"inbox", func() error {
+			_, _, err := db.Emails().ListByFolder(recipient.ID, "inbox", Page{Limit: 50})
+			return err
+		}},
+		{"inbox-deep-cursor", func() error {
+			_, _, err := db.Emails().ListByFolder(recipient.ID, "inbox", Page{Limit: 50, Cursor: deep})
+			return err
+		}},
+		{"sent", func() error {
+			_, _, err := db.Emails().ListByFolder(recipient.ID, "sent", Page{Limit: 50})
+			return err
+		}},
+		{"starred", func() error {
+			_, _, err := db.Emails().ListByFolder(recipient.ID, "starred", Page{Limit: 50})
+			return err
+		}},
+		{"unread-count", func() error {
+			_, err := db.Emails().CountUnread(recipient.ID)
+			return err
+		}},
+		{"search", func() error {
+			_, _, err := db.Emails().Search("invoice", Page{Limit: 50})
+			return err
+		}},
+	}
+	
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if err := bm.run(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
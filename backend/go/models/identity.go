@@ -0,0 +1,156 @@
+package models
+
+import (
+	"SwiftPost/utils"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+type UserIdentity struct {
+	ID          int        `json:"id"`
+	UserID      int        `json:"user_id"`
+	Issuer      string     `json:"issuer"`
+	Subject     string     `json:"subject"`
+	Email       string     `json:"email,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+}
+
+// LDAPIssuer 目录用户在外部身份表中使用的 issuer
+func LDAPIssuer(config *utils.Config) string {
+	return "ldap:" + strings.ToLower(config.LDAP.BaseDN)
+}
+
+// GetUserIdentity 根据身份提供方和用户标识查找关联的本地账号，不存在时返回 sql.ErrNoRows
+func GetUserIdentity(db *Database, issuer, subject string) (*UserIdentity, error) {
+	query := `
+	SELECT id, user_id, issuer, subject, COALESCE(email, ''), created_at, last_login_at
+	FROM user_identities WHERE issuer = ? AND subject = ?
+	`
+	
+	var identity UserIdentity
+	var lastLoginAt sql.NullTime
+	err := db.QueryRow(query, issuer, subject).Scan(
+		&identity.ID, &identity.UserID, &identity.Issuer, &identity.Subject, &identity.Email,
+		&identity.CreatedAt, &lastLoginAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	
+	if lastLoginAt.Valid {
+		identity.LastLoginAt = &lastLoginAt.Time
+	}
+	
+	return &identity, nil
+}
+
+// CreateUserIdentity 将外部身份关联到本地账号
+func CreateUserIdentity(db *Database, userID int, issuer, subject, email string) (int64, error) {
+	query := `
+	INSERT INTO user_identities (user_id, issuer, subject, email, created_at, last_login_at)
+	VALUES (?, ?, ?, ?, ?, ?)
+	`
+	
+	now := time.Now()
+	return insertReturningID(db, query, userID, issuer, subject, email, now, now)
+}
+
+// HasUserIdentity 用户是否关联了指定身份提供方（或目录）的外部身份
+func HasUserIdentity(db *Database, userID int, issuer string) (bool, error) {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM user_identities WHERE user_id = ? AND issuer = ?", userID, issuer).Scan(&count)
+	return count > 0, err
+}
+
+// GetUserIdentitiesByIssuer 获取某个身份提供方（或目录）关联的全部外部身份
+func GetUserIdentitiesByIssuer(db *Database, issuer string) ([]*UserIdentity, error) {
+	query := `
+	SELECT id, user_id, issuer, subject, COALESCE(email, ''), created_at, last_login_at
+	FROM user_identities WHERE issuer = ? ORDER BY id
+	`
+	
+	rows, err := db.Query(query, issuer)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	
+	var identities []*UserIdentity
+	for rows.Next() {
+		var identity UserIdentity
+		var lastLoginAt sql.NullTime
+		err := rows.Scan(
+			&identity.ID, &identity.UserID, &identity.Issuer, &identity.Subject, &identity.Email,
+			&identity.CreatedAt, &lastLoginAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if lastLoginAt.Valid {
+			identity.LastLoginAt = &lastLoginAt.Time
+		}
+		identities = append(identities, &identity)
+	}
+	
+	return identities, rows.Err()
+}
+
+// TouchUserIdentity 记录外部身份的最近登录时间和邮箱
+func TouchUserIdentity(db *Database, id int, email string) error {
+	_, err := db.Exec("UPDATE user_identities SET email = ?, last_login_at = ? WHERE id = ?", email, time.Now(), id)
+	return err
+}
+
+// SaveOIDCState 保存单点登录跳转前生成的 state、nonce 和 PKCE 校验码
+func SaveOIDCState(db *Database, state, nonce, codeVerifier string, expiresAt time.Time) error {
+	query := `
+	INSERT INTO oidc_states (state, nonce, code_verifier, expires_at, created_at)
+	VALUES (?, ?, ?, ?, ?)
+	`
+	
+	_, err := db.Exec(query, state, nonce, codeVerifier, expiresAt, time.Now())
+	return err
+}
+
+// ConsumeOIDCState 取出并删除登录状态，每个 state 只能使用一次，过期或不存在时返回 sql.ErrNoRows
+func ConsumeOIDCState(db *Database, state string) (string, string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return "", "", err
+	}
+	defer tx.Rollback()
+	
+	var nonce, codeVerifier string
+	var expiresAt time.Time
+	err = tx.QueryRow(
+		"SELECT nonce, code_verifier, expires_at FROM oidc_states WHERE state = ?", state,
+	).Scan(&nonce, &codeVerifier, &expiresAt)
+	if err != nil {
+		return "", "", err
+	}
+	
+	if _, err := tx.Exec("DELETE FROM oidc_states WHERE state = ?", state); err != nil {
+		return "", "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", "", err
+	}
+	
+	if time.Now().After(expiresAt) {
+		return "", "", sql.ErrNoRows
+	}
+	
+	return nonce, codeVerifier, nil
+}
+
+// DeleteExpiredOIDCStates 清理过期的单点登录状态
+func DeleteExpiredOIDCStates(db *Database) (int64, error) {
+	result, err := db.Exec("DELETE FROM oidc_states WHERE expires_at < ?", time.Now())
+	if err != nil {
+		return 0, err
+	}
+	
+	return result.RowsAffected()
+}
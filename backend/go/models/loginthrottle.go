@@ -0,0 +1,272 @@
+package models
+
+import (
+	"SwiftPost/utils"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// 登录限制的统计维度
+const (
+	LoginScopeAccount = "account"
+	LoginScopeIP      = "ip"
+)
+
+// LoginThrottle 某个账号或IP的连续登录失败记录
+type LoginThrottle struct {
+	Scope         string     `json:"scope"`
+	Key           string     `json:"key"`
+	Failures      int        `json:"failures"`
+	Lockouts      int        `json:"lockouts"`
+	LastFailureAt *time.Time `json:"last_failure_at,omitempty"`
+	LockedUntil   *time.Time `json:"locked_until,omitempty"`
+}
+
+// LoginBlockedError 登录因连续失败被锁定或需要等待，RetryAfter 为剩余等待时间
+type LoginBlockedError struct {
+	Locked     bool
+	RetryAfter time.Duration
+}
+
+func (e *LoginBlockedError) Error() string {
+	if e.Locked {
+		minutes := int(e.RetryAfter.Minutes()) + 1
+		return fmt.Sprintf("登录失败次数过多，请在 %d 分钟后重试", minutes)
+	}
+	return fmt.Sprintf("登录尝试过于频繁，请在 %d 秒后重试", int(e.RetryAfter.Seconds())+1)
+}
+
+// OnLoginLocked 账号或IP被锁定时调用，用于通知管理员，由 main 设置
+var OnLoginLocked func(scope, key, ip string, failures int, until time.Time)
+
+// LoginAccountKey 账号维度使用规范化后的邮箱，不存在的账号同样计数，避免通过锁定行为判断邮箱是否注册
+func LoginAccountKey(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func getLoginThrottle(db *Database, scope, key string) (*LoginThrottle, error) {
+	t := &LoginThrottle{Scope: scope, Key: key}
+	var lastFailureAt, lockedUntil sql.NullTime
+	err := db.QueryRow(
+		"SELECT failures, lockouts, last_failure_at, locked_until FROM login_throttles WHERE scope = ? AND key = ?",
+		scope, key,
+	).Scan(&t.Failures, &t.Lockouts, &lastFailureAt, &lockedUntil)
+	if err != nil {
+		return nil, err
+	}
+	
+	if lastFailureAt.Valid {
+		t.LastFailureAt = &lastFailureAt.Time
+	}
+	if lockedUntil.Valid {
+		t.LockedUntil = &lockedUntil.Time
+	}
+	return t, nil
+}
+
+// loginDelay 连续失败达到阈值后，两次尝试之间需要等待的时间，每多失败一次翻倍
+func loginDelay(config *utils.Config, failures int) time.Duration {
+	if failures < config.LoginProtection.DelayThreshold {
+		return 0
+	}
+	
+	maxDelay := time.Duration(config.LoginProtection.MaxDelay) * time.Second
+	shift := failures - config.LoginProtection.DelayThreshold
+	if shift > 16 {
+		return maxDelay
+	}
+	delay := time.Second << uint(shift)
+	if delay > maxDelay {
+		return maxDelay
+	}
+	return delay
+}
+
+// lockoutDuration 第 lockouts 次锁定的时长，每次锁定时长翻倍，不超过最长锁定时长
+func lockoutDuration(config *utils.Config, lockouts int) time.Duration {
+	maxDuration := time.Duration(config.LoginProtection.MaxLockoutDuration) * time.Minute
+	duration := time.Duration(config.LoginProtection.LockoutDuration) * time.Minute
+	for i := 1; i < lockouts && duration < maxDuration; i++ {
+		duration *= 2
+	}
+	if duration > maxDuration {
+		return maxDuration
+	}
+	return duration
+}
+
+// CheckLoginAllowed 验证密码前检查账号和IP是否被锁定或需要等待，返回 *LoginBlockedError 表示拒绝本次尝试
+func CheckLoginAllowed(db *Database, config *utils.Config, email, ip string) error {
+	if !config.LoginProtection.Enabled {
+		return nil
+	}
+	
+	now := time.Now()
+	window := time.Duration(config.LoginProtection.FailureWindow) * time.Minute
+	var blocked *LoginBlockedError
+	
+	for _, scope := range [][2]string{{LoginScopeAccount, LoginAccountKey(email)}, {LoginScopeIP, ip}} {
+		if scope[1] == "" {
+			continue
+		}
+		
+		t, err := getLoginThrottle(db, scope[0], scope[1])
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		
+		if t.LockedUntil != nil && t.LockedUntil.After(now) {
+			wait := t.LockedUntil.Sub(now)
+			if blocked == nil || !blocked.Locked || wait > blocked.RetryAfter {
+				blocked = &LoginBlockedError{Locked: true, RetryAfter: wait}
+			}
+			continue
+		}
+		
+		// 逐次延迟只针对账号，同一出口IP下的多个用户不会互相影响；统计窗口内没有新的失败时不再要求等待
+		if scope[0] != LoginScopeAccount || t.LastFailureAt == nil || now.Sub(*t.LastFailureAt) > window {
+			continue
+		}
+		next := t.LastFailureAt.Add(loginDelay(config, t.Failures))
+		if next.After(now) && blocked == nil {
+			blocked = &LoginBlockedError{RetryAfter: next.Sub(now)}
+		}
+	}
+	
+	if blocked != nil {
+		return blocked
+	}
+	return nil
+}
+
+// RecordLoginFailure 记录一次登录失败，账号或IP的失败次数达到阈值时锁定并通知管理员
+func RecordLoginFailure(db *Database, config *utils.Config, email, ip string) error {
+	if !config.LoginProtection.Enabled {
+		return nil
+	}
+	
+	if err := recordLoginFailure(db, config, LoginScopeAccount, LoginAccountKey(email), ip, config.LoginProtection.AccountThreshold); err != nil {
+		return err
+	}
+	if ip == "" {
+		return nil
+	}
+	return recordLoginFailure(db, config, LoginScopeIP, ip, ip, config.LoginProtection.IPThreshold)
+}
+
+func recordLoginFailure(db *Database, config *utils.Config, scope, key, ip string, threshold int) error {
+	now := time.Now()
+	windowStart := now.Add(-time.Duration(config.LoginProtection.FailureWindow) * time.Minute)
+	
+	// 超出统计窗口的失败不再累计
+	_, err := db.Exec(`
+	INSERT INTO login_throttles (scope, key, failures, lockouts, last_failure_at)
+	VALUES (?, ?, 1, 0, ?)
+	ON CONFLICT(scope, key) DO UPDATE SET
+		failures = CASE WHEN last_failure_at IS NULL OR last_failure_at < ? THEN 1 ELSE failures + 1 END,
+		last_failure_at = excluded.last_failure_at
+	`, scope, key, now, windowStart)
+	if err != nil {
+		return err
+	}
+	
+	t, err := getLoginThrottle(db, scope, key)
+	if err != nil {
+		return err
+	}
+	if t.Failures < threshold {
+		return nil
+	}
+	
+	// 条件更新保证并发请求只会触发一次锁定
+	until := now.Add(lockoutDuration(config, t.Lockouts+1))
+	result, err := db.Exec(`
+	UPDATE login_throttles SET failures = 0, lockouts = lockouts + 1, locked_until = ?
+	WHERE scope = ? AND key = ? AND failures >= ?
+	`, until, scope, key, threshold)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return nil
+	}
+	
+	dbLog.Warn("登录失败次数过多，已锁定 %s %s 至 %s（来源IP %s）", scope, key, until.Format("2006-01-02 15:04:05"), ip)
+	if OnLoginLocked != nil {
+		OnLoginLocked(scope, key, ip, t.Failures, until)
+	}
+	return nil
+}
+
+// ResetLoginFailures 登录成功后清除账号的失败记录，IP的失败记录只随统计窗口过期
+func ResetLoginFailures(db *Database, email string) error {
+	_, err := db.Exec("DELETE FROM login_throttles WHERE scope = ? AND key = ?", LoginScopeAccount, LoginAccountKey(email))
+	return err
+}
+
+// GetActiveLoginLockouts 获取当前仍处于锁定状态的账号和IP
+func GetActiveLoginLockouts(db *Database) ([]*LoginThrottle, error) {
+	rows, err := db.Query(`
+	SELECT scope, key, failures, lockouts, last_failure_at, locked_until FROM login_throttles
+	WHERE locked_until > ?
+	ORDER BY locked_until DESC
+	`, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	
+	lockouts := []*LoginThrottle{}
+	for rows.Next() {
+		t := &LoginThrottle{}
+		var lastFailureAt, lockedUntil sql.NullTime
+		if err := rows.Scan(&t.Scope, &t.Key, &t.Failures, &t.Lockouts, &lastFailureAt, &lockedUntil); err != nil {
+			return nil, err
+		}
+		if lastFailureAt.Valid {
+			t.LastFailureAt = &lastFailureAt.Time
+		}
+		if lockedUntil.Valid {
+			t.LockedUntil = &lockedUntil.Time
+		}
+		lockouts = append(lockouts, t)
+	}
+	
+	return lockouts, rows.Err()
+}
+
+// UnlockLogin 解除账号或IP的锁定并清除失败记录，记录不存在时返回 sql.ErrNoRows
+func UnlockLogin(db *Database, scope, key string) error {
+	if scope == LoginScopeAccount {
+		key = LoginAccountKey(key)
+	}
+	
+	result, err := db.Exec("DELETE FROM login_throttles WHERE scope = ? AND key = ?", scope, key)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteStaleLoginThrottles 清理一天内没有新失败且未处于锁定状态的记录
+func DeleteStaleLoginThrottles(db *Database) (int64, error) {
+	now := time.Now()
+	result, err := db.Exec(`
+	DELETE FROM login_throttles
+	WHERE (last_failure_at IS NULL OR last_failure_at < ?)
+	AND (locked_until IS NULL OR locked_until < ?)
+	`, now.Add(-24*time.Hour), now)
+	if err != nil {
+		return 0, err
+	}
+	
+	return result.RowsAffected()
+}
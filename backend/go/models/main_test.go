@@ -0,0 +1,29 @@
+package models
+
+import (
+	"SwiftPost/utils"
+	"path/filepath"
+	"testing"
+)
+
+// newTestConfig 使用默认配置和临时目录中的 SQLite 数据库
+func newTestConfig(t testing.TB) *utils.Config {
+	t.Helper()
+	config, err := (&utils.ConfigLoader{}).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Database.Path = filepath.Join(t.TempDir(), "swiftpost.db")
+	return config
+}
+
+// newTestDB 打开并迁移测试数据库
+func newTestDB(t testing.TB, config *utils.Config) *Database {
+	t.Helper()
+	db, err := InitDatabase(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
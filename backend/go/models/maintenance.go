@@ -0,0 +1,229 @@
+package models
+
+import (
+	"SwiftPost/utils"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// 数据库维护任务
+const (
+	MaintenanceIntegrityCheck = "integrity_check"
+	MaintenanceCheckpoint     = "wal_checkpoint"
+	MaintenanceAnalyze        = "analyze"
+	MaintenanceVacuum         = "vacuum"
+)
+
+// vacuumMinFreeRatio 空闲页占比低于该值时跳过 VACUUM，避免无意义地重写整个数据库文件
+const vacuumMinFreeRatio = 0.1
+
+// MaintenanceRun 维护任务最近一次的执行结果
+type MaintenanceRun struct {
+	Task       string    `json:"task"`
+	RanAt      time.Time `json:"ran_at"`
+	DurationMs int64     `json:"duration_ms"`
+	OK         bool      `json:"ok"`
+	Result     string    `json:"result,omitempty"`
+}
+
+// DatabaseStats 数据库文件的大小信息
+type DatabaseStats struct {
+	Driver      string `json:"driver"`
+	JournalMode string `json:"journal_mode,omitempty"`
+	SizeBytes   int64  `json:"size_bytes"`
+	FreeBytes   int64  `json:"free_bytes"`
+	WALBytes    int64  `json:"wal_bytes"`
+}
+
+// maintenanceInterval 任务的执行间隔，配置为0时使用默认值，负数表示不执行
+func maintenanceInterval(config *utils.Config, task string) time.Duration {
+	maintenance := config.Database.Maintenance
+	var value int
+	var unit, fallback time.Duration
+	switch task {
+	case MaintenanceIntegrityCheck:
+		value, unit, fallback = maintenance.IntegrityCheckInterval, time.Minute, time.Hour
+	case MaintenanceCheckpoint:
+		value, unit, fallback = maintenance.CheckpointInterval, time.Minute, 5*time.Minute
+	case MaintenanceAnalyze:
+		value, unit, fallback = maintenance.AnalyzeInterval, time.Hour, 24*time.Hour
+	case MaintenanceVacuum:
+		value, unit, fallback = maintenance.VacuumInterval, time.Hour, 7*24*time.Hour
+	}
+	
+	if value < 0 {
+		return 0
+	}
+	if value == 0 {
+		return fallback
+	}
+	return time.Duration(value) * unit
+}
+
+// GetMaintenanceRuns 获取各维护任务最近一次的执行结果
+func GetMaintenanceRuns(db *Database) (map[string]*MaintenanceRun, error) {
+	rows, err := db.Query("SELECT task, ran_at, duration_ms, ok, COALESCE(result, '') FROM maintenance_runs")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	
+	runs := make(map[string]*MaintenanceRun)
+	for rows.Next() {
+		run := &MaintenanceRun{}
+		if err := rows.Scan(&run.Task, &run.RanAt, &run.DurationMs, &run.OK, &run.Result); err != nil {
+			return nil, err
+		}
+		runs[run.Task] = run
+	}
+	
+	return runs, rows.Err()
+}
+
+func recordMaintenanceRun(db *Database, run *MaintenanceRun) error {
+	_, err := db.Exec(`
+	INSERT INTO maintenance_runs (task, ran_at, duration_ms, ok, result)
+	VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT(task) DO UPDATE SET
+		ran_at = excluded.ran_at,
+		duration_ms = excluded.duration_ms,
+		ok = excluded.ok,
+		result = excluded.result
+	`, run.Task, run.RanAt, run.DurationMs, run.OK, run.Result)
+	return err
+}
+
+// GetDatabaseStats 获取数据库占用的空间
+func GetDatabaseStats(db *Database) (*DatabaseStats, error) {
+	stats, err := db.dialect.databaseStats(db)
+	if err != nil {
+		return nil, err
+	}
+	stats.Driver = db.Driver()
+	return stats, nil
+}
+
+// QuickCheck 执行 PRAGMA quick_check，返回发现的问题，数据库完好时返回空列表
+func QuickCheck(db *Database) ([]string, error) {
+	rows, err := db.Query("PRAGMA quick_check(20)")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	
+	var problems []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return nil, err
+		}
+		if line != "ok" {
+			problems = append(problems, line)
+		}
+	}
+	
+	return problems, rows.Err()
+}
+
+// Checkpoint 将 WAL 中的内容写回数据库文件并截断 WAL，非 WAL 模式下不做任何事
+func Checkpoint(db *Database) (string, error) {
+	var busy, logFrames, checkpointed int
+	if err := db.writeRow("PRAGMA wal_checkpoint(TRUNCATE)").Scan(&busy, &logFrames, &checkpointed); err != nil {
+		return "", err
+	}
+	if logFrames < 0 {
+		return "非 WAL 模式，跳过", nil
+	}
+	if busy != 0 {
+		return "", fmt.Errorf("检查点被其他连接阻塞，已写回 %d/%d 帧", checkpointed, logFrames)
+	}
+	return fmt.Sprintf("已写回 %d 帧", checkpointed), nil
+}
+
+// Vacuum 空闲页足够多时重建数据库文件以回收空间
+func Vacuum(db *Database) (string, error) {
+	stats, err := GetDatabaseStats(db)
+	if err != nil {
+		return "", err
+	}
+	if stats.SizeBytes == 0 || float64(stats.FreeBytes)/float64(stats.SizeBytes) < vacuumMinFreeRatio {
+		return fmt.Sprintf("空闲空间 %d 字节，跳过", stats.FreeBytes), nil
+	}
+	
+	if _, err := db.Exec("VACUUM"); err != nil {
+		return "", err
+	}
+	
+	after, err := GetDatabaseStats(db)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("数据库从 %d 字节缩小到 %d 字节", stats.SizeBytes, after.SizeBytes), nil
+}
+
+// runMaintenanceTask 执行一个维护任务并记录结果
+func runMaintenanceTask(db *Database, task string) *MaintenanceRun {
+	run := &MaintenanceRun{Task: task, RanAt: time.Now(), OK: true}
+	
+	var err error
+	switch task {
+	case MaintenanceIntegrityCheck:
+		var problems []string
+		problems, err = QuickCheck(db)
+		if err == nil && len(problems) > 0 {
+			err = fmt.Errorf("完整性检查发现问题: %s", strings.Join(problems, "; "))
+		}
+		if err == nil {
+			run.Result = "ok"
+		}
+	case MaintenanceCheckpoint:
+		run.Result, err = Checkpoint(db)
+	case MaintenanceAnalyze:
+		_, err = db.Exec("ANALYZE")
+	case MaintenanceVacuum:
+		run.Result, err = Vacuum(db)
+	}
+	
+	run.DurationMs = time.Since(run.RanAt).Milliseconds()
+	if err != nil {
+		run.OK = false
+		run.Result = err.Error()
+		dbLog.Error("数据库维护任务 %s 失败: %v", task, err)
+	}
+	
+	if err := recordMaintenanceRun(db, run); err != nil {
+		dbLog.Error("记录数据库维护结果失败: %v", err)
+	}
+	return run
+}
+
+// RunDatabaseMaintenance 执行到期的维护任务，按上次执行时间和配置的间隔调度，由后台任务定期调用。
+// 这些任务只针对 SQLite，PostgreSQL 由服务器自己的 autovacuum 和检查点负责
+func RunDatabaseMaintenance(db *Database, config *utils.Config) {
+	if db.Driver() != DriverSQLite {
+		return
+	}
+	
+	runs, err := GetMaintenanceRuns(db)
+	if err != nil {
+		dbLog.Error("读取数据库维护记录失败: %v", err)
+		return
+	}
+	
+	now := time.Now()
+	for _, task := range []string{MaintenanceIntegrityCheck, MaintenanceCheckpoint, MaintenanceAnalyze, MaintenanceVacuum} {
+		interval := maintenanceInterval(config, task)
+		if interval <= 0 {
+			continue
+		}
+		if last, ok := runs[task]; ok && now.Sub(last.RanAt) < interval {
+			continue
+		}
+		
+		run := runMaintenanceTask(db, task)
+		if run.OK && task != MaintenanceCheckpoint {
+			dbLog.Info("数据库维护任务 %s 完成，耗时 %dms", task, run.DurationMs)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+	
+	"golang.org/x/crypto/bcrypt"
+)
+
+type UserMFA struct {
+	UserID       int        `json:"user_id"`
+	TOTPSecret   string     `json:"-"`
+	Enabled      bool       `json:"enabled"`
+	LastUsedStep int64      `json:"-"`
+	EnabledAt    *time.Time `json:"enabled_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// GetUserMFA 获取用户的两步验证设置，未设置时返回 sql.ErrNoRows
+func GetUserMFA(db *Database, userID int) (*UserMFA, error) {
+	var mfa UserMFA
+	var enabledAt sql.NullTime
+	query := `
+	SELECT user_id, totp_secret, enabled, last_used_step, enabled_at, created_at
+	FROM user_mfa WHERE user_id = ?
+	`
+	
+	err := db.QueryRow(query, userID).Scan(
+		&mfa.UserID, &mfa.TOTPSecret, &mfa.Enabled, &mfa.LastUsedStep, &enabledAt, &mfa.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	
+	if enabledAt.Valid {
+		mfa.EnabledAt = &enabledAt.Time
+	}
+	
+	return &mfa, nil
+}
+
+// IsMFAEnabled 用户是否已启用两步验证
+func IsMFAEnabled(db *Database, userID int) (bool, error) {
+	var enabled bool
+	err := db.QueryRow("SELECT enabled FROM user_mfa WHERE user_id = ?", userID).Scan(&enabled)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	
+	return enabled, nil
+}
+
+// SavePendingTOTPSecret 保存待确认的TOTP密钥，已启用的设置不会被覆盖
+func SavePendingTOTPSecret(db *Database, userID int, secret string) error {
+	query := `
+	INSERT INTO user_mfa (user_id, totp_secret, enabled, last_used_step, created_at)
+	VALUES (?, ?, FALSE, 0, ?)
+	ON CONFLICT(user_id) DO UPDATE SET
+		totp_secret = excluded.totp_secret,
+		last_used_step = 0,
+		created_at = excluded.created_at
+	WHERE user_mfa.enabled = FALSE
+	`
+	
+	_, err := db.Exec(query, userID, secret, time.Now())
+	return err
+}
+
+// EnableTOTP 确认验证码后启用两步验证
+func EnableTOTP(db *Database, userID int, step int64) error {
+	query := `UPDATE user_mfa SET enabled = TRUE, last_used_step = ?, enabled_at = ? WHERE user_id = ?`
+	_, err := db.Exec(query, step, time.Now(), userID)
+	return err
+}
+
+// UseTOTPStep 记录已使用的时间步长，同一步长的验证码不能重复使用
+func UseTOTPStep(db *Database, userID int, step int64) (bool, error) {
+	query := `UPDATE user_mfa SET last_used_step = ? WHERE user_id = ? AND last_used_step < ?`
+	result, err := db.Exec(query, step, userID, step)
+	if err != nil {
+		return false, err
+	}
+	
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	
+	return affected > 0, nil
+}
+
+// DisableMFA 关闭两步验证并删除恢复码
+func DisableMFA(db *Database, userID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	
+	if _, err := tx.Exec("DELETE FROM mfa_recovery_codes WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM user_mfa WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	
+	return tx.Commit()
+}
+
+// ReplaceRecoveryCodes 用新的恢复码替换旧的，只保存 bcrypt 哈希
+func ReplaceRecoveryCodes(db *Database, userID int, codes []string) error {
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hash, err := bcrypt.GenerateFromPassword([]byte(code), bcrypt.DefaultCost)
+		if err != nil {
+			return err
+		}
+		hashes[i] = string(hash)
+	}
+	
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	
+	if _, err := tx.Exec("DELETE FROM mfa_recovery_codes WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	
+	now := time.Now()
+	for _, hash := range hashes {
+		if _, err := tx.Exec(
+			"INSERT INTO mfa_recovery_codes (user_id, code_hash, created_at) VALUES (?, ?, ?)",
+			userID, hash, now,
+		); err != nil {
+			return err
+		}
+	}
+	
+	return tx.Commit()
+}
+
+// UseRecoveryCode 验证并消耗一个恢复码
+func UseRecoveryCode(db *Database, userID int, code string) (bool, error) {
+	rows, err := db.Query("SELECT id, code_hash FROM mfa_recovery_codes WHERE user_id = ? AND used_at IS NULL", userID)
+	if err != nil {
+		return false, err
+	}
+	
+	matchedID := 0
+	for rows.Next() {
+		var id int
+		var hash string
+		if err := rows.Scan(&id, &hash); err != nil {
+			rows.Close()
+			return false, err
+		}
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(code)) == nil {
+			matchedID = id
+			break
+		}
+	}
+	rows.Close()
+	
+	if matchedID == 0 {
+		return false, nil
+	}
+	
+	// 条件更新，防止同一个恢复码被并发使用两次
+	result, err := db.Exec("UPDATE mfa_recovery_codes SET used_at = ? WHERE id = ? AND used_at IS NULL", time.Now(), matchedID)
+	if err != nil {
+		return false, err
+	}
+	
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	
+	return affected > 0, nil
+}
+
+// CountUnusedRecoveryCodes 剩余可用的恢复码数量
+func CountUnusedRecoveryCodes(db *Database, userID int) (int, error) {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM mfa_recovery_codes WHERE user_id = ? AND used_at IS NULL", userID).Scan(&count)
+	return count, err
+}
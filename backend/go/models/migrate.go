@@ -0,0 +1,381 @@
+package models
+
+import (
+	"embed"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrationFiles 编译进程序的迁移脚本，每种数据库一个目录，
+// 文件名格式为 0001_name.up.sql / 0001_name.down.sql，两个目录中的版本号必须一一对应
+//
+//go:embed migrations/sqlite/*.sql migrations/postgres/*.sql
+var migrationFiles embed.FS
+
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration 一个版本的数据库结构变更
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+	
+	// upgrade 在 Up 之后执行的 Go 代码，用于 SQL 无法表达的变更
+	upgrade func(tx *Tx) error
+}
+
+// MigrationStatus 迁移在当前数据库中的应用情况，AppliedAt 为空表示尚未应用
+type MigrationStatus struct {
+	*Migration
+	AppliedAt *time.Time
+}
+
+// SchemaTooNewError 数据库已经由更新版本的程序迁移过，当前程序不认识其中的结构
+type SchemaTooNewError struct {
+	Current int
+	Latest  int
+}
+
+func (e *SchemaTooNewError) Error() string {
+	return fmt.Sprintf("数据库结构版本 %d 高于程序支持的版本 %d，请升级 SwiftPost 后再启动", e.Current, e.Latest)
+}
+
+// migrationUpgrades 各数据库在各版本迁移中需要额外执行的 Go 代码
+var migrationUpgrades = map[string]map[int]func(tx *Tx) error{
+	DriverSQLite: {
+		1: upgradeLegacySchema,
+		3: backfillEmailPreviews,
+	},
+	DriverPostgres: {
+		3: backfillEmailPreviews,
+	},
+}
+
+// upgradeLegacySchema 引入版本化迁移之前创建的 SQLite 数据库中，表已存在但缺少后来添加的列
+func upgradeLegacySchema(tx *Tx) error {
+	columns := []struct{ table, column, definition string }{
+		// 旧版本的用户表没有邮箱验证状态，已有账号视为已验证
+		{"users", "email_verified", "BOOLEAN DEFAULT 1"},
+		{"sessions", "last_seen_at", "TIMESTAMP"},
+		{"sessions", "revoked_at", "TIMESTAMP"},
+	}
+	for _, c := range columns {
+		if err := addColumnIfMissing(tx, c.table, c.column, c.definition); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backfillEmailPreviews 为添加 preview 列之前写入的邮件生成摘要，分批读取以免一次载入全部正文
+func backfillEmailPreviews(tx *Tx) error {
+	const batchSize = 500
+	type emailBody struct {
+		id   int
+		body string
+	}
+	
+	lastID := 0
+	for {
+		rows, err := tx.Query("SELECT id, body FROM emails WHERE id > ? ORDER BY id LIMIT ?", lastID, batchSize)
+		if err != nil {
+			return err
+		}
+		var batch []emailBody
+		for rows.Next() {
+			var email emailBody
+			if err := rows.Scan(&email.id, &email.body); err != nil {
+				rows.Close()
+				return err
+			}
+			batch = append(batch, email)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		
+		for _, email := range batch {
+			if _, err := tx.Exec("UPDATE emails SET preview = ? WHERE id = ?", EmailPreview(email.body), email.id); err != nil {
+				return err
+			}
+			lastID = email.id
+		}
+		if len(batch) < batchSize {
+			return nil
+		}
+	}
+}
+
+// Migrations 当前数据库可用的全部迁移，按版本号排序
+func Migrations(db *Database) ([]*Migration, error) {
+	dir := path.Join("migrations", db.Driver())
+	entries, err := migrationFiles.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		match := migrationFilePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("无效的迁移文件名: %s", entry.Name())
+		}
+		
+		version, _ := strconv.Atoi(match[1])
+		content, err := migrationFiles.ReadFile(path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2], upgrade: migrationUpgrades[db.Driver()][version]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("迁移版本 %d 重复: %s 和 %s", version, migration.Name, match[2])
+		}
+		
+		if match[3] == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+	
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("迁移 %04d_%s 缺少 up 或 down 脚本", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	
+	return migrations, nil
+}
+
+// ensureMigrationsTable 创建记录已应用迁移的表
+func ensureMigrationsTable(db *Database) error {
+	_, err := db.Exec(db.dialect.migrationsTable())
+	return err
+}
+
+// appliedMigrations 已应用的迁移版本及应用时间，迁移表不存在时视为没有应用任何迁移
+func appliedMigrations(db *Database) (map[int]time.Time, error) {
+	exists, err := db.dialect.tableExists(db, "schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	
+	applied := make(map[int]time.Time)
+	if !exists {
+		return applied, nil
+	}
+	
+	rows, err := db.Query("SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	
+	return applied, rows.Err()
+}
+
+// checkSchemaVersion 数据库版本高于程序内置的最新迁移时拒绝继续
+func checkSchemaVersion(migrations []*Migration, applied map[int]time.Time) (int, error) {
+	current, latest := 0, 0
+	for version := range applied {
+		if version > current {
+			current = version
+		}
+	}
+	if len(migrations) > 0 {
+		latest = migrations[len(migrations)-1].Version
+	}
+	
+	if current > latest {
+		return current, &SchemaTooNewError{Current: current, Latest: latest}
+	}
+	return current, nil
+}
+
+// GetMigrationStatus 获取全部迁移的应用情况和数据库当前的结构版本
+func GetMigrationStatus(db *Database) ([]MigrationStatus, int, error) {
+	migrations, err := Migrations(db)
+	if err != nil {
+		return nil, 0, err
+	}
+	
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, 0, err
+	}
+	
+	current, err := checkSchemaVersion(migrations, applied)
+	statuses := make([]MigrationStatus, len(migrations))
+	for i, migration := range migrations {
+		statuses[i].Migration = migration
+		if appliedAt, ok := applied[migration.Version]; ok {
+			statuses[i].AppliedAt = &appliedAt
+		}
+	}
+	
+	return statuses, current, err
+}
+
+// PendingMigrations 升级到 target 版本需要应用的迁移，target 为 0 时升级到最新版本
+func PendingMigrations(db *Database, target int) ([]*Migration, error) {
+	migrations, err := Migrations(db)
+	if err != nil {
+		return nil, err
+	}
+	
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := checkSchemaVersion(migrations, applied); err != nil {
+		return nil, err
+	}
+	
+	var pending []*Migration
+	for _, migration := range migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		if target > 0 && migration.Version > target {
+			break
+		}
+		pending = append(pending, migration)
+	}
+	
+	return pending, nil
+}
+
+// RollbackMigrations 回退到 target 版本需要撤销的迁移，按版本从新到旧排列
+func RollbackMigrations(db *Database, target int) ([]*Migration, error) {
+	migrations, err := Migrations(db)
+	if err != nil {
+		return nil, err
+	}
+	
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := checkSchemaVersion(migrations, applied); err != nil {
+		return nil, err
+	}
+	
+	var rollback []*Migration
+	for i := len(migrations) - 1; i >= 0; i-- {
+		migration := migrations[i]
+		if migration.Version <= target {
+			break
+		}
+		if _, ok := applied[migration.Version]; ok {
+			rollback = append(rollback, migration)
+		}
+	}
+	
+	return rollback, nil
+}
+
+// ApplyMigration 在一个事务中执行迁移并记录版本
+func ApplyMigration(db *Database, migration *Migration) error {
+	if err := ensureMigrationsTable(db); err != nil {
+		return err
+	}
+	
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	
+	if _, err := tx.Exec(migration.Up); err != nil {
+		return fmt.Errorf("执行迁移 %04d_%s 失败: %v", migration.Version, migration.Name, err)
+	}
+	if migration.upgrade != nil {
+		if err := migration.upgrade(tx); err != nil {
+			return fmt.Errorf("执行迁移 %04d_%s 失败: %v", migration.Version, migration.Name, err)
+		}
+	}
+	if _, err := tx.Exec(
+		"INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)",
+		migration.Version, migration.Name, time.Now(),
+	); err != nil {
+		return err
+	}
+	
+	return tx.Commit()
+}
+
+// RevertMigration 在一个事务中撤销迁移并删除版本记录
+func RevertMigration(db *Database, migration *Migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	
+	if _, err := tx.Exec(migration.Down); err != nil {
+		return fmt.Errorf("回退迁移 %04d_%s 失败: %v", migration.Version, migration.Name, err)
+	}
+	if _, err := tx.Exec("DELETE FROM schema_migrations WHERE version = ?", migration.Version); err != nil {
+		return err
+	}
+	
+	return tx.Commit()
+}
+
+// MigrationSQL 迁移将要执行的SQL，用于 dry-run 输出
+func MigrationSQL(migration *Migration, up bool) string {
+	var sb strings.Builder
+	if up {
+		fmt.Fprintf(&sb, "-- %04d_%s (up)\n", migration.Version, migration.Name)
+		sb.WriteString(strings.TrimSpace(migration.Up))
+		if migration.upgrade != nil {
+			sb.WriteString("\n-- 另外执行程序内置的升级步骤")
+		}
+		fmt.Fprintf(&sb, "\nINSERT INTO schema_migrations (version, name, applied_at) VALUES (%d, '%s', CURRENT_TIMESTAMP);\n", migration.Version, migration.Name)
+	} else {
+		fmt.Fprintf(&sb, "-- %04d_%s (down)\n", migration.Version, migration.Name)
+		sb.WriteString(strings.TrimSpace(migration.Down))
+		fmt.Fprintf(&sb, "\nDELETE FROM schema_migrations WHERE version = %d;\n", migration.Version)
+	}
+	return sb.String()
+}
+
+// MigrateUp 应用全部未执行的迁移，启动时调用；数据库版本比程序新时返回 SchemaTooNewError
+func MigrateUp(db *Database) error {
+	pending, err := PendingMigrations(db, 0)
+	if err != nil {
+		return err
+	}
+	
+	for _, migration := range pending {
+		if err := ApplyMigration(db, migration); err != nil {
+			return err
+		}
+		dbLog.Info("已应用数据库迁移 %04d_%s", migration.Version, migration.Name)
+	}
+	
+	return nil
+}
@@ -0,0 +1,24 @@
+-- 删除全部表，数据将全部丢失
+
+DROP TABLE IF EXISTS jwt_keys;
+DROP TABLE IF EXISTS user_roles;
+DROP TABLE IF EXISTS role_permissions;
+DROP TABLE IF EXISTS roles;
+DROP TABLE IF EXISTS webauthn_challenges;
+DROP TABLE IF EXISTS oidc_states;
+DROP TABLE IF EXISTS user_identities;
+DROP TABLE IF EXISTS login_throttles;
+DROP TABLE IF EXISTS account_tokens;
+DROP TABLE IF EXISTS app_passwords;
+DROP TABLE IF EXISTS personal_access_tokens;
+DROP TABLE IF EXISTS webauthn_credentials;
+DROP TABLE IF EXISTS presence_settings;
+DROP TABLE IF EXISTS notification_preferences;
+DROP TABLE IF EXISTS push_subscriptions;
+DROP TABLE IF EXISTS mfa_recovery_codes;
+DROP TABLE IF EXISTS user_mfa;
+DROP TABLE IF EXISTS retired_refresh_tokens;
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS attachments;
+DROP TABLE IF EXISTS emails;
+DROP TABLE IF EXISTS users;
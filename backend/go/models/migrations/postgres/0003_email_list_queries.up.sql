@@ -0,0 +1,6 @@
+-- 列表中显示的正文摘要，写入邮件时生成，列表查询不再读取完整正文
+ALTER TABLE emails ADD COLUMN preview TEXT NOT NULL DEFAULT '';
+
+-- 覆盖文件夹、未读数和管理后台按用户统计的条件，计数时不需要回表
+CREATE INDEX IF NOT EXISTS idx_emails_recipient_flags ON emails(recipient_id, is_deleted, is_draft, is_read);
+CREATE INDEX IF NOT EXISTS idx_emails_sender_flags ON emails(sender_id, is_deleted, is_draft);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_users_custom_domain;
+ALTER TABLE users DROP COLUMN custom_domain_verified;
@@ -0,0 +1,5 @@
+-- 用户自定义域名通过 DNS TXT 记录验证后才会为其申请证书，修改域名时重置
+ALTER TABLE users ADD COLUMN custom_domain_verified BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- TLS 握手时按 SNI 中的域名查找已验证的用户
+CREATE INDEX IF NOT EXISTS idx_users_custom_domain ON users(custom_domain);
@@ -0,0 +1,6 @@
+-- 服务端首次启动时生成的随机密钥（如CSRF令牌的HMAC密钥），多个实例共享同一个数据库时使用相同的密钥
+CREATE TABLE server_secrets (
+    name TEXT PRIMARY KEY,
+    value TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL
+);
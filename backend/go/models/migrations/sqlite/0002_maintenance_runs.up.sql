@@ -0,0 +1,8 @@
+-- 数据库维护任务最近一次的执行结果，重启后按上次执行时间继续调度
+CREATE TABLE maintenance_runs (
+    task TEXT PRIMARY KEY,
+    ran_at TIMESTAMP NOT NULL,
+    duration_ms INTEGER NOT NULL DEFAULT 0,
+    ok BOOLEAN NOT NULL DEFAULT 1,
+    result TEXT
+);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_emails_sender_flags;
+DROP INDEX IF EXISTS idx_emails_recipient_flags;
+ALTER TABLE emails DROP COLUMN preview;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_users_created;
+DROP INDEX IF EXISTS idx_emails_created;
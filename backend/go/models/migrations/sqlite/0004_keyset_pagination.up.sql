@@ -0,0 +1,3 @@
+-- 管理后台的邮件和用户列表按 (created_at, id) 倒序翻页
+CREATE INDEX IF NOT EXISTS idx_emails_created ON emails(created_at, id);
+CREATE INDEX IF NOT EXISTS idx_users_created ON users(created_at, id);
@@ -0,0 +1,123 @@
+package models
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidCursor 分页游标无法解析
+var ErrInvalidCursor = errors.New("无效的分页游标")
+
+// Cursor 键集分页的位置。列表按 (created_at, id) 倒序排列，
+// Before 为 false 时取游标之后（更旧）的记录，为 true 时取游标之前（更新）的记录
+type Cursor struct {
+	CreatedAt time.Time
+	ID        int
+	Before    bool
+}
+
+// Page 分页参数，Cursor 不为空时按游标分页并忽略 Offset
+type Page struct {
+	Limit  int
+	Offset int
+	Cursor *Cursor
+}
+
+// PageInfo 翻页用的游标，没有更多记录时为空
+type PageInfo struct {
+	NextCursor string
+	PrevCursor string
+}
+
+// EncodeCursor 把游标编码为不透明的字符串，时间保留原始时区，和数据库中保存的格式一致
+func EncodeCursor(c Cursor) string {
+	direction := "a"
+	if c.Before {
+		direction = "b"
+	}
+	raw := direction + "|" + c.CreatedAt.Format(time.RFC3339Nano) + "|" + strconv.Itoa(c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeCursor 解析 EncodeCursor 生成的游标
+func DecodeCursor(s string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	
+	parts := strings.Split(string(raw), "|")
+	if len(parts) != 3 || (parts[0] != "a" && parts[0] != "b") {
+		return nil, ErrInvalidCursor
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, parts[1])
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	id, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	
+	return &Cursor{CreatedAt: createdAt, ID: id, Before: parts[0] == "b"}, nil
+}
+
+// keyset 在 where 上追加游标条件，返回条件、参数和排序。prefix 为列名前缀，如 "e."。
+// 多查询一条记录用于判断是否还有下一页，结果交给 paginate 处理
+func (p Page) keyset(prefix, where string, args []interface{}) (string, []interface{}, string) {
+	createdAt, id := prefix+"created_at", prefix+"id"
+	order := createdAt + " DESC, " + id + " DESC"
+	offset := p.Offset
+	
+	if p.Cursor != nil {
+		offset = 0
+		if p.Cursor.Before {
+			where = "(" + where + ") AND (" + createdAt + ", " + id + ") > (?, ?)"
+			order = createdAt + " ASC, " + id + " ASC"
+		} else {
+			where = "(" + where + ") AND (" + createdAt + ", " + id + ") < (?, ?)"
+		}
+		args = append(args, p.Cursor.CreatedAt, p.Cursor.ID)
+	}
+	
+	return where, append(args, p.Limit+1, offset), order
+}
+
+// paginate 去掉 keyset 多查询的一条记录，向前翻页时恢复倒序，并生成前后两页的游标
+func paginate[T any](p Page, items []T, cursorOf func(T) Cursor) ([]T, *PageInfo) {
+	more := len(items) > p.Limit
+	if more {
+		items = items[:p.Limit]
+	}
+	
+	hasNext, hasPrev := more, p.Offset > 0
+	if p.Cursor != nil {
+		hasNext, hasPrev = true, true
+		if p.Cursor.Before {
+			for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+				items[i], items[j] = items[j], items[i]
+			}
+			hasPrev = more
+		} else {
+			hasNext = more
+		}
+	}
+	
+	info := &PageInfo{}
+	if len(items) == 0 {
+		return items, info
+	}
+	if hasNext {
+		info.NextCursor = EncodeCursor(cursorOf(items[len(items)-1]))
+	}
+	if hasPrev {
+		first := cursorOf(items[0])
+		first.Before = true
+		info.PrevCursor = EncodeCursor(first)
+	}
+	
+	return items, info
+}
@@ -0,0 +1,83 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+type PresenceSettings struct {
+	UserID        int       `json:"user_id"`
+	AppearOffline bool      `json:"appear_offline"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+func GetPresenceSettings(db *Database, userID int) (*PresenceSettings, error) {
+	var settings PresenceSettings
+	query := `SELECT user_id, appear_offline, updated_at FROM presence_settings WHERE user_id = ?`
+	
+	err := db.QueryRow(query, userID).Scan(&settings.UserID, &settings.AppearOffline, &settings.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return &PresenceSettings{UserID: userID}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	
+	return &settings, nil
+}
+
+func UpdatePresenceSettings(db *Database, settings *PresenceSettings) error {
+	query := `
+	INSERT INTO presence_settings (user_id, appear_offline, updated_at)
+	VALUES (?, ?, ?)
+	ON CONFLICT(user_id) DO UPDATE SET
+		appear_offline = excluded.appear_offline,
+		updated_at = excluded.updated_at
+	`
+	
+	_, err := db.Exec(query, settings.UserID, settings.AppearOffline, time.Now())
+	return err
+}
+
+// GetContactIDs 获取与用户有过邮件往来的联系人ID（草稿不算）
+func GetContactIDs(db *Database, userID int) ([]int, error) {
+	query := `
+	SELECT DISTINCT CASE WHEN sender_id = ? THEN recipient_id ELSE sender_id END
+	FROM emails
+	WHERE (sender_id = ? OR recipient_id = ?) AND is_draft = FALSE AND sender_id != recipient_id
+	`
+	
+	rows, err := db.Query(query, userID, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	
+	return ids, nil
+}
+
+// IsEmailBetweenUsers 检查邮件是否是两个用户之间的往来邮件，用于确认双方处于同一会话
+func IsEmailBetweenUsers(db *Database, emailID, userA, userB int) (bool, error) {
+	var count int
+	query := `
+	SELECT COUNT(*) FROM emails
+	WHERE id = ? AND is_draft = FALSE
+	AND ((sender_id = ? AND recipient_id = ?) OR (sender_id = ? AND recipient_id = ?))
+	`
+	
+	err := db.QueryRow(query, emailID, userA, userB, userB, userA).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	
+	return count > 0, nil
+}
@@ -0,0 +1,144 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+type PushSubscription struct {
+	ID         int       `json:"id"`
+	UserID     int       `json:"user_id"`
+	Endpoint   string    `json:"endpoint"`
+	P256dh     string    `json:"-"`
+	Auth       string    `json:"-"`
+	UserAgent  string    `json:"user_agent"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+}
+
+type NotificationPreferences struct {
+	UserID         int       `json:"user_id"`
+	PushEnabled    bool      `json:"push_enabled"`
+	NotifyNewEmail bool      `json:"notify_new_email"`
+	NotifySystem   bool      `json:"notify_system"`
+	ShowPreview    bool      `json:"show_preview"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// DefaultNotificationPreferences 用户未设置时使用的默认通知偏好
+func DefaultNotificationPreferences(userID int) *NotificationPreferences {
+	return &NotificationPreferences{
+		UserID:         userID,
+		PushEnabled:    true,
+		NotifyNewEmail: true,
+		NotifySystem:   true,
+		ShowPreview:    false,
+	}
+}
+
+// SavePushSubscription 保存推送订阅，同一 endpoint 重复订阅时更新密钥和所属用户
+func SavePushSubscription(db *Database, sub *PushSubscription) error {
+	query := `
+	INSERT INTO push_subscriptions (user_id, endpoint, p256dh, auth, user_agent, created_at, last_used_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT(endpoint) DO UPDATE SET
+		user_id = excluded.user_id,
+		p256dh = excluded.p256dh,
+		auth = excluded.auth,
+		user_agent = excluded.user_agent
+	`
+	
+	now := time.Now()
+	_, err := db.Exec(query,
+		sub.UserID, sub.Endpoint, sub.P256dh, sub.Auth, sub.UserAgent, now, now,
+	)
+	return err
+}
+
+func GetPushSubscriptionsByUser(db *Database, userID int) ([]*PushSubscription, error) {
+	query := `
+	SELECT id, user_id, endpoint, p256dh, auth, COALESCE(user_agent, ''), created_at, last_used_at
+	FROM push_subscriptions WHERE user_id = ?
+	ORDER BY created_at DESC
+	`
+	
+	rows, err := db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	
+	var subs []*PushSubscription
+	for rows.Next() {
+		var sub PushSubscription
+		err := rows.Scan(
+			&sub.ID, &sub.UserID, &sub.Endpoint, &sub.P256dh, &sub.Auth,
+			&sub.UserAgent, &sub.CreatedAt, &sub.LastUsedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, &sub)
+	}
+	
+	return subs, nil
+}
+
+func DeletePushSubscription(db *Database, userID int, endpoint string) error {
+	query := `DELETE FROM push_subscriptions WHERE user_id = ? AND endpoint = ?`
+	_, err := db.Exec(query, userID, endpoint)
+	return err
+}
+
+func DeletePushSubscriptionByID(db *Database, id int) error {
+	query := `DELETE FROM push_subscriptions WHERE id = ?`
+	_, err := db.Exec(query, id)
+	return err
+}
+
+func TouchPushSubscription(db *Database, id int) error {
+	query := `UPDATE push_subscriptions SET last_used_at = ? WHERE id = ?`
+	_, err := db.Exec(query, time.Now(), id)
+	return err
+}
+
+func GetNotificationPreferences(db *Database, userID int) (*NotificationPreferences, error) {
+	var prefs NotificationPreferences
+	query := `
+	SELECT user_id, push_enabled, notify_new_email, notify_system, show_preview, updated_at
+	FROM notification_preferences WHERE user_id = ?
+	`
+	
+	err := db.QueryRow(query, userID).Scan(
+		&prefs.UserID, &prefs.PushEnabled, &prefs.NotifyNewEmail,
+		&prefs.NotifySystem, &prefs.ShowPreview, &prefs.UpdatedAt,
+	)
+	
+	if err == sql.ErrNoRows {
+		return DefaultNotificationPreferences(userID), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	
+	return &prefs, nil
+}
+
+func UpdateNotificationPreferences(db *Database, prefs *NotificationPreferences) error {
+	query := `
+	INSERT INTO notification_preferences (user_id, push_enabled, notify_new_email, notify_system, show_preview, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?)
+	ON CONFLICT(user_id) DO UPDATE SET
+		push_enabled = excluded.push_enabled,
+		notify_new_email = excluded.notify_new_email,
+		notify_system = excluded.notify_system,
+		show_preview = excluded.show_preview,
+		updated_at = excluded.updated_at
+	`
+	
+	_, err := db.Exec(query,
+		prefs.UserID, prefs.PushEnabled, prefs.NotifyNewEmail,
+		prefs.NotifySystem, prefs.ShowPreview, time.Now(),
+	)
+	return err
+}
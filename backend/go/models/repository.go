@@ -0,0 +1,167 @@
+package models
+
+import "time"
+
+// handlers 通过下面的接口读写用户、邮件、附件和会话，SQL 只出现在 models 包中。
+// 现有实现使用标准SQL，SQLite 和 PostgreSQL 之间的差异由 dialect 处理
+
+// UserRepository 用户数据
+type UserRepository interface {
+	Create(username, email, passwordHash string) (int64, error)
+	GetByID(id int) (*User, error)
+	GetByEmail(email string) (*User, error)
+	GetByUsername(username string) (*User, error)
+	Update(user *User) error
+	UpdatePassword(userID int, passwordHash string) error
+	SetEmailVerified(userID int, verified bool) error
+	UpdateStorage(userID int, storageUsed int64) error
+	
+	// 自定义域名修改后需要重新验证，只为已验证的域名申请证书
+	UpdateCustomDomain(userID int, domain string) error
+	SetCustomDomainVerified(userID int, domain string) error
+	IsVerifiedCustomDomain(domain string) (bool, error)
+	
+	// Delete 删除用户及其邮件、附件、会话、推送订阅等数据，两步验证、令牌和角色等由各自的模型删除
+	Delete(id int) error
+	
+	// List 和 ListInDomains 按注册时间倒序分页
+	List(page Page) ([]*User, *PageInfo, error)
+	Count() (int, error)
+	ListInDomains(domains []string, page Page) ([]*User, *PageInfo, error)
+	CountInDomains(domains []string) (int, error)
+	AdminIDs() ([]int, error)
+	
+	// Totals 全站用户数量和存储空间合计
+	Totals() (*UserTotals, error)
+	CountCreatedSince(since time.Time) (int, error)
+}
+
+// EmailRepository 邮件数据，folder 为 inbox、sent、starred、drafts 或 trash，其他值按 inbox 处理。
+// ListByFolder、List 和 Search 按时间倒序分页，返回列表用的摘要：不含 Body，带 Preview 和收发件人名称
+type EmailRepository interface {
+	Create(email *Email) (int64, error)
+	GetByID(id int) (*Email, error)
+	GetByUUID(uuid string) (*Email, error)
+	ListByFolder(userID int, folder string, page Page) ([]*Email, *PageInfo, error)
+	CountByFolder(userID int, folder string) (int, error)
+	CountUnread(userID int) (int, error)
+	MarkAsRead(id int) error
+	ToggleStar(id int) error
+	UpdateFlags(id int, isDraft, isStarred bool) error
+	MoveToTrash(id int) error
+	DeletePermanently(id int) error
+	
+	// PurgeTrash 永久删除在回收站中超过 before 未修改的邮件，返回删除的数量
+	PurgeTrash(before time.Time) (int64, error)
+	
+	List(page Page) ([]*Email, *PageInfo, error)
+	Count() (int, error)
+	Search(keyword string, page Page) ([]*Email, *PageInfo, error)
+	CountSearch(keyword string) (int, error)
+	
+	// CountByUsers 一次统计多个用户发送和收到的邮件数量，不含回收站，每个用户都有对应的结果
+	CountByUsers(userIDs []int) (map[int]*UserEmailCounts, error)
+	
+	// Totals 全站邮件统计，Since 为 since 之后发送的邮件数
+	Totals(since time.Time) (*EmailTotals, error)
+	CountDeliveredSince(since time.Time) (int, error)
+	CountActiveUsersSince(since time.Time) (int, error)
+	
+	// Activity 用户 since 之后的收发统计
+	Activity(userID int, since time.Time) (*EmailActivity, error)
+	DailyActivity(userID int, since time.Time) ([]*EmailActivity, error)
+	HourlyActivity(userID int, since time.Time) ([]*EmailActivity, error)
+	TopContacts(userID int, since time.Time, limit int) ([]*ContactCount, error)
+	
+	// BodySizeByUser 用户邮件正文占用的空间，不含回收站
+	BodySizeByUser(userID int) (count int, size int64, err error)
+}
+
+// AttachmentRepository 附件数据
+type AttachmentRepository interface {
+	Create(attachment *Attachment) (int64, error)
+	GetByID(id int) (*Attachment, error)
+	GetByUUID(uuid string) (*Attachment, error)
+	ListByEmail(emailID int) ([]*Attachment, error)
+	Delete(id int) error
+	CountByUser(userID int) (int, error)
+	TotalSizeByUser(userID int) (int64, error)
+	
+	// Totals 全站附件数量和大小
+	Totals() (count int, size int64, err error)
+	
+	// ListRecentBySender 用户最近发送的附件，附带所属邮件的主题
+	ListRecentBySender(userID, limit int) ([]*SentAttachment, error)
+	
+	// DailySizeByUser 用户 since 之后每天新增的附件大小
+	DailySizeByUser(userID int, since time.Time) ([]*DailySize, error)
+}
+
+// SessionRepository 登录会话数据
+type SessionRepository interface {
+	Create(session *Session) (int64, error)
+	GetByID(id int) (*Session, error)
+	GetByTokenHash(tokenHash string) (*Session, error)
+	GetByRetiredToken(tokenHash string) (*Session, time.Time, error)
+	RotateToken(sessionID int, oldHash, newHash, ipAddress, userAgent string) error
+	Validate(sessionID, userID int) (bool, error)
+	Touch(sessionID int) error
+	Revoke(sessionID int) error
+	RevokeForUser(userID, sessionID int) error
+	RevokeAllForUser(userID int) (int64, error)
+	RevokeAll(exceptSessionID int) (int64, error)
+	ListActiveByUser(userID int) ([]*Session, error)
+	DeleteExpired(retention time.Duration) (int64, error)
+	
+	// LastLoginAt 用户最近一次登录（创建仍有效的会话）的时间
+	LastLoginAt(userID int) (time.Time, error)
+}
+
+// UserTotals 全站用户统计
+type UserTotals struct {
+	Total           int
+	Active          int
+	Admins          int
+	StorageUsed     int64
+	StorageCapacity int64
+}
+
+// EmailTotals 全站邮件统计，均不含回收站中的邮件
+type EmailTotals struct {
+	Total  int
+	Unread int
+	Since  int
+}
+
+// UserEmailCounts 用户发送和收到的邮件数量
+type UserEmailCounts struct {
+	Sent     int
+	Received int
+}
+
+// EmailActivity 一段时间内的收发数量，按天或按小时统计时 Date 或 Hour 为分组的值
+type EmailActivity struct {
+	Date     string
+	Hour     int
+	Sent     int
+	Received int
+	Read     int
+}
+
+// ContactCount 和某个联系人往来的邮件数量
+type ContactCount struct {
+	Email string
+	Count int
+}
+
+// SentAttachment 用户发送的附件
+type SentAttachment struct {
+	Attachment
+	EmailSubject string
+}
+
+// DailySize 某一天新增的数据大小
+type DailySize struct {
+	Date string
+	Size int64
+}
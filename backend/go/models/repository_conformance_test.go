@@ -0,0 +1,798 @@
+package models
+
+import (
+	"database/sql"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// postgresDSNEnv 设置后同时对 PostgreSQL 运行仓库一致性测试，数据库中的 public schema 会被清空
+const postgresDSNEnv = "SWIFTPOST_TEST_POSTGRES_DSN"
+
+// repositoryBackend 一致性测试使用的数据库后端，open 每次返回一个刚迁移好的空库
+type repositoryBackend struct {
+	name string
+	open func(t *testing.T) *Database
+}
+
+func repositoryBackends() []repositoryBackend {
+	backends := []repositoryBackend{{
+		name: DriverSQLite,
+		open: func(t *testing.T) *Database {
+			return newTestDB(t, newTestConfig(t))
+		},
+	}}
+	
+	dsn := os.Getenv(postgresDSNEnv)
+	if dsn == "" {
+		return backends
+	}
+	return append(backends, repositoryBackend{
+		name: DriverPostgres,
+		open: func(t *testing.T) *Database {
+			t.Helper()
+			config := newTestConfig(t)
+			config.Database.Driver = DriverPostgres
+			config.Database.DSN = dsn
+			
+			db, err := OpenDatabase(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, statement := range []string{"DROP SCHEMA public CASCADE", "CREATE SCHEMA public"} {
+				if _, err := db.Exec(statement); err != nil {
+					db.Close()
+					t.Fatalf("清空 PostgreSQL 测试库失败: %v", err)
+				}
+			}
+			db.Close()
+			
+			return newTestDB(t, config)
+		},
+	})
+}
+
+// repositoryCases 每个用例在两个后端上用同样的数据运行，断言的结果也必须一致
+var repositoryCases = []struct {
+	name string
+	run  func(t *testing.T, db *Database)
+}{
+	{"UserCRUD", testUserCRUD},
+	{"UserCustomDomain", testUserCustomDomain},
+	{"UserDeleteCascade", testUserDeleteCascade},
+	{"EmailFolders", testEmailFolders},
+	{"EmailFlags", testEmailFlags},
+	{"EmailTrash", testEmailTrash},
+	{"EmailSearch", testEmailSearch},
+	{"EmailCursorPagination", testEmailCursorPagination},
+	{"EmailStats", testEmailStats},
+	{"Attachments", testAttachments},
+	{"Sessions", testSessions},
+}
+
+func TestRepositoryConformance(t *testing.T) {
+	backends := repositoryBackends()
+	if len(backends) == 1 {
+		t.Logf("未设置 %s，只测试 SQLite", postgresDSNEnv)
+	}
+	
+	for _, backend := range backends {
+		for _, tc := range repositoryCases {
+			t.Run(backend.name+"/"+tc.name, func(t *testing.T) {
+				tc.run(t, backend.open(t))
+			})
+		}
+	}
+}
+
+func mustCreateUser(t *testing.T, db *Database, username string) int {
+	t.Helper()
+	id, err := db.Users().Create(username, username+"@example.com", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return int(id)
+}
+
+func mustSendEmail(t *testing.T, db *Database, from, to int, subject, body string) int {
+	t.Helper()
+	sender, err := db.Users().GetByID(from)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipient, err := db.Users().GetByID(to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := db.Emails().Create(&Email{
+		SenderID: from, RecipientID: to,
+		SenderEmail: sender.Email, RecipientEmail: recipient.Email,
+		Subject: subject, Body: body,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return int(id)
+}
+
+func emailIDs(emails []*Email) []int {
+	ids := make([]int, len(emails))
+	for i, email := range emails {
+		ids[i] = email.ID
+	}
+	return ids
+}
+
+func equalIDs(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func testUserCRUD(t *testing.T, db *Database) {
+	alice := mustCreateUser(t, db, "alice")
+	bob := mustCreateUser(t, db, "bob")
+	if alice == bob {
+		t.Fatalf("两个用户的ID相同: %d", alice)
+	}
+	if _, err := db.Users().Create("alice", "other@example.com", "hash"); err == nil {
+		t.Fatal("重复的用户名应当创建失败")
+	}
+	
+	user, err := db.Users().GetByEmail("alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != alice || user.Username != "alice" || !user.IsActive || user.IsAdmin {
+		t.Fatalf("读取的用户不正确: %+v", user)
+	}
+	if _, err := db.Users().GetByUsername("nobody"); err != sql.ErrNoRows {
+		t.Fatalf("不存在的用户应返回 sql.ErrNoRows，实际为 %v", err)
+	}
+	
+	user.IsAdmin = true
+	user.StorageUsed = 1234
+	if err := db.Users().Update(user); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Users().SetEmailVerified(alice, true); err != nil {
+		t.Fatal(err)
+	}
+	user, err = db.Users().GetByID(alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !user.IsAdmin || user.StorageUsed != 1234 || !user.EmailVerified {
+		t.Fatalf("用户更新没有生效: %+v", user)
+	}
+	
+	admins, err := db.Users().AdminIDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalIDs(admins, []int{alice}) {
+		t.Fatalf("管理员列表应为 [%d]，实际为 %v", alice, admins)
+	}
+	
+	count, err := db.Users().Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	users, _, err := db.Users().List(Page{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 || len(users) != 2 || users[0].ID != bob {
+		t.Fatalf("用户列表应按注册时间倒序包含两个用户，实际 count=%d users=%v", count, users)
+	}
+}
+
+func testUserCustomDomain(t *testing.T, db *Database) {
+	alice := mustCreateUser(t, db, "alice")
+	mustCreateUser(t, db, "bob")
+	
+	if err := db.Users().UpdateCustomDomain(alice, " Mail.Example.ORG. "); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := db.Users().IsVerifiedCustomDomain("mail.example.org"); err != nil || ok {
+		t.Fatalf("未验证的域名不应通过: ok=%v err=%v", ok, err)
+	}
+	if err := db.Users().SetCustomDomainVerified(alice, "mail.example.org"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := db.Users().IsVerifiedCustomDomain("MAIL.example.org"); err != nil || !ok {
+		t.Fatalf("已验证的域名应通过: ok=%v err=%v", ok, err)
+	}
+	
+	carol, err := db.Users().Create("carol", "Carol@Corp.Example", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	users, _, err := db.Users().ListInDomains([]string{"corp.example", "other.example"}, Page{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	count, err := db.Users().CountInDomains([]string{"corp.example"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || users[0].ID != int(carol) || count != 1 {
+		t.Fatalf("按邮箱域名筛选应只返回 carol，实际 users=%v count=%d", users, count)
+	}
+	if count, err := db.Users().CountInDomains(nil); err != nil || count != 0 {
+		t.Fatalf("空域名列表应返回 0: count=%d err=%v", count, err)
+	}
+	
+	user, err := db.Users().GetByID(alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user.CustomDomain = "new.example.org"
+	if err := db.Users().Update(user); err != nil {
+		t.Fatal(err)
+	}
+	user, err = db.Users().GetByID(alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.CustomDomain != "new.example.org" || user.CustomDomainVerified {
+		t.Fatalf("更换域名后应重新验证: %+v", user)
+	}
+	
+	if err := db.Users().SetCustomDomainVerified(alice, "new.example.org"); err != nil {
+		t.Fatal(err)
+	}
+	user.IsActive = false
+	if err := db.Users().Update(user); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := db.Users().IsVerifiedCustomDomain("new.example.org"); err != nil || ok {
+		t.Fatalf("禁用用户的域名不应通过: ok=%v err=%v", ok, err)
+	}
+}
+
+func testUserDeleteCascade(t *testing.T, db *Database) {
+	alice := mustCreateUser(t, db, "alice")
+	bob := mustCreateUser(t, db, "bob")
+	emailID := mustSendEmail(t, db, alice, bob, "hello", "body")
+	kept := mustSendEmail(t, db, bob, bob, "note", "body")
+	if _, err := db.Attachments().Create(&Attachment{EmailID: emailID, UUID: "a-1", Filename: "a.txt", Filepath: "a-1", FileSize: 10, MimeType: "text/plain"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Sessions().Create(&Session{UserID: alice, TokenHash: "alice-token", ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	seedUserCredentials(t, db, alice)
+	seedUserCredentials(t, db, bob)
+	
+	if err := db.Users().Delete(alice); err != nil {
+		t.Fatal(err)
+	}
+	
+	if _, err := db.Users().GetByID(alice); err != sql.ErrNoRows {
+		t.Fatalf("用户应已删除，实际为 %v", err)
+	}
+	if _, err := db.Emails().GetByID(emailID); err != sql.ErrNoRows {
+		t.Fatalf("用户的邮件应已删除，实际为 %v", err)
+	}
+	if _, err := db.Emails().GetByID(kept); err != nil {
+		t.Fatalf("其他用户的邮件不应删除: %v", err)
+	}
+	if count, _, err := db.Attachments().Totals(); err != nil || count != 0 {
+		t.Fatalf("附件应已删除: count=%d err=%v", count, err)
+	}
+	if _, err := db.Sessions().GetByTokenHash("alice-token"); err != sql.ErrNoRows {
+		t.Fatalf("会话应已删除，实际为 %v", err)
+	}
+	for _, table := range userCredentialTables {
+		if n := countUserRows(t, db, table, alice); n != 0 {
+			t.Errorf("%s 中仍有 %d 行属于已删除的用户", table, n)
+		}
+		if n := countUserRows(t, db, table, bob); n == 0 {
+			t.Errorf("%s 中其他用户的数据不应删除", table)
+		}
+	}
+}
+
+// userCredentialTables 保存用户登录凭据和权限的表，删除用户时都要清理
+var userCredentialTables = []string{
+	"user_mfa", "mfa_recovery_codes", "webauthn_credentials", "personal_access_tokens",
+	"app_passwords", "account_tokens", "user_identities", "user_roles",
+}
+
+// seedUserCredentials 为用户写入两步验证、安全密钥、访问令牌、应用专用密码、账号令牌、外部身份和角色
+func seedUserCredentials(t *testing.T, db *Database, userID int) {
+	t.Helper()
+	suffix := strconv.Itoa(userID)
+	roles, err := GetRoles(db)
+	if err != nil || len(roles) == 0 {
+		t.Fatalf("没有可分配的角色: %v", err)
+	}
+	
+	steps := []error{
+		SavePendingTOTPSecret(db, userID, "secret-"+suffix),
+		EnableTOTP(db, userID, 1),
+		ReplaceRecoveryCodes(db, userID, []string{"code-" + suffix}),
+		CreateAccountToken(db, "token-"+suffix, userID, AccountTokenPasswordReset, suffix+"@example.com", time.Now().Add(time.Hour)),
+		SetUserRoles(db, userID, []UserRole{{RoleID: roles[0].ID}}),
+	}
+	_, err = CreateWebAuthnCredential(db, &WebAuthnCredential{UserID: userID, CredentialID: []byte("cred-" + suffix), PublicKey: []byte("key"), Name: "key"})
+	steps = append(steps, err)
+	_, err = CreatePersonalAccessToken(db, &PersonalAccessToken{UserID: userID, Name: "ci", TokenHash: "pat-" + suffix, Prefix: "sp_" + suffix, Scopes: []string{ScopeMailRead}})
+	steps = append(steps, err)
+	_, err = CreateAppPassword(db, userID, "mail", "app-"+suffix)
+	steps = append(steps, err)
+	_, err = CreateUserIdentity(db, userID, "https://idp.example.com", "subject-"+suffix, suffix+"@example.com")
+	steps = append(steps, err)
+	for _, err := range steps {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func countUserRows(t *testing.T, db *Database, table string, userID int) int {
+	t.Helper()
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM "+table+" WHERE user_id = ?", userID).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func testEmailFolders(t *testing.T, db *Database) {
+	alice := mustCreateUser(t, db, "alice")
+	bob := mustCreateUser(t, db, "bob")
+	received := mustSendEmail(t, db, bob, alice, "to alice", "<p>Hello <b>Alice</b></p>")
+	sent := mustSendEmail(t, db, alice, bob, "to bob", "hi")
+	draft, err := db.Emails().Create(&Email{
+		SenderID: alice, RecipientID: bob,
+		SenderEmail: "alice@example.com", RecipientEmail: "bob@example.com",
+		Subject: "draft", Body: "later", IsDraft: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	
+	email, err := db.Emails().GetByID(received)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if email.UUID == "" || email.Preview != "Hello Alice" || email.IsRead || email.IsStarred {
+		t.Fatalf("新邮件的字段不正确: %+v", email)
+	}
+	if byUUID, err := db.Emails().GetByUUID(email.UUID); err != nil || byUUID.ID != received {
+		t.Fatalf("按UUID读取失败: %v %v", byUUID, err)
+	}
+	
+	folders := map[string][]int{
+		"inbox":  {received},
+		"sent":   {sent},
+		"drafts": {int(draft)},
+		"trash":  {},
+	}
+	for folder, want := range folders {
+		emails, _, err := db.Emails().ListByFolder(alice, folder, Page{Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := emailIDs(emails); !equalIDs(got, want) {
+			t.Errorf("%s 应为 %v，实际为 %v", folder, want, got)
+		}
+		count, err := db.Emails().CountByFolder(alice, folder)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != len(want) {
+			t.Errorf("%s 数量应为 %d，实际为 %d", folder, len(want), count)
+		}
+	}
+	
+	emails, _, err := db.Emails().ListByFolder(alice, "inbox", Page{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if emails[0].SenderName != "bob" || emails[0].RecipientName != "alice" || emails[0].Body != "" {
+		t.Fatalf("列表中的邮件摘要不正确: %+v", emails[0])
+	}
+}
+
+func testEmailFlags(t *testing.T, db *Database) {
+	alice := mustCreateUser(t, db, "alice")
+	bob := mustCreateUser(t, db, "bob")
+	first := mustSendEmail(t, db, bob, alice, "one", "body")
+	mustSendEmail(t, db, bob, alice, "two", "body")
+	
+	if unread, err := db.Emails().CountUnread(alice); err != nil || unread != 2 {
+		t.Fatalf("未读数应为 2: unread=%d err=%v", unread, err)
+	}
+	if err := db.Emails().MarkAsRead(first); err != nil {
+		t.Fatal(err)
+	}
+	if unread, err := db.Emails().CountUnread(alice); err != nil || unread != 1 {
+		t.Fatalf("标记已读后未读数应为 1: unread=%d err=%v", unread, err)
+	}
+	
+	if err := db.Emails().ToggleStar(first); err != nil {
+		t.Fatal(err)
+	}
+	starred, _, err := db.Emails().ListByFolder(bob, "starred", Page{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalIDs(emailIDs(starred), []int{first}) {
+		t.Fatalf("星标邮件对收发双方都可见，实际为 %v", emailIDs(starred))
+	}
+	if err := db.Emails().ToggleStar(first); err != nil {
+		t.Fatal(err)
+	}
+	
+	if err := db.Emails().UpdateFlags(first, true, true); err != nil {
+		t.Fatal(err)
+	}
+	email, err := db.Emails().GetByID(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !email.IsRead || !email.IsDraft || !email.IsStarred {
+		t.Fatalf("标志更新没有生效: %+v", email)
+	}
+}
+
+func testEmailTrash(t *testing.T, db *Database) {
+	alice := mustCreateUser(t, db, "alice")
+	bob := mustCreateUser(t, db, "bob")
+	old := mustSendEmail(t, db, bob, alice, "old", "body")
+	recent := mustSendEmail(t, db, bob, alice, "recent", "body")
+	gone := mustSendEmail(t, db, bob, alice, "gone", "body")
+	if _, err := db.Attachments().Create(&Attachment{EmailID: gone, UUID: "g-1", Filename: "g.txt", Filepath: "g-1", FileSize: 1, MimeType: "text/plain"}); err != nil {
+		t.Fatal(err)
+	}
+	
+	for _, id := range []int{old, recent} {
+		if err := db.Emails().MoveToTrash(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.Exec("UPDATE emails SET updated_at = ? WHERE id = ?", time.Now().Add(-48*time.Hour), old); err != nil {
+		t.Fatal(err)
+	}
+	trash, _, err := db.Emails().ListByFolder(alice, "trash", Page{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalIDs(emailIDs(trash), []int{recent, old}) {
+		t.Fatalf("回收站应为 [%d %d]，实际为 %v", recent, old, emailIDs(trash))
+	}
+	
+	purged, err := db.Emails().PurgeTrash(time.Now().Add(-24 * time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if purged != 1 {
+		t.Fatalf("应清理 1 封过期邮件，实际为 %d", purged)
+	}
+	if _, err := db.Emails().GetByID(old); err != sql.ErrNoRows {
+		t.Fatalf("过期的回收站邮件应已删除，实际为 %v", err)
+	}
+	if _, err := db.Emails().GetByID(recent); err != nil {
+		t.Fatalf("未过期的回收站邮件不应删除: %v", err)
+	}
+	
+	if err := db.Emails().DeletePermanently(gone); err != nil {
+		t.Fatal(err)
+	}
+	if count, _, err := db.Attachments().Totals(); err != nil || count != 0 {
+		t.Fatalf("彻底删除邮件时应删除附件: count=%d err=%v", count, err)
+	}
+}
+
+func testEmailSearch(t *testing.T, db *Database) {
+	alice := mustCreateUser(t, db, "alice")
+	bob := mustCreateUser(t, db, "bob")
+	bySubject := mustSendEmail(t, db, alice, bob, "Quarterly REPORT", "numbers")
+	byBody := mustSendEmail(t, db, bob, alice, "misc", "see the report attached")
+	trashed := mustSendEmail(t, db, bob, alice, "report draft", "old")
+	mustSendEmail(t, db, bob, alice, "lunch", "noon?")
+	if err := db.Emails().MoveToTrash(trashed); err != nil {
+		t.Fatal(err)
+	}
+	
+	emails, _, err := db.Emails().Search("report", Page{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalIDs(emailIDs(emails), []int{byBody, bySubject}) {
+		t.Fatalf("搜索结果应为 [%d %d]，实际为 %v", byBody, bySubject, emailIDs(emails))
+	}
+	if count, err := db.Emails().CountSearch("REPORT"); err != nil || count != 2 {
+		t.Fatalf("搜索计数应为 2: count=%d err=%v", count, err)
+	}
+	if count, err := db.Emails().CountSearch("bob@example"); err != nil || count != 3 {
+		t.Fatalf("按邮箱地址搜索应为 3: count=%d err=%v", count, err)
+	}
+}
+
+func testEmailCursorPagination(t *testing.T, db *Database) {
+	alice := mustCreateUser(t, db, "alice")
+	bob := mustCreateUser(t, db, "bob")
+	var want []int
+	for i := 0; i < 5; i++ {
+		want = append([]int{mustSendEmail(t, db, bob, alice, "page", "body")}, want...)
+	}
+	
+	var got []int
+	page := Page{Limit: 2}
+	var prev string
+	for {
+		emails, info, err := db.Emails().ListByFolder(alice, "inbox", page)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, emailIDs(emails)...)
+		prev = info.PrevCursor
+		if info.NextCursor == "" {
+			break
+		}
+		if page.Cursor, err = DecodeCursor(info.NextCursor); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !equalIDs(got, want) {
+		t.Fatalf("按游标翻页应为 %v，实际为 %v", want, got)
+	}
+	
+	cursor, err := DecodeCursor(prev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	emails, info, err := db.Emails().ListByFolder(alice, "inbox", Page{Limit: 2, Cursor: cursor})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalIDs(emailIDs(emails), want[2:4]) || info.PrevCursor == "" || info.NextCursor == "" {
+		t.Fatalf("向前翻页应为 %v，实际为 %v (%+v)", want[2:4], emailIDs(emails), info)
+	}
+	
+	emails, _, err = db.Emails().ListByFolder(alice, "inbox", Page{Limit: 2, Offset: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalIDs(emailIDs(emails), want[3:]) {
+		t.Fatalf("按偏移翻页应为 %v，实际为 %v", want[3:], emailIDs(emails))
+	}
+}
+
+func testEmailStats(t *testing.T, db *Database) {
+	alice := mustCreateUser(t, db, "alice")
+	bob := mustCreateUser(t, db, "bob")
+	carol := mustCreateUser(t, db, "carol")
+	read := mustSendEmail(t, db, bob, alice, "one", "12345")
+	mustSendEmail(t, db, bob, alice, "two", "12345")
+	mustSendEmail(t, db, alice, bob, "three", "12345")
+	if err := db.Emails().MarkAsRead(read); err != nil {
+		t.Fatal(err)
+	}
+	
+	counts, err := db.Emails().CountByUsers([]int{alice, bob, carol})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *counts[alice] != (UserEmailCounts{Sent: 1, Received: 2}) || *counts[bob] != (UserEmailCounts{Sent: 2, Received: 1}) || *counts[carol] != (UserEmailCounts{}) {
+		t.Fatalf("收发统计不正确: alice=%+v bob=%+v carol=%+v", *counts[alice], *counts[bob], *counts[carol])
+	}
+	
+	since := time.Now().Add(-time.Hour)
+	daily, err := db.Emails().DailyActivity(alice, since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(daily) == 0 || len(daily[len(daily)-1].Date) != len("2006-01-02") {
+		t.Fatalf("按天统计的日期格式不正确: %+v", daily)
+	}
+	hourly, err := db.Emails().HourlyActivity(alice, since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sent, received, readCount int
+	for _, activity := range hourly {
+		if activity.Hour < 0 || activity.Hour > 23 {
+			t.Fatalf("小时超出范围: %+v", activity)
+		}
+		sent += activity.Sent
+		received += activity.Received
+		readCount += activity.Read
+	}
+	if sent != 1 || received != 2 || readCount != 1 {
+		t.Fatalf("按小时统计应为 1/2/1，实际为 %d/%d/%d", sent, received, readCount)
+	}
+	
+	count, size, err := db.Emails().BodySizeByUser(alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 || size != 15 {
+		t.Fatalf("正文统计应为 3 封 15 字节，实际为 %d 封 %d 字节", count, size)
+	}
+}
+
+func testAttachments(t *testing.T, db *Database) {
+	alice := mustCreateUser(t, db, "alice")
+	bob := mustCreateUser(t, db, "bob")
+	emailID := mustSendEmail(t, db, alice, bob, "files", "see attached")
+	
+	var ids []int
+	for _, uuid := range []string{"att-1", "att-2"} {
+		id, err := db.Attachments().Create(&Attachment{
+			EmailID: emailID, UUID: uuid, Filename: uuid + ".pdf",
+			Filepath: uuid, FileSize: 100, MimeType: "application/pdf",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, int(id))
+	}
+	
+	attachment, err := db.Attachments().GetByUUID("att-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attachment.ID != ids[1] || attachment.EmailID != emailID || attachment.FileSize != 100 {
+		t.Fatalf("读取的附件不正确: %+v", attachment)
+	}
+	if list, err := db.Attachments().ListByEmail(emailID); err != nil || len(list) != 2 {
+		t.Fatalf("邮件应有 2 个附件: %v %v", list, err)
+	}
+	
+	for _, userID := range []int{alice, bob} {
+		count, err := db.Attachments().CountByUser(userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		size, err := db.Attachments().TotalSizeByUser(userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != 2 || size != 200 {
+			t.Fatalf("用户 %d 的附件统计应为 2 个 200 字节，实际为 %d 个 %d 字节", userID, count, size)
+		}
+	}
+	
+	recent, err := db.Attachments().ListRecentBySender(alice, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recent) != 2 || recent[0].EmailSubject != "files" {
+		t.Fatalf("最近发送的附件不正确: %+v", recent)
+	}
+	if recent, err := db.Attachments().ListRecentBySender(bob, 10); err != nil || len(recent) != 0 {
+		t.Fatalf("bob 没有发送附件: %v %v", recent, err)
+	}
+	
+	sizes, err := db.Attachments().DailySizeByUser(bob, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var total int64
+	for _, size := range sizes {
+		total += size.Size
+	}
+	if total != 200 {
+		t.Fatalf("按天统计的附件大小应为 200，实际为 %d", total)
+	}
+	
+	if err := db.Attachments().Delete(ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	if count, size, err := db.Attachments().Totals(); err != nil || count != 1 || size != 100 {
+		t.Fatalf("删除后应剩 1 个附件: count=%d size=%d err=%v", count, size, err)
+	}
+}
+
+func testSessions(t *testing.T, db *Database) {
+	alice := mustCreateUser(t, db, "alice")
+	bob := mustCreateUser(t, db, "bob")
+	expires := time.Now().Add(time.Hour)
+	
+	id, err := db.Sessions().Create(&Session{UserID: alice, TokenHash: "t1", IPAddress: "10.0.0.1", UserAgent: "test", ExpiresAt: expires})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessionID := int(id)
+	other, err := db.Sessions().Create(&Session{UserID: alice, TokenHash: "t2", ExpiresAt: expires})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bobSession, err := db.Sessions().Create(&Session{UserID: bob, TokenHash: "t3", ExpiresAt: expires})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Sessions().Create(&Session{UserID: bob, TokenHash: "expired", ExpiresAt: time.Now().Add(-time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	
+	if isAdmin, err := db.Sessions().Validate(sessionID, alice); err != nil || isAdmin {
+		t.Fatalf("会话应有效: isAdmin=%v err=%v", isAdmin, err)
+	}
+	if _, err := db.Sessions().Validate(sessionID, bob); err != sql.ErrNoRows {
+		t.Fatalf("会话不属于 bob，实际为 %v", err)
+	}
+	
+	if err := db.Sessions().RotateToken(sessionID, "t1", "t1b", "10.0.0.2", "test2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Sessions().RotateToken(sessionID, "t1", "t1c", "10.0.0.2", "test2"); err != ErrRefreshTokenReused {
+		t.Fatalf("重复轮换应返回 ErrRefreshTokenReused，实际为 %v", err)
+	}
+	if session, retiredAt, err := db.Sessions().GetByRetiredToken("t1"); err != nil || session.ID != sessionID || time.Since(retiredAt) > time.Minute {
+		t.Fatalf("应能通过旧令牌找到会话: %v %v %v", session, retiredAt, err)
+	}
+	session, err := db.Sessions().GetByTokenHash("t1b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.IPAddress != "10.0.0.2" || session.UserAgent != "test2" || session.RevokedAt != nil {
+		t.Fatalf("轮换后的会话不正确: %+v", session)
+	}
+	
+	active, err := db.Sessions().ListActiveByUser(bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(active) != 1 || active[0].ID != int(bobSession) {
+		t.Fatalf("bob 应只有 1 个有效会话: %+v", active)
+	}
+	
+	if err := db.Sessions().RevokeForUser(bob, sessionID); err != sql.ErrNoRows {
+		t.Fatalf("不能撤销其他用户的会话，实际为 %v", err)
+	}
+	if err := db.Sessions().Revoke(int(other)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Sessions().Validate(int(other), alice); err != sql.ErrNoRows {
+		t.Fatalf("已撤销的会话不应有效，实际为 %v", err)
+	}
+	revoked, err := db.Sessions().RevokeAll(sessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revoked != 2 {
+		t.Fatalf("应撤销除当前会话外的 2 个会话，实际为 %d", revoked)
+	}
+	if revoked, err := db.Sessions().RevokeAllForUser(alice); err != nil || revoked != 1 {
+		t.Fatalf("应撤销 alice 剩下的 1 个会话: revoked=%d err=%v", revoked, err)
+	}
+	
+	deleted, err := db.Sessions().DeleteExpired(-time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 4 {
+		t.Fatalf("应清理 4 个已撤销或过期的会话，实际为 %d", deleted)
+	}
+	if _, _, err := db.Sessions().GetByRetiredToken("t1"); err != sql.ErrNoRows {
+		t.Fatalf("清理会话时应删除旧令牌记录，实际为 %v", err)
+	}
+}
+
+func TestPostgresRebind(t *testing.T) {
+	cases := map[string]string{
+		"SELECT 1":                                   "SELECT 1",
+		"SELECT * FROM t WHERE a = ? AND b = ?":      "SELECT * FROM t WHERE a = $1 AND b = $2",
+		"SELECT '?' FROM t WHERE a = ?":              "SELECT '?' FROM t WHERE a = $1",
+		`SELECT "col?" FROM t WHERE a IN (?, ?, ?)`: `SELECT "col?" FROM t WHERE a IN ($1, $2, $3)`,
+	}
+	for query, want := range cases {
+		if got := (postgresDialect{}).rebind(query); got != want {
+			t.Errorf("rebind(%q) = %q，应为 %q", query, got, want)
+		}
+	}
+}
@@ -0,0 +1,452 @@
+package models
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 后台权限，角色由若干权限组成；超级管理员（users.is_admin）拥有全部权限
+const (
+	PermissionAll          = "*"
+	PermUsersRead          = "users:read"
+	PermUsersWrite         = "users:write"
+	PermUsersDelete        = "users:delete"
+	PermUsersResetPassword = "users:reset_password"
+	PermMailReadAll        = "mail:read_all"
+	PermStatsRead          = "stats:read"
+	PermNotificationsSend  = "notifications:send"
+	PermSystemManage       = "system:manage"
+	PermRolesManage        = "roles:manage"
+)
+
+// ValidPermissions 可以分配给角色的全部权限
+var ValidPermissions = []string{
+	PermUsersRead,
+	PermUsersWrite,
+	PermUsersDelete,
+	PermUsersResetPassword,
+	PermMailReadAll,
+	PermStatsRead,
+	PermNotificationsSend,
+	PermSystemManage,
+	PermRolesManage,
+}
+
+// 内置角色
+const (
+	RoleSupportAgent = "support_agent"
+	RoleAuditor      = "auditor"
+	RoleDomainAdmin  = "domain_admin"
+)
+
+// builtinRoles 启动时写入数据库的内置角色，内置角色不能修改或删除
+var builtinRoles = []Role{
+	{
+		Name:        RoleSupportAgent,
+		Description: "客服：查看用户、重置密码和两步验证、解除登录锁定，不能阅读邮件",
+		Permissions: []string{PermUsersRead, PermUsersResetPassword},
+	},
+	{
+		Name:        RoleAuditor,
+		Description: "审计员：只读查看系统统计",
+		Permissions: []string{PermStatsRead},
+	},
+	{
+		Name:        RoleDomainAdmin,
+		Description: "域管理员：管理指定域名下的用户，分配时需要指定域名",
+		Permissions: []string{PermUsersRead, PermUsersWrite, PermUsersDelete, PermUsersResetPassword},
+	},
+}
+
+// ErrBuiltinRole 内置角色不能修改或删除
+var ErrBuiltinRole = errors.New("内置角色不能修改或删除")
+
+// Role 角色及其包含的权限
+type Role struct {
+	ID          int       `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Builtin     bool      `json:"builtin"`
+	Permissions []string  `json:"permissions"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// UserRole 用户被分配的角色，Domain 不为空时角色的权限只对该域名下的用户生效
+type UserRole struct {
+	RoleID   int    `json:"role_id"`
+	RoleName string `json:"role"`
+	Domain   string `json:"domain,omitempty"`
+}
+
+// ValidPermission 是否是可以分配给角色的权限
+func ValidPermission(permission string) bool {
+	for _, p := range ValidPermissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// DomainScopedPermission 是否可以按域名授予，只有管理用户的权限可以限定域名，其余权限作用于全局
+func DomainScopedPermission(permission string) bool {
+	return strings.HasPrefix(permission, "users:")
+}
+
+// EmailDomain 邮箱地址的域名部分（小写），按域名授权的角色据此判断用户归属
+func EmailDomain(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(email[at+1:]))
+}
+
+// splitPermission 解析权限授予，"users:read@example.com" 表示只对 example.com 下的用户生效
+func splitPermission(grant string) (string, string) {
+	permission, domain, _ := strings.Cut(grant, "@")
+	return permission, domain
+}
+
+// HasPermission 权限列表中是否有指定权限，不区分是否限定了域名
+func HasPermission(permissions []string, permission string) bool {
+	for _, grant := range permissions {
+		p, _ := splitPermission(grant)
+		if p == PermissionAll || p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// PermissionCoversDomain 权限列表是否允许对指定域名下的用户执行操作
+func PermissionCoversDomain(permissions []string, permission, domain string) bool {
+	for _, grant := range permissions {
+		p, d := splitPermission(grant)
+		if (p == PermissionAll || p == permission) && (d == "" || d == domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// PermissionDomains 权限生效的域名范围，all 为 true 表示不限域名
+func PermissionDomains(permissions []string, permission string) (bool, []string) {
+	var domains []string
+	for _, grant := range permissions {
+		p, d := splitPermission(grant)
+		if p != PermissionAll && p != permission {
+			continue
+		}
+		if d == "" {
+			return true, nil
+		}
+		domains = append(domains, d)
+	}
+	return false, domains
+}
+
+// seedBuiltinRoles 写入内置角色，已存在的角色保持不变
+func seedBuiltinRoles(db *Database) error {
+	for _, role := range builtinRoles {
+		if _, err := db.Exec(
+			"INSERT INTO roles (name, description, builtin, created_at) VALUES (?, ?, TRUE, ?) ON CONFLICT (name) DO NOTHING",
+			role.Name, role.Description, time.Now(),
+		); err != nil {
+			return err
+		}
+		for _, permission := range role.Permissions {
+			if _, err := db.Exec(`
+			INSERT INTO role_permissions (role_id, permission)
+			SELECT id, ? FROM roles WHERE name = ?
+			ON CONFLICT DO NOTHING
+			`, permission, role.Name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// loadRolePermissions 为角色列表填充权限
+func loadRolePermissions(db *Database, roles []*Role) error {
+	byID := make(map[int]*Role, len(roles))
+	for _, role := range roles {
+		role.Permissions = []string{}
+		byID[role.ID] = role
+	}
+	
+	rows, err := db.Query("SELECT role_id, permission FROM role_permissions ORDER BY permission")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	
+	for rows.Next() {
+		var roleID int
+		var permission string
+		if err := rows.Scan(&roleID, &permission); err != nil {
+			return err
+		}
+		if role, ok := byID[roleID]; ok {
+			role.Permissions = append(role.Permissions, permission)
+		}
+	}
+	
+	return rows.Err()
+}
+
+// GetRoles 获取全部角色及其权限
+func GetRoles(db *Database) ([]*Role, error) {
+	rows, err := db.Query("SELECT id, name, COALESCE(description, ''), builtin, created_at FROM roles ORDER BY builtin DESC, name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	
+	roles := []*Role{}
+	for rows.Next() {
+		role := &Role{}
+		if err := rows.Scan(&role.ID, &role.Name, &role.Description, &role.Builtin, &role.CreatedAt); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	
+	if err := loadRolePermissions(db, roles); err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+// GetRoleByID 获取角色及其权限
+func GetRoleByID(db *Database, roleID int) (*Role, error) {
+	role := &Role{}
+	err := db.QueryRow(
+		"SELECT id, name, COALESCE(description, ''), builtin, created_at FROM roles WHERE id = ?",
+		roleID,
+	).Scan(&role.ID, &role.Name, &role.Description, &role.Builtin, &role.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	
+	if err := loadRolePermissions(db, []*Role{role}); err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+// GetRoleByName 按名称获取角色
+func GetRoleByName(db *Database, name string) (*Role, error) {
+	var roleID int
+	if err := db.QueryRow("SELECT id FROM roles WHERE name = ?", name).Scan(&roleID); err != nil {
+		return nil, err
+	}
+	return GetRoleByID(db, roleID)
+}
+
+// replaceRolePermissions 在事务中替换角色的权限
+func replaceRolePermissions(tx *Tx, roleID int, permissions []string) error {
+	if _, err := tx.Exec("DELETE FROM role_permissions WHERE role_id = ?", roleID); err != nil {
+		return err
+	}
+	for _, permission := range permissions {
+		if _, err := tx.Exec(
+			"INSERT INTO role_permissions (role_id, permission) VALUES (?, ?) ON CONFLICT DO NOTHING",
+			roleID, permission,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateRole 创建自定义角色
+func CreateRole(db *Database, role *Role) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	
+	roleID, err := insertReturningID(tx,
+		"INSERT INTO roles (name, description, builtin, created_at) VALUES (?, ?, FALSE, ?)",
+		role.Name, role.Description, time.Now(),
+	)
+	if err != nil {
+		return 0, err
+	}
+	
+	if err := replaceRolePermissions(tx, int(roleID), role.Permissions); err != nil {
+		return 0, err
+	}
+	return roleID, tx.Commit()
+}
+
+// UpdateRole 修改自定义角色的描述和权限
+func UpdateRole(db *Database, role *Role) error {
+	if role.Builtin {
+		return ErrBuiltinRole
+	}
+	
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	
+	if _, err := tx.Exec("UPDATE roles SET description = ? WHERE id = ? AND builtin = FALSE", role.Description, role.ID); err != nil {
+		return err
+	}
+	if err := replaceRolePermissions(tx, role.ID, role.Permissions); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteRole 删除自定义角色，同时取消所有用户的该角色
+func DeleteRole(db *Database, role *Role) error {
+	if role.Builtin {
+		return ErrBuiltinRole
+	}
+	
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	
+	if _, err := tx.Exec("DELETE FROM user_roles WHERE role_id = ?", role.ID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM role_permissions WHERE role_id = ?", role.ID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM roles WHERE id = ? AND builtin = FALSE", role.ID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetRoleUserIDs 获取被分配了该角色的用户ID
+func GetRoleUserIDs(db *Database, roleID int) ([]int, error) {
+	rows, err := db.Query("SELECT DISTINCT user_id FROM user_roles WHERE role_id = ?", roleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	
+	return ids, rows.Err()
+}
+
+// GetUserRoles 获取用户被分配的角色
+func GetUserRoles(db *Database, userID int) ([]*UserRole, error) {
+	rows, err := db.Query(`
+	SELECT ur.role_id, r.name, ur.domain FROM user_roles ur
+	JOIN roles r ON r.id = ur.role_id
+	WHERE ur.user_id = ?
+	ORDER BY r.name, ur.domain
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	
+	roles := []*UserRole{}
+	for rows.Next() {
+		role := &UserRole{}
+		if err := rows.Scan(&role.RoleID, &role.RoleName, &role.Domain); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	
+	return roles, rows.Err()
+}
+
+// SetUserRoles 替换用户被分配的角色
+func SetUserRoles(db *Database, userID int, roles []UserRole) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	
+	if _, err := tx.Exec("DELETE FROM user_roles WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	
+	now := time.Now()
+	for _, role := range roles {
+		if _, err := tx.Exec(
+			"INSERT INTO user_roles (user_id, role_id, domain, created_at) VALUES (?, ?, ?, ?) ON CONFLICT DO NOTHING",
+			userID, role.RoleID, role.Domain, now,
+		); err != nil {
+			return err
+		}
+	}
+	
+	return tx.Commit()
+}
+
+// GetUserPermissions 汇总用户所有角色的权限，限定域名的权限记为 "权限@域名"，结果写入访问令牌的 scope
+// 超级管理员的全部权限不写入令牌，而是每次请求根据数据库中的 is_admin 判断，撤销管理员后立即生效
+func GetUserPermissions(db *Database, userID int) ([]string, error) {
+	rows, err := db.Query(`
+	SELECT DISTINCT rp.permission, ur.domain FROM user_roles ur
+	JOIN role_permissions rp ON rp.role_id = ur.role_id
+	WHERE ur.user_id = ?
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	
+	unrestricted := make(map[string]bool)
+	var grants []string
+	var scoped [][2]string
+	for rows.Next() {
+		var permission, domain string
+		if err := rows.Scan(&permission, &domain); err != nil {
+			return nil, err
+		}
+		// 全局权限即使被按域名分配也不生效
+		if domain != "" && !DomainScopedPermission(permission) {
+			continue
+		}
+		if domain == "" {
+			unrestricted[permission] = true
+			grants = append(grants, permission)
+		} else {
+			scoped = append(scoped, [2]string{permission, domain})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	
+	// 已经不限域名的权限不再重复记录按域名的授予
+	for _, s := range scoped {
+		if !unrestricted[s[0]] {
+			grants = append(grants, s[0]+"@"+s[1])
+		}
+	}
+	
+	sort.Strings(grants)
+	return grants, nil
+}
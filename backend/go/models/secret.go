@@ -0,0 +1,45 @@
+package models
+
+import (
+	"SwiftPost/utils"
+	"crypto/rand"
+	"encoding/base64"
+	"time"
+)
+
+// 服务端密钥的名称
+const secretCSRF = "csrf"
+
+// serverSecret 读取指定名称的随机密钥，不存在时生成并保存。
+// 多个实例同时第一次启动时以先写入的为准，之后都读取同一个值
+func serverSecret(db *Database, name string, size int) ([]byte, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	
+	_, err := db.Exec(`
+	INSERT INTO server_secrets (name, value, created_at)
+	VALUES (?, ?, ?)
+	ON CONFLICT(name) DO NOTHING
+	`, name, base64.StdEncoding.EncodeToString(buf), time.Now())
+	if err != nil {
+		return nil, err
+	}
+	
+	var value string
+	if err := db.QueryRow(`SELECT value FROM server_secrets WHERE name = ?`, name).Scan(&value); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(value)
+}
+
+// LoadCSRFKey 加载CSRF令牌的HMAC密钥，第一次启动时生成
+func LoadCSRFKey(db *Database) error {
+	key, err := serverSecret(db, secretCSRF, 32)
+	if err != nil {
+		return err
+	}
+	utils.SetCSRFKey(key)
+	return nil
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestServerSecret(t *testing.T) {
+	config := newTestConfig(t)
+	db := newTestDB(t, config)
+	
+	first, err := serverSecret(db, secretCSRF, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first) != 32 || bytes.Equal(first, make([]byte, 32)) {
+		t.Fatalf("生成的密钥无效: %x", first)
+	}
+	
+	// 重启后读取已保存的密钥，不会重新生成
+	db.Close()
+	db = newTestDB(t, config)
+	again, err := serverSecret(db, secretCSRF, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first, again) {
+		t.Fatal("重新打开数据库后密钥发生了变化")
+	}
+	
+	other, err := serverSecret(db, "other", 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(first, other) {
+		t.Fatal("不同名称的密钥应各自生成")
+	}
+}
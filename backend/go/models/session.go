@@ -0,0 +1,260 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrRefreshTokenReused 刷新令牌已被轮换过，再次使用说明令牌可能泄露
+var ErrRefreshTokenReused = errors.New("刷新令牌已被使用")
+
+type Session struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"user_id"`
+	TokenHash  string     `json:"-"`
+	IPAddress  string     `json:"ip_address"`
+	UserAgent  string     `json:"user_agent"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// IsActive 会话未撤销且未过期
+func (s *Session) IsActive() bool {
+	return s.RevokedAt == nil && time.Now().Before(s.ExpiresAt)
+}
+
+// sqlSessionRepository SessionRepository 的SQL实现
+type sqlSessionRepository struct {
+	db *Database
+}
+
+func (r *sqlSessionRepository) Create(session *Session) (int64, error) {
+	query := `
+	INSERT INTO sessions (user_id, session_token, ip_address, user_agent, expires_at, created_at, last_seen_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+	
+	now := time.Now()
+	return insertReturningID(r.db, query,
+		session.UserID, session.TokenHash, session.IPAddress, session.UserAgent,
+		session.ExpiresAt, now, now,
+	)
+}
+
+const sessionColumns = `id, user_id, session_token, COALESCE(ip_address, ''), COALESCE(user_agent, ''),
+	       expires_at, created_at, last_seen_at, revoked_at`
+
+func scanSession(row interface{ Scan(...interface{}) error }) (*Session, error) {
+	var session Session
+	var lastSeenAt, revokedAt sql.NullTime
+	
+	err := row.Scan(
+		&session.ID, &session.UserID, &session.TokenHash, &session.IPAddress, &session.UserAgent,
+		&session.ExpiresAt, &session.CreatedAt, &lastSeenAt, &revokedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	
+	session.LastSeenAt = session.CreatedAt
+	if lastSeenAt.Valid {
+		session.LastSeenAt = lastSeenAt.Time
+	}
+	if revokedAt.Valid {
+		session.RevokedAt = &revokedAt.Time
+	}
+	
+	return &session, nil
+}
+
+func (r *sqlSessionRepository) GetByID(id int) (*Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM sessions WHERE id = ?`
+	return scanSession(r.db.QueryRow(query, id))
+}
+
+func (r *sqlSessionRepository) GetByTokenHash(tokenHash string) (*Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM sessions WHERE session_token = ?`
+	return scanSession(r.db.queryRowStmt(query, tokenHash))
+}
+
+// GetByRetiredToken 通过已轮换的刷新令牌查找所属会话，同时返回令牌被轮换的时间
+func (r *sqlSessionRepository) GetByRetiredToken(tokenHash string) (*Session, time.Time, error) {
+	var sessionID int
+	var retiredAt time.Time
+	err := r.db.QueryRow(
+		"SELECT session_id, retired_at FROM retired_refresh_tokens WHERE token_hash = ?", tokenHash,
+	).Scan(&sessionID, &retiredAt)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	
+	session, err := r.GetByID(sessionID)
+	return session, retiredAt, err
+}
+
+// RotateToken 替换会话的刷新令牌，旧令牌记录下来用于检测重用
+func (r *sqlSessionRepository) RotateToken(sessionID int, oldHash, newHash, ipAddress, userAgent string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	
+	result, err := tx.Exec(`
+	UPDATE sessions SET session_token = ?, ip_address = ?, user_agent = ?, last_seen_at = ?
+	WHERE id = ? AND session_token = ? AND revoked_at IS NULL
+	`, newHash, ipAddress, userAgent, time.Now(), sessionID, oldHash)
+	if err != nil {
+		return err
+	}
+	
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		// 并发请求已经轮换了这个令牌
+		return ErrRefreshTokenReused
+	}
+	
+	if _, err := tx.Exec(
+		"INSERT INTO retired_refresh_tokens (token_hash, session_id, retired_at) VALUES (?, ?, ?)",
+		oldHash, sessionID, time.Now(),
+	); err != nil {
+		return err
+	}
+	
+	return tx.Commit()
+}
+
+// Validate 检查会话属于该用户、未撤销未过期且用户未被禁用，返回用户当前的管理员状态
+func (r *sqlSessionRepository) Validate(sessionID, userID int) (bool, error) {
+	var isAdmin bool
+	query := `
+	SELECT u.is_admin FROM sessions s
+	JOIN users u ON u.id = s.user_id
+	WHERE s.id = ? AND s.user_id = ? AND s.revoked_at IS NULL AND s.expires_at > ? AND u.is_active = TRUE
+	`
+	
+	err := r.db.queryRowStmt(query, sessionID, userID, time.Now()).Scan(&isAdmin)
+	if err != nil {
+		return false, err
+	}
+	
+	return isAdmin, nil
+}
+
+// Touch 更新会话最后活跃时间，一分钟内最多写一次
+func (r *sqlSessionRepository) Touch(sessionID int) error {
+	now := time.Now()
+	query := `
+	UPDATE sessions SET last_seen_at = ?
+	WHERE id = ? AND (last_seen_at IS NULL OR last_seen_at < ?)
+	`
+	
+	_, err := r.db.execStmt(query, now, sessionID, now.Add(-time.Minute))
+	return err
+}
+
+func (r *sqlSessionRepository) Revoke(sessionID int) error {
+	query := `UPDATE sessions SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL`
+	_, err := r.db.Exec(query, time.Now(), sessionID)
+	return err
+}
+
+// RevokeAllForUser 撤销用户的所有会话，返回撤销的数量
+func (r *sqlSessionRepository) RevokeAllForUser(userID int) (int64, error) {
+	query := `UPDATE sessions SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL`
+	result, err := r.db.Exec(query, time.Now(), userID)
+	if err != nil {
+		return 0, err
+	}
+	
+	return result.RowsAffected()
+}
+
+// ListActiveByUser 获取用户未撤销且未过期的会话，按最后活跃时间排序
+func (r *sqlSessionRepository) ListActiveByUser(userID int) ([]*Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM sessions
+	WHERE user_id = ? AND revoked_at IS NULL AND expires_at > ?
+	ORDER BY COALESCE(last_seen_at, created_at) DESC`
+	
+	rows, err := r.db.Query(query, userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	
+	var sessions []*Session
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	
+	return sessions, nil
+}
+
+// RevokeForUser 撤销属于指定用户的单个会话，会话不存在或不属于该用户时返回 sql.ErrNoRows
+func (r *sqlSessionRepository) RevokeForUser(userID, sessionID int) error {
+	query := `UPDATE sessions SET revoked_at = ? WHERE id = ? AND user_id = ? AND revoked_at IS NULL`
+	result, err := r.db.Exec(query, time.Now(), sessionID, userID)
+	if err != nil {
+		return err
+	}
+	
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	
+	return nil
+}
+
+// RevokeAll 撤销所有用户的会话（保留 exceptSessionID），用于安全事件后强制重新登录
+func (r *sqlSessionRepository) RevokeAll(exceptSessionID int) (int64, error) {
+	query := `UPDATE sessions SET revoked_at = ? WHERE revoked_at IS NULL AND id != ?`
+	result, err := r.db.Exec(query, time.Now(), exceptSessionID)
+	if err != nil {
+		return 0, err
+	}
+	
+	return result.RowsAffected()
+}
+
+// DeleteExpired 清理过期或已撤销超过保留期的会话
+func (r *sqlSessionRepository) DeleteExpired(retention time.Duration) (int64, error) {
+	cutoff := time.Now().Add(-retention)
+	
+	_, err := r.db.Exec(`
+	DELETE FROM retired_refresh_tokens WHERE session_id IN (
+		SELECT id FROM sessions WHERE expires_at < ? OR revoked_at < ?
+	)
+	`, cutoff, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	
+	result, err := r.db.Exec("DELETE FROM sessions WHERE expires_at < ? OR revoked_at < ?", cutoff, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	
+	return result.RowsAffected()
+}
+
+func (r *sqlSessionRepository) LastLoginAt(userID int) (time.Time, error) {
+	var createdAt time.Time
+	err := r.db.QueryRow(
+		"SELECT created_at FROM sessions WHERE user_id = ? ORDER BY created_at DESC LIMIT 1", userID,
+	).Scan(&createdAt)
+	return createdAt, err
+}
@@ -0,0 +1,166 @@
+package models
+
+import (
+	"SwiftPost/utils"
+	"database/sql"
+	"time"
+)
+
+// signingKeyPrepublish 新密钥在开始签名之前提前发布到 JWKS 的时间，给其他服务留出刷新缓存的时间
+const signingKeyPrepublish = time.Hour
+
+// GetSigningKeys 获取尚未失效的签名密钥，按生效时间从新到旧排序
+func GetSigningKeys(db *Database) ([]*utils.SigningKey, error) {
+	rows, err := db.Query(`
+	SELECT kid, algorithm, private_key, activates_at, retires_at, expires_at
+	FROM jwt_keys WHERE expires_at > ?
+	ORDER BY activates_at DESC
+	`, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	
+	var keys []*utils.SigningKey
+	for rows.Next() {
+		key := &utils.SigningKey{}
+		var privateKey string
+		if err := rows.Scan(&key.KeyID, &key.Algorithm, &privateKey, &key.ActivatesAt, &key.RetiresAt, &key.ExpiresAt); err != nil {
+			return nil, err
+		}
+		
+		key.PrivateKey, err = utils.DecodePrivateKey(privateKey)
+		if err != nil {
+			dbLog.Error("解析签名密钥 %s 失败: %v", key.KeyID, err)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	
+	return keys, rows.Err()
+}
+
+// LoadSigningKeys 从数据库加载签名密钥到内存
+func LoadSigningKeys(db *Database) error {
+	keys, err := GetSigningKeys(db)
+	if err != nil {
+		return err
+	}
+	utils.SetSigningKeys(keys)
+	return nil
+}
+
+// createSigningKey 生成并保存一个在 activatesAt 开始签名的新密钥
+func createSigningKey(db *Database, config *utils.Config, activatesAt time.Time) (*utils.SigningKey, error) {
+	key, err := utils.GenerateSigningKey(utils.SigningAlgorithm(config))
+	if err != nil {
+		return nil, err
+	}
+	
+	privateKey, err := utils.EncodePrivateKey(key.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	
+	key.ActivatesAt = activatesAt
+	key.RetiresAt = activatesAt.Add(utils.KeyRotationPeriod(config))
+	key.ExpiresAt = key.RetiresAt.Add(utils.KeyGracePeriod(config))
+	
+	_, err = db.Exec(`
+	INSERT INTO jwt_keys (kid, algorithm, private_key, activates_at, retires_at, expires_at, created_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, key.KeyID, key.Algorithm, privateKey, key.ActivatesAt, key.RetiresAt, key.ExpiresAt, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	
+	return key, nil
+}
+
+// RotateSigningKeys 定期调用，清理过期密钥，并在当前密钥退役前生成下一个密钥
+// 新密钥提前发布到 JWKS，当前密钥退役时接替签名；没有可用密钥或配置的算法改变时立即生成并启用新密钥
+func RotateSigningKeys(db *Database, config *utils.Config) error {
+	now := time.Now()
+	if _, err := db.Exec("DELETE FROM jwt_keys WHERE expires_at <= ?", now); err != nil {
+		return err
+	}
+	
+	keys, err := GetSigningKeys(db)
+	if err != nil {
+		return err
+	}
+	
+	var latest, current *utils.SigningKey
+	for _, key := range keys {
+		if latest == nil {
+			latest = key
+		}
+		if current == nil && !key.ActivatesAt.After(now) && key.RetiresAt.After(now) {
+			current = key
+		}
+	}
+	
+	switch {
+	case current == nil || latest.Algorithm != utils.SigningAlgorithm(config):
+		key, err := createSigningKey(db, config, now)
+		if err != nil {
+			return err
+		}
+		dbLog.Info("已生成新的JWT签名密钥 %s (%s)", key.KeyID, key.Algorithm)
+	case latest.RetiresAt.Sub(now) <= signingKeyPrepublish:
+		activatesAt := latest.RetiresAt
+		if activatesAt.Before(now) {
+			activatesAt = now
+		}
+		key, err := createSigningKey(db, config, activatesAt)
+		if err != nil {
+			return err
+		}
+		dbLog.Info("已生成下一个JWT签名密钥 %s，将于 %s 开始使用", key.KeyID, activatesAt.Format("2006-01-02 15:04:05"))
+	}
+	
+	return LoadSigningKeys(db)
+}
+
+// RotateSigningKeysNow 立即启用新密钥，之前的密钥全部退役，在宽限期内仍可验证已签发的令牌
+func RotateSigningKeysNow(db *Database, config *utils.Config) (*utils.SigningKey, error) {
+	now := time.Now()
+	// 尚未开始签名的密钥直接删除，由新密钥代替
+	if _, err := db.Exec("DELETE FROM jwt_keys WHERE activates_at > ?", now); err != nil {
+		return nil, err
+	}
+	
+	_, err := db.Exec(`
+	UPDATE jwt_keys SET retires_at = ?, expires_at = ?
+	WHERE retires_at > ?
+	`, now, now.Add(utils.KeyGracePeriod(config)), now)
+	if err != nil {
+		return nil, err
+	}
+	
+	key, err := createSigningKey(db, config, now)
+	if err != nil {
+		return nil, err
+	}
+	
+	return key, LoadSigningKeys(db)
+}
+
+// RevokeSigningKey 删除密钥，用它签发的令牌立即失效，用于密钥泄露的情况
+func RevokeSigningKey(db *Database, config *utils.Config, kid string) error {
+	result, err := db.Exec("DELETE FROM jwt_keys WHERE kid = ?", kid)
+	if err != nil {
+		return err
+	}
+	
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	
+	// 删除的可能是正在使用的密钥，需要时生成新密钥
+	return RotateSigningKeys(db, config)
+}
@@ -1,50 +1,52 @@
 package models
 
 import (
-	"database/sql"
+	"strings"
 	"time"
 )
 
 type User struct {
-	ID           int       `json:"id"`
-	Username     string    `json:"username"`
-	Email        string    `json:"email"`
-	PasswordHash string    `json:"-"`
-	IsAdmin      bool      `json:"is_admin"`
-	CustomDomain string    `json:"custom_domain"`
-	StorageUsed  int64     `json:"storage_used"`
-	MaxStorage   int64     `json:"max_storage"`
-	IsActive     bool      `json:"is_active"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
-}
-
-func CreateUser(db *Database, username, email, passwordHash string) (int64, error) {
+	ID                   int       `json:"id"`
+	Username             string    `json:"username"`
+	Email                string    `json:"email"`
+	PasswordHash         string    `json:"-"`
+	IsAdmin              bool      `json:"is_admin"`
+	CustomDomain         string    `json:"custom_domain"`
+	CustomDomainVerified bool      `json:"custom_domain_verified"`
+	StorageUsed          int64     `json:"storage_used"`
+	MaxStorage           int64     `json:"max_storage"`
+	IsActive             bool      `json:"is_active"`
+	EmailVerified        bool      `json:"email_verified"`
+	CreatedAt            time.Time `json:"created_at"`
+	UpdatedAt            time.Time `json:"updated_at"`
+}
+
+// sqlUserRepository UserRepository 的SQL实现
+type sqlUserRepository struct {
+	db *Database
+}
+
+func (r *sqlUserRepository) Create(username, email, passwordHash string) (int64, error) {
 	query := `
 	INSERT INTO users (username, email, password_hash, created_at, updated_at)
 	VALUES (?, ?, ?, ?, ?)
 	`
 	
-	result, err := db.Exec(query, username, email, passwordHash, time.Now(), time.Now())
-	if err != nil {
-		return 0, err
-	}
-	
-	return result.LastInsertId()
+	return insertReturningID(r.db, query, username, email, passwordHash, time.Now(), time.Now())
 }
 
-func GetUserByID(db *Database, id int) (*User, error) {
+func (r *sqlUserRepository) GetByID(id int) (*User, error) {
 	var user User
 	query := `
-	SELECT id, username, email, password_hash, is_admin, custom_domain,
-	       storage_used, max_storage, is_active, created_at, updated_at
+	SELECT id, username, email, password_hash, is_admin, COALESCE(custom_domain, ''), custom_domain_verified,
+	       storage_used, max_storage, is_active, email_verified, created_at, updated_at
 	FROM users WHERE id = ?
 	`
 	
-	err := db.QueryRow(query, id).Scan(
+	err := r.db.queryRowStmt(query, id).Scan(
 		&user.ID, &user.Username, &user.Email, &user.PasswordHash,
-		&user.IsAdmin, &user.CustomDomain, &user.StorageUsed, &user.MaxStorage,
-		&user.IsActive, &user.CreatedAt, &user.UpdatedAt,
+		&user.IsAdmin, &user.CustomDomain, &user.CustomDomainVerified, &user.StorageUsed, &user.MaxStorage,
+		&user.IsActive, &user.EmailVerified, &user.CreatedAt, &user.UpdatedAt,
 	)
 	
 	if err != nil {
@@ -54,18 +56,18 @@ func GetUserByID(db *Database, id int) (*User, error) {
 	return &user, nil
 }
 
-func GetUserByEmail(db *Database, email string) (*User, error) {
+func (r *sqlUserRepository) GetByEmail(email string) (*User, error) {
 	var user User
 	query := `
-	SELECT id, username, email, password_hash, is_admin, custom_domain,
-	       storage_used, max_storage, is_active, created_at, updated_at
+	SELECT id, username, email, password_hash, is_admin, COALESCE(custom_domain, ''), custom_domain_verified,
+	       storage_used, max_storage, is_active, email_verified, created_at, updated_at
 	FROM users WHERE email = ?
 	`
 	
-	err := db.QueryRow(query, email).Scan(
+	err := r.db.QueryRow(query, email).Scan(
 		&user.ID, &user.Username, &user.Email, &user.PasswordHash,
-		&user.IsAdmin, &user.CustomDomain, &user.StorageUsed, &user.MaxStorage,
-		&user.IsActive, &user.CreatedAt, &user.UpdatedAt,
+		&user.IsAdmin, &user.CustomDomain, &user.CustomDomainVerified, &user.StorageUsed, &user.MaxStorage,
+		&user.IsActive, &user.EmailVerified, &user.CreatedAt, &user.UpdatedAt,
 	)
 	
 	if err != nil {
@@ -75,18 +77,18 @@ func GetUserByEmail(db *Database, email string) (*User, error) {
 	return &user, nil
 }
 
-func GetUserByUsername(db *Database, username string) (*User, error) {
+func (r *sqlUserRepository) GetByUsername(username string) (*User, error) {
 	var user User
 	query := `
-	SELECT id, username, email, password_hash, is_admin, custom_domain,
-	       storage_used, max_storage, is_active, created_at, updated_at
+	SELECT id, username, email, password_hash, is_admin, COALESCE(custom_domain, ''), custom_domain_verified,
+	       storage_used, max_storage, is_active, email_verified, created_at, updated_at
 	FROM users WHERE username = ?
 	`
 	
-	err := db.QueryRow(query, username).Scan(
+	err := r.db.QueryRow(query, username).Scan(
 		&user.ID, &user.Username, &user.Email, &user.PasswordHash,
-		&user.IsAdmin, &user.CustomDomain, &user.StorageUsed, &user.MaxStorage,
-		&user.IsActive, &user.CreatedAt, &user.UpdatedAt,
+		&user.IsAdmin, &user.CustomDomain, &user.CustomDomainVerified, &user.StorageUsed, &user.MaxStorage,
+		&user.IsActive, &user.EmailVerified, &user.CreatedAt, &user.UpdatedAt,
 	)
 	
 	if err != nil {
@@ -96,12 +98,15 @@ func GetUserByUsername(db *Database, username string) (*User, error) {
 	return &user, nil
 }
 
-func UpdateUser(db *Database, user *User) error {
+// Update 更新用户资料，自定义域名改变时需要重新验证
+func (r *sqlUserRepository) Update(user *User) error {
+	user.CustomDomain = NormalizeDomain(user.CustomDomain)
 	query := `
 	UPDATE users SET
 		username = ?,
 		email = ?,
 		is_admin = ?,
+		custom_domain_verified = CASE WHEN COALESCE(custom_domain, '') = ? THEN custom_domain_verified ELSE FALSE END,
 		custom_domain = ?,
 		storage_used = ?,
 		max_storage = ?,
@@ -110,66 +115,225 @@ func UpdateUser(db *Database, user *User) error {
 	WHERE id = ?
 	`
 	
-	_, err := db.Exec(query,
-		user.Username, user.Email, user.IsAdmin, user.CustomDomain,
+	_, err := r.db.Exec(query,
+		user.Username, user.Email, user.IsAdmin, user.CustomDomain, user.CustomDomain,
 		user.StorageUsed, user.MaxStorage, user.IsActive, time.Now(), user.ID,
 	)
 	
 	return err
 }
 
-func DeleteUser(db *Database, id int) error {
-	query := `DELETE FROM users WHERE id = ?`
-	_, err := db.Exec(query, id)
+// UpdatePassword 更新用户的密码哈希
+func (r *sqlUserRepository) UpdatePassword(userID int, passwordHash string) error {
+	_, err := r.db.Exec("UPDATE users SET password_hash = ?, updated_at = ? WHERE id = ?", passwordHash, time.Now(), userID)
 	return err
 }
 
-func GetAllUsers(db *Database, limit, offset int) ([]*User, error) {
-	query := `
-	SELECT id, username, email, is_admin, custom_domain,
-	       storage_used, max_storage, is_active, created_at, updated_at
-	FROM users
-	ORDER BY id DESC
-	LIMIT ? OFFSET ?
-	`
+// SetEmailVerified 设置用户邮箱是否已验证，未验证的账号处于待确认状态，不能登录
+func (r *sqlUserRepository) SetEmailVerified(userID int, verified bool) error {
+	_, err := r.db.Exec("UPDATE users SET email_verified = ?, updated_at = ? WHERE id = ?", verified, time.Now(), userID)
+	return err
+}
+
+// Delete 在一个事务中删除用户和属于该用户的邮件、附件、会话、登录凭据和角色等数据
+func (r *sqlUserRepository) Delete(id int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	
+	statements := []string{
+		"DELETE FROM attachments WHERE email_id IN (SELECT id FROM emails WHERE ? IN (sender_id, recipient_id))",
+		"DELETE FROM emails WHERE ? IN (sender_id, recipient_id)",
+		"DELETE FROM retired_refresh_tokens WHERE session_id IN (SELECT id FROM sessions WHERE user_id = ?)",
+		"DELETE FROM sessions WHERE user_id = ?",
+		"DELETE FROM push_subscriptions WHERE user_id = ?",
+		"DELETE FROM notification_preferences WHERE user_id = ?",
+		"DELETE FROM presence_settings WHERE user_id = ?",
+		"DELETE FROM webauthn_challenges WHERE user_id = ?",
+		"DELETE FROM webauthn_credentials WHERE user_id = ?",
+		"DELETE FROM user_mfa WHERE user_id = ?",
+		"DELETE FROM mfa_recovery_codes WHERE user_id = ?",
+		"DELETE FROM personal_access_tokens WHERE user_id = ?",
+		"DELETE FROM app_passwords WHERE user_id = ?",
+		"DELETE FROM account_tokens WHERE user_id = ?",
+		"DELETE FROM user_identities WHERE user_id = ?",
+		"DELETE FROM user_roles WHERE user_id = ?",
+		"DELETE FROM users WHERE id = ?",
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement, id); err != nil {
+			return err
+		}
+	}
 	
-	rows, err := db.Query(query, limit, offset)
+	return tx.Commit()
+}
+
+// userListColumns 用户列表的列，不含密码哈希
+const userListColumns = `id, username, email, is_admin, COALESCE(custom_domain, ''), custom_domain_verified,
+	       storage_used, max_storage, is_active, email_verified, created_at, updated_at`
+
+// list 按条件分页查询用户，按注册时间倒序
+func (r *sqlUserRepository) list(where string, args []interface{}, page Page) ([]*User, *PageInfo, error) {
+	where, args, order := page.keyset("", where, args)
+	query := `SELECT ` + userListColumns + ` FROM users
+	WHERE ` + where + `
+	ORDER BY ` + order + `
+	LIMIT ? OFFSET ?`
+	
+	rows, err := r.db.Query(query, args...)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer rows.Close()
 	
-	var users []*User
+	users := []*User{}
 	for rows.Next() {
 		var user User
 		err := rows.Scan(
 			&user.ID, &user.Username, &user.Email,
-			&user.IsAdmin, &user.CustomDomain, &user.StorageUsed,
-			&user.MaxStorage, &user.IsActive, &user.CreatedAt, &user.UpdatedAt,
+			&user.IsAdmin, &user.CustomDomain, &user.CustomDomainVerified, &user.StorageUsed,
+			&user.MaxStorage, &user.IsActive, &user.EmailVerified, &user.CreatedAt, &user.UpdatedAt,
 		)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		users = append(users, &user)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
 	
-	return users, nil
+	users, info := paginate(page, users, func(user *User) Cursor {
+		return Cursor{CreatedAt: user.CreatedAt, ID: user.ID}
+	})
+	return users, info, nil
+}
+
+func (r *sqlUserRepository) List(page Page) ([]*User, *PageInfo, error) {
+	return r.list("1 = 1", nil, page)
 }
 
-func CountUsers(db *Database) (int, error) {
+func (r *sqlUserRepository) Count() (int, error) {
 	var count int
-	err := db.QueryRow("SELECT COUNT(*) FROM users").Scan(&count)
+	err := r.db.QueryRow("SELECT COUNT(*) FROM users").Scan(&count)
 	return count, err
 }
 
-func UpdateUserStorage(db *Database, userID int, storageUsed int64) error {
+// domainFilter 生成按邮箱域名过滤用户的条件
+func (r *sqlUserRepository) domainFilter(domains []string) (string, []interface{}) {
+	placeholders := make([]string, len(domains))
+	args := make([]interface{}, len(domains))
+	for i, domain := range domains {
+		placeholders[i] = "?"
+		args[i] = domain
+	}
+	return "lower(" + r.db.dialect.emailDomain("email") + ") IN (" + strings.Join(placeholders, ", ") + ")", args
+}
+
+// ListInDomains 获取邮箱属于指定域名的用户，用于按域名授权的管理员
+func (r *sqlUserRepository) ListInDomains(domains []string, page Page) ([]*User, *PageInfo, error) {
+	if len(domains) == 0 {
+		return []*User{}, &PageInfo{}, nil
+	}
+	
+	where, args := r.domainFilter(domains)
+	return r.list(where, args, page)
+}
+
+// CountInDomains 统计邮箱属于指定域名的用户数量
+func (r *sqlUserRepository) CountInDomains(domains []string) (int, error) {
+	if len(domains) == 0 {
+		return 0, nil
+	}
+	
+	where, args := r.domainFilter(domains)
+	var count int
+	err := r.db.QueryRow("SELECT COUNT(*) FROM users WHERE "+where, args...).Scan(&count)
+	return count, err
+}
+
+func (r *sqlUserRepository) UpdateStorage(userID int, storageUsed int64) error {
 	query := `UPDATE users SET storage_used = ?, updated_at = ? WHERE id = ?`
-	_, err := db.Exec(query, storageUsed, time.Now(), userID)
+	_, err := r.db.Exec(query, storageUsed, time.Now(), userID)
 	return err
 }
 
-func UpdateCustomDomain(db *Database, userID int, domain string) error {
-	query := `UPDATE users SET custom_domain = ?, updated_at = ? WHERE id = ?`
-	_, err := db.Exec(query, domain, time.Now(), userID)
+// UpdateCustomDomain 修改用户的自定义域名，域名改变时需要重新验证
+func (r *sqlUserRepository) UpdateCustomDomain(userID int, domain string) error {
+	domain = NormalizeDomain(domain)
+	query := `UPDATE users SET
+		custom_domain_verified = CASE WHEN COALESCE(custom_domain, '') = ? THEN custom_domain_verified ELSE FALSE END,
+		custom_domain = ?, updated_at = ?
+	WHERE id = ?`
+	_, err := r.db.Exec(query, domain, domain, time.Now(), userID)
 	return err
-}
\ No newline at end of file
+}
+
+// SetCustomDomainVerified 把用户当前的自定义域名标记为已验证，域名已被修改时不做任何事
+func (r *sqlUserRepository) SetCustomDomainVerified(userID int, domain string) error {
+	query := `UPDATE users SET custom_domain_verified = TRUE, updated_at = ? WHERE id = ? AND custom_domain = ?`
+	_, err := r.db.Exec(query, time.Now(), userID, NormalizeDomain(domain))
+	return err
+}
+
+// IsVerifiedCustomDomain 域名是否为某个启用的用户已验证的自定义域名
+func (r *sqlUserRepository) IsVerifiedCustomDomain(domain string) (bool, error) {
+	var count int
+	err := r.db.QueryRow(
+		"SELECT COUNT(*) FROM users WHERE custom_domain = ? AND custom_domain_verified = TRUE AND is_active = TRUE",
+		NormalizeDomain(domain),
+	).Scan(&count)
+	return count > 0, err
+}
+
+// NormalizeDomain 自定义域名统一保存为小写，去掉首尾空白和末尾的点
+func NormalizeDomain(domain string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+}
+
+// AdminIDs 获取所有启用的管理员账号ID，用于发送安全通知
+func (r *sqlUserRepository) AdminIDs() ([]int, error) {
+	rows, err := r.db.Query("SELECT id FROM users WHERE is_admin = TRUE AND is_active = TRUE")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	
+	return ids, rows.Err()
+}
+
+func (r *sqlUserRepository) Totals() (*UserTotals, error) {
+	totals := &UserTotals{}
+	err := r.db.QueryRow(`
+	SELECT COUNT(*),
+	       COALESCE(SUM(CASE WHEN is_active THEN 1 ELSE 0 END), 0),
+	       COALESCE(SUM(CASE WHEN is_admin THEN 1 ELSE 0 END), 0),
+	       COALESCE(SUM(storage_used), 0),
+	       COALESCE(SUM(max_storage), 0)
+	FROM users
+	`).Scan(&totals.Total, &totals.Active, &totals.Admins, &totals.StorageUsed, &totals.StorageCapacity)
+	if err != nil {
+		return nil, err
+	}
+	
+	return totals, nil
+}
+
+// CountCreatedSince 统计 since 之后注册的用户
+func (r *sqlUserRepository) CountCreatedSince(since time.Time) (int, error) {
+	var count int
+	err := r.db.QueryRow("SELECT COUNT(*) FROM users WHERE created_at >= ?", since).Scan(&count)
+	return count, err
+}
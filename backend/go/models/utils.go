@@ -1,7 +1,9 @@
 package models
 
 import (
+	"net/http"
 	"strconv"
+	"strings"
 	"github.com/gorilla/mux"
 )
 
@@ -103,9 +105,3 @@ func ValidatePassword(password string) bool {
 	
 	return hasLetter && hasDigit
 }
-
-// 需要导入的包
-import (
-	"net/http"
-	"strings"
-)
\ No newline at end of file
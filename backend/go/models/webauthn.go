@@ -0,0 +1,212 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+type WebAuthnCredential struct {
+	ID              int        `json:"id"`
+	UserID          int        `json:"user_id"`
+	CredentialID    []byte     `json:"-"`
+	PublicKey       []byte     `json:"-"`
+	AttestationType string     `json:"attestation_type"`
+	AAGUID          []byte     `json:"-"`
+	SignCount       uint32     `json:"-"`
+	Transports      string     `json:"transports"`
+	Flags           uint8      `json:"-"`
+	Name            string     `json:"name"`
+	CreatedAt       time.Time  `json:"created_at"`
+	LastUsedAt      *time.Time `json:"last_used_at,omitempty"`
+}
+
+const webAuthnCredentialColumns = `
+	id, user_id, credential_id, public_key, COALESCE(attestation_type, ''), aaguid,
+	sign_count, COALESCE(transports, ''), flags, name, created_at, last_used_at
+`
+
+func scanWebAuthnCredential(scanner interface{ Scan(...interface{}) error }) (*WebAuthnCredential, error) {
+	var cred WebAuthnCredential
+	var lastUsedAt sql.NullTime
+	
+	err := scanner.Scan(
+		&cred.ID, &cred.UserID, &cred.CredentialID, &cred.PublicKey, &cred.AttestationType, &cred.AAGUID,
+		&cred.SignCount, &cred.Transports, &cred.Flags, &cred.Name, &cred.CreatedAt, &lastUsedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	
+	if lastUsedAt.Valid {
+		cred.LastUsedAt = &lastUsedAt.Time
+	}
+	
+	return &cred, nil
+}
+
+// CreateWebAuthnCredential 保存注册成功的WebAuthn凭据
+func CreateWebAuthnCredential(db *Database, cred *WebAuthnCredential) (int64, error) {
+	query := `
+	INSERT INTO webauthn_credentials (user_id, credential_id, public_key, attestation_type, aaguid,
+		sign_count, transports, flags, name, created_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	
+	return insertReturningID(db, query,
+		cred.UserID, cred.CredentialID, cred.PublicKey, cred.AttestationType, cred.AAGUID,
+		cred.SignCount, cred.Transports, cred.Flags, cred.Name, time.Now(),
+	)
+}
+
+// GetWebAuthnCredentialsByUser 获取用户的全部WebAuthn凭据
+func GetWebAuthnCredentialsByUser(db *Database, userID int) ([]*WebAuthnCredential, error) {
+	query := `SELECT ` + webAuthnCredentialColumns + ` FROM webauthn_credentials WHERE user_id = ? ORDER BY id`
+	
+	rows, err := db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	
+	var creds []*WebAuthnCredential
+	for rows.Next() {
+		cred, err := scanWebAuthnCredential(rows)
+		if err != nil {
+			return nil, err
+		}
+		creds = append(creds, cred)
+	}
+	
+	return creds, rows.Err()
+}
+
+// GetWebAuthnCredentialByCredentialID 根据认证器返回的凭据ID查找凭据
+func GetWebAuthnCredentialByCredentialID(db *Database, credentialID []byte) (*WebAuthnCredential, error) {
+	query := `SELECT ` + webAuthnCredentialColumns + ` FROM webauthn_credentials WHERE credential_id = ?`
+	return scanWebAuthnCredential(db.QueryRow(query, credentialID))
+}
+
+// CountWebAuthnCredentials 用户已注册的WebAuthn凭据数量
+func CountWebAuthnCredentials(db *Database, userID int) (int, error) {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM webauthn_credentials WHERE user_id = ?", userID).Scan(&count)
+	return count, err
+}
+
+// UpdateWebAuthnCredentialUsage 登录成功后更新签名计数器和标志位
+func UpdateWebAuthnCredentialUsage(db *Database, id int, signCount uint32, flags uint8) error {
+	query := `UPDATE webauthn_credentials SET sign_count = ?, flags = ?, last_used_at = ? WHERE id = ?`
+	_, err := db.Exec(query, signCount, flags, time.Now(), id)
+	return err
+}
+
+// RenameWebAuthnCredential 重命名凭据，凭据不存在或不属于该用户时返回 sql.ErrNoRows
+func RenameWebAuthnCredential(db *Database, userID, id int, name string) error {
+	result, err := db.Exec("UPDATE webauthn_credentials SET name = ? WHERE id = ? AND user_id = ?", name, id, userID)
+	if err != nil {
+		return err
+	}
+	
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	
+	return nil
+}
+
+// DeleteWebAuthnCredential 删除凭据，凭据不存在或不属于该用户时返回 sql.ErrNoRows
+func DeleteWebAuthnCredential(db *Database, userID, id int) error {
+	result, err := db.Exec("DELETE FROM webauthn_credentials WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return err
+	}
+	
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	
+	return nil
+}
+
+// DeleteUserWebAuthnCredentials 删除用户的全部WebAuthn凭据
+func DeleteUserWebAuthnCredentials(db *Database, userID int) error {
+	_, err := db.Exec("DELETE FROM webauthn_credentials WHERE user_id = ?", userID)
+	return err
+}
+
+// HasSecondFactor 用户是否启用了任意一种第二因素（TOTP或WebAuthn凭据）
+func HasSecondFactor(db *Database, userID int) (bool, error) {
+	enabled, err := IsMFAEnabled(db, userID)
+	if err != nil || enabled {
+		return enabled, err
+	}
+	
+	count, err := CountWebAuthnCredentials(db, userID)
+	if err != nil {
+		return false, err
+	}
+	
+	return count > 0, nil
+}
+
+// SaveWebAuthnChallenge 保存注册或登录流程的挑战数据，userID 为 0 表示无用户名登录
+func SaveWebAuthnChallenge(db *Database, id string, userID int, ceremony, data string, expiresAt time.Time) error {
+	query := `
+	INSERT INTO webauthn_challenges (id, user_id, ceremony, session_data, expires_at, created_at)
+	VALUES (?, ?, ?, ?, ?, ?)
+	`
+	
+	_, err := db.Exec(query, id, userID, ceremony, data, expiresAt, time.Now())
+	return err
+}
+
+// ConsumeWebAuthnChallenge 取出并删除挑战数据，每个挑战只能使用一次，过期或不存在时返回 sql.ErrNoRows
+func ConsumeWebAuthnChallenge(db *Database, id, ceremony string) (int, string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, "", err
+	}
+	defer tx.Rollback()
+	
+	var userID int
+	var data string
+	var expiresAt time.Time
+	err = tx.QueryRow(
+		"SELECT user_id, session_data, expires_at FROM webauthn_challenges WHERE id = ? AND ceremony = ?",
+		id, ceremony,
+	).Scan(&userID, &data, &expiresAt)
+	if err != nil {
+		return 0, "", err
+	}
+	
+	if _, err := tx.Exec("DELETE FROM webauthn_challenges WHERE id = ?", id); err != nil {
+		return 0, "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, "", err
+	}
+	
+	if time.Now().After(expiresAt) {
+		return 0, "", sql.ErrNoRows
+	}
+	
+	return userID, data, nil
+}
+
+// DeleteExpiredWebAuthnChallenges 清理过期的挑战数据
+func DeleteExpiredWebAuthnChallenges(db *Database) (int64, error) {
+	result, err := db.Exec("DELETE FROM webauthn_challenges WHERE expires_at < ?", time.Now())
+	if err != nil {
+		return 0, err
+	}
+	
+	return result.RowsAffected()
+}
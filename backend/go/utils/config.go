@@ -1,12 +1,13 @@
 package utils
 
-import (
-	"encoding/json"
-	"fmt"
-	"os"
-)
+import "os"
 
+// Config 程序配置。reload:"restart" 标记的配置项修改后需要重启才能生效，热重载时保持原值；
+// secret:"true" 标记的配置项在打印配置时隐藏
 type Config struct {
+	// 运行环境：development 或 production，production 下存在不安全的默认配置时拒绝启动
+	Env string `json:"env" reload:"restart"`
+	
 	Server struct {
 		Host   string `json:"host"`
 		Port   string `json:"port"`
@@ -15,78 +16,168 @@ type Config struct {
 			Enabled bool   `json:"enabled"`
 			Cert    string `json:"cert"`
 			Key     string `json:"key"`
+			// 通过 ACME 自动申请证书，启用后忽略 cert 和 key
+			ACME struct {
+				Enabled       bool   `json:"enabled"`
+				Email         string `json:"email"`          // CA 用来发送证书到期等通知的邮箱
+				DirectoryURL  string `json:"directory_url"`  // 留空使用 Let's Encrypt，测试时可指向 Pebble
+				CAFile        string `json:"ca_file"`        // 访问 ACME 服务器时额外信任的根证书，如 Pebble 的测试证书
+				CacheDir      string `json:"cache_dir"`      // 账号密钥和证书的缓存目录
+				HTTPPort      string `json:"http_port"`      // 响应 HTTP-01 验证并把其他请求重定向到 HTTPS 的端口
+				CustomDomains bool   `json:"custom_domains"` // 为用户已验证的自定义域名按需申请证书
+			} `json:"acme"`
 		} `json:"ssl"`
-	} `json:"server"`
+	} `json:"server" reload:"restart"`
 	
 	Database struct {
-		Path          string `json:"path"`
-		PythonEnabled bool   `json:"python_enabled"`
-		PythonScript  string `json:"python_script"`
+		Driver string `json:"driver" reload:"restart"`            // sqlite 或 postgres
+		Path   string `json:"path" reload:"restart"`              // SQLite 数据库文件
+		DSN    string `json:"dsn" reload:"restart" secret:"true"` // PostgreSQL 连接串
+		// 数据库维护任务的执行间隔，0 使用默认值，负数表示不执行
+		Maintenance struct {
+			IntegrityCheckInterval int `json:"integrity_check_interval"` // PRAGMA quick_check 间隔，分钟
+			CheckpointInterval     int `json:"checkpoint_interval"`      // WAL 检查点间隔，分钟
+			AnalyzeInterval        int `json:"analyze_interval"`         // ANALYZE 间隔，小时
+			VacuumInterval         int `json:"vacuum_interval"`          // VACUUM 间隔，小时
+		} `json:"maintenance"`
 	} `json:"database"`
 	
 	Email struct {
-		StoragePath    string `json:"storage_path"`
+		StoragePath    string `json:"storage_path" reload:"restart"`
 		MaxEmailSize   int64  `json:"max_email_size"`
 		DefaultDomain  string `json:"default_domain"`
-		AttachmentPath string `json:"attachment_path"`
+		AttachmentPath string `json:"attachment_path" reload:"restart"`
 	} `json:"email"`
 	
 	Security struct {
-		JWTSecret      string `json:"jwt_secret"`
-		TokenExpiry    int    `json:"token_expiry"`
-		RateLimit      int    `json:"rate_limit"`
-		CorsOrigins    string `json:"cors_origins"`
+		JWTSecret         string `json:"jwt_secret" reload:"restart" secret:"true"` // 已不再使用，保留以兼容旧配置文件。JWT和CSRF令牌使用数据库中首次启动时生成的密钥
+		JWTAlgorithm      string `json:"jwt_algorithm"`       // JWT签名算法：EdDSA 或 RS256
+		JWTKeyRotation    int    `json:"jwt_key_rotation"`    // 签名密钥轮换周期，天
+		JWTKeyGracePeriod int    `json:"jwt_key_grace_period"` // 密钥退役后仍可用于验证的时间，小时
+		TokenExpiry       int    `json:"token_expiry"`        // 会话（刷新令牌）有效期，小时
+		AccessTokenExpiry int    `json:"access_token_expiry"` // 访问令牌有效期，分钟
+		RateLimit         int    `json:"rate_limit"`      // 每个用户（未登录时按IP）每分钟的API请求数
+		AuthRateLimit     int    `json:"auth_rate_limit"` // 登录、注册等认证接口每个IP每分钟的请求数
+		SendRateLimit     int    `json:"send_rate_limit"` // 每个用户每小时最多发送的邮件数
+		CorsOrigins       string `json:"cors_origins"`    // 允许跨域访问的来源，逗号分隔，* 表示任意来源
+		GeoIPFile         string `json:"geoip_file"`      // IP段到位置的CSV文件（cidr,位置），用于显示登录设备的大致位置
+		// 反向代理的地址或网段，只有请求来自这些地址时才信任 X-Real-IP、X-Forwarded-For 和 X-Forwarded-Proto
+		TrustedProxies []string `json:"trusted_proxies"`
 	} `json:"security"`
 	
 	Admin struct {
 		FirstUserAdmin bool `json:"first_user_admin"`
+		Require2FA     bool `json:"require_2fa"` // 管理员账号必须启用两步验证才能使用管理功能
 	} `json:"admin"`
 	
 	WebSocket struct {
-		Enabled        bool `json:"enabled"`
+		Enabled        bool `json:"enabled" reload:"restart"`
 		PingInterval   int  `json:"ping_interval"`
 		MaxMessageSize int  `json:"max_message_size"`
 	} `json:"websocket"`
+	
+	Push struct {
+		Enabled         bool   `json:"enabled"`
+		VAPIDPublicKey  string `json:"vapid_public_key" reload:"restart"`
+		VAPIDPrivateKey string `json:"vapid_private_key" reload:"restart" secret:"true"`
+		VAPIDSubject    string `json:"vapid_subject"`
+		TTL             int    `json:"ttl"`
+		// 仅用于测试：允许 http 和回环、内网地址的推送服务，生产环境中会让用户借推送让服务器访问内网
+		AllowInsecureEndpoints bool `json:"allow_insecure_endpoints"`
+	} `json:"push"`
+	
+	WebAuthn struct {
+		RPID          string   `json:"rp_id"` // 留空时使用 server.domain
+		RPDisplayName string   `json:"rp_display_name"`
+		RPOrigins     []string `json:"rp_origins"` // 允许的来源，留空时根据域名和端口推导
+		Timeout       int      `json:"timeout"`    // 注册和登录流程的有效期，秒
+	} `json:"webauthn"`
+	
+	OIDC struct {
+		Enabled              bool     `json:"enabled"`
+		ProviderName         string   `json:"provider_name"` // 登录页按钮上显示的名称
+		IssuerURL            string   `json:"issuer_url"`
+		ClientID             string   `json:"client_id"`
+		ClientSecret         string   `json:"client_secret" secret:"true"`
+		RedirectURL          string   `json:"redirect_url"` // 例如 https://mail.example.com/api/auth/oidc/callback
+		Scopes               []string `json:"scopes"`
+		UsernameClaim        string   `json:"username_claim"`
+		AdminClaim           string   `json:"admin_claim"`  // 例如 groups，留空则不根据声明同步管理员
+		AdminValues          []string `json:"admin_values"` // 声明中包含任意一个值即为管理员
+		AutoCreateUsers      bool     `json:"auto_create_users"`
+		DisableLocalPassword bool     `json:"disable_local_password"` // 禁用本地密码登录和注册，只能通过单点登录
+	} `json:"oidc"`
+	
+	LDAP struct {
+		Enabled            bool   `json:"enabled"`
+		URL                string `json:"url"` // ldap://host:389 或 ldaps://host:636
+		StartTLS           bool   `json:"start_tls"`
+		InsecureSkipVerify bool   `json:"insecure_skip_verify"` // 仅用于测试环境的自签名证书
+		BindDN             string `json:"bind_dn"`              // 用于查找和同步用户的服务账号
+		BindPassword       string `json:"bind_password" secret:"true"`
+		BaseDN             string `json:"base_dn"`
+		UserFilter         string `json:"user_filter"` // 例如 (objectClass=inetOrgPerson)
+		EmailAttribute     string `json:"email_attribute"`
+		UsernameAttribute  string `json:"username_attribute"`  // OpenLDAP 为 uid，AD 为 sAMAccountName
+		UniqueIDAttribute  string `json:"unique_id_attribute"` // OpenLDAP 为 entryUUID，AD 为 objectGUID
+		GroupAttribute     string `json:"group_attribute"`     // 用户条目上记录所属组的属性
+		AdminGroupDN       string `json:"admin_group_dn"`      // 该组成员为管理员，留空则不同步管理员
+		AutoCreateUsers    bool   `json:"auto_create_users"`
+		SyncInterval       int    `json:"sync_interval" reload:"restart"` // 目录同步间隔，分钟，0 表示不定期同步
+		Timeout            int    `json:"timeout"`       // 连接超时，秒
+	} `json:"ldap"`
+	
+	Account struct {
+		RequireEmailVerification bool   `json:"require_email_verification"` // 新注册的账号需验证邮箱后才能登录
+		TokenDelivery            string `json:"token_delivery"`             // system（站内系统消息）或 smtp（外发邮件）
+		PublicURL                string `json:"public_url"`                 // 邮件中链接使用的地址，留空时根据域名和端口推导
+		PasswordResetTTL         int    `json:"password_reset_ttl"`         // 密码重置链接有效期，分钟
+		VerificationTTL          int    `json:"verification_ttl"`           // 邮箱验证链接有效期，小时
+		MaxRequestsPerHour       int    `json:"max_requests_per_hour"`      // 每个邮箱地址每小时最多发送的链接数量
+	} `json:"account"`
+	
+	SMTP struct {
+		Host     string `json:"host"`
+		Port     int    `json:"port"`
+		Username string `json:"username"`
+		Password string `json:"password" secret:"true"`
+		From     string `json:"from"`
+		TLS      bool   `json:"tls"` // 使用隐式TLS（通常为465端口），否则在服务器支持时使用 STARTTLS
+	} `json:"smtp"`
+	
+	LoginProtection struct {
+		Enabled            bool `json:"enabled"`
+		AccountThreshold   int  `json:"account_threshold"`    // 同一账号连续失败多少次后锁定
+		IPThreshold        int  `json:"ip_threshold"`         // 同一IP连续失败多少次后封禁
+		DelayThreshold     int  `json:"delay_threshold"`      // 同一账号连续失败多少次后开始要求等待
+		MaxDelay           int  `json:"max_delay"`            // 两次尝试之间的最长等待时间，秒
+		FailureWindow      int  `json:"failure_window"`       // 失败次数的统计窗口，分钟
+		LockoutDuration    int  `json:"lockout_duration"`     // 首次锁定时长，分钟，之后每次锁定时长翻倍
+		MaxLockoutDuration int  `json:"max_lockout_duration"` // 最长锁定时长，分钟
+	} `json:"login_protection"`
+	
+	// 日志级别修改后立即生效，其他配置项需要重启
+	Logging struct {
+		Level          string            `json:"level"`                            // debug、info、warn 或 error
+		Levels         map[string]string `json:"levels"`                           // 按子系统覆盖级别，如 {"auth": "debug", "db": "warn"}
+		Format         string            `json:"format" reload:"restart"`          // json 或 text
+		Dir            string            `json:"dir" reload:"restart"`             // 日志文件目录，留空输出到标准输出
+		MaxSize        int               `json:"max_size" reload:"restart"`        // 单个日志文件的最大大小，MB
+		RotateInterval int               `json:"rotate_interval" reload:"restart"` // 按时间轮转的间隔，小时，0 表示只按大小轮转
+		MaxBackups     int               `json:"max_backups" reload:"restart"`     // 最多保留的历史日志文件数，0 表示不限制
+		MaxAge         int               `json:"max_age" reload:"restart"`         // 历史日志文件的保留天数，0 表示不限制
+	} `json:"logging"`
 }
 
+// LoadConfig 按默认值、配置文件、SWIFTPOST_* 环境变量的顺序加载配置，不包含命令行参数
 func LoadConfig(filename string) (*Config, error) {
-	config := &Config{}
-	
-	// 检查配置文件是否存在
-	if _, err := os.Stat(filename); os.IsNotExist(err) {
-		// 创建默认配置
-		config = createDefaultConfig()
-		
-		// 保存默认配置到文件
-		data, err := json.MarshalIndent(config, "", "  ")
-		if err != nil {
-			return nil, fmt.Errorf("无法序列化默认配置: %v", err)
-		}
-		
-		if err := os.WriteFile(filename, data, 0644); err != nil {
-			return nil, fmt.Errorf("无法创建配置文件: %v", err)
-		}
-		
-		PrintColored("📝 已创建默认配置文件: "+filename, 0, ColorGreen)
-		return config, nil
-	}
-	
-	// 读取配置文件
-	data, err := os.ReadFile(filename)
-	if err != nil {
-		return nil, fmt.Errorf("无法读取配置文件: %v", err)
-	}
-	
-	// 解析 JSON
-	if err := json.Unmarshal(data, config); err != nil {
-		return nil, fmt.Errorf("无法解析配置文件: %v", err)
-	}
-	
-	return config, nil
+	loader := &ConfigLoader{File: filename, Env: os.Environ()}
+	return loader.Load()
 }
 
 func createDefaultConfig() *Config {
 	config := &Config{}
+	config.Env = ConfigEnvDevelopment
 	
 	// 服务器配置
 	config.Server.Host = "0.0.0.0"
@@ -95,11 +186,18 @@ func createDefaultConfig() *Config {
 	config.Server.SSL.Enabled = false
 	config.Server.SSL.Cert = ""
 	config.Server.SSL.Key = ""
+	config.Server.SSL.ACME.Enabled = false
+	config.Server.SSL.ACME.CacheDir = "data/acme"
+	config.Server.SSL.ACME.HTTPPort = "80"
+	config.Server.SSL.ACME.CustomDomains = true
 	
 	// 数据库配置
+	config.Database.Driver = "sqlite"
 	config.Database.Path = "data/swiftpost.db"
-	config.Database.PythonEnabled = true
-	config.Database.PythonScript = "start.py"
+	config.Database.Maintenance.IntegrityCheckInterval = 60 // 分钟
+	config.Database.Maintenance.CheckpointInterval = 5 // 分钟
+	config.Database.Maintenance.AnalyzeInterval = 24 // 小时
+	config.Database.Maintenance.VacuumInterval = 168 // 小时
 	
 	// 邮件配置
 	config.Email.StoragePath = "data/emails"
@@ -109,26 +207,90 @@ func createDefaultConfig() *Config {
 	
 	// 安全配置
 	config.Security.JWTSecret = "your-secret-key-change-this-in-production"
+	config.Security.JWTAlgorithm = JWTAlgorithmEdDSA
+	config.Security.JWTKeyRotation = 30 // 天
+	config.Security.JWTKeyGracePeriod = 72 // 小时
 	config.Security.TokenExpiry = 72 // 小时
+	config.Security.AccessTokenExpiry = 15 // 分钟
 	config.Security.RateLimit = 100
+	config.Security.AuthRateLimit = 20
+	config.Security.SendRateLimit = 100
 	config.Security.CorsOrigins = "*"
+	config.Security.TrustedProxies = []string{"127.0.0.1/32", "::1/128"} // 同一台机器上的 nginx
 	
 	// 管理员配置
 	config.Admin.FirstUserAdmin = true
+	config.Admin.Require2FA = false
 	
 	// WebSocket 配置
 	config.WebSocket.Enabled = true
 	config.WebSocket.PingInterval = 30
 	config.WebSocket.MaxMessageSize = 1024 * 1024 // 1MB
 	
+	// Web Push 配置（VAPID 密钥在首次启动时生成）
+	config.Push.Enabled = true
+	config.Push.VAPIDSubject = "mailto:admin@swiftpost.local"
+	config.Push.TTL = 86400 // 秒
+	
+	// WebAuthn（通行密钥）配置
+	config.WebAuthn.RPID = ""
+	config.WebAuthn.RPDisplayName = "SwiftPost"
+	config.WebAuthn.Timeout = 300 // 秒
+	
+	// OpenID Connect 单点登录配置
+	config.OIDC.Enabled = false
+	config.OIDC.ProviderName = "企业账号"
+	config.OIDC.Scopes = []string{"openid", "profile", "email"}
+	config.OIDC.UsernameClaim = "preferred_username"
+	config.OIDC.AutoCreateUsers = true
+	config.OIDC.DisableLocalPassword = false
+	
+	// LDAP / Active Directory 认证配置
+	config.LDAP.Enabled = false
+	config.LDAP.UserFilter = "(objectClass=inetOrgPerson)"
+	config.LDAP.EmailAttribute = "mail"
+	config.LDAP.UsernameAttribute = "uid"
+	config.LDAP.UniqueIDAttribute = "entryUUID"
+	config.LDAP.GroupAttribute = "memberOf"
+	config.LDAP.AutoCreateUsers = true
+	config.LDAP.SyncInterval = 60 // 分钟
+	config.LDAP.Timeout = 10      // 秒
+	
+	// 密码重置和邮箱验证配置
+	config.Account.RequireEmailVerification = false
+	config.Account.TokenDelivery = "system"
+	config.Account.PasswordResetTTL = 30 // 分钟
+	config.Account.VerificationTTL = 48  // 小时
+	config.Account.MaxRequestsPerHour = 3
+	
+	// 外发邮件配置
+	config.SMTP.Port = 587
+	config.SMTP.From = "no-reply@swiftpost.local"
+	
+	// 登录防暴力破解配置
+	config.LoginProtection.Enabled = true
+	config.LoginProtection.AccountThreshold = 5
+	config.LoginProtection.IPThreshold = 20
+	config.LoginProtection.DelayThreshold = 3
+	config.LoginProtection.MaxDelay = 30        // 秒
+	config.LoginProtection.FailureWindow = 15   // 分钟
+	config.LoginProtection.LockoutDuration = 15 // 分钟
+	config.LoginProtection.MaxLockoutDuration = 24 * 60
+	
+	// 日志配置
+	config.Logging.Level = "info"
+	config.Logging.Levels = map[string]string{}
+	config.Logging.Format = "json"
+	config.Logging.Dir = ""
+	config.Logging.MaxSize = 100       // MB
+	config.Logging.RotateInterval = 24 // 小时
+	config.Logging.MaxBackups = 10
+	config.Logging.MaxAge = 30 // 天
+	
 	return config
 }
 
+// Save 按文件扩展名对应的格式保存配置
 func (c *Config) Save(filename string) error {
-	data, err := json.MarshalIndent(c, "", "  ")
-	if err != nil {
-		return err
-	}
-	
-	return os.WriteFile(filename, data, 0644)
+	return writeConfigFile(filename, c)
 }
\ No newline at end of file
@@ -0,0 +1,133 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 运行环境
+const (
+	ConfigEnvDevelopment = "development"
+	ConfigEnvProduction  = "production"
+)
+
+// defaultDomain 默认配置中的示例域名
+const defaultDomain = "swiftpost.local"
+
+// ConfigIssue 配置检查发现的一个问题
+type ConfigIssue struct {
+	Key     string
+	Message string
+}
+
+func (i ConfigIssue) String() string {
+	return i.Key + ": " + i.Message
+}
+
+// ConfigErrors 配置检查发现的全部错误
+type ConfigErrors []ConfigIssue
+
+func (e ConfigErrors) Error() string {
+	lines := make([]string, len(e))
+	for i, issue := range e {
+		lines[i] = "  " + issue.String()
+	}
+	return fmt.Sprintf("配置检查发现 %d 个错误:\n%s", len(e), strings.Join(lines, "\n"))
+}
+
+// sortConfigIssues 按配置项排序，同一个配置项保持原来的顺序
+func sortConfigIssues(issues []ConfigIssue) {
+	sort.SliceStable(issues, func(i, j int) bool { return issues[i].Key < issues[j].Key })
+}
+
+// InsecureDefaults 检查仍在使用的不安全默认配置，生产环境中这些问题会阻止启动
+func InsecureDefaults(config *Config) []ConfigIssue {
+	var issues []ConfigIssue
+	if config.Server.Domain == defaultDomain {
+		issues = append(issues, ConfigIssue{Key: "server.domain", Message: "仍是示例域名 " + defaultDomain + "，请设置实际对外提供服务的域名"})
+	}
+	return issues
+}
+
+// configWarnings 不影响启动但需要注意的配置
+func configWarnings(config *Config) []ConfigIssue {
+	var issues []ConfigIssue
+	if config.Env == ConfigEnvProduction {
+		for _, origin := range strings.Split(config.Security.CorsOrigins, ",") {
+			if strings.TrimSpace(origin) == "*" {
+				issues = append(issues, ConfigIssue{Key: "security.cors_origins", Message: "允许任意来源跨域访问，建议只列出前端实际使用的来源"})
+				break
+			}
+		}
+	}
+	if port, err := strconv.Atoi(config.Server.Port); err == nil && port < 1024 && os.Geteuid() > 0 {
+		issues = append(issues, ConfigIssue{Key: "server.port", Message: fmt.Sprintf("端口 %d 小于 1024，非 root 用户需要 CAP_NET_BIND_SERVICE 权限才能监听", port)})
+	}
+	return issues
+}
+
+// CheckConfig 清理并验证配置，返回需要提示的警告。不安全的默认配置在生产环境中作为错误返回，
+// 其他环境中作为警告；返回的错误为 ConfigErrors，包含全部错误
+func CheckConfig(config *Config) ([]ConfigIssue, error) {
+	SanitizeConfig(config)
+	
+	var errs ConfigErrors
+	if err := ValidateConfig(config); err != nil {
+		errs = append(errs, err.(ConfigErrors)...)
+	}
+	
+	warnings := configWarnings(config)
+	if config.Env == ConfigEnvProduction {
+		errs = append(errs, InsecureDefaults(config)...)
+	} else {
+		warnings = append(warnings, InsecureDefaults(config)...)
+	}
+	sortConfigIssues(warnings)
+	
+	if len(errs) > 0 {
+		sortConfigIssues(errs)
+		return warnings, errs
+	}
+	return warnings, nil
+}
+
+// UnknownConfigKeys 列出配置文件中无法识别的配置项，通常是拼写错误
+func UnknownConfigKeys(filename string) ([]string, error) {
+	data, err := decodeConfigFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]interface{}{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("无法解析配置文件: %v", err)
+	}
+	
+	known := make(map[string]bool)
+	for _, field := range configFields(createDefaultConfig()) {
+		known[field.Key] = true
+		for key := field.Key; strings.Contains(key, "."); {
+			key = key[:strings.LastIndex(key, ".")]
+			known[key+"."] = true
+		}
+	}
+	
+	var unknown []string
+	var walk func(values map[string]interface{}, prefix string)
+	walk = func(values map[string]interface{}, prefix string) {
+		for name, value := range values {
+			key := prefix + name
+			if nested, ok := value.(map[string]interface{}); ok && known[key+"."] {
+				walk(nested, key+".")
+			} else if !known[key] {
+				unknown = append(unknown, key)
+			}
+		}
+	}
+	walk(values, "")
+	sort.Strings(unknown)
+	return unknown, nil
+}
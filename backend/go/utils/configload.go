@@ -0,0 +1,427 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigEnvPrefix 覆盖配置项的环境变量前缀，server.ssl.enabled 对应 SWIFTPOST_SERVER_SSL_ENABLED
+const ConfigEnvPrefix = "SWIFTPOST_"
+
+// configEnvAliases systemd/swiftpost.env 中沿用的旧变量名，同时设置时以完整路径的变量为准
+var configEnvAliases = map[string]string{
+	"SWIFTPOST_HOST":                "server.host",
+	"SWIFTPOST_PORT":                "server.port",
+	"SWIFTPOST_DOMAIN":              "server.domain",
+	"SWIFTPOST_SSL_ENABLED":         "server.ssl.enabled",
+	"SWIFTPOST_SSL_CERT":            "server.ssl.cert",
+	"SWIFTPOST_SSL_KEY":             "server.ssl.key",
+	"SWIFTPOST_DB_PATH":             "database.path",
+	"SWIFTPOST_MAX_EMAIL_SIZE":      "email.max_email_size",
+	"SWIFTPOST_STORAGE_PATH":        "email.storage_path",
+	"SWIFTPOST_ATTACHMENT_PATH":     "email.attachment_path",
+	"SWIFTPOST_JWT_SECRET":          "security.jwt_secret",
+	"SWIFTPOST_TOKEN_EXPIRY":        "security.token_expiry",
+	"SWIFTPOST_RATE_LIMIT":          "security.rate_limit",
+	"SWIFTPOST_WS_ENABLED":          "websocket.enabled",
+	"SWIFTPOST_WS_PING_INTERVAL":    "websocket.ping_interval",
+	"SWIFTPOST_WS_MAX_MESSAGE_SIZE": "websocket.max_message_size",
+	"SWIFTPOST_LOG_LEVEL":           "logging.level",
+	"SWIFTPOST_LOG_PATH":            "logging.dir",
+	"SWIFTPOST_LOG_MAX_SIZE":        "logging.max_size",
+	"SWIFTPOST_LOG_MAX_BACKUPS":     "logging.max_backups",
+	"SWIFTPOST_LOG_MAX_AGE":         "logging.max_age",
+}
+
+// ConfigLoader 按默认值、配置文件、SWIFTPOST_* 环境变量、命令行参数的顺序合并配置，
+// 后面的来源覆盖前面的。热重载时用同一个 ConfigLoader 重新加载
+type ConfigLoader struct {
+	File  string            // 配置文件，按扩展名识别 .json、.yaml、.yml 或 .toml
+	Env   []string          // 环境变量，格式同 os.Environ()
+	Flags map[string]string // 命令行中显式设置的配置项，键为 server.port 这样的路径
+}
+
+// configField 配置中的一个叶子项
+type configField struct {
+	Key     string // 点分隔的路径，如 server.ssl.enabled
+	Value   reflect.Value
+	Restart bool
+	Secret  bool
+}
+
+// configFields 按结构体中的顺序列出全部配置项，路径取自 json 标签
+func configFields(config *Config) []configField {
+	var fields []configField
+	var walk func(v reflect.Value, prefix string, restart bool)
+	walk = func(v reflect.Value, prefix string, restart bool) {
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if name == "" || name == "-" {
+				continue
+			}
+			
+			key := prefix + name
+			fieldRestart := restart || field.Tag.Get("reload") == "restart"
+			if field.Type.Kind() == reflect.Struct {
+				walk(v.Field(i), key+".", fieldRestart)
+				continue
+			}
+			fields = append(fields, configField{
+				Key:     key,
+				Value:   v.Field(i),
+				Restart: fieldRestart,
+				Secret:  field.Tag.Get("secret") == "true",
+			})
+		}
+	}
+	walk(reflect.ValueOf(config).Elem(), "", false)
+	return fields
+}
+
+// configEnvName 配置项对应的环境变量名
+func configEnvName(key string) string {
+	return ConfigEnvPrefix + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// setConfigValue 把字符串形式的值写入配置项，列表用逗号分隔，映射写成 key=value,key=value
+func setConfigValue(field configField, raw string) error {
+	v := field.Value
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(raw))
+		if err != nil {
+			return fmt.Errorf("需要布尔值，实际为 %q", raw)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(strings.TrimSpace(raw), 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("需要整数，实际为 %q", raw)
+		}
+		v.SetInt(n)
+	case reflect.Slice:
+		items := []string{}
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	case reflect.Map:
+		items := map[string]string{}
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			name, value, ok := strings.Cut(item, "=")
+			if !ok {
+				return fmt.Errorf("需要 key=value 形式，实际为 %q", item)
+			}
+			items[strings.TrimSpace(name)] = strings.TrimSpace(value)
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("不支持通过字符串设置")
+	}
+	return nil
+}
+
+// Load 合并全部来源得到配置。配置文件不存在且为 JSON 格式时写入默认配置，与之前的行为一致
+func (l *ConfigLoader) Load() (*Config, error) {
+	config := createDefaultConfig()
+	
+	if l.File != "" {
+		if _, err := os.Stat(l.File); os.IsNotExist(err) && configFileFormat(l.File) == "json" {
+			if err := writeConfigFile(l.File, config); err != nil {
+				return nil, fmt.Errorf("无法创建配置文件: %v", err)
+			}
+			PrintColored("📝 已创建默认配置文件: "+l.File, 0, ColorGreen)
+		} else if err := readConfigFile(l.File, config); err != nil {
+			return nil, err
+		}
+	}
+	
+	fields := configFields(config)
+	byKey := make(map[string]configField, len(fields))
+	for _, field := range fields {
+		byKey[field.Key] = field
+	}
+	
+	env := make(map[string]string)
+	for _, entry := range l.Env {
+		if name, value, ok := strings.Cut(entry, "="); ok && strings.HasPrefix(name, ConfigEnvPrefix) {
+			env[name] = value
+		}
+	}
+	
+	var errs []string
+	aliases := make([]string, 0, len(configEnvAliases))
+	for name := range configEnvAliases {
+		aliases = append(aliases, name)
+	}
+	sort.Strings(aliases)
+	for _, name := range aliases {
+		key := configEnvAliases[name]
+		value, ok := env[name]
+		if _, canonical := env[configEnvName(key)]; !ok || canonical {
+			continue
+		}
+		if err := setConfigValue(byKey[key], value); err != nil {
+			errs = append(errs, "环境变量 "+name+": "+err.Error())
+		}
+	}
+	for _, field := range fields {
+		if value, ok := env[configEnvName(field.Key)]; ok {
+			if err := setConfigValue(field, value); err != nil {
+				errs = append(errs, "环境变量 "+configEnvName(field.Key)+": "+err.Error())
+			}
+		}
+	}
+	
+	for _, field := range fields {
+		if value, ok := l.Flags[field.Key]; ok {
+			if err := setConfigValue(field, value); err != nil {
+				errs = append(errs, "命令行参数 -"+field.Key+": "+err.Error())
+			}
+		}
+	}
+	
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("配置无效:\n  %s", strings.Join(errs, "\n  "))
+	}
+	return config, nil
+}
+
+// configFlag 命令行中的一个配置项，只记录显式设置的值
+type configFlag struct {
+	key    string
+	isBool bool
+	values map[string]string
+}
+
+func (f *configFlag) String() string {
+	if f == nil || f.values == nil {
+		return ""
+	}
+	return f.values[f.key]
+}
+
+func (f *configFlag) Set(value string) error {
+	f.values[f.key] = value
+	return nil
+}
+
+func (f *configFlag) IsBoolFlag() bool {
+	return f.isBool
+}
+
+// ConfigFlags 为每个配置项注册一个同名的命令行参数，如 -server.port 8080，
+// 返回的 map 在解析参数后包含显式设置的配置项，用作 ConfigLoader.Flags
+func ConfigFlags(fs *flag.FlagSet) map[string]string {
+	values := make(map[string]string)
+	for _, field := range configFields(createDefaultConfig()) {
+		usage := "配置项 " + field.Key
+		if field.Value.Kind() == reflect.Slice {
+			usage += "，多个值用逗号分隔"
+		}
+		fs.Var(&configFlag{key: field.Key, isBool: field.Value.Kind() == reflect.Bool, values: values}, field.Key, usage)
+	}
+	return values
+}
+
+// DefaultConfigFile 默认的配置文件，可以用 SWIFTPOST_CONFIG 环境变量指定
+func DefaultConfigFile() string {
+	if file := os.Getenv("SWIFTPOST_CONFIG"); file != "" {
+		return file
+	}
+	return "config.json"
+}
+
+// configFileFormat 根据扩展名判断配置文件格式，未知扩展名按 JSON 处理
+func configFileFormat(filename string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		return "yaml"
+	case ".toml":
+		return "toml"
+	default:
+		return "json"
+	}
+}
+
+// readConfigFile 读取配置文件覆盖 config 中的值，文件中没有的配置项保持不变
+func readConfigFile(filename string, config *Config) error {
+	data, err := decodeConfigFile(filename)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, config); err != nil {
+		return fmt.Errorf("无法解析配置文件: %v", err)
+	}
+	return nil
+}
+
+// decodeConfigFile 读取配置文件并统一转换成 JSON，YAML 和 TOML 与 JSON 配置文件使用相同的键名
+func decodeConfigFile(filename string) ([]byte, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("无法读取配置文件: %v", err)
+	}
+	
+	format := configFileFormat(filename)
+	if format == "json" {
+		return data, nil
+	}
+	
+	values := map[string]interface{}{}
+	if format == "yaml" {
+		err = yaml.Unmarshal(data, &values)
+	} else {
+		err = toml.Unmarshal(data, &values)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("无法解析配置文件: %v", err)
+	}
+	if data, err = json.Marshal(values); err != nil {
+		return nil, fmt.Errorf("无法解析配置文件: %v", err)
+	}
+	return data, nil
+}
+
+// ConfigMap 把配置转换成按 json 标签命名的嵌套 map，用于输出 YAML 和 TOML
+func ConfigMap(config *Config) (map[string]interface{}, error) {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	values := map[string]interface{}{}
+	if err := decoder.Decode(&values); err != nil {
+		return nil, err
+	}
+	
+	// 整数保持整数，避免 YAML 输出成科学计数法
+	var convert func(interface{}) interface{}
+	convert = func(value interface{}) interface{} {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			for key, item := range v {
+				v[key] = convert(item)
+			}
+		case []interface{}:
+			for i, item := range v {
+				v[i] = convert(item)
+			}
+		case json.Number:
+			if n, err := v.Int64(); err == nil {
+				return n
+			}
+			f, _ := v.Float64()
+			return f
+		}
+		return value
+	}
+	convert(values)
+	return values, nil
+}
+
+// MarshalConfig 按指定格式（json、yaml 或 toml）序列化配置
+func MarshalConfig(config *Config, format string) ([]byte, error) {
+	if format == "json" {
+		data, err := json.MarshalIndent(config, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(data, '\n'), nil
+	}
+	
+	values, err := ConfigMap(config)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	switch format {
+	case "yaml":
+		encoder := yaml.NewEncoder(&buf)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(values); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case "toml":
+		if err := toml.NewEncoder(&buf).Encode(values); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, fmt.Errorf("不支持的配置格式: %s", format)
+}
+
+// writeConfigFile 按扩展名对应的格式写入配置文件
+func writeConfigFile(filename string, config *Config) error {
+	data, err := MarshalConfig(config, configFileFormat(filename))
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, data, 0644)
+}
+
+// UpdateConfigFile 修改配置文件中的配置项。只读写默认值和文件中的配置，
+// 不会把环境变量和命令行参数的值写进文件
+func UpdateConfigFile(filename string, update func(*Config)) error {
+	config := createDefaultConfig()
+	if _, err := os.Stat(filename); err == nil {
+		if err := readConfigFile(filename, config); err != nil {
+			return err
+		}
+	}
+	
+	update(config)
+	return writeConfigFile(filename, config)
+}
+
+// RedactConfig 复制配置并隐藏密钥、密码等敏感配置项，用于打印和日志
+func RedactConfig(config *Config) *Config {
+	redacted := *config
+	for _, field := range configFields(&redacted) {
+		if field.Secret && field.Value.Kind() == reflect.String && field.Value.String() != "" {
+			field.Value.SetString("******")
+		}
+	}
+	return &redacted
+}
+
+var currentConfig atomic.Pointer[Config]
+
+// SetConfig 设置当前生效的配置，启动时加载一次后调用，热重载时整体替换
+func SetConfig(config *Config) {
+	currentConfig.Store(config)
+}
+
+// GetConfig 当前生效的配置。返回的配置在热重载时会被整体替换，调用方不要修改其中的值；
+// 未调用 SetConfig 时返回默认配置
+func GetConfig() *Config {
+	if config := currentConfig.Load(); config != nil {
+		return config
+	}
+	currentConfig.CompareAndSwap(nil, createDefaultConfig())
+	return currentConfig.Load()
+}
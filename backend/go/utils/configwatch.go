@@ -0,0 +1,105 @@
+package utils
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+	
+	"github.com/fsnotify/fsnotify"
+)
+
+// configLog 配置加载和热重载的日志
+var configLog = NewLogger("config")
+
+// configReloadMu 避免 SIGHUP 和文件监听同时重新加载
+var configReloadMu sync.Mutex
+
+// mergeReloadable 把 next 中需要重启才能生效的配置项恢复为 current 的值，返回被忽略修改的配置项
+func mergeReloadable(current, next *Config) []string {
+	var ignored []string
+	currentFields := configFields(current)
+	for i, field := range configFields(next) {
+		if !field.Restart {
+			continue
+		}
+		old := currentFields[i].Value
+		if !reflect.DeepEqual(old.Interface(), field.Value.Interface()) {
+			ignored = append(ignored, field.Key)
+			field.Value.Set(old)
+		}
+	}
+	return ignored
+}
+
+// ReloadConfig 重新加载配置并替换当前配置。需要重启才能生效的配置项保持原值，
+// 加载或检查失败时继续使用原来的配置
+func ReloadConfig(loader *ConfigLoader) error {
+	configReloadMu.Lock()
+	defer configReloadMu.Unlock()
+	
+	next, err := loader.Load()
+	if err != nil {
+		return err
+	}
+	warnings, err := CheckConfig(next)
+	if err != nil {
+		return err
+	}
+	for _, warning := range warnings {
+		configLog.Warn("配置警告 %s", warning)
+	}
+	
+	if ignored := mergeReloadable(GetConfig(), next); len(ignored) > 0 {
+		configLog.Warn("以下配置项需要重启后生效: %s", strings.Join(ignored, ", "))
+	}
+	SetConfig(next)
+	applyLogLevels(next)
+	configLog.Info("配置已重新加载")
+	return nil
+}
+
+// WatchConfigFile 监听配置文件的修改并自动重新加载。监听所在目录而不是文件本身，
+// 编辑器先写临时文件再重命名时也能收到通知；短时间内的多次修改只重新加载一次
+func WatchConfigFile(loader *ConfigLoader) (*fsnotify.Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err := watcher.Add(filepath.Dir(loader.File)); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+	
+	name := filepath.Clean(loader.File)
+	go func() {
+		var timer *time.Timer
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) != name || !event.Has(fsnotify.Write|fsnotify.Create|fsnotify.Rename) {
+					continue
+				}
+				if timer != nil {
+					timer.Stop()
+				}
+				timer = time.AfterFunc(300*time.Millisecond, func() {
+					if err := ReloadConfig(loader); err != nil {
+						configLog.Error("重新加载配置失败: %v", err)
+					}
+				})
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				configLog.Error("监听配置文件失败: %v", err)
+			}
+		}
+	}()
+	
+	return watcher, nil
+}
@@ -0,0 +1,92 @@
+package utils
+
+import (
+	"encoding/csv"
+	"net"
+	"os"
+	"strings"
+	"sync"
+)
+
+type geoIPRange struct {
+	network  *net.IPNet
+	location string
+}
+
+var (
+	geoIPMutex  sync.Mutex
+	geoIPFile   string
+	geoIPRanges []geoIPRange
+)
+
+// ApproximateLocation 根据IP返回大致位置描述，内网地址直接识别，公网地址查询配置的 GeoIP CSV 文件
+func ApproximateLocation(config *Config, ipStr string) string {
+	ip := net.ParseIP(ipStr)
+	if ip == nil {
+		return "未知"
+	}
+	if ip.IsLoopback() {
+		return "本机"
+	}
+	if ip.IsPrivate() || ip.IsLinkLocalUnicast() {
+		return "局域网"
+	}
+	
+	for _, r := range loadGeoIPRanges(config.Security.GeoIPFile) {
+		if r.network.Contains(ip) {
+			return r.location
+		}
+	}
+	
+	return "未知"
+}
+
+// loadGeoIPRanges 加载并缓存 GeoIP 文件，文件路径变化时重新加载
+func loadGeoIPRanges(filename string) []geoIPRange {
+	geoIPMutex.Lock()
+	defer geoIPMutex.Unlock()
+	
+	if filename == geoIPFile {
+		return geoIPRanges
+	}
+	
+	geoIPFile = filename
+	geoIPRanges = nil
+	if filename == "" {
+		return nil
+	}
+	
+	file, err := os.Open(filename)
+	if err != nil {
+		Error("打开GeoIP文件失败: %v", err)
+		return nil
+	}
+	defer file.Close()
+	
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+	
+	records, err := reader.ReadAll()
+	if err != nil {
+		Error("读取GeoIP文件失败: %v", err)
+		return nil
+	}
+	
+	for _, record := range records {
+		if len(record) < 2 {
+			continue
+		}
+		_, network, err := net.ParseCIDR(strings.TrimSpace(record[0]))
+		if err != nil {
+			continue
+		}
+		geoIPRanges = append(geoIPRanges, geoIPRange{
+			network:  network,
+			location: strings.TrimSpace(record[1]),
+		})
+	}
+	
+	Info("已加载 %d 条GeoIP记录", len(geoIPRanges))
+	return geoIPRanges
+}
@@ -0,0 +1,272 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+	
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// JWT 签名算法
+const (
+	JWTAlgorithmRS256 = "RS256"
+	JWTAlgorithmEdDSA = "EdDSA"
+)
+
+// rsaKeyBits RS256 签名密钥的长度
+const rsaKeyBits = 2048
+
+// SigningKey JWT签名密钥：ActivatesAt 之后用于签名，RetiresAt 之后只用于验证，ExpiresAt 之后完全失效
+type SigningKey struct {
+	KeyID       string
+	Algorithm   string
+	PrivateKey  crypto.Signer
+	ActivatesAt time.Time
+	RetiresAt   time.Time
+	ExpiresAt   time.Time
+}
+
+// keyring 当前进程使用的签名密钥，由 models 从数据库加载后设置
+var keyring struct {
+	sync.RWMutex
+	keys []*SigningKey
+}
+
+// SetSigningKeys 替换进程中的签名密钥
+func SetSigningKeys(keys []*SigningKey) {
+	keyring.Lock()
+	defer keyring.Unlock()
+	keyring.keys = keys
+}
+
+// currentSigningKey 已生效且未退役的密钥中最新的一个
+// 轮换任务没有按时运行时，退回使用最近生效且尚未失效的密钥，避免无法签发令牌
+func currentSigningKey() (*SigningKey, error) {
+	keyring.RLock()
+	defer keyring.RUnlock()
+	
+	now := time.Now()
+	var current, fallback *SigningKey
+	for _, key := range keyring.keys {
+		if key.ActivatesAt.After(now) || !key.ExpiresAt.After(now) {
+			continue
+		}
+		if key.RetiresAt.After(now) && (current == nil || key.ActivatesAt.After(current.ActivatesAt)) {
+			current = key
+		}
+		if fallback == nil || key.ActivatesAt.After(fallback.ActivatesAt) {
+			fallback = key
+		}
+	}
+	
+	if current != nil {
+		return current, nil
+	}
+	if fallback != nil {
+		return fallback, nil
+	}
+	return nil, errors.New("没有可用的签名密钥")
+}
+
+// verificationKey 按 kid 查找尚未失效的密钥，已发布但尚未开始签名的密钥同样可以验证
+func verificationKey(kid string) (*SigningKey, bool) {
+	keyring.RLock()
+	defer keyring.RUnlock()
+	
+	now := time.Now()
+	for _, key := range keyring.keys {
+		if key.KeyID == kid && key.ExpiresAt.After(now) {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+// ValidJWTAlgorithm 是否是支持的签名算法
+func ValidJWTAlgorithm(algorithm string) bool {
+	return algorithm == JWTAlgorithmRS256 || algorithm == JWTAlgorithmEdDSA
+}
+
+// GenerateSigningKey 生成新的签名密钥，kid 由公钥的 SHA-256 摘要得到
+func GenerateSigningKey(algorithm string) (*SigningKey, error) {
+	var privateKey crypto.Signer
+	var err error
+	switch algorithm {
+	case JWTAlgorithmRS256:
+		privateKey, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	case JWTAlgorithmEdDSA:
+		_, privateKey, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("不支持的签名算法: %s", algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+	
+	der, err := x509.MarshalPKIXPublicKey(privateKey.Public())
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(der)
+	
+	return &SigningKey{
+		KeyID:      base64.RawURLEncoding.EncodeToString(sum[:12]),
+		Algorithm:  algorithm,
+		PrivateKey: privateKey,
+	}, nil
+}
+
+// EncodePrivateKey 将私钥编码为 PKCS#8 PEM，用于保存到数据库
+func EncodePrivateKey(key crypto.Signer) (string, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), nil
+}
+
+// DecodePrivateKey 解析 PKCS#8 PEM 格式的私钥
+func DecodePrivateKey(encoded string) (crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(encoded))
+	if block == nil {
+		return nil, errors.New("无效的私钥格式")
+	}
+	
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("不支持的私钥类型")
+	}
+	return signer, nil
+}
+
+func signingMethod(algorithm string) jwt.SigningMethod {
+	if algorithm == JWTAlgorithmRS256 {
+		return jwt.SigningMethodRS256
+	}
+	return jwt.SigningMethodEdDSA
+}
+
+// signToken 使用当前签名密钥签发令牌，头部带上 kid
+func signToken(claims jwt.MapClaims) (string, error) {
+	key, err := currentSigningKey()
+	if err != nil {
+		return "", err
+	}
+	
+	token := jwt.NewWithClaims(signingMethod(key.Algorithm), claims)
+	token.Header["kid"] = key.KeyID
+	return token.SignedString(key.PrivateKey)
+}
+
+// parseToken 按头部的 kid 选择密钥验证签名，只接受该密钥对应的非对称算法
+func parseToken(tokenString string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := verificationKey(kid)
+		if !ok {
+			return nil, errors.New("未知的签名密钥")
+		}
+		if token.Method.Alg() != key.Algorithm {
+			return nil, errors.New("无效的签名方法")
+		}
+		return key.PrivateKey.Public(), nil
+	}, jwt.WithValidMethods([]string{JWTAlgorithmRS256, JWTAlgorithmEdDSA}))
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// JSONWebKey JWKS 中的一个公钥 (RFC 7517)
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+}
+
+// PublicJWKS 尚未失效的全部公钥，包括提前发布、尚未开始签名的新密钥
+func PublicJWKS() []JSONWebKey {
+	keyring.RLock()
+	defer keyring.RUnlock()
+	
+	now := time.Now()
+	var keys []*SigningKey
+	for _, key := range keyring.keys {
+		if key.ExpiresAt.After(now) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ActivatesAt.After(keys[j].ActivatesAt) })
+	
+	jwks := []JSONWebKey{}
+	for _, key := range keys {
+		jwk := JSONWebKey{KeyID: key.KeyID, Algorithm: key.Algorithm, Use: "sig"}
+		switch pub := key.PrivateKey.Public().(type) {
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		default:
+			continue
+		}
+		jwks = append(jwks, jwk)
+	}
+	return jwks
+}
+
+// SigningAlgorithm 配置的签名算法，未配置或无效时使用 EdDSA
+func SigningAlgorithm(config *Config) string {
+	if !ValidJWTAlgorithm(config.Security.JWTAlgorithm) {
+		return JWTAlgorithmEdDSA
+	}
+	return config.Security.JWTAlgorithm
+}
+
+// KeyRotationPeriod 签名密钥的使用期限
+func KeyRotationPeriod(config *Config) time.Duration {
+	if config.Security.JWTKeyRotation <= 0 {
+		return 30 * 24 * time.Hour
+	}
+	return time.Duration(config.Security.JWTKeyRotation) * 24 * time.Hour
+}
+
+// KeyGracePeriod 密钥退役后继续用于验证的时间
+// 不短于用这些密钥签名的所有令牌的最长有效期，否则密钥轮换后尚未过期的重置和验证链接会失效
+func KeyGracePeriod(config *Config) time.Duration {
+	grace := 72 * time.Hour
+	if config.Security.JWTKeyGracePeriod > 0 {
+		grace = time.Duration(config.Security.JWTKeyGracePeriod) * time.Hour
+	}
+	for _, ttl := range []time.Duration{AccessTokenTTL(config), mfaTokenTTL, PasswordResetTTL(config), VerificationTTL(config)} {
+		if grace < ttl {
+			grace = ttl
+		}
+	}
+	return grace
+}
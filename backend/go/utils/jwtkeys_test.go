@@ -0,0 +1,41 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestKeyGracePeriod(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(config *Config)
+		want  time.Duration
+	}{
+		{"默认配置", func(config *Config) {}, 72 * time.Hour},
+		{"配置的宽限期已足够", func(config *Config) { config.Security.JWTKeyGracePeriod = 96 }, 96 * time.Hour},
+		{"访问令牌有效期更长", func(config *Config) {
+			config.Security.JWTKeyGracePeriod = 1
+			config.Security.AccessTokenExpiry = 120
+			config.Account.VerificationTTL = 1
+		}, 2 * time.Hour},
+		{"密码重置链接有效期更长", func(config *Config) {
+			config.Security.JWTKeyGracePeriod = 1
+			config.Account.VerificationTTL = 1
+			config.Account.PasswordResetTTL = 180
+		}, 3 * time.Hour},
+		{"邮箱验证链接有效期更长", func(config *Config) {
+			config.Security.JWTKeyGracePeriod = 24
+			config.Account.VerificationTTL = 7 * 24
+		}, 7 * 24 * time.Hour},
+	}
+	
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{}
+			tt.setup(config)
+			if got := KeyGracePeriod(config); got != tt.want {
+				t.Fatalf("KeyGracePeriod = %v，应为 %v", got, tt.want)
+			}
+		})
+	}
+}
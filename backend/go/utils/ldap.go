@@ -0,0 +1,205 @@
+package utils
+
+import (
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+	
+	"github.com/go-ldap/ldap/v3"
+)
+
+// ErrLDAPUserNotFound 目录中不存在该用户
+var ErrLDAPUserNotFound = errors.New("目录中不存在该用户")
+
+// ErrLDAPInvalidCredentials 目录用户密码错误
+var ErrLDAPInvalidCredentials = errors.New("目录用户名或密码错误")
+
+// LDAPEntry 目录中的用户条目
+type LDAPEntry struct {
+	DN       string
+	UniqueID string
+	Username string
+	Email    string
+	Groups   []string
+}
+
+// InGroup 用户是否属于指定的组（DN 比较不区分大小写）
+func (e *LDAPEntry) InGroup(groupDN string) bool {
+	target, err := ldap.ParseDN(groupDN)
+	for _, group := range e.Groups {
+		if err != nil {
+			if strings.EqualFold(group, groupDN) {
+				return true
+			}
+			continue
+		}
+		if dn, err := ldap.ParseDN(group); err == nil && dn.EqualFold(target) {
+			return true
+		}
+	}
+	return false
+}
+
+// LDAPDirectory 已使用服务账号绑定的目录连接
+type LDAPDirectory struct {
+	conn   *ldap.Conn
+	config *Config
+}
+
+// DialLDAP 连接目录服务器，按配置启用 StartTLS，并使用服务账号绑定
+func DialLDAP(config *Config) (*LDAPDirectory, error) {
+	timeout := time.Duration(config.LDAP.Timeout) * time.Second
+	
+	tlsConfig := &tls.Config{InsecureSkipVerify: config.LDAP.InsecureSkipVerify}
+	if u, err := url.Parse(config.LDAP.URL); err == nil {
+		if host, _, err := net.SplitHostPort(u.Host); err == nil {
+			tlsConfig.ServerName = host
+		} else {
+			tlsConfig.ServerName = u.Host
+		}
+	}
+	
+	conn, err := ldap.DialURL(config.LDAP.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: timeout}),
+		ldap.DialWithTLSConfig(tlsConfig),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("连接LDAP服务器失败: %v", err)
+	}
+	conn.SetTimeout(timeout)
+	
+	if config.LDAP.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("LDAP StartTLS 失败: %v", err)
+		}
+	}
+	
+	d := &LDAPDirectory{conn: conn, config: config}
+	if err := d.bindService(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	
+	return d, nil
+}
+
+// bindService 使用服务账号绑定，未配置服务账号时使用匿名绑定
+func (d *LDAPDirectory) bindService() error {
+	var err error
+	if d.config.LDAP.BindDN == "" {
+		err = d.conn.UnauthenticatedBind("")
+	} else {
+		err = d.conn.Bind(d.config.LDAP.BindDN, d.config.LDAP.BindPassword)
+	}
+	if err != nil {
+		return fmt.Errorf("LDAP服务账号绑定失败: %v", err)
+	}
+	return nil
+}
+
+// Close 关闭目录连接
+func (d *LDAPDirectory) Close() {
+	d.conn.Close()
+}
+
+func (d *LDAPDirectory) attributes() []string {
+	return []string{
+		d.config.LDAP.EmailAttribute,
+		d.config.LDAP.UsernameAttribute,
+		d.config.LDAP.UniqueIDAttribute,
+		d.config.LDAP.GroupAttribute,
+	}
+}
+
+func (d *LDAPDirectory) toEntry(entry *ldap.Entry) *LDAPEntry {
+	// objectGUID 等二进制属性转为十六进制字符串
+	uniqueID := entry.GetRawAttributeValue(d.config.LDAP.UniqueIDAttribute)
+	id := string(uniqueID)
+	if !utf8.Valid(uniqueID) {
+		id = hex.EncodeToString(uniqueID)
+	}
+	if id == "" {
+		id = strings.ToLower(entry.DN)
+	}
+	
+	return &LDAPEntry{
+		DN:       entry.DN,
+		UniqueID: id,
+		Username: entry.GetAttributeValue(d.config.LDAP.UsernameAttribute),
+		Email:    strings.ToLower(strings.TrimSpace(entry.GetAttributeValue(d.config.LDAP.EmailAttribute))),
+		Groups:   entry.GetAttributeValues(d.config.LDAP.GroupAttribute),
+	}
+}
+
+// FindUser 按邮箱查找用户条目，找不到时返回 ErrLDAPUserNotFound
+func (d *LDAPDirectory) FindUser(email string) (*LDAPEntry, error) {
+	filter := fmt.Sprintf("(&%s(%s=%s))",
+		d.config.LDAP.UserFilter, d.config.LDAP.EmailAttribute, ldap.EscapeFilter(email))
+	
+	result, err := d.conn.Search(ldap.NewSearchRequest(
+		d.config.LDAP.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 0, false,
+		filter, d.attributes(), nil,
+	))
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+			return nil, ErrLDAPUserNotFound
+		}
+		return nil, fmt.Errorf("LDAP查找用户失败: %v", err)
+	}
+	
+	switch len(result.Entries) {
+	case 0:
+		return nil, ErrLDAPUserNotFound
+	case 1:
+		return d.toEntry(result.Entries[0]), nil
+	default:
+		return nil, fmt.Errorf("LDAP中有多个用户使用邮箱 %s", email)
+	}
+}
+
+// Authenticate 以用户身份绑定验证密码，验证后恢复服务账号绑定
+func (d *LDAPDirectory) Authenticate(entry *LDAPEntry, password string) error {
+	// 空密码会被服务器当作匿名绑定而成功，必须拒绝
+	if password == "" {
+		return ErrLDAPInvalidCredentials
+	}
+	
+	err := d.conn.Bind(entry.DN, password)
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return ErrLDAPInvalidCredentials
+		}
+		return fmt.Errorf("LDAP用户绑定失败: %v", err)
+	}
+	
+	return d.bindService()
+}
+
+// ListUsers 分页列出目录中的全部用户，用于定期同步
+func (d *LDAPDirectory) ListUsers() ([]*LDAPEntry, error) {
+	result, err := d.conn.SearchWithPaging(ldap.NewSearchRequest(
+		d.config.LDAP.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		d.config.LDAP.UserFilter, d.attributes(), nil,
+	), 500)
+	if err != nil {
+		return nil, fmt.Errorf("LDAP列出用户失败: %v", err)
+	}
+	
+	var entries []*LDAPEntry
+	for _, entry := range result.Entries {
+		e := d.toEntry(entry)
+		if e.Email == "" {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	
+	return entries, nil
+}
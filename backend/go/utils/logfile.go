@@ -0,0 +1,158 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logBackupTimeFormat 历史日志文件名中的时间，按文件名排序即按时间排序
+const logBackupTimeFormat = "20060102-150405.000"
+
+// RotatingFile 按大小和时间轮转的日志文件。当前日志写入 dir/name.log，
+// 轮转时重命名为 name-时间.log，并按数量和天数清理历史文件
+type RotatingFile struct {
+	dir        string
+	name       string
+	maxSize    int64
+	interval   time.Duration
+	maxBackups int
+	maxAge     time.Duration
+	
+	mu         sync.Mutex
+	file       *os.File
+	size       int64
+	nextRotate time.Time
+}
+
+// NewRotatingFile 打开日志文件，不存在时创建。maxSize 为字节数，interval 为 0 时只按大小轮转，
+// maxBackups 和 maxAge 为 0 时不按该条件清理
+func NewRotatingFile(dir, name string, maxSize int64, interval time.Duration, maxBackups int, maxAge time.Duration) (*RotatingFile, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("无法创建日志目录: %v", err)
+	}
+	
+	f := &RotatingFile{
+		dir:        dir,
+		name:       name,
+		maxSize:    maxSize,
+		interval:   interval,
+		maxBackups: maxBackups,
+		maxAge:     maxAge,
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	f.prune()
+	return f, nil
+}
+
+func (f *RotatingFile) path() string {
+	return filepath.Join(f.dir, f.name+".log")
+}
+
+// open 以追加方式打开当前日志文件，并计算下一次按时间轮转的时刻
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("无法打开日志文件: %v", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("无法读取日志文件: %v", err)
+	}
+	
+	f.file = file
+	f.size = info.Size()
+	f.nextRotate = time.Time{}
+	if f.interval > 0 {
+		// 从当天零点开始按间隔对齐，24 小时的间隔总在零点轮转
+		now := time.Now()
+		next := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		for !next.After(now) {
+			next = next.Add(f.interval)
+		}
+		f.nextRotate = next
+	}
+	return nil
+}
+
+// Write 写入一条日志，写入后超过大小限制或到达轮转时刻时先轮转
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	if (f.size > 0 && f.size+int64(len(p)) > f.maxSize) || (!f.nextRotate.IsZero() && !time.Now().Before(f.nextRotate)) {
+		if err := f.rotate(); err != nil {
+			// 轮转失败时继续写入原文件，不丢日志
+			fmt.Fprintf(os.Stderr, "日志文件轮转失败: %v\n", err)
+		}
+	}
+	
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// rotate 把当前日志文件改名为历史文件并重新打开，调用时需持有锁
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	backup := filepath.Join(f.dir, f.name+"-"+time.Now().Format(logBackupTimeFormat)+".log")
+	renameErr := os.Rename(f.path(), backup)
+	if err := f.open(); err != nil {
+		return err
+	}
+	if renameErr != nil {
+		return renameErr
+	}
+	f.prune()
+	return nil
+}
+
+// prune 删除超出保留数量或保留天数的历史日志文件
+func (f *RotatingFile) prune() {
+	if f.maxBackups <= 0 && f.maxAge <= 0 {
+		return
+	}
+	backups, err := filepath.Glob(filepath.Join(f.dir, f.name+"-*.log"))
+	if err != nil {
+		return
+	}
+	// 时间戳在文件名中，倒序后最新的在前
+	sort.Sort(sort.Reverse(sort.StringSlice(backups)))
+	
+	cutoff := time.Now().Add(-f.maxAge)
+	for i, backup := range backups {
+		stamp := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(backup), f.name+"-"), ".log")
+		created, err := time.ParseInLocation(logBackupTimeFormat, stamp, time.Local)
+		if err != nil {
+			continue
+		}
+		if (f.maxBackups > 0 && i >= f.maxBackups) || (f.maxAge > 0 && created.Before(cutoff)) {
+			os.Remove(backup)
+		}
+	}
+}
+
+// Close 关闭日志文件，之后的写入返回错误
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
@@ -1,7 +1,14 @@
 package utils
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -35,72 +42,157 @@ var logLevelNames = map[LogLevel]string{
 	FATAL: "FATAL",
 }
 
-var logLevelColors = map[LogLevel]string{
-	DEBUG: ColorCyan,
-	INFO:  ColorGreen,
-	WARN:  ColorYellow,
-	ERROR: ColorRed,
-	FATAL: ColorMagenta,
+// slogLevels 对应的 slog 级别，FATAL 没有对应的级别，输出时显示为 FATAL
+var slogLevels = map[LogLevel]slog.Level{
+	DEBUG: slog.LevelDebug,
+	INFO:  slog.LevelInfo,
+	WARN:  slog.LevelWarn,
+	ERROR: slog.LevelError,
+	FATAL: slog.LevelError + 4,
 }
 
+// ParseLogLevel 解析 debug、info、warn、error 形式的日志级别，不区分大小写
+func ParseLogLevel(name string) (LogLevel, bool) {
+	for level, levelName := range logLevelNames {
+		if strings.EqualFold(name, levelName) && level != FATAL {
+			return level, true
+		}
+	}
+	return INFO, false
+}
+
+// logLevels 默认级别和按子系统覆盖的级别，热重载时整体替换
+type logLevels struct {
+	level      LogLevel
+	subsystems map[string]LogLevel
+}
+
+var currentLogLevels atomic.Pointer[logLevels]
+
+var currentLogger atomic.Pointer[slog.Logger]
+
+func init() {
+	currentLogLevels.Store(&logLevels{level: INFO})
+	currentLogger.Store(slog.New(newLogHandler(os.Stdout, "json")))
+}
+
+// newLogHandler 创建 json 或 text 格式的 slog 处理器，级别过滤由 Logger 按子系统完成
+func newLogHandler(w io.Writer, format string) slog.Handler {
+	options := &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+			if attr.Key == slog.LevelKey && len(groups) == 0 && attr.Value.Any() == slogLevels[FATAL] {
+				attr.Value = slog.StringValue(logLevelNames[FATAL])
+			}
+			return attr
+		},
+	}
+	if format == "text" {
+		return slog.NewTextHandler(w, options)
+	}
+	return slog.NewJSONHandler(w, options)
+}
+
+// Logger 一个子系统的日志，如 http、auth、db，日志级别可以按子系统单独配置
 type Logger struct {
-	level LogLevel
-	name  string
+	name string
 }
 
+// NewLogger 创建子系统日志，同名的 Logger 共享日志级别
 func NewLogger(name string) *Logger {
-	return &Logger{
-		level: INFO,
-		name:  name,
-	}
+	return &Logger{name: name}
 }
 
+// SetLevel 设置这个子系统的日志级别，下次加载配置时会被覆盖
 func (l *Logger) SetLevel(level LogLevel) {
-	l.level = level
+	current := currentLogLevels.Load()
+	subsystems := make(map[string]LogLevel, len(current.subsystems)+1)
+	for name, subsystemLevel := range current.subsystems {
+		subsystems[name] = subsystemLevel
+	}
+	subsystems[l.name] = level
+	currentLogLevels.Store(&logLevels{level: current.level, subsystems: subsystems})
+}
+
+// Enabled 这个子系统是否输出该级别的日志
+func (l *Logger) Enabled(level LogLevel) bool {
+	levels := currentLogLevels.Load()
+	minLevel, ok := levels.subsystems[l.name]
+	if !ok {
+		minLevel = levels.level
+	}
+	return level >= minLevel
 }
 
-func (l *Logger) log(level LogLevel, format string, args ...interface{}) {
-	if level < l.level {
+func (l *Logger) log(ctx context.Context, level LogLevel, format string, args ...interface{}) {
+	if !l.Enabled(level) {
 		return
 	}
+	l.Log(ctx, level, fmt.Sprintf(format, args...))
+}
+
+// Log 输出一条带结构化字段的日志，ctx 中有请求ID时自动加上 request_id 字段
+func (l *Logger) Log(ctx context.Context, level LogLevel, message string, attrs ...slog.Attr) {
+	if !l.Enabled(level) {
+		return
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
 	
-	timestamp := time.Now().Format("2006-01-02 15:04:05.000")
-	levelName := logLevelNames[level]
-	levelColor := logLevelColors[level]
-	
-	message := fmt.Sprintf(format, args...)
-	
-	fmt.Printf("%s[%s]%s %s%s%s [%s] %s\n",
-		ColorCyan, timestamp, ColorReset,
-		levelColor, levelName, ColorReset,
-		l.name, message)
+	fields := make([]slog.Attr, 0, len(attrs)+2)
+	fields = append(fields, slog.String("subsystem", l.name))
+	if id := RequestID(ctx); id != "" {
+		fields = append(fields, slog.String("request_id", id))
+	}
+	fields = append(fields, attrs...)
+	currentLogger.Load().LogAttrs(ctx, slogLevels[level], message, fields...)
 }
 
 func (l *Logger) Debug(format string, args ...interface{}) {
-	l.log(DEBUG, format, args...)
+	l.log(context.Background(), DEBUG, format, args...)
 }
 
 func (l *Logger) Info(format string, args ...interface{}) {
-	l.log(INFO, format, args...)
+	l.log(context.Background(), INFO, format, args...)
 }
 
 func (l *Logger) Warn(format string, args ...interface{}) {
-	l.log(WARN, format, args...)
+	l.log(context.Background(), WARN, format, args...)
 }
 
 func (l *Logger) Error(format string, args ...interface{}) {
-	l.log(ERROR, format, args...)
+	l.log(context.Background(), ERROR, format, args...)
 }
 
 func (l *Logger) Fatal(format string, args ...interface{}) {
-	l.log(FATAL, format, args...)
+	l.log(context.Background(), FATAL, format, args...)
+}
+
+// DebugContext 和 Debug 相同，日志带上 ctx 中的请求ID，下同
+func (l *Logger) DebugContext(ctx context.Context, format string, args ...interface{}) {
+	l.log(ctx, DEBUG, format, args...)
+}
+
+func (l *Logger) InfoContext(ctx context.Context, format string, args ...interface{}) {
+	l.log(ctx, INFO, format, args...)
+}
+
+func (l *Logger) WarnContext(ctx context.Context, format string, args ...interface{}) {
+	l.log(ctx, WARN, format, args...)
 }
 
-// 全局日志函数
-var defaultLogger = NewLogger("SwiftPost")
+func (l *Logger) ErrorContext(ctx context.Context, format string, args ...interface{}) {
+	l.log(ctx, ERROR, format, args...)
+}
+
+// 全局日志函数，使用 app 子系统
+var defaultLogger = NewLogger("app")
 
+// SetLogLevel 设置默认日志级别，没有单独配置级别的子系统都使用这个级别
 func SetLogLevel(level LogLevel) {
-	defaultLogger.SetLevel(level)
+	current := currentLogLevels.Load()
+	currentLogLevels.Store(&logLevels{level: level, subsystems: current.subsystems})
 }
 
 func Debug(format string, args ...interface{}) {
@@ -124,6 +216,101 @@ func Fatal(format string, args ...interface{}) {
 	panic(fmt.Sprintf(format, args...))
 }
 
+func DebugContext(ctx context.Context, format string, args ...interface{}) {
+	defaultLogger.DebugContext(ctx, format, args...)
+}
+
+func InfoContext(ctx context.Context, format string, args ...interface{}) {
+	defaultLogger.InfoContext(ctx, format, args...)
+}
+
+func WarnContext(ctx context.Context, format string, args ...interface{}) {
+	defaultLogger.WarnContext(ctx, format, args...)
+}
+
+func ErrorContext(ctx context.Context, format string, args ...interface{}) {
+	defaultLogger.ErrorContext(ctx, format, args...)
+}
+
+// requestIDKey 请求ID在 context 中的键
+type requestIDKey struct{}
+
+// WithRequestID 返回带有请求ID的 context，之后用它输出的日志都带有 request_id 字段
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID 取出 context 中的请求ID，没有时返回空字符串
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// logWriter 把标准库 log 的输出转为指定子系统的日志
+type logWriter struct {
+	logger *Logger
+	level  LogLevel
+}
+
+func (w logWriter) Write(p []byte) (int, error) {
+	w.logger.Log(context.Background(), w.level, strings.TrimRight(string(p), "\n"))
+	return len(p), nil
+}
+
+// NewStdLogger 创建写入指定子系统的标准库 *log.Logger，用于 http.Server.ErrorLog 等只接受它的地方
+func NewStdLogger(subsystem string, level LogLevel) *log.Logger {
+	return log.New(logWriter{logger: NewLogger(subsystem), level: level}, "", 0)
+}
+
+// currentLogFile 当前的日志文件，重新配置时关闭
+var currentLogFile *RotatingFile
+
+// applyLogLevels 按配置设置默认级别和各子系统的级别，配置已经过 ValidateConfig 检查
+func applyLogLevels(config *Config) {
+	levels := &logLevels{level: INFO, subsystems: make(map[string]LogLevel, len(config.Logging.Levels))}
+	if level, ok := ParseLogLevel(config.Logging.Level); ok {
+		levels.level = level
+	}
+	for subsystem, name := range config.Logging.Levels {
+		if level, ok := ParseLogLevel(name); ok {
+			levels.subsystems[subsystem] = level
+		}
+	}
+	currentLogLevels.Store(levels)
+}
+
+// ConfigureLogging 按配置设置日志格式、输出位置和级别。dir 为空时输出到标准输出，
+// 否则写入 dir/swiftpost.log 并按大小和时间轮转。标准库 log 和 slog 默认日志也一并转到这里
+func ConfigureLogging(config *Config) error {
+	logging := config.Logging
+	var output io.Writer = os.Stdout
+	var file *RotatingFile
+	if logging.Dir != "" {
+		var err error
+		file, err = NewRotatingFile(logging.Dir, "swiftpost",
+			int64(logging.MaxSize)*1024*1024,
+			time.Duration(logging.RotateInterval)*time.Hour,
+			logging.MaxBackups,
+			time.Duration(logging.MaxAge)*24*time.Hour)
+		if err != nil {
+			return err
+		}
+		output = file
+	}
+	
+	applyLogLevels(config)
+	currentLogger.Store(slog.New(newLogHandler(output, logging.Format)))
+	if currentLogFile != nil {
+		currentLogFile.Close()
+	}
+	currentLogFile = file
+	
+	// 第三方库通过标准库 log 或 slog 输出的日志
+	log.SetFlags(0)
+	log.SetOutput(logWriter{logger: NewLogger("lib"), level: INFO})
+	return nil
+}
+
 // 彩色输出函数
 func PrintColored(text string, length int, color string) {
 	if length > 0 {
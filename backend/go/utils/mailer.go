@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+	
+	"github.com/google/uuid"
+)
+
+// SendMail 通过配置的SMTP服务器向外部地址发送纯文本邮件
+func SendMail(config *Config, to, subject, body string) error {
+	if config.SMTP.Host == "" {
+		return fmt.Errorf("未配置SMTP服务器")
+	}
+	if strings.ContainsAny(to, "\r\n") {
+		return fmt.Errorf("无效的收件人地址")
+	}
+	
+	from := config.SMTP.From
+	domain := from[strings.LastIndex(from, "@")+1:]
+	
+	var msg strings.Builder
+	msg.WriteString("From: " + from + "\r\n")
+	msg.WriteString("To: " + to + "\r\n")
+	msg.WriteString("Subject: " + mime.BEncoding.Encode("UTF-8", subject) + "\r\n")
+	msg.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	msg.WriteString("Message-ID: <" + uuid.NewString() + "@" + domain + ">\r\n")
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	
+	addr := net.JoinHostPort(config.SMTP.Host, strconv.Itoa(config.SMTP.Port))
+	var auth smtp.Auth
+	if config.SMTP.Username != "" {
+		auth = smtp.PlainAuth("", config.SMTP.Username, config.SMTP.Password, config.SMTP.Host)
+	}
+	
+	// 未使用隐式TLS时，smtp.SendMail 会在服务器支持时自动升级为 STARTTLS
+	if !config.SMTP.TLS {
+		return smtp.SendMail(addr, auth, from, []string{to}, []byte(msg.String()))
+	}
+	
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 10 * time.Second}, "tcp", addr, &tls.Config{ServerName: config.SMTP.Host})
+	if err != nil {
+		return fmt.Errorf("连接SMTP服务器失败: %v", err)
+	}
+	
+	client, err := smtp.NewClient(conn, config.SMTP.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+	
+	if auth != nil {
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(from); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to); err != nil {
+		return err
+	}
+	
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte(msg.String())); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	
+	return client.Quit()
+}
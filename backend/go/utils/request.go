@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// trustedProxies 解析后的 security.trusted_proxies，配置重新加载后第一次使用时重新解析
+type trustedProxies struct {
+	config *Config
+	nets   []*net.IPNet
+}
+
+var trustedProxyCache atomic.Pointer[trustedProxies]
+
+// parseTrustedProxy 解析单个 IP 或 CIDR 网段，无效时返回 nil
+func parseTrustedProxy(value string) *net.IPNet {
+	value = strings.TrimSpace(value)
+	if _, network, err := net.ParseCIDR(value); err == nil {
+		return network
+	}
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return nil
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}
+}
+
+func trustedProxyNets(config *Config) []*net.IPNet {
+	if cached := trustedProxyCache.Load(); cached != nil && cached.config == config {
+		return cached.nets
+	}
+	var nets []*net.IPNet
+	for _, proxy := range config.Security.TrustedProxies {
+		if network := parseTrustedProxy(proxy); network != nil {
+			nets = append(nets, network)
+		}
+	}
+	trustedProxyCache.Store(&trustedProxies{config: config, nets: nets})
+	return nets
+}
+
+// isTrustedProxy 判断地址是否在 security.trusted_proxies 中
+func isTrustedProxy(config *Config, host string) bool {
+	ip := net.ParseIP(strings.TrimSpace(host))
+	if ip == nil {
+		return false
+	}
+	for _, network := range trustedProxyNets(config) {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteHost 去掉 RemoteAddr 中的端口
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// FromTrustedProxy 请求是否直接来自配置的反向代理，只有这时才信任代理添加的 X-Forwarded-* 头
+func FromTrustedProxy(r *http.Request) bool {
+	return isTrustedProxy(GetConfig(), remoteHost(r))
+}
+
+// ClientIP 获取客户端IP。只有请求来自 security.trusted_proxies 中的代理（如 nginx）时才使用
+// X-Real-IP / X-Forwarded-For；X-Forwarded-For 从右往左跳过可信代理，取第一个不可信的地址，
+// 客户端自己伪造的最左边的地址不会被采用
+func ClientIP(r *http.Request) string {
+	config := GetConfig()
+	host := remoteHost(r)
+	if !isTrustedProxy(config, host) {
+		return host
+	}
+	
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(realIP) != nil {
+		return realIP
+	}
+	if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+		hops := strings.Split(strings.Join(forwarded, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if net.ParseIP(hop) == nil {
+				break
+			}
+			host = hop
+			if !isTrustedProxy(config, hop) {
+				break
+			}
+		}
+	}
+	
+	return host
+}
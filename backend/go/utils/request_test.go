@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	config := createDefaultConfig()
+	config.Security.TrustedProxies = []string{"127.0.0.1", "10.0.0.0/8"}
+	SetConfig(config)
+	defer SetConfig(createDefaultConfig())
+	
+	tests := []struct {
+		name      string
+		remote    string
+		realIP    string
+		forwarded string
+		want      string
+	}{
+		{"直接连接", "203.0.113.7:5000", "", "", "203.0.113.7"},
+		{"不可信的内网客户端伪造头", "192.168.1.20:5000", "1.2.3.4", "1.2.3.4", "192.168.1.20"},
+		{"不可信的公网客户端伪造头", "203.0.113.7:5000", "1.2.3.4", "", "203.0.113.7"},
+		{"可信代理的 X-Real-IP", "127.0.0.1:5000", "198.51.100.9", "", "198.51.100.9"},
+		{"可信代理的 X-Forwarded-For", "127.0.0.1:5000", "", "198.51.100.9", "198.51.100.9"},
+		{"跳过多层可信代理", "127.0.0.1:5000", "", "198.51.100.9, 10.1.2.3", "198.51.100.9"},
+		{"客户端伪造的最左边地址不被采用", "127.0.0.1:5000", "", "1.2.3.4, 198.51.100.9", "198.51.100.9"},
+		{"无效的 X-Real-IP", "127.0.0.1:5000", "not-an-ip", "198.51.100.9", "198.51.100.9"},
+		{"全部是可信代理", "127.0.0.1:5000", "", "10.1.2.3", "10.1.2.3"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tt.remote
+		if tt.realIP != "" {
+			r.Header.Set("X-Real-IP", tt.realIP)
+		}
+		if tt.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", tt.forwarded)
+		}
+		if got := ClientIP(r); got != tt.want {
+			t.Errorf("%s: ClientIP = %s，应为 %s", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+	
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// AccessClaims 访问令牌中携带的用户信息，Scopes 为用户角色授予的后台权限
+type AccessClaims struct {
+	UserID    int
+	Username  string
+	Email     string
+	IsAdmin   bool
+	SessionID int
+	Scopes    []string
+}
+
+// AccessTokenTTL 访问令牌有效期
+func AccessTokenTTL(config *Config) time.Duration {
+	if config.Security.AccessTokenExpiry <= 0 {
+		return 15 * time.Minute
+	}
+	return time.Duration(config.Security.AccessTokenExpiry) * time.Minute
+}
+
+// SessionTTL 会话（刷新令牌）有效期
+func SessionTTL(config *Config) time.Duration {
+	if config.Security.TokenExpiry <= 0 {
+		return 72 * time.Hour
+	}
+	return time.Duration(config.Security.TokenExpiry) * time.Hour
+}
+
+// PasswordResetTTL 密码重置链接有效期
+func PasswordResetTTL(config *Config) time.Duration {
+	if config.Account.PasswordResetTTL <= 0 {
+		return 30 * time.Minute
+	}
+	return time.Duration(config.Account.PasswordResetTTL) * time.Minute
+}
+
+// VerificationTTL 邮箱验证链接有效期
+func VerificationTTL(config *Config) time.Duration {
+	if config.Account.VerificationTTL <= 0 {
+		return 48 * time.Hour
+	}
+	return time.Duration(config.Account.VerificationTTL) * time.Hour
+}
+
+// GenerateAccessToken 生成绑定会话的短期访问令牌
+func GenerateAccessToken(config *Config, claims AccessClaims) (string, error) {
+	now := time.Now()
+	return signToken(jwt.MapClaims{
+		"user_id":  claims.UserID,
+		"username": claims.Username,
+		"email":    claims.Email,
+		"is_admin": claims.IsAdmin,
+		"sid":      claims.SessionID,
+		"scope":    strings.Join(claims.Scopes, " "),
+		"exp":      now.Add(AccessTokenTTL(config)).Unix(),
+		"iat":      now.Unix(),
+	})
+}
+
+// ParseAccessToken 验证访问令牌并提取用户信息，没有会话ID的旧令牌视为无效
+func ParseAccessToken(tokenString string) (*AccessClaims, error) {
+	mapClaims, err := parseToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	
+	userID, ok := mapClaims["user_id"].(float64)
+	if !ok {
+		return nil, errors.New("无效的用户ID")
+	}
+	
+	sessionID, ok := mapClaims["sid"].(float64)
+	if !ok {
+		return nil, errors.New("Token缺少会话信息")
+	}
+	
+	claims := &AccessClaims{
+		UserID:    int(userID),
+		SessionID: int(sessionID),
+	}
+	claims.Username, _ = mapClaims["username"].(string)
+	claims.Email, _ = mapClaims["email"].(string)
+	claims.IsAdmin, _ = mapClaims["is_admin"].(bool)
+	if scope, ok := mapClaims["scope"].(string); ok {
+		claims.Scopes = strings.Fields(scope)
+	}
+	
+	return claims, nil
+}
+
+// GenerateRefreshToken 生成随机刷新令牌
+func GenerateRefreshToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// HashToken 计算令牌的 SHA-256 摘要，数据库中只保存摘要
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// csrfKey CSRF令牌的HMAC密钥，由 models 从数据库加载，第一次启动时随机生成
+var csrfKey atomic.Pointer[[]byte]
+
+// SetCSRFKey 设置CSRF令牌的HMAC密钥
+func SetCSRFKey(key []byte) {
+	csrfKey.Store(&key)
+}
+
+// CSRFToken 由会话ID签名得到的CSRF令牌，同一会话内保持不变，其他会话或伪造的Cookie无法通过校验。
+// 密钥尚未加载时返回空字符串，所有请求都无法通过校验
+func CSRFToken(sessionID int) string {
+	key := csrfKey.Load()
+	if key == nil || len(*key) == 0 {
+		return ""
+	}
+	mac := hmac.New(sha256.New, *key)
+	mac.Write([]byte("csrf:" + strconv.Itoa(sessionID)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// ValidCSRFToken 常量时间比较请求中的CSRF令牌
+func ValidCSRFToken(sessionID int, token string) bool {
+	expected := CSRFToken(sessionID)
+	return token != "" && expected != "" && hmac.Equal([]byte(token), []byte(expected))
+}
+
+// PersonalAccessTokenPrefix 个人访问令牌的固定前缀，用于和会话令牌区分
+const PersonalAccessTokenPrefix = "spat_"
+
+// GeneratePersonalAccessToken 生成个人访问令牌
+func GeneratePersonalAccessToken() (string, error) {
+	token, err := GenerateRefreshToken()
+	if err != nil {
+		return "", err
+	}
+	return PersonalAccessTokenPrefix + token, nil
+}
+
+// IsPersonalAccessToken 判断是否为个人访问令牌
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, PersonalAccessTokenPrefix)
+}
+
+// appPasswordAlphabet 应用专用密码只使用小写字母，方便在邮件客户端中输入
+const appPasswordAlphabet = "abcdefghijklmnopqrstuvwxyz"
+
+// randomString 从字母表中均匀随机取 n 个字符，字母表长度不超过 256
+func randomString(alphabet string, n int) (string, error) {
+	// 拒绝采样，避免取模带来的偏差
+	limit := 256 - 256%len(alphabet)
+	result := make([]byte, 0, n)
+	buf := make([]byte, n)
+	for len(result) < n {
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		for _, b := range buf {
+			if int(b) < limit && len(result) < n {
+				result = append(result, alphabet[int(b)%len(alphabet)])
+			}
+		}
+	}
+	return string(result), nil
+}
+
+// GenerateAppPassword 生成16位应用专用密码，格式为 xxxx-xxxx-xxxx-xxxx
+func GenerateAppPassword() (string, error) {
+	password, err := randomString(appPasswordAlphabet, 16)
+	if err != nil {
+		return "", err
+	}
+	return password[:4] + "-" + password[4:8] + "-" + password[8:12] + "-" + password[12:], nil
+}
+
+// HashAppPassword 计算应用专用密码的摘要，忽略大小写、空格和连字符
+func HashAppPassword(password string) string {
+	normalized := strings.ToLower(password)
+	normalized = strings.NewReplacer("-", "", " ", "").Replace(normalized)
+	return HashToken(normalized)
+}
+
+// mfaTokenTTL 两步验证临时令牌的有效期
+const mfaTokenTTL = 5 * time.Minute
+
+// GenerateMFAToken 密码验证通过后签发的临时令牌，只能用于完成两步验证
+func GenerateMFAToken(userID int) (string, error) {
+	now := time.Now()
+	return signToken(jwt.MapClaims{
+		"user_id": userID,
+		"purpose": "mfa",
+		"exp":     now.Add(mfaTokenTTL).Unix(),
+		"iat":     now.Unix(),
+	})
+}
+
+// ParseMFAToken 验证两步验证临时令牌，返回用户ID
+func ParseMFAToken(tokenString string) (int, error) {
+	claims, err := parseToken(tokenString)
+	if err != nil {
+		return 0, err
+	}
+	if claims["purpose"] != "mfa" {
+		return 0, errors.New("无效的两步验证令牌")
+	}
+	
+	userID, ok := claims["user_id"].(float64)
+	if !ok {
+		return 0, errors.New("无效的用户ID")
+	}
+	
+	return int(userID), nil
+}
+
+// GenerateAccountToken 生成密码重置或邮箱验证令牌，tokenID 用于在数据库中保证令牌只能使用一次
+func GenerateAccountToken(purpose string, userID int, email, tokenID string, expiresAt time.Time) (string, error) {
+	return signToken(jwt.MapClaims{
+		"user_id": userID,
+		"email":   email,
+		"purpose": purpose,
+		"jti":     tokenID,
+		"exp":     expiresAt.Unix(),
+		"iat":     time.Now().Unix(),
+	})
+}
+
+// ParseAccountToken 验证账号令牌的签名、用途和有效期，返回用户ID、邮箱和令牌ID
+func ParseAccountToken(purpose, tokenString string) (int, string, string, error) {
+	claims, err := parseToken(tokenString)
+	if err != nil {
+		return 0, "", "", err
+	}
+	if claims["purpose"] != purpose {
+		return 0, "", "", errors.New("无效的令牌")
+	}
+	
+	userID, ok := claims["user_id"].(float64)
+	email, _ := claims["email"].(string)
+	tokenID, _ := claims["jti"].(string)
+	if !ok || tokenID == "" {
+		return 0, "", "", errors.New("无效的令牌")
+	}
+	
+	return int(userID), email, tokenID, nil
+}
@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCSRFToken(t *testing.T) {
+	defer SetCSRFKey(nil)
+	
+	// 密钥尚未加载时不签发也不接受任何令牌
+	SetCSRFKey(nil)
+	if token := CSRFToken(1); token != "" {
+		t.Fatalf("未加载密钥时 CSRFToken = %q，应为空", token)
+	}
+	if ValidCSRFToken(1, "") {
+		t.Fatal("未加载密钥时不应通过校验")
+	}
+	
+	SetCSRFKey(bytes.Repeat([]byte{1}, 32))
+	token := CSRFToken(1)
+	if !ValidCSRFToken(1, token) {
+		t.Fatal("同一会话的令牌应通过校验")
+	}
+	if ValidCSRFToken(2, token) {
+		t.Fatal("其他会话的令牌不应通过校验")
+	}
+	if ValidCSRFToken(1, "") {
+		t.Fatal("空令牌不应通过校验")
+	}
+	
+	// 换了密钥后原来的令牌失效，不同部署之间无法互相计算令牌
+	SetCSRFKey(bytes.Repeat([]byte{2}, 32))
+	if ValidCSRFToken(1, token) {
+		t.Fatal("使用其他密钥签发的令牌不应通过校验")
+	}
+}
@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestGenerateRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	
+	format := regexp.MustCompile(`^[abcdefghjkmnpqrstuvwxyz23456789]{5}-[abcdefghjkmnpqrstuvwxyz23456789]{5}$`)
+	seen := map[string]bool{}
+	counts := map[rune]int{}
+	for _, code := range codes {
+		if !format.MatchString(code) {
+			t.Fatalf("恢复码格式错误: %q", code)
+		}
+		if seen[code] {
+			t.Fatalf("恢复码重复: %q", code)
+		}
+		seen[code] = true
+		if NormalizeRecoveryCode(strings.ToUpper(strings.ReplaceAll(code, "-", ""))) != code {
+			t.Fatalf("NormalizeRecoveryCode 无法还原 %q", code)
+		}
+		for _, c := range strings.ReplaceAll(code, "-", "") {
+			counts[c]++
+		}
+	}
+	
+	// 2000 个字符中每种字符都应出现
+	if len(counts) != 31 {
+		t.Fatalf("只出现了 %d 种字符", len(counts))
+	}
+}
+
+func TestRandomString(t *testing.T) {
+	alphabet := "abcdefghjkmnpqrstuvwxyz23456789"
+	s, err := randomString(alphabet, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s) != 1000 || strings.Trim(s, alphabet) != "" {
+		t.Fatalf("randomString 返回了字母表以外的字符或长度错误: %d", len(s))
+	}
+}
@@ -245,32 +245,74 @@ func (v *Validator) Valid() bool {
 	return len(v.Errors) == 0
 }
 
-// ValidateConfig 验证配置
+// ValidateConfig 验证配置，返回的错误为 ConfigErrors，包含所有不合法的配置项
 func ValidateConfig(config *Config) error {
 	validator := NewValidator()
 	
+	if config.Env != ConfigEnvDevelopment && config.Env != ConfigEnvProduction {
+		validator.Errors["env"] = "必须是 development 或 production"
+	}
+	
 	// 验证服务器配置
 	validator.Required("server.host", config.Server.Host)
 	validator.Required("server.port", config.Server.Port)
 	validator.Port("server.port", config.Server.Port)
 	
-	if config.Server.SSL.Enabled {
+	acme := config.Server.SSL.ACME
+	if acme.Enabled {
+		if !config.Server.SSL.Enabled {
+			validator.Errors["server.ssl.acme.enabled"] = "需要同时启用 server.ssl.enabled"
+		}
+		validator.ValidDomain("server.domain", config.Server.Domain)
+		validator.Email("server.ssl.acme.email", acme.Email)
+		validator.URL("server.ssl.acme.directory_url", acme.DirectoryURL)
+		validator.FileExists("server.ssl.acme.ca_file", acme.CAFile)
+		validator.Required("server.ssl.acme.cache_dir", acme.CacheDir)
+		validator.Port("server.ssl.acme.http_port", acme.HTTPPort)
+		if acme.HTTPPort == config.Server.Port {
+			validator.Errors["server.ssl.acme.http_port"] = "不能和 server.port 相同"
+		}
+	} else if config.Server.SSL.Enabled {
 		validator.FileExists("server.ssl.cert", config.Server.SSL.Cert)
 		validator.FileExists("server.ssl.key", config.Server.SSL.Key)
 	}
 	
 	// 验证数据库配置
-	validator.Required("database.path", config.Database.Path)
-	validator.ValidPath("database.path", config.Database.Path)
+	switch config.Database.Driver {
+	case "", "sqlite":
+		validator.Required("database.path", config.Database.Path)
+		validator.ValidPath("database.path", config.Database.Path)
+	case "postgres":
+		validator.Required("database.dsn", config.Database.DSN)
+	default:
+		validator.Errors["database.driver"] = "必须是 sqlite 或 postgres"
+	}
 	
 	// 验证邮件配置
 	validator.Range("email.max_email_size", int(config.Email.MaxEmailSize), 1024*1024, 100*1024*1024) // 1MB to 100MB
 	
 	// 验证安全配置
-	validator.Required("security.jwt_secret", config.Security.JWTSecret)
-	validator.MinLength("security.jwt_secret", config.Security.JWTSecret, 32)
+	if !ValidJWTAlgorithm(config.Security.JWTAlgorithm) {
+		validator.Errors["security.jwt_algorithm"] = "必须是 EdDSA 或 RS256"
+	}
+	validator.Range("security.jwt_key_rotation", config.Security.JWTKeyRotation, 1, 365)
+	validator.Range("security.jwt_key_grace_period", config.Security.JWTKeyGracePeriod, 1, 720)
 	validator.Range("security.token_expiry", config.Security.TokenExpiry, 1, 720) // 1小时到30天
+	validator.Range("security.access_token_expiry", config.Security.AccessTokenExpiry, 1, 1440) // 1分钟到1天
 	validator.Range("security.rate_limit", config.Security.RateLimit, 1, 10000)
+	validator.Range("security.auth_rate_limit", config.Security.AuthRateLimit, 1, 10000)
+	validator.Range("security.send_rate_limit", config.Security.SendRateLimit, 1, 100000)
+	for _, origin := range strings.Split(config.Security.CorsOrigins, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" && origin != "*" {
+			validator.URL("security.cors_origins", origin)
+		}
+	}
+	validator.FileExists("security.geoip_file", config.Security.GeoIPFile)
+	for _, proxy := range config.Security.TrustedProxies {
+		if parseTrustedProxy(proxy) == nil {
+			validator.Errors["security.trusted_proxies"] = fmt.Sprintf("无效的地址或网段 %q", proxy)
+		}
+	}
 	
 	// 验证WebSocket配置
 	if config.WebSocket.Enabled {
@@ -278,12 +320,91 @@ func ValidateConfig(config *Config) error {
 		validator.Range("websocket.max_message_size", config.WebSocket.MaxMessageSize, 1024, 10*1024*1024) // 1KB to 10MB
 	}
 	
+	if config.Push.AllowInsecureEndpoints && config.Env == ConfigEnvProduction {
+		validator.Errors["push.allow_insecure_endpoints"] = "只能在测试环境中开启"
+	}
+	
+	// 验证WebAuthn配置
+	validator.Range("webauthn.timeout", config.WebAuthn.Timeout, 30, 3600)
+	
+	// 验证OIDC配置
+	if config.OIDC.Enabled {
+		validator.Required("oidc.issuer_url", config.OIDC.IssuerURL)
+		validator.URL("oidc.issuer_url", config.OIDC.IssuerURL)
+		validator.Required("oidc.client_id", config.OIDC.ClientID)
+		validator.Required("oidc.redirect_url", config.OIDC.RedirectURL)
+		validator.URL("oidc.redirect_url", config.OIDC.RedirectURL)
+	}
+	if config.OIDC.DisableLocalPassword && !config.OIDC.Enabled {
+		validator.Errors["oidc.disable_local_password"] = "禁用本地密码前必须启用单点登录"
+	}
+	
+	// 验证LDAP配置
+	if config.LDAP.Enabled {
+		validator.Required("ldap.url", config.LDAP.URL)
+		if config.LDAP.URL != "" && !strings.HasPrefix(config.LDAP.URL, "ldap://") && !strings.HasPrefix(config.LDAP.URL, "ldaps://") {
+			validator.Errors["ldap.url"] = "LDAP地址必须以 ldap:// 或 ldaps:// 开头"
+		}
+		validator.Required("ldap.base_dn", config.LDAP.BaseDN)
+		validator.Range("ldap.sync_interval", config.LDAP.SyncInterval, 0, 7*24*60)
+		validator.Range("ldap.timeout", config.LDAP.Timeout, 1, 120)
+	}
+	
+	// 验证密码重置和邮箱验证配置
+	switch config.Account.TokenDelivery {
+	case "system":
+	case "smtp":
+		validator.Required("smtp.host", config.SMTP.Host)
+		validator.Range("smtp.port", config.SMTP.Port, 1, 65535)
+		validator.Email("smtp.from", config.SMTP.From)
+	default:
+		validator.Errors["account.token_delivery"] = "发送方式必须是 system 或 smtp"
+	}
+	if config.Account.PublicURL != "" {
+		validator.URL("account.public_url", config.Account.PublicURL)
+	}
+	validator.Range("account.password_reset_ttl", config.Account.PasswordResetTTL, 5, 24*60)
+	validator.Range("account.verification_ttl", config.Account.VerificationTTL, 1, 30*24)
+	validator.Range("account.max_requests_per_hour", config.Account.MaxRequestsPerHour, 1, 100)
+	
+	// 验证登录防暴力破解配置
+	if config.LoginProtection.Enabled {
+		validator.Range("login_protection.account_threshold", config.LoginProtection.AccountThreshold, 1, 1000)
+		validator.Range("login_protection.ip_threshold", config.LoginProtection.IPThreshold, 1, 10000)
+		validator.Range("login_protection.delay_threshold", config.LoginProtection.DelayThreshold, 1, 1000)
+		validator.Range("login_protection.max_delay", config.LoginProtection.MaxDelay, 1, 3600)
+		validator.Range("login_protection.failure_window", config.LoginProtection.FailureWindow, 1, 24*60)
+		validator.Range("login_protection.lockout_duration", config.LoginProtection.LockoutDuration, 1, 7*24*60)
+		validator.Range("login_protection.max_lockout_duration", config.LoginProtection.MaxLockoutDuration, config.LoginProtection.LockoutDuration, 30*24*60)
+	}
+	
+	// 验证日志配置
+	if _, ok := ParseLogLevel(config.Logging.Level); !ok {
+		validator.Errors["logging.level"] = "必须是 debug、info、warn 或 error"
+	}
+	for subsystem, level := range config.Logging.Levels {
+		if _, ok := ParseLogLevel(level); !ok {
+			validator.Errors["logging.levels."+subsystem] = "必须是 debug、info、warn 或 error"
+		}
+	}
+	if config.Logging.Format != "json" && config.Logging.Format != "text" {
+		validator.Errors["logging.format"] = "必须是 json 或 text"
+	}
+	if config.Logging.Dir != "" {
+		validator.ValidPath("logging.dir", config.Logging.Dir)
+		validator.Range("logging.max_size", config.Logging.MaxSize, 1, 10*1024)
+		validator.Range("logging.rotate_interval", config.Logging.RotateInterval, 0, 30*24)
+		validator.Range("logging.max_backups", config.Logging.MaxBackups, 0, 10000)
+		validator.Range("logging.max_age", config.Logging.MaxAge, 0, 3650)
+	}
+	
 	if !validator.Valid() {
-		var errorMsgs []string
+		var errs ConfigErrors
 		for field, msg := range validator.Errors {
-			errorMsgs = append(errorMsgs, fmt.Sprintf("%s: %s", field, msg))
+			errs = append(errs, ConfigIssue{Key: field, Message: msg})
 		}
-		return fmt.Errorf("配置验证失败: %s", strings.Join(errorMsgs, "; "))
+		sortConfigIssues(errs)
+		return errs
 	}
 	
 	return nil
@@ -291,6 +412,11 @@ func ValidateConfig(config *Config) error {
 
 // SanitizeConfig 清理和标准化配置
 func SanitizeConfig(config *Config) {
+	config.Env = strings.ToLower(strings.TrimSpace(config.Env))
+	if config.Env == "" {
+		config.Env = ConfigEnvDevelopment
+	}
+	
 	// 清理服务器配置
 	config.Server.Host = strings.TrimSpace(config.Server.Host)
 	if config.Server.Host == "" {
@@ -302,19 +428,34 @@ func SanitizeConfig(config *Config) {
 		config.Server.Port = "252"
 	}
 	
-	config.Server.Domain = strings.TrimSpace(config.Server.Domain)
+	config.Server.Domain = strings.ToLower(strings.TrimSpace(config.Server.Domain))
 	if config.Server.Domain == "" {
 		config.Server.Domain = "swiftpost.local"
 	}
 	
+	config.Server.SSL.ACME.DirectoryURL = strings.TrimSpace(config.Server.SSL.ACME.DirectoryURL)
+	config.Server.SSL.ACME.CacheDir = strings.TrimSpace(config.Server.SSL.ACME.CacheDir)
+	if config.Server.SSL.ACME.CacheDir == "" {
+		config.Server.SSL.ACME.CacheDir = "data/acme"
+	}
+	config.Server.SSL.ACME.HTTPPort = strings.TrimSpace(config.Server.SSL.ACME.HTTPPort)
+	if config.Server.SSL.ACME.HTTPPort == "" {
+		config.Server.SSL.ACME.HTTPPort = "80"
+	}
+	
 	// 清理数据库配置
+	config.Database.Driver = strings.ToLower(strings.TrimSpace(config.Database.Driver))
+	if config.Database.Driver == "" {
+		config.Database.Driver = "sqlite"
+	}
+	config.Database.DSN = strings.TrimSpace(config.Database.DSN)
 	config.Database.Path = strings.TrimSpace(config.Database.Path)
 	if config.Database.Path == "" {
 		config.Database.Path = "data/swiftpost.db"
 	}
 	
 	// 确保路径是绝对路径
-	if !filepath.IsAbs(config.Database.Path) {
+	if config.Database.Driver == "sqlite" && !filepath.IsAbs(config.Database.Path) {
 		absPath, err := filepath.Abs(config.Database.Path)
 		if err == nil {
 			config.Database.Path = absPath
@@ -332,16 +473,8 @@ func SanitizeConfig(config *Config) {
 		config.Email.AttachmentPath = "data/attachments"
 	}
 	
-	// 确保目录路径存在
-	os.MkdirAll(config.Email.StoragePath, 0755)
-	os.MkdirAll(config.Email.AttachmentPath, 0755)
-	
-	// 清理安全配置
+	// 清理安全配置，默认密钥不在这里替换，由 CheckConfig 报告
 	config.Security.JWTSecret = strings.TrimSpace(config.Security.JWTSecret)
-	if config.Security.JWTSecret == "" || config.Security.JWTSecret == "your-secret-key-change-this-in-production" {
-		// 生成一个随机的JWT密钥
-		config.Security.JWTSecret = generateRandomString(64)
-	}
 	
 	config.Security.CorsOrigins = strings.TrimSpace(config.Security.CorsOrigins)
 	if config.Security.CorsOrigins == "" {
@@ -353,14 +486,38 @@ func SanitizeConfig(config *Config) {
 		config.Email.MaxEmailSize = 25 * 1024 * 1024 // 25MB
 	}
 	
+	if !ValidJWTAlgorithm(config.Security.JWTAlgorithm) {
+		config.Security.JWTAlgorithm = JWTAlgorithmEdDSA
+	}
+	
+	if config.Security.JWTKeyRotation <= 0 {
+		config.Security.JWTKeyRotation = 30 // 天
+	}
+	
+	if config.Security.JWTKeyGracePeriod <= 0 {
+		config.Security.JWTKeyGracePeriod = 72 // 小时
+	}
+	
 	if config.Security.TokenExpiry <= 0 {
 		config.Security.TokenExpiry = 72 // 小时
 	}
 	
+	if config.Security.AccessTokenExpiry <= 0 {
+		config.Security.AccessTokenExpiry = 15 // 分钟
+	}
+	
 	if config.Security.RateLimit <= 0 {
 		config.Security.RateLimit = 100
 	}
 	
+	if config.Security.AuthRateLimit <= 0 {
+		config.Security.AuthRateLimit = 20
+	}
+	
+	if config.Security.SendRateLimit <= 0 {
+		config.Security.SendRateLimit = 100
+	}
+	
 	if config.WebSocket.PingInterval <= 0 {
 		config.WebSocket.PingInterval = 30
 	}
@@ -368,6 +525,102 @@ func SanitizeConfig(config *Config) {
 	if config.WebSocket.MaxMessageSize <= 0 {
 		config.WebSocket.MaxMessageSize = 1024 * 1024 // 1MB
 	}
+	
+	config.WebAuthn.RPID = strings.TrimSpace(config.WebAuthn.RPID)
+	if config.WebAuthn.RPDisplayName == "" {
+		config.WebAuthn.RPDisplayName = "SwiftPost"
+	}
+	
+	if config.WebAuthn.Timeout <= 0 {
+		config.WebAuthn.Timeout = 300 // 秒
+	}
+	
+	config.OIDC.IssuerURL = strings.TrimRight(strings.TrimSpace(config.OIDC.IssuerURL), "/")
+	if len(config.OIDC.Scopes) == 0 {
+		config.OIDC.Scopes = []string{"openid", "profile", "email"}
+	}
+	
+	if config.OIDC.UsernameClaim == "" {
+		config.OIDC.UsernameClaim = "preferred_username"
+	}
+	
+	config.LDAP.URL = strings.TrimSpace(config.LDAP.URL)
+	if config.LDAP.UserFilter == "" {
+		config.LDAP.UserFilter = "(objectClass=inetOrgPerson)"
+	}
+	if config.LDAP.EmailAttribute == "" {
+		config.LDAP.EmailAttribute = "mail"
+	}
+	if config.LDAP.UsernameAttribute == "" {
+		config.LDAP.UsernameAttribute = "uid"
+	}
+	if config.LDAP.UniqueIDAttribute == "" {
+		config.LDAP.UniqueIDAttribute = "entryUUID"
+	}
+	if config.LDAP.GroupAttribute == "" {
+		config.LDAP.GroupAttribute = "memberOf"
+	}
+	if config.LDAP.Timeout <= 0 {
+		config.LDAP.Timeout = 10 // 秒
+	}
+	
+	if config.Account.TokenDelivery == "" {
+		config.Account.TokenDelivery = "system"
+	}
+	config.Account.PublicURL = strings.TrimRight(strings.TrimSpace(config.Account.PublicURL), "/")
+	if config.Account.PasswordResetTTL <= 0 {
+		config.Account.PasswordResetTTL = 30 // 分钟
+	}
+	if config.Account.VerificationTTL <= 0 {
+		config.Account.VerificationTTL = 48 // 小时
+	}
+	if config.Account.MaxRequestsPerHour <= 0 {
+		config.Account.MaxRequestsPerHour = 3
+	}
+	
+	if config.SMTP.Port <= 0 {
+		config.SMTP.Port = 587
+	}
+	
+	if config.LoginProtection.AccountThreshold <= 0 {
+		config.LoginProtection.AccountThreshold = 5
+	}
+	if config.LoginProtection.IPThreshold <= 0 {
+		config.LoginProtection.IPThreshold = 20
+	}
+	if config.LoginProtection.DelayThreshold <= 0 {
+		config.LoginProtection.DelayThreshold = 3
+	}
+	if config.LoginProtection.MaxDelay <= 0 {
+		config.LoginProtection.MaxDelay = 30 // 秒
+	}
+	if config.LoginProtection.FailureWindow <= 0 {
+		config.LoginProtection.FailureWindow = 15 // 分钟
+	}
+	if config.LoginProtection.LockoutDuration <= 0 {
+		config.LoginProtection.LockoutDuration = 15 // 分钟
+	}
+	if config.LoginProtection.MaxLockoutDuration < config.LoginProtection.LockoutDuration {
+		config.LoginProtection.MaxLockoutDuration = 24 * 60
+	}
+	
+	config.Logging.Level = strings.ToLower(strings.TrimSpace(config.Logging.Level))
+	if config.Logging.Level == "" {
+		config.Logging.Level = "info"
+	}
+	levels := make(map[string]string, len(config.Logging.Levels))
+	for subsystem, level := range config.Logging.Levels {
+		levels[strings.ToLower(strings.TrimSpace(subsystem))] = strings.ToLower(strings.TrimSpace(level))
+	}
+	config.Logging.Levels = levels
+	config.Logging.Format = strings.ToLower(strings.TrimSpace(config.Logging.Format))
+	if config.Logging.Format == "" {
+		config.Logging.Format = "json"
+	}
+	config.Logging.Dir = strings.TrimSpace(config.Logging.Dir)
+	if config.Logging.MaxSize <= 0 {
+		config.Logging.MaxSize = 100 // MB
+	}
 }
 
 // ValidateEmailAddress 验证邮箱地址
@@ -602,15 +855,4 @@ func GenerateDefaultEmailDomain(config *Config, username string, userID int) (st
 	}
 	
 	return ValidateEmailTemplate(template, username, userID)
-}
-
-// Helper function to generate random string
-func generateRandomString(length int) string {
-	const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789!@#$%^&*()_+-=[]{}|;:,.<>?"
-	b := make([]byte, length)
-	for i := range b {
-		// 这里简化处理，实际应该使用 crypto/rand
-		b[i] = charset[i%len(charset)]
-	}
-	return string(b)
 }
\ No newline at end of file
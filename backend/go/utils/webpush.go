@@ -0,0 +1,359 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+	
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// PushTarget 推送订阅的目标信息（浏览器 PushSubscription）
+type PushTarget struct {
+	Endpoint string
+	P256dh   string
+	Auth     string
+}
+
+// 推送服务返回这些状态码时，订阅已失效，应当删除
+var pushGoneStatus = map[int]bool{
+	http.StatusNotFound: true,
+	http.StatusGone:     true,
+}
+
+// pushHTTPClient 连接时检查推送服务的 IP，域名解析结果在校验后变为内网地址时也会被拒绝；
+// 推送服务不会重定向，不跟随重定向
+var pushHTTPClient = newPushHTTPClient(false)
+
+// insecurePushHTTPClient 允许 http 和内网地址，只在 push.allow_insecure_endpoints 开启时使用
+var insecurePushHTTPClient = newPushHTTPClient(true)
+
+func newPushHTTPClient(allowInsecure bool) *http.Client {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	if !allowInsecure {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || isInternalIP(ip) {
+				return fmt.Errorf("推送地址指向内网地址 %s", host)
+			}
+			return nil
+		}
+	}
+	
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// isInternalIP 回环、内网、链路本地、运营商 NAT 等不应由推送请求访问的地址
+func isInternalIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() ||
+		sharedAddressSpace.Contains(ip)
+}
+
+// sharedAddressSpace 运营商级 NAT 地址段 (RFC 6598)
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// lookupPushHost 解析推送服务的域名
+var lookupPushHost = net.DefaultResolver.LookupIPAddr
+
+// ValidatePushEndpoint 检查浏览器提交的推送地址：必须是 https，且域名解析结果不能是内网地址。
+// 开启 push.allow_insecure_endpoints 时不检查，仅用于本地测试
+func ValidatePushEndpoint(ctx context.Context, config *Config, endpoint string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" || u.User != nil {
+		return fmt.Errorf("无效的推送地址")
+	}
+	if config.Push.AllowInsecureEndpoints && (u.Scheme == "https" || u.Scheme == "http") {
+		return nil
+	}
+	if u.Scheme != "https" {
+		return fmt.Errorf("推送地址必须使用 https")
+	}
+	
+	host := u.Hostname()
+	if ip := net.ParseIP(host); ip != nil {
+		if isInternalIP(ip) {
+			return fmt.Errorf("推送地址不能是内网地址")
+		}
+		return nil
+	}
+	addrs, err := lookupPushHost(ctx, host)
+	if err != nil || len(addrs) == 0 {
+		return fmt.Errorf("无法解析推送地址的域名")
+	}
+	for _, addr := range addrs {
+		if isInternalIP(addr.IP) {
+			return fmt.Errorf("推送地址不能是内网地址")
+		}
+	}
+	return nil
+}
+
+// IsPushSubscriptionGone 判断推送服务的响应是否表示订阅已失效
+func IsPushSubscriptionGone(statusCode int) bool {
+	return pushGoneStatus[statusCode]
+}
+
+// GenerateVAPIDKeys 生成 VAPID 密钥对（base64url 编码，无填充）
+func GenerateVAPIDKeys() (publicKey, privateKey string, err error) {
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	
+	publicKey = base64.RawURLEncoding.EncodeToString(key.PublicKey().Bytes())
+	privateKey = base64.RawURLEncoding.EncodeToString(key.Bytes())
+	return publicKey, privateKey, nil
+}
+
+// EnsureVAPIDKeys 如果配置中没有 VAPID 密钥，则生成后写入 config 并保存到配置文件。
+// 只把密钥写进文件，环境变量和命令行参数覆盖的配置项不会被写入
+func EnsureVAPIDKeys(config *Config, filename string) error {
+	if !config.Push.Enabled {
+		return nil
+	}
+	if config.Push.VAPIDPublicKey != "" && config.Push.VAPIDPrivateKey != "" {
+		return nil
+	}
+	
+	publicKey, privateKey, err := GenerateVAPIDKeys()
+	if err != nil {
+		return fmt.Errorf("生成 VAPID 密钥失败: %v", err)
+	}
+	
+	config.Push.VAPIDPublicKey = publicKey
+	config.Push.VAPIDPrivateKey = privateKey
+	if config.Push.VAPIDSubject == "" {
+		config.Push.VAPIDSubject = "mailto:admin@" + config.Server.Domain
+	}
+	if config.Push.TTL <= 0 {
+		config.Push.TTL = 86400
+	}
+	
+	err = UpdateConfigFile(filename, func(file *Config) {
+		file.Push.VAPIDPublicKey = config.Push.VAPIDPublicKey
+		file.Push.VAPIDPrivateKey = config.Push.VAPIDPrivateKey
+		if file.Push.VAPIDSubject == "" {
+			file.Push.VAPIDSubject = config.Push.VAPIDSubject
+		}
+		if file.Push.TTL <= 0 {
+			file.Push.TTL = config.Push.TTL
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("保存 VAPID 密钥失败: %v", err)
+	}
+	
+	PrintSuccess("已生成 VAPID 密钥")
+	return nil
+}
+
+// SendWebPush 加密并发送一条 Web Push 消息，返回推送服务的 HTTP 状态码
+func SendWebPush(config *Config, target PushTarget, payload []byte, urgency string) (int, error) {
+	body, err := EncryptPushPayload(target.P256dh, target.Auth, payload)
+	if err != nil {
+		return 0, err
+	}
+	
+	authorization, err := vapidAuthorization(config, target.Endpoint)
+	if err != nil {
+		return 0, err
+	}
+	
+	req, err := http.NewRequest(http.MethodPost, target.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	
+	ttl := config.Push.TTL
+	if ttl <= 0 {
+		ttl = 86400
+	}
+	if urgency == "" {
+		urgency = "normal"
+	}
+	
+	req.Header.Set("Authorization", authorization)
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("TTL", strconv.Itoa(ttl))
+	req.Header.Set("Urgency", urgency)
+	
+	client := pushHTTPClient
+	if config.Push.AllowInsecureEndpoints {
+		client = insecurePushHTTPClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("推送服务返回状态码 %d", resp.StatusCode)
+	}
+	
+	return resp.StatusCode, nil
+}
+
+// vapidAuthorization 生成 VAPID 认证头 (RFC 8292)
+func vapidAuthorization(config *Config, endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("无效的推送地址: %s", endpoint)
+	}
+	
+	privateKey, err := decodeVAPIDPrivateKey(config.Push.VAPIDPrivateKey)
+	if err != nil {
+		return "", err
+	}
+	
+	subject := config.Push.VAPIDSubject
+	if subject == "" {
+		subject = "mailto:admin@" + config.Server.Domain
+	}
+	
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"aud": u.Scheme + "://" + u.Host,
+		"exp": time.Now().Add(12 * time.Hour).Unix(),
+		"sub": subject,
+	})
+	
+	signed, err := token.SignedString(privateKey)
+	if err != nil {
+		return "", fmt.Errorf("签名 VAPID 令牌失败: %v", err)
+	}
+	
+	return fmt.Sprintf("vapid t=%s, k=%s", signed, config.Push.VAPIDPublicKey), nil
+}
+
+func decodeVAPIDPrivateKey(encoded string) (*ecdsa.PrivateKey, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("无效的 VAPID 私钥")
+	}
+	
+	privateKey, err := ecdsa.ParseRawPrivateKey(elliptic.P256(), raw)
+	if err != nil {
+		return nil, fmt.Errorf("无效的 VAPID 私钥: %v", err)
+	}
+	return privateKey, nil
+}
+
+// EncryptPushPayload 按 RFC 8291 (aes128gcm) 加密推送内容
+func EncryptPushPayload(p256dh, authSecret string, plaintext []byte) ([]byte, error) {
+	uaPublicBytes, err := decodePushKey(p256dh)
+	if err != nil {
+		return nil, fmt.Errorf("无效的 p256dh: %v", err)
+	}
+	auth, err := decodePushKey(authSecret)
+	if err != nil || len(auth) != 16 {
+		return nil, fmt.Errorf("无效的 auth 密钥")
+	}
+	
+	uaPublic, err := ecdh.P256().NewPublicKey(uaPublicBytes)
+	if err != nil {
+		return nil, fmt.Errorf("无效的 p256dh: %v", err)
+	}
+	
+	// 每条消息使用新的临时密钥对
+	asPrivate, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	asPublicBytes := asPrivate.PublicKey().Bytes()
+	
+	sharedSecret, err := asPrivate.ECDH(uaPublic)
+	if err != nil {
+		return nil, err
+	}
+	
+	// IKM = HKDF(auth_secret, ecdh_secret, "WebPush: info" || 0x00 || ua_public || as_public)
+	keyInfo := append([]byte("WebPush: info\x00"), uaPublicBytes...)
+	keyInfo = append(keyInfo, asPublicBytes...)
+	ikm, err := hkdf.Key(sha256.New, sharedSecret, auth, string(keyInfo), 32)
+	if err != nil {
+		return nil, err
+	}
+	
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	
+	prk, err := hkdf.Extract(sha256.New, ikm, salt)
+	if err != nil {
+		return nil, err
+	}
+	cek, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: aes128gcm\x00", 16)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: nonce\x00", 12)
+	if err != nil {
+		return nil, err
+	}
+	
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	
+	// 单条记录，0x02 为最后一条记录的分隔符
+	const recordSize = 4096
+	if len(plaintext)+1+gcm.Overhead() > recordSize {
+		return nil, fmt.Errorf("推送内容过大")
+	}
+	padded := append(append([]byte{}, plaintext...), 0x02)
+	
+	header := make([]byte, 0, 16+4+1+len(asPublicBytes))
+	header = append(header, salt...)
+	header = binary.BigEndian.AppendUint32(header, recordSize)
+	header = append(header, byte(len(asPublicBytes)))
+	header = append(header, asPublicBytes...)
+	
+	return gcm.Seal(header, nonce, padded, nil), nil
+}
+
+// 浏览器可能给出带填充或标准 base64 的密钥，这里统一处理
+func decodePushKey(value string) ([]byte, error) {
+	if data, err := base64.RawURLEncoding.DecodeString(value); err == nil {
+		return data, nil
+	}
+	if data, err := base64.URLEncoding.DecodeString(value); err == nil {
+		return data, nil
+	}
+	return base64.StdEncoding.DecodeString(value)
+}
@@ -200,6 +200,9 @@ class AdminPanel {
                             <button class="btn btn-sm btn-warning me-1" onclick="adminPanel.editUser(${data})">
                                 <i class="fas fa-edit"></i>
                             </button>
+                            <button class="btn btn-sm btn-secondary me-1" onclick="adminPanel.viewSessions(${data})" title="登录设备">
+                                <i class="fas fa-laptop"></i>
+                            </button>
                             <button class="btn btn-sm btn-danger" onclick="adminPanel.deleteUser(${data})">
                                 <i class="fas fa-trash"></i>
                             </button>
@@ -512,6 +515,91 @@ class AdminPanel {
         }
     }
     
+    async viewSessions(userId) {
+        try {
+            const response = await fetch(`/api/admin/users/${userId}/sessions`, {
+                headers: {
+                    'Authorization': `Bearer ${this.token}`
+                }
+            });
+            
+            const data = await response.json();
+            if (!data.success) {
+                this.showAlert('获取登录设备失败: ' + data.message, 'danger');
+                return;
+            }
+            
+            if (data.sessions.length === 0) {
+                this.showAlert('该用户当前没有登录的设备', 'info');
+                return;
+            }
+            
+            const list = data.sessions
+                .map(s => `#${s.id}  ${s.ip_address} (${s.location})  ${s.last_seen}\n    ${s.user_agent}`)
+                .join('\n');
+            
+            if (confirm(`登录设备:\n${list}\n\n是否让该用户在所有设备上退出登录？`)) {
+                await this.revokeUserSessions(userId);
+            }
+        } catch (error) {
+            console.error('获取登录设备错误:', error);
+            this.showAlert('网络错误，请稍后重试', 'danger');
+        }
+    }
+    
+    async revokeUserSessions(userId) {
+        try {
+            const response = await fetch(`/api/admin/users/${userId}/sessions`, {
+                method: 'DELETE',
+                headers: {
+                    'Authorization': `Bearer ${this.token}`
+                }
+            });
+            
+            const data = await response.json();
+            if (data.success) {
+                this.showAlert(`已注销 ${data.revoked} 个会话`, 'success');
+            } else {
+                this.showAlert('注销失败: ' + data.message, 'danger');
+            }
+        } catch (error) {
+            console.error('注销会话错误:', error);
+            this.showAlert('网络错误，请稍后重试', 'danger');
+        }
+    }
+    
+    async forceReloginAll() {
+        if (!confirm('确定要强制所有用户重新登录吗？除当前会话外的所有登录都将失效。')) {
+            return;
+        }
+        const revokeAPICredentials = confirm('是否同时吊销所有个人访问令牌和应用专用密码？凭据可能已泄露时请选择“确定”。');
+        
+        try {
+            const response = await fetch('/api/admin/sessions/revoke', {
+                method: 'POST',
+                headers: {
+                    'Authorization': `Bearer ${this.token}`,
+                    'Content-Type': 'application/json'
+                },
+                body: JSON.stringify({ all: true, revoke_api_credentials: revokeAPICredentials })
+            });
+            
+            const data = await response.json();
+            if (data.success) {
+                let message = `已强制重新登录，注销 ${data.revoked} 个会话`;
+                if (data.revoked_types.includes('personal_access_tokens')) {
+                    message += `，吊销 ${data.revoked_tokens} 个访问令牌和 ${data.revoked_app_passwords} 个应用专用密码`;
+                }
+                this.showAlert(message, 'success');
+            } else {
+                this.showAlert('操作失败: ' + data.message, 'danger');
+            }
+        } catch (error) {
+            console.error('强制重新登录错误:', error);
+            this.showAlert('网络错误，请稍后重试', 'danger');
+        }
+    }
+    
     async viewEmail(emailId) {
         window.open(`/email/${emailId}`, '_blank');
     }
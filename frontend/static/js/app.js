@@ -908,6 +908,38 @@ ${email.body}
         // 保存草稿功能
         this.showAlert('草稿保存功能开发中', 'info');
     }
+    
+    async subscribePush(registration) {
+        if (!this.token || !('PushManager' in window)) return;
+        
+        try {
+            const permission = await Notification.requestPermission();
+            if (permission !== 'granted') return;
+            
+            const keyResponse = await fetch('/api/push/vapid-public-key');
+            const keyData = await keyResponse.json();
+            if (!keyData.success) return;
+            
+            let subscription = await registration.pushManager.getSubscription();
+            if (!subscription) {
+                subscription = await registration.pushManager.subscribe({
+                    userVisibleOnly: true,
+                    applicationServerKey: urlBase64ToUint8Array(keyData.public_key)
+                });
+            }
+            
+            await fetch('/api/push/subscribe', {
+                method: 'POST',
+                headers: {
+                    'Authorization': `Bearer ${this.token}`,
+                    'Content-Type': 'application/json'
+                },
+                body: JSON.stringify(subscription.toJSON())
+            });
+        } catch (error) {
+            console.log('推送订阅失败:', error);
+        }
+    }
 }
 
 // 页面加载完成后初始化应用
@@ -937,12 +969,20 @@ function formatDateTime(date) {
     return d.toLocaleDateString();
 }
 
-// 注册Service Worker（PWA支持）
+function urlBase64ToUint8Array(base64String) {
+    const padding = '='.repeat((4 - base64String.length % 4) % 4);
+    const base64 = (base64String + padding).replace(/-/g, '+').replace(/_/g, '/');
+    const raw = window.atob(base64);
+    return Uint8Array.from([...raw].map(char => char.charCodeAt(0)));
+}
+
+// 注册Service Worker（PWA支持与推送通知）
 if ('serviceWorker' in navigator) {
     window.addEventListener('load', () => {
         navigator.serviceWorker.register('/service-worker.js')
             .then(registration => {
                 console.log('ServiceWorker注册成功:', registration.scope);
+                window.swiftpost?.subscribePush(registration);
             })
             .catch(error => {
                 console.log('ServiceWorker注册失败:', error);
@@ -0,0 +1,73 @@
+// SwiftPost 认证辅助：访问令牌过期时使用刷新令牌（HttpOnly Cookie）自动续期，
+// 只带Cookie认证的写请求自动附加CSRF令牌
+
+(function () {
+    const originalFetch = window.fetch.bind(window);
+    let refreshing = null;
+    
+    // 其他标签页同时刷新时服务端返回 409，等对方的新Cookie生效后重试
+    async function postRefresh(attempts = 3) {
+        const response = await originalFetch('/api/refresh', { method: 'POST', credentials: 'same-origin' });
+        if (response.status === 409 && attempts > 1) {
+            await new Promise(resolve => setTimeout(resolve, 300));
+            return postRefresh(attempts - 1);
+        }
+        return response;
+    }
+    
+    function refreshAccessToken() {
+        if (!refreshing) {
+            refreshing = postRefresh()
+                .then(response => response.ok ? response.json() : null)
+                .then(data => {
+                    if (!data || !data.success) return null;
+                    localStorage.setItem('token', data.token);
+                    return data.token;
+                })
+                .catch(() => null)
+                .finally(() => {
+                    refreshing = null;
+                });
+        }
+        return refreshing;
+    }
+    
+    function csrfToken() {
+        const match = document.cookie.match(/(?:^|;\s*)csrf_token=([^;]*)/);
+        return match ? decodeURIComponent(match[1]) : '';
+    }
+    
+    // 使用最新的访问令牌替换请求中的旧令牌
+    function withCurrentToken(init) {
+        const token = localStorage.getItem('token');
+        const headers = new Headers(init.headers || {});
+        if (token && headers.has('Authorization')) {
+            headers.set('Authorization', `Bearer ${token}`);
+        }
+        
+        const method = (init.method || 'GET').toUpperCase();
+        if (!['GET', 'HEAD', 'OPTIONS'].includes(method) && !headers.has('X-CSRF-Token')) {
+            headers.set('X-CSRF-Token', csrfToken());
+        }
+        return { ...init, headers };
+    }
+    
+    window.fetch = async (input, init = {}) => {
+        const url = typeof input === 'string' ? input : input.url;
+        const isApi = url.startsWith('/api/') && !url.startsWith('/api/refresh') && !url.startsWith('/api/login');
+        
+        const response = await originalFetch(input, isApi ? withCurrentToken(init) : init);
+        if (!isApi || response.status !== 401) {
+            return response;
+        }
+        
+        const token = await refreshAccessToken();
+        if (!token) {
+            return response;
+        }
+        
+        return originalFetch(input, withCurrentToken(init));
+    };
+    
+    window.swiftpostRefreshToken = refreshAccessToken;
+})();
@@ -0,0 +1,35 @@
+// SwiftPost Service Worker：接收 Web Push 通知
+
+self.addEventListener('push', (event) => {
+    let data = {};
+    try {
+        data = event.data ? event.data.json() : {};
+    } catch (error) {
+        data = { title: 'SwiftPost', body: event.data ? event.data.text() : '' };
+    }
+    
+    const title = data.title || 'SwiftPost';
+    const options = {
+        body: data.body || '',
+        tag: data.email_id ? `email-${data.email_id}` : data.type,
+        data: { url: data.url || '/dashboard' }
+    };
+    
+    event.waitUntil(self.registration.showNotification(title, options));
+});
+
+self.addEventListener('notificationclick', (event) => {
+    event.notification.close();
+    const url = event.notification.data && event.notification.data.url ? event.notification.data.url : '/dashboard';
+    
+    event.waitUntil(
+        clients.matchAll({ type: 'window', includeUncontrolled: true }).then((windowClients) => {
+            for (const client of windowClients) {
+                if (client.url.includes(url) && 'focus' in client) {
+                    return client.focus();
+                }
+            }
+            return clients.openWindow(url);
+        })
+    );
+});
@@ -0,0 +1,112 @@
+// SwiftPost 安全密钥 / 通行密钥（WebAuthn）辅助
+
+(function () {
+    function base64UrlToBuffer(value) {
+        const base64 = value.replace(/-/g, '+').replace(/_/g, '/');
+        const padded = base64 + '='.repeat((4 - base64.length % 4) % 4);
+        const raw = atob(padded);
+        const buffer = new Uint8Array(raw.length);
+        for (let i = 0; i < raw.length; i++) {
+            buffer[i] = raw.charCodeAt(i);
+        }
+        return buffer.buffer;
+    }
+    
+    function bufferToBase64Url(buffer) {
+        const bytes = new Uint8Array(buffer);
+        let raw = '';
+        for (let i = 0; i < bytes.length; i++) {
+            raw += String.fromCharCode(bytes[i]);
+        }
+        return btoa(raw).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
+    }
+    
+    async function postJSON(url, body, token) {
+        const headers = { 'Content-Type': 'application/json' };
+        if (token) {
+            headers['Authorization'] = `Bearer ${token}`;
+        }
+        const response = await fetch(url, {
+            method: 'POST',
+            headers: headers,
+            body: JSON.stringify(body || {})
+        });
+        return response.json();
+    }
+    
+    // 使用安全密钥登录：传入 mfaToken 时作为两步验证，否则为无密码登录
+    async function login(mfaToken) {
+        const begin = await postJSON('/api/login/webauthn/begin', mfaToken ? { mfa_token: mfaToken } : {});
+        if (!begin.success) return begin;
+        
+        const options = begin.options.publicKey;
+        options.challenge = base64UrlToBuffer(options.challenge);
+        (options.allowCredentials || []).forEach(cred => {
+            cred.id = base64UrlToBuffer(cred.id);
+        });
+        
+        let credential;
+        try {
+            credential = await navigator.credentials.get({ publicKey: options });
+        } catch (error) {
+            return { success: false, message: '已取消安全密钥验证' };
+        }
+        
+        return postJSON('/api/login/webauthn/finish', {
+            challenge_id: begin.challenge_id,
+            credential: {
+                id: credential.id,
+                rawId: bufferToBase64Url(credential.rawId),
+                type: credential.type,
+                response: {
+                    clientDataJSON: bufferToBase64Url(credential.response.clientDataJSON),
+                    authenticatorData: bufferToBase64Url(credential.response.authenticatorData),
+                    signature: bufferToBase64Url(credential.response.signature),
+                    userHandle: credential.response.userHandle ? bufferToBase64Url(credential.response.userHandle) : ''
+                }
+            }
+        });
+    }
+    
+    // 为当前用户注册新的安全密钥
+    async function register(name) {
+        const token = localStorage.getItem('token');
+        const begin = await postJSON('/api/user/webauthn/register/begin', {}, token);
+        if (!begin.success) return begin;
+        
+        const options = begin.options.publicKey;
+        options.challenge = base64UrlToBuffer(options.challenge);
+        options.user.id = base64UrlToBuffer(options.user.id);
+        (options.excludeCredentials || []).forEach(cred => {
+            cred.id = base64UrlToBuffer(cred.id);
+        });
+        
+        let credential;
+        try {
+            credential = await navigator.credentials.create({ publicKey: options });
+        } catch (error) {
+            return { success: false, message: '已取消添加安全密钥' };
+        }
+        
+        return postJSON('/api/user/webauthn/register/finish', {
+            challenge_id: begin.challenge_id,
+            name: name || '',
+            credential: {
+                id: credential.id,
+                rawId: bufferToBase64Url(credential.rawId),
+                type: credential.type,
+                response: {
+                    clientDataJSON: bufferToBase64Url(credential.response.clientDataJSON),
+                    attestationObject: bufferToBase64Url(credential.response.attestationObject),
+                    transports: credential.response.getTransports ? credential.response.getTransports() : []
+                }
+            }
+        }, token);
+    }
+    
+    window.SwiftPostWebAuthn = {
+        supported: () => !!window.PublicKeyCredential,
+        login: login,
+        register: register
+    };
+})();
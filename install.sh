@@ -61,7 +61,6 @@ install_dependencies() {
             apt-get update
             apt-get install -y \
                 curl wget git build-essential \
-                python3 python3-pip python3-venv \
                 sqlite3 libsqlite3-dev \
                 nginx certbot \
                 redis-server \
@@ -72,7 +71,6 @@ install_dependencies() {
             yum update -y
             yum install -y \
                 curl wget git gcc make \
-                python3 python3-pip python3-virtualenv \
                 sqlite sqlite-devel \
                 nginx certbot \
                 redis postgresql postgresql-server
@@ -82,7 +80,6 @@ install_dependencies() {
             apk update
             apk add \
                 curl wget git build-base \
-                python3 py3-pip python3-dev \
                 sqlite sqlite-dev \
                 nginx certbot \
                 redis postgresql postgresql-client
@@ -92,7 +89,6 @@ install_dependencies() {
             print_color $YELLOW "⚠️  不支持的操作系统: $OS"
             print_color $YELLOW "请手动安装以下依赖:"
             print_color $YELLOW "  - Go 1.21+"
-            print_color $YELLOW "  - Python 3.8+"
             print_color $YELLOW "  - SQLite3"
             print_color $YELLOW "  - Git"
             ;;
@@ -180,10 +176,6 @@ install_swiftpost() {
     go build -o /opt/swiftpost/swiftpost
     cd ../..
     
-    # 安装Python依赖
-    print_color $BLUE "🐍 安装 Python 依赖..."
-    pip3 install -r backend/python/requirements.txt
-    
     # 创建配置文件
     if [ ! -f "/opt/swiftpost/config.json" ]; then
         print_color $BLUE "📝 创建配置文件..."
@@ -201,7 +193,7 @@ install_swiftpost() {
     
     # 创建数据库
     print_color $BLUE "🗄️  初始化数据库..."
-    sudo -u swiftpost python3 start.py --init-only
+    (cd /opt/swiftpost && sudo -u swiftpost ./swiftpost migrate up)
     
     print_color $GREEN "✅ SwiftPost 安装完成"
 }
@@ -11,7 +11,6 @@ echo "=================================================="
 # 检查依赖
 echo "🔍 检查系统依赖..."
 command -v go >/dev/null 2>&1 || { echo "❌ Go 未安装"; exit 1; }
-command -v python3 >/dev/null 2>&1 || { echo "❌ Python3 未安装"; exit 1; }
 
 echo "✅ 依赖检查通过"
 
@@ -36,9 +35,7 @@ if [ ! -f "config.json" ]; then
     }
   },
   "database": {
-    "path": "data/swiftpost.db",
-    "python_enabled": true,
-    "python_script": "start.py"
+    "path": "data/swiftpost.db"
   },
   "email": {
     "storage_path": "data/emails",
@@ -71,22 +68,9 @@ cd backend/go
 go mod download
 cd ../..
 
-# 启动Python数据库服务
-echo "🐍 启动Python数据库服务..."
-python3 start.py --child &
-PYTHON_PID=$!
-
-# 等待Python服务启动
-sleep 2
-
 # 启动Go服务
 echo "🚀 启动Go主服务..."
 cd backend/go
-go run main.go
-
-# 清理
-echo "🔄 停止服务..."
-kill $PYTHON_PID 2>/dev/null || true
-wait $PYTHON_PID 2>/dev/null || true
+go run .
 
 echo "👋 SwiftPost 服务已停止"
\ No newline at end of file